@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+type deployRecord struct {
+	ID         string     `json:"id"`
+	Services   []string   `json:"services"`
+	Trigger    string     `json:"trigger"`
+	Source     string     `json:"source"`
+	Image      string     `json:"image"`
+	BuildRef   string     `json:"build_ref"`
+	Status     string     `json:"status"`
+	StartedAt  string     `json:"started_at"`
+	FinishedAt *string    `json:"finished_at"`
+	DurationMs int64      `json:"duration_ms"`
+	Error      string     `json:"error"`
+	Builds     []buildRun `json:"builds"`
+	Hooks      []hookRun  `json:"hooks"`
+	ExpiresAt  *string    `json:"expires_at"`
+	DecidedBy  string     `json:"decided_by"`
+	Reason     string     `json:"reason"`
+
+	FreezeOverride string `json:"freeze_override"`
+}
+
+type buildRun struct {
+	Service         string `json:"service"`
+	Ref             string `json:"ref"`
+	Commit          string `json:"commit"`
+	Image           string `json:"image"`
+	Cached          bool   `json:"cached"`
+	DurationMs      int64  `json:"duration_ms"`
+	Error           string `json:"error"`
+	Output          string `json:"output"`
+	OutputTruncated bool   `json:"output_truncated"`
+}
+
+type hookRun struct {
+	Service         string   `json:"service"`
+	Phase           string   `json:"phase"`
+	Command         []string `json:"command"`
+	ExitCode        int      `json:"exit_code"`
+	DurationMs      int64    `json:"duration_ms"`
+	Error           string   `json:"error"`
+	Output          string   `json:"output"`
+	OutputTruncated bool     `json:"output_truncated"`
+}
+
+func cmdDeployHistory(args []string) error {
+	query := url.Values{}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--service":
+			i++
+			if i >= len(args) {
+				return fmt.Errorf("--service requires a value")
+			}
+			query.Set("service", args[i])
+		case "--pending":
+			query.Set("status", "pending")
+		default:
+			return fmt.Errorf("usage: tinyserve deploy history [--service NAME] [--pending]")
+		}
+	}
+	path := "/deploys"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	var recs []deployRecord
+	if err := getJobJSON(path, &recs); err != nil {
+		return err
+	}
+	if len(recs) == 0 {
+		fmt.Println("No deploys recorded")
+		return nil
+	}
+	fmt.Printf("%-26s %-8s %-10s %-10s %-20s %s\n", "DEPLOY", "TRIGGER", "STATUS", "DURATION", "SERVICES", "STARTED")
+	fmt.Println(strings.Repeat("-", 100))
+	for _, rec := range recs {
+		duration := "-"
+		if rec.FinishedAt != nil {
+			duration = fmt.Sprintf("%.1fs", float64(rec.DurationMs)/1000)
+		}
+		services := strings.Join(rec.Services, ",")
+		if services == "" {
+			services = "(all)"
+		}
+		fmt.Printf("%-26s %-8s %-10s %-10s %-20s %s\n", rec.ID, rec.Trigger, rec.Status, duration, services, rec.StartedAt)
+	}
+	return nil
+}
+
+func cmdDeployShow(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: tinyserve deploy show ID")
+	}
+	var rec deployRecord
+	if err := getJobJSON("/deploys/"+url.PathEscape(args[0]), &rec); err != nil {
+		return err
+	}
+	services := strings.Join(rec.Services, ", ")
+	if services == "" {
+		services = "all"
+	}
+	fmt.Printf("deploy %s: %s (%s, services: %s, started %s)\n", rec.ID, rec.Status, rec.Trigger, services, rec.StartedAt)
+	if rec.Source != "" {
+		fmt.Printf("requested by: %s\n", rec.Source)
+	}
+	if rec.Image != "" {
+		fmt.Printf("image: %s\n", rec.Image)
+	}
+	if rec.BuildRef != "" {
+		fmt.Printf("build ref: %s\n", rec.BuildRef)
+	}
+	if rec.Status == "pending" && rec.ExpiresAt != nil {
+		fmt.Printf("expires: %s (tinyserve deploy approve|reject %s)\n", *rec.ExpiresAt, rec.ID)
+	}
+	if rec.DecidedBy != "" {
+		fmt.Printf("decided by: %s\n", rec.DecidedBy)
+	}
+	if rec.Reason != "" {
+		fmt.Printf("reason: %s\n", rec.Reason)
+	}
+	if rec.FreezeOverride != "" {
+		fmt.Printf("forced during freeze %s\n", rec.FreezeOverride)
+	}
+	if rec.Error != "" {
+		fmt.Printf("error: %s\n", rec.Error)
+	}
+	for _, b := range rec.Builds {
+		result := b.Image
+		switch {
+		case b.Error != "":
+			result = "failed"
+		case b.Image == "":
+			result = "running"
+		case b.Cached:
+			result += ", cached"
+		}
+		ref := b.Ref
+		if ref == "" {
+			ref = "HEAD"
+		}
+		fmt.Printf("\n== build of %s at %s (%s, %.1fs)\n", b.Service, ref, result, float64(b.DurationMs)/1000)
+		if b.OutputTruncated {
+			fmt.Fprintln(os.Stderr, "(earlier output truncated)")
+		}
+		fmt.Print(b.Output)
+		if b.Output != "" && !strings.HasSuffix(b.Output, "\n") {
+			fmt.Println()
+		}
+		if b.Error != "" {
+			fmt.Printf("error: %s\n", b.Error)
+		}
+	}
+	for _, hook := range rec.Hooks {
+		fmt.Printf("\n== %s hook for %s: %s (exit %d, %.1fs)\n", strings.ReplaceAll(hook.Phase, "_", "-"), hook.Service, strings.Join(hook.Command, " "), hook.ExitCode, float64(hook.DurationMs)/1000)
+		fmt.Print(hook.Output)
+		if hook.Output != "" && !strings.HasSuffix(hook.Output, "\n") {
+			fmt.Println()
+		}
+		if hook.OutputTruncated {
+			fmt.Fprintln(os.Stderr, "(output truncated)")
+		}
+		if hook.Error != "" {
+			fmt.Printf("error: %s\n", hook.Error)
+		}
+	}
+	return nil
+}
+
+// cmdDeployDecide approves or rejects a pending deploy.
+func cmdDeployDecide(action string, args []string) error {
+	var id, reason string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--reason":
+			i++
+			if i >= len(args) {
+				return fmt.Errorf("--reason requires text")
+			}
+			reason = args[i]
+		default:
+			if id != "" || strings.HasPrefix(args[i], "-") {
+				return fmt.Errorf("usage: tinyserve deploy %s ID [--reason TEXT]", action)
+			}
+			id = args[i]
+		}
+	}
+	if id == "" {
+		return fmt.Errorf("usage: tinyserve deploy %s ID [--reason TEXT]", action)
+	}
+
+	body, _ := json.Marshal(map[string]string{"reason": reason})
+	resp, err := http.Post(apiBase()+"/deploys/"+url.PathEscape(id)+"/"+action, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return wrapConnError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s failed: %s (%s)", action, resp.Status, strings.TrimSpace(string(data)))
+	}
+	var rec deployRecord
+	if err := json.NewDecoder(resp.Body).Decode(&rec); err != nil {
+		return err
+	}
+	if action == "approve" {
+		fmt.Printf("Deploy %s approved and started for %s\n", rec.ID, strings.Join(rec.Services, ", "))
+		fmt.Printf("Follow up with: tinyserve deploy show %s\n", rec.ID)
+		return nil
+	}
+	fmt.Printf("Deploy %s rejected\n", rec.ID)
+	return nil
+}
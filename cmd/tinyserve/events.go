@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type serviceEvent struct {
+	ID        int64     `json:"id"`
+	Service   string    `json:"service"`
+	Container string    `json:"container"`
+	Action    string    `json:"action"`
+	ExitCode  *int      `json:"exit_code,omitempty"`
+	Health    string    `json:"health,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+func cmdEvents(args []string) error {
+	q := url.Values{}
+	var follow bool
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--service", "--since", "--limit":
+			flag := args[i]
+			i++
+			if i >= len(args) {
+				return fmt.Errorf("%s requires a value", flag)
+			}
+			q.Set(strings.TrimPrefix(flag, "--"), args[i])
+		case "--follow", "-f":
+			follow = true
+		default:
+			return fmt.Errorf("unknown flag: %s", args[i])
+		}
+	}
+	if !follow {
+		_, err := streamEvents(q, "")
+		return err
+	}
+
+	// Reconnect whenever the stream ends or the daemon can't be reached,
+	// e.g. while it restarts, resuming after the last event seen.
+	q.Set("follow", "1")
+	lastID, err := streamEvents(q, "")
+	for {
+		var status errEventsStatus
+		if errors.As(err, &status) {
+			return err
+		}
+		if err == nil {
+			err = errors.New("stream closed")
+		}
+		fmt.Fprintf(os.Stderr, "events: %v; reconnecting\n", err)
+		time.Sleep(2 * time.Second)
+		lastID, err = streamEvents(q, lastID)
+	}
+}
+
+// errEventsStatus is an error response from /events, which reconnecting
+// won't fix.
+type errEventsStatus struct {
+	status string
+	body   string
+}
+
+func (e errEventsStatus) Error() string {
+	return fmt.Sprintf("events failed: %s (%s)", e.status, e.body)
+}
+
+// streamEvents prints the events of one /events response and returns the ID
+// of the last one, or lastID if there were none.
+func streamEvents(q url.Values, lastID string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, apiBase()+"/events?"+q.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return lastID, wrapConnError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(resp.Body)
+		return lastID, errEventsStatus{status: resp.Status, body: strings.TrimSpace(string(data))}
+	}
+
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		line := sc.Text()
+		if id, ok := strings.CutPrefix(line, "id: "); ok {
+			lastID = id
+			continue
+		}
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		var ev serviceEvent
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return lastID, fmt.Errorf("decode event: %w", err)
+		}
+		fmt.Println(formatEvent(ev))
+	}
+	return lastID, sc.Err()
+}
+
+func formatEvent(ev serviceEvent) string {
+	detail := ev.Action
+	switch {
+	case ev.ExitCode != nil:
+		detail += " (exit " + strconv.Itoa(*ev.ExitCode) + ")"
+	case ev.Health != "":
+		detail += ": " + ev.Health
+	}
+	return fmt.Sprintf("%s  %-16s %-24s %s", ev.Time.Local().Format("2006-01-02 15:04:05"), ev.Service, detail, ev.Container)
+}
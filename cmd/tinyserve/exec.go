@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"tinyserve/internal/websocket"
+)
+
+// exitCodeError makes main exit with the status of a remote command.
+type exitCodeError struct {
+	code int
+}
+
+func (e *exitCodeError) Error() string {
+	return fmt.Sprintf("command exited with status %d", e.code)
+}
+
+// execMessage is a control message of an exec or run session.
+type execMessage struct {
+	Type    string `json:"type"`
+	Rows    int    `json:"rows,omitempty"`
+	Cols    int    `json:"cols,omitempty"`
+	Code    *int   `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// cmdExec runs a command in a service container ("exec") or in a throwaway
+// container from the service's image ("run") through the daemon. The
+// daemon requires an admin token, read from TINYSERVE_TOKEN.
+func cmdExec(action string, args []string) error {
+	usage := fmt.Sprintf("usage: tinyserve %s SERVICE [-i] [-t] -- CMD [ARG...]", action)
+	if action == "run" {
+		usage = "usage: tinyserve run SERVICE [-i] -- CMD [ARG...]"
+	}
+	var name string
+	var command []string
+	interactive, tty := false, false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			command = args[i+1:]
+			i = len(args)
+		case arg == "-i" || arg == "--interactive":
+			interactive = true
+		case arg == "-t" || arg == "--tty":
+			tty = true
+		case arg == "-it" || arg == "-ti":
+			interactive, tty = true, true
+		case strings.HasPrefix(arg, "-"):
+			return fmt.Errorf("unknown flag: %s", arg)
+		case name == "":
+			name = arg
+		default:
+			command = args[i:]
+			i = len(args)
+		}
+	}
+	if name == "" || len(command) == 0 {
+		return fmt.Errorf("%s", usage)
+	}
+	if tty && action == "run" {
+		return fmt.Errorf("run has no TTY; use tinyserve exec -it for an interactive shell")
+	}
+	if tty && !isTerminal(os.Stdin) {
+		return fmt.Errorf("-t needs stdin to be a terminal")
+	}
+	token := os.Getenv("TINYSERVE_TOKEN")
+	if token == "" {
+		return fmt.Errorf("%s needs an admin token in TINYSERVE_TOKEN (create one with: tinyserve remote token create --admin)", action)
+	}
+
+	q := url.Values{"cmd": command}
+	if interactive {
+		q.Set("stdin", "1")
+	}
+	if tty {
+		q.Set("tty", "1")
+	}
+	ctx := context.Background()
+	conn, err := websocket.Dial(ctx, apiBase()+"/services/"+url.PathEscape(name)+"/"+action+"?"+q.Encode(),
+		http.Header{"Authorization": {"Bearer " + token}})
+	if err != nil {
+		var hs *websocket.HandshakeError
+		if errors.As(err, &hs) && hs.Status != 0 {
+			return fmt.Errorf("%s failed: %s (%s)", action, http.StatusText(hs.Status), hs.Message)
+		}
+		return wrapConnError(err)
+	}
+	defer conn.Close()
+
+	if tty {
+		restore, err := rawTerminal()
+		if err != nil {
+			return err
+		}
+		defer restore()
+		sendTerminalSize(conn)
+		winch := make(chan os.Signal, 1)
+		signal.Notify(winch, syscall.SIGWINCH)
+		defer signal.Stop(winch)
+		go func() {
+			for range winch {
+				sendTerminalSize(conn)
+			}
+		}()
+	}
+	if interactive {
+		go sendStdin(conn)
+	}
+
+	for {
+		typ, data, err := conn.ReadMessage()
+		if err != nil {
+			return fmt.Errorf("%s: connection lost: %w", action, err)
+		}
+		if typ == websocket.BinaryMessage {
+			if len(data) == 0 {
+				continue
+			}
+			switch data[0] {
+			case 1:
+				os.Stdout.Write(data[1:])
+			case 2:
+				os.Stderr.Write(data[1:])
+			}
+			continue
+		}
+		var msg execMessage
+		if json.Unmarshal(data, &msg) != nil {
+			continue
+		}
+		switch msg.Type {
+		case "exit":
+			if msg.Code != nil && *msg.Code != 0 {
+				return &exitCodeError{code: *msg.Code}
+			}
+			return nil
+		case "error":
+			return fmt.Errorf("%s: %s", action, msg.Message)
+		}
+	}
+}
+
+// sendStdin forwards stdin to the session and reports its end.
+func sendStdin(conn *websocket.Conn) {
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if n > 0 {
+			msg := append([]byte{0}, buf[:n]...)
+			if conn.WriteMessage(websocket.BinaryMessage, msg) != nil {
+				return
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				data, _ := json.Marshal(execMessage{Type: "eof"})
+				conn.WriteMessage(websocket.TextMessage, data)
+			}
+			return
+		}
+	}
+}
+
+func sendTerminalSize(conn *websocket.Conn) {
+	rows, cols, err := terminalSize()
+	if err != nil {
+		return
+	}
+	data, _ := json.Marshal(execMessage{Type: "resize", Rows: rows, Cols: cols})
+	conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// rawTerminal puts the terminal on stdin in raw mode, so keys such as
+// ctrl-c reach the remote command, and returns a function restoring it.
+func rawTerminal() (func(), error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, fmt.Errorf("read terminal settings: %w", err)
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, fmt.Errorf("set raw terminal: %w", err)
+	}
+	return func() { stty(strings.TrimSpace(saved)) }, nil
+}
+
+func terminalSize() (rows, cols int, err error) {
+	out, err := stty("size")
+	if err != nil {
+		return 0, 0, err
+	}
+	fields := strings.Fields(out)
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("unexpected stty size output %q", out)
+	}
+	if rows, err = strconv.Atoi(fields[0]); err != nil {
+		return 0, 0, err
+	}
+	cols, err = strconv.Atoi(fields[1])
+	return rows, cols, err
+}
+
+// stty runs stty on the terminal of stdin.
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+func cmdAudit(args []string) error {
+	q := url.Values{}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--service", "--limit", "--since":
+			flag := args[i]
+			i++
+			if i >= len(args) {
+				return fmt.Errorf("%s requires a value", flag)
+			}
+			q.Set(strings.TrimPrefix(flag, "--"), args[i])
+		default:
+			return fmt.Errorf("usage: tinyserve audit [--service NAME] [--since 2h|TIME] [--limit N]")
+		}
+	}
+	path := "/audit"
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	var entries []struct {
+		Time     string   `json:"time"`
+		Actor    string   `json:"actor"`
+		Action   string   `json:"action"`
+		Service  string   `json:"service"`
+		Command  []string `json:"command"`
+		ExitCode *int     `json:"exit_code"`
+		Error    string   `json:"error"`
+	}
+	if err := getJobJSON(path, &entries); err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Println("No audit entries")
+		return nil
+	}
+	fmt.Printf("%-20s %-14s %-5s %-16s %-8s %s\n", "TIME", "ACTOR", "WHAT", "SERVICE", "RESULT", "COMMAND")
+	fmt.Println(strings.Repeat("-", 100))
+	for _, e := range entries {
+		result := "running"
+		switch {
+		case e.Error != "":
+			result = "error"
+		case e.ExitCode != nil:
+			result = "exit " + strconv.Itoa(*e.ExitCode)
+		}
+		fmt.Printf("%-20s %-14s %-5s %-16s %-8s %s\n", formatTime(e.Time), e.Actor, e.Action, e.Service, result, strings.Join(e.Command, " "))
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type freezeWindow struct {
+	Name            string     `json:"name"`
+	Cron            string     `json:"cron,omitempty"`
+	DurationMinutes int        `json:"duration_minutes,omitempty"`
+	Start           *time.Time `json:"start,omitempty"`
+	End             *time.Time `json:"end,omitempty"`
+	Reason          string     `json:"reason,omitempty"`
+}
+
+type freezePeriod struct {
+	Name   string    `json:"name"`
+	Reason string    `json:"reason"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+}
+
+type freezeSettings struct {
+	Windows []freezeWindow `json:"windows"`
+	Active  *freezePeriod  `json:"active"`
+	Next    *freezePeriod  `json:"next"`
+}
+
+const freezeTimeFormat = "Mon Jan 2 15:04 MST"
+
+func cmdFreeze(args []string) error {
+	if len(args) == 0 || args[0] == "list" {
+		return cmdFreezeList()
+	}
+	switch args[0] {
+	case "add":
+		return cmdFreezeAdd(args[1:])
+	case "remove":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: tinyserve freeze remove NAME")
+		}
+		return cmdFreezeRemove(args[1])
+	default:
+		return fmt.Errorf("unknown freeze subcommand: %s", args[0])
+	}
+}
+
+func cmdFreezeList() error {
+	var settings freezeSettings
+	if err := getJobJSON("/settings/freeze", &settings); err != nil {
+		return err
+	}
+	if len(settings.Windows) == 0 {
+		fmt.Println("No freeze windows configured")
+		return nil
+	}
+	fmt.Printf("%-16s %-36s %s\n", "NAME", "WHEN", "REASON")
+	fmt.Println(strings.Repeat("-", 72))
+	for _, w := range settings.Windows {
+		fmt.Printf("%-16s %-36s %s\n", w.Name, describeFreezeWindow(w), w.Reason)
+	}
+	fmt.Println()
+	if p := settings.Active; p != nil {
+		fmt.Printf("Deploys are frozen until %s (%s)\n", p.End.Local().Format(freezeTimeFormat), p.Name)
+	} else {
+		fmt.Println("Deploys are not frozen")
+	}
+	if p := settings.Next; p != nil {
+		fmt.Printf("Next freeze: %s from %s until %s\n", p.Name, p.Start.Local().Format(freezeTimeFormat), p.End.Local().Format(freezeTimeFormat))
+	}
+	return nil
+}
+
+func describeFreezeWindow(w freezeWindow) string {
+	if w.Cron != "" {
+		return fmt.Sprintf("%s for %s", w.Cron, time.Duration(w.DurationMinutes)*time.Minute)
+	}
+	if w.Start == nil || w.End == nil {
+		return "-"
+	}
+	return w.Start.Local().Format("2006-01-02 15:04") + " - " + w.End.Local().Format("2006-01-02 15:04")
+}
+
+func cmdFreezeAdd(args []string) error {
+	const usage = `usage: tinyserve freeze add NAME (--cron "CRON" --duration DUR | --from DATE --until DATE) [--reason TEXT]`
+	var w freezeWindow
+	var duration, from, until string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--cron", "--duration", "--from", "--until", "--reason":
+			flag := args[i]
+			i++
+			if i >= len(args) {
+				return fmt.Errorf("%s requires a value", flag)
+			}
+			switch flag {
+			case "--cron":
+				w.Cron = args[i]
+			case "--duration":
+				duration = args[i]
+			case "--from":
+				from = args[i]
+			case "--until":
+				until = args[i]
+			case "--reason":
+				w.Reason = args[i]
+			}
+		default:
+			if w.Name != "" || strings.HasPrefix(args[i], "-") {
+				return fmt.Errorf("%s", usage)
+			}
+			w.Name = args[i]
+		}
+	}
+	if w.Name == "" {
+		return fmt.Errorf("%s", usage)
+	}
+	switch {
+	case w.Cron != "":
+		if duration == "" || from != "" || until != "" {
+			return fmt.Errorf("--cron needs --duration and can't be combined with --from/--until")
+		}
+		d, err := parseFreezeDuration(duration)
+		if err != nil {
+			return err
+		}
+		w.DurationMinutes = int(d / time.Minute)
+	case from != "" && until != "":
+		if duration != "" {
+			return fmt.Errorf("--duration only applies to --cron windows")
+		}
+		start, _, err := parseFreezeDate(from)
+		if err != nil {
+			return fmt.Errorf("--from: %w", err)
+		}
+		end, dateOnly, err := parseFreezeDate(until)
+		if err != nil {
+			return fmt.Errorf("--until: %w", err)
+		}
+		// A bare date includes the whole day.
+		if dateOnly {
+			end = end.AddDate(0, 0, 1)
+		}
+		w.Start, w.End = &start, &end
+	default:
+		return fmt.Errorf("%s", usage)
+	}
+
+	var settings freezeSettings
+	if err := getJobJSON("/settings/freeze", &settings); err != nil {
+		return err
+	}
+	for _, existing := range settings.Windows {
+		if strings.EqualFold(existing.Name, w.Name) {
+			return fmt.Errorf("freeze window %q already exists; remove it first", w.Name)
+		}
+	}
+	updated, err := putFreezeWindows(append(settings.Windows, w))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Added freeze window %s (%s)\n", w.Name, describeFreezeWindow(w))
+	if p := updated.Active; p != nil {
+		fmt.Printf("Deploys are frozen until %s (%s)\n", p.End.Local().Format(freezeTimeFormat), p.Name)
+	} else if p := updated.Next; p != nil {
+		fmt.Printf("Next freeze: %s from %s\n", p.Name, p.Start.Local().Format(freezeTimeFormat))
+	}
+	return nil
+}
+
+func cmdFreezeRemove(name string) error {
+	var settings freezeSettings
+	if err := getJobJSON("/settings/freeze", &settings); err != nil {
+		return err
+	}
+	kept := settings.Windows[:0]
+	for _, w := range settings.Windows {
+		if !strings.EqualFold(w.Name, name) {
+			kept = append(kept, w)
+		}
+	}
+	if len(kept) == len(settings.Windows) {
+		return fmt.Errorf("freeze window %q not found", name)
+	}
+	if _, err := putFreezeWindows(kept); err != nil {
+		return err
+	}
+	fmt.Printf("Removed freeze window %s\n", name)
+	return nil
+}
+
+func putFreezeWindows(windows []freezeWindow) (freezeSettings, error) {
+	body, _ := json.Marshal(map[string]any{"windows": windows})
+	req, err := http.NewRequest(http.MethodPut, apiBase()+"/settings/freeze", bytes.NewReader(body))
+	if err != nil {
+		return freezeSettings{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return freezeSettings{}, wrapConnError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(resp.Body)
+		return freezeSettings{}, fmt.Errorf("%s (%s)", resp.Status, strings.TrimSpace(string(data)))
+	}
+	var settings freezeSettings
+	if err := json.NewDecoder(resp.Body).Decode(&settings); err != nil {
+		return freezeSettings{}, err
+	}
+	return settings, nil
+}
+
+// parseFreezeDuration accepts Go durations ("64h", "90m") and whole days ("14d").
+func parseFreezeDuration(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < time.Minute || d%time.Minute != 0 {
+		return 0, fmt.Errorf("invalid duration %q: use whole minutes, e.g. 64h or 90m", s)
+	}
+	return d, nil
+}
+
+// parseFreezeDate reads RFC 3339 or a local "2006-01-02[ 15:04]" and reports
+// whether only a date was given.
+func parseFreezeDate(s string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, false, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local); err == nil {
+		return t, false, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, true, nil
+	}
+	return time.Time{}, false, fmt.Errorf("invalid date %q: use 2006-01-02, \"2006-01-02 15:04\" or RFC 3339", s)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+func cmdJob(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: tinyserve job <list|run-now|history|logs> ...")
+	}
+	switch args[0] {
+	case "list":
+		return cmdJobList()
+	case "run-now":
+		return cmdJobRunNow(args[1:])
+	case "history":
+		return cmdJobHistory(args[1:])
+	case "logs":
+		return cmdJobLogs(args[1:])
+	default:
+		return fmt.Errorf("unknown job subcommand: %s", args[0])
+	}
+}
+
+type jobRun struct {
+	ID              string  `json:"id"`
+	Trigger         string  `json:"trigger"`
+	Status          string  `json:"status"`
+	ExitCode        int     `json:"exit_code"`
+	StartedAt       string  `json:"started_at"`
+	DurationMs      int64   `json:"duration_ms"`
+	Error           string  `json:"error"`
+	OutputTruncated bool    `json:"output_truncated"`
+	FinishedAt      *string `json:"finished_at"`
+}
+
+func cmdJobList() error {
+	var jobs []struct {
+		Name     string  `json:"name"`
+		Enabled  bool    `json:"enabled"`
+		Schedule string  `json:"schedule"`
+		NextRun  string  `json:"next_run"`
+		LastRun  *jobRun `json:"last_run"`
+	}
+	if err := getJobJSON("/jobs", &jobs); err != nil {
+		return err
+	}
+	if len(jobs) == 0 {
+		fmt.Println("No jobs configured")
+		return nil
+	}
+	fmt.Printf("%-20s %-20s %-22s %-12s\n", "NAME", "SCHEDULE", "NEXT RUN", "LAST STATUS")
+	fmt.Println(strings.Repeat("-", 77))
+	for _, j := range jobs {
+		next := j.NextRun
+		if !j.Enabled {
+			next = "disabled"
+		}
+		last := "-"
+		if j.LastRun != nil {
+			last = j.LastRun.Status
+		}
+		fmt.Printf("%-20s %-20s %-22s %-12s\n", j.Name, j.Schedule, next, last)
+	}
+	return nil
+}
+
+func cmdJobRunNow(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: tinyserve job run-now NAME")
+	}
+	name := args[0]
+	resp, err := http.Post(apiBase()+"/jobs/"+url.PathEscape(name)+"/run", "application/json", nil)
+	if err != nil {
+		return wrapConnError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("run job failed: %s (%s)", resp.Status, strings.TrimSpace(string(data)))
+	}
+	var run jobRun
+	if err := json.NewDecoder(resp.Body).Decode(&run); err != nil {
+		return err
+	}
+	fmt.Printf("Job %q started (run %s)\n", name, run.ID)
+	fmt.Printf("Follow up with: tinyserve job logs %s %s\n", name, run.ID)
+	return nil
+}
+
+func cmdJobHistory(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: tinyserve job history NAME")
+	}
+	var runs []jobRun
+	if err := getJobJSON("/jobs/"+url.PathEscape(args[0])+"/runs", &runs); err != nil {
+		return err
+	}
+	if len(runs) == 0 {
+		fmt.Println("No runs recorded")
+		return nil
+	}
+	fmt.Printf("%-26s %-10s %-10s %-5s %-10s %s\n", "RUN", "TRIGGER", "STATUS", "EXIT", "DURATION", "STARTED")
+	fmt.Println(strings.Repeat("-", 90))
+	for _, run := range runs {
+		duration := "-"
+		if run.FinishedAt != nil {
+			duration = fmt.Sprintf("%.1fs", float64(run.DurationMs)/1000)
+		}
+		fmt.Printf("%-26s %-10s %-10s %-5d %-10s %s\n", run.ID, run.Trigger, run.Status, run.ExitCode, duration, run.StartedAt)
+	}
+	return nil
+}
+
+func cmdJobLogs(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("usage: tinyserve job logs NAME [RUN_ID]")
+	}
+	name := args[0]
+	var run jobRun
+	if len(args) == 2 {
+		if err := getJobJSON("/jobs/"+url.PathEscape(name)+"/runs/"+url.PathEscape(args[1]), &run); err != nil {
+			return err
+		}
+	} else {
+		var runs []jobRun
+		if err := getJobJSON("/jobs/"+url.PathEscape(name)+"/runs", &runs); err != nil {
+			return err
+		}
+		if len(runs) == 0 {
+			return fmt.Errorf("job %q has no runs yet", name)
+		}
+		run = runs[0]
+	}
+
+	resp, err := http.Get(apiBase() + "/jobs/" + url.PathEscape(name) + "/runs/" + url.PathEscape(run.ID) + "/logs")
+	if err != nil {
+		return wrapConnError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("job logs failed: %s (%s)", resp.Status, strings.TrimSpace(string(data)))
+	}
+	fmt.Fprintf(os.Stderr, "run %s: %s (exit %d)\n", run.ID, run.Status, run.ExitCode)
+	if _, err := io.Copy(os.Stdout, resp.Body); err != nil {
+		return err
+	}
+	if run.OutputTruncated {
+		fmt.Fprintln(os.Stderr, "(output truncated)")
+	}
+	if run.Error != "" {
+		fmt.Fprintf(os.Stderr, "error: %s\n", run.Error)
+	}
+	return nil
+}
+
+func getJobJSON(path string, out any) error {
+	resp, err := http.Get(apiBase() + path)
+	if err != nil {
+		return wrapConnError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("request failed: %s (%s)", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
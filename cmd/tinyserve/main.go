@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -43,6 +44,14 @@ func main() {
 		err = cmdDeploy(os.Args[2:])
 	case "logs":
 		err = cmdLogs(os.Args[2:])
+	case "events":
+		err = cmdEvents(os.Args[2:])
+	case "top":
+		err = cmdTop(os.Args[2:])
+	case "exec", "run":
+		err = cmdExec(os.Args[1], os.Args[2:])
+	case "audit":
+		err = cmdAudit(os.Args[2:])
 	case "rollback":
 		err = cmdRollback()
 	case "backup":
@@ -53,11 +62,23 @@ func main() {
 		err = cmdLaunchd(os.Args[2:])
 	case "remote":
 		err = cmdRemote(os.Args[2:])
+	case "job":
+		err = cmdJob(os.Args[2:])
+	case "notify":
+		err = cmdNotify(os.Args[2:])
+	case "freeze":
+		err = cmdFreeze(os.Args[2:])
+	case "runtime":
+		err = cmdRuntime(os.Args[2:])
 	default:
 		usage()
 		return
 	}
 
+	var exitErr *exitCodeError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.code)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
@@ -102,8 +123,21 @@ commands:
   init                           interactive setup wizard
        [--cloudflare-api-token T] [--default-domain D] [--tunnel-name N] [--account-id ID] [--skip-cloudflare]
   service add --image [--name N] [--port P] [--hostname h] [--env K=V] [--env-file .env]
+               (or --git PATH|URL [--ref REF] [--dockerfile PATH] to build from source,
+                or --static --name N to serve files uploaded to PUT /services/N/site,
+                or --image with --schedule "CRON" [--max-concurrency N] [--job-timeout SEC] for a job)
                [--mem MB] [--volume host:container] [--healthcheck "CMD ..."] [--command "ARG ..."]
-               [--auto-volumes | --no-auto-volumes]
+               [--auto-volumes | --no-auto-volumes] [--replicas N] [--idle-timeout MIN]
+               [--auto-update [--update-semver RANGE] [--update-interval MIN]]
+               [--on-crash-loop alert|stop|rollback] [--crash-restarts N] [--crash-window MIN]
+               [--smoke-check PATH]... [--smoke-status N] [--smoke-body TEXT] [--smoke-timeout SEC]
+               [--pre-deploy "CMD ..."] [--post-deploy "CMD ..."] [--hook-timeout SEC]
+               [--require-approval [--approval-ttl MIN]]
+               [--link SVC]... [--depends-on SVC]... [--no-egress]
+               [--cpus N] [--cpu-reservation N] [--mem-reservation MB] [--pids-limit N]
+               [--restart POLICY] [--user UID[:GID]] [--read-only] [--tmpfs PATH]...
+               [--cap-drop CAP]... [--cap-add CAP]... [--allow-new-privileges]
+               [--log-max-size MB] [--log-max-files N]
                [--cloudflare] [--deploy] [--timeout SEC]
                example: tinyserve service add --name statik-cms --image ghcr.io/ptmt/statik:latest --port 3000
                         --command "run -- --root-path /github/workspace --cms"
@@ -111,8 +145,55 @@ commands:
   service edit --name NAME [--deploy] [--timeout SEC]
                                open service config in $EDITOR
   service remove --name NAME   remove a service
+  service scale NAME N [--timeout SEC]
+                               run N replicas of a service without a full redeploy
+  service start|stop|restart NAME
+                               act on a service's containers without a redeploy; a stopped
+                               service stays down across deploys and daemon restarts until started
+  service maintenance on|off NAME [--message MSG]
+                               serve a maintenance page on the service's hostnames
+  service error-pages NAME [--404 FILE] [--5xx FILE] [--clear]
+                               serve custom HTML for 404 and 5xx responses
+  service check-update NAME [--dry-run]
+                               check the registry now and deploy a newer image
+  service webhook NAME [--branch GLOB]... [--tag GLOB]... [--image-tag GLOB]... [--rotate-secret] [--disable]
+                               deploy on GitHub, GitLab or Docker Hub webhooks
+  job list                     list scheduled jobs with their next and last run
+  job run-now NAME             start a job run immediately
+  job history NAME             show recent runs of a job
+  job logs NAME [RUN_ID]       show the output of a run (default: latest)
   deploy [--service NAME]... [--timeout SEC]  pull, restart, and wait for health
+  deploy --service NAME --image REF [--timeout SEC]
+                               deploy a specific image; it is saved only if healthy
+  deploy ... --force --reason TEXT
+                               deploy during a freeze window; the reason is recorded
+  deploy history [--service NAME] [--pending]
+                               list recent deploys, newest first
+  deploy show ID               show a deploy with the output of its hooks
+  deploy approve|reject ID [--reason TEXT]
+                               decide a webhook deploy waiting for approval
   logs --service NAME [--tail N] [--follow]
+  logs --service NAME... [--since 2h|TIME] [--until 1h|TIME] [--grep RE] [--level LEVEL] [--tail N] [--json]
+                               search the stored logs of services, interleaved by time; level is
+                               the minimum of debug, info, warn or error
+  events [--service NAME] [--since 2h|TIME] [--limit N] [--follow]
+                               show container crashes, OOM kills, restarts and health changes
+  top [--interval DUR] [--once]
+                               show CPU, memory, network and block IO per service
+  exec SERVICE [-i] [-t] -- CMD [ARG...]
+                               run a command in the service's container (needs an admin token in TINYSERVE_TOKEN)
+  run SERVICE [-i] -- CMD [ARG...]
+                               run a command in a throwaway container with the service's image, env and volumes
+  audit [--service NAME] [--since 2h|TIME] [--limit N]
+                               show who ran which exec and run commands
+  notify [set URL | clear | test]
+                               show or change the webhook that receives update notifications
+  freeze [list]                show freeze windows and the active and next freeze
+  freeze add NAME --cron "CRON" --duration DUR [--reason TEXT]
+  freeze add NAME --from DATE --until DATE [--reason TEXT]
+                               refuse webhook and automatic deploys during a window
+  freeze remove NAME           delete a freeze window
+  runtime [docker|podman]      show or change the container runtime (takes effect on daemon restart)
   rollback                     restore last backup
   backup config [--bucket B] [--prefix P] [--endpoint URL] [--region R] [--profile P]
                                configure S3-compatible backup upload via aws CLI
@@ -132,8 +213,9 @@ remote:
   remote enable [--hostname H | --ui-hostname H] [--api-hostname H] [--cloudflare] [--deploy] [--timeout SEC]
                                enable remote access (--cloudflare to setup DNS/tunnel)
   remote disable               disable remote access
-  remote token create [--name] [--service S]...
-                               create a deploy token (--service restricts to specific services)
+  remote token create [--name] [--service S]... [--admin]
+                               create a deploy token (--service restricts to specific services,
+                               --admin also allows exec and run)
   remote token list            list all tokens
   remote token revoke <id>     revoke a token
   remote auth cloudflare-access --team-domain <domain> --policy-aud <aud>
@@ -310,7 +392,7 @@ func cmdInit(args []string) error {
 
 func cmdService(args []string) error {
 	if len(args) == 0 {
-		return fmt.Errorf("usage: tinyserve service <add|list|remove|edit> ...")
+		return fmt.Errorf("usage: tinyserve service <add|list|remove|edit|scale|start|stop|restart|maintenance|error-pages> ...")
 	}
 	switch args[0] {
 	case "add":
@@ -321,6 +403,18 @@ func cmdService(args []string) error {
 		return cmdServiceRemove(args[1:])
 	case "edit":
 		return cmdServiceEdit(args[1:])
+	case "scale":
+		return cmdServiceScale(args[1:])
+	case "start", "stop", "restart":
+		return cmdServiceLifecycle(args[0], args[1:])
+	case "maintenance":
+		return cmdServiceMaintenance(args[1:])
+	case "error-pages":
+		return cmdServiceErrorPages(args[1:])
+	case "check-update":
+		return cmdServiceCheckUpdate(args[1:])
+	case "webhook":
+		return cmdServiceWebhook(args[1:])
 	default:
 		return fmt.Errorf("unknown service subcommand: %s", args[0])
 	}
@@ -340,9 +434,66 @@ func cmdServiceAdd(args []string) error {
 		"volumes":       opts.Volumes,
 		"auto_volumes":  opts.AutoVolumes,
 		"resources": map[string]any{
-			"memory_limit_mb": opts.Memory,
+			"memory_limit_mb":       opts.Memory,
+			"memory_reservation_mb": opts.MemoryReservation,
+			"cpu_limit":             opts.CPUs,
+			"cpu_reservation":       opts.CPUReservation,
+			"pids_limit":            opts.PidsLimit,
+		},
+		"replicas":             opts.Replicas,
+		"idle_timeout_minutes": opts.IdleTimeout,
+		"restart_policy":       opts.Restart,
+		"security": map[string]any{
+			"user":              opts.User,
+			"read_only_root_fs": opts.ReadOnly,
+			"tmpfs":             opts.Tmpfs,
+			"cap_drop":          opts.CapDrop,
+			"cap_add":           opts.CapAdd,
+			"no_new_privileges": !opts.AllowNewPrivileges,
 		},
+		"logging": map[string]any{
+			"max_size_mb": opts.LogMaxSize,
+			"max_files":   opts.LogMaxFiles,
+		},
+		"links":      opts.Links,
+		"depends_on": opts.DependsOn,
+		"no_egress":  opts.NoEgress,
 		"cloudflare": opts.Cloudflare,
+
+		"require_approval":     opts.RequireApproval,
+		"approval_ttl_minutes": opts.ApprovalTTL,
+	}
+	if opts.AutoUpdate {
+		payload["update_policy"] = map[string]any{
+			"semver":           opts.UpdateSemver,
+			"interval_minutes": opts.UpdateInterval,
+		}
+	}
+	if opts.OnCrashLoop != "" || opts.CrashRestarts != 0 || opts.CrashWindow != 0 {
+		payload["crash_policy"] = map[string]any{
+			"action":         opts.OnCrashLoop,
+			"max_restarts":   opts.CrashRestarts,
+			"window_minutes": opts.CrashWindow,
+		}
+	}
+	if opts.Static {
+		payload["type"] = "static"
+	}
+	if opts.Schedule != "" {
+		payload["type"] = "job"
+		payload["job"] = map[string]any{
+			"schedule":        opts.Schedule,
+			"max_concurrency": opts.MaxConcurrency,
+			"timeout_seconds": opts.JobTimeout,
+		}
+	}
+	if opts.GitSource != "" {
+		payload["type"] = "git-build"
+		payload["build"] = map[string]any{
+			"source":     opts.GitSource,
+			"ref":        opts.GitRef,
+			"dockerfile": opts.Dockerfile,
+		}
 	}
 	if opts.Healthcheck != "" {
 		payload["healthcheck"] = map[string]any{
@@ -352,6 +503,28 @@ func cmdServiceAdd(args []string) error {
 	if opts.Command != "" {
 		payload["command"] = strings.Fields(opts.Command)
 	}
+	if len(opts.SmokeChecks) > 0 {
+		checks := make([]map[string]any, 0, len(opts.SmokeChecks))
+		for _, path := range opts.SmokeChecks {
+			checks = append(checks, map[string]any{
+				"path":            path,
+				"expect_status":   opts.SmokeStatus,
+				"body_contains":   opts.SmokeBody,
+				"timeout_seconds": opts.SmokeTimeout,
+			})
+		}
+		payload["smoke_checks"] = checks
+	}
+	if opts.PreDeploy != "" || opts.PostDeploy != "" {
+		hooks := map[string]any{}
+		if opts.PreDeploy != "" {
+			hooks["pre_deploy"] = map[string]any{"command": strings.Fields(opts.PreDeploy), "timeout_seconds": opts.HookTimeout}
+		}
+		if opts.PostDeploy != "" {
+			hooks["post_deploy"] = map[string]any{"command": strings.Fields(opts.PostDeploy), "timeout_seconds": opts.HookTimeout}
+		}
+		payload["hooks"] = hooks
+	}
 	body, _ := json.Marshal(payload)
 	req, err := http.NewRequest(http.MethodPost, apiBase()+"/services", bytes.NewReader(body))
 	if err != nil {
@@ -387,7 +560,7 @@ func cmdServiceAdd(args []string) error {
 		}
 		// Deploy infrastructure (traefik, cloudflared) and the new service
 		services := []string{"traefik", "cloudflared", serviceName}
-		if _, err := doDeploy(services, timeoutSec); err != nil {
+		if _, err := doDeploy(services, "", "", timeoutSec); err != nil {
 			return fmt.Errorf("service added but deploy failed: %w", err)
 		}
 		fmt.Printf("✓ Service %s deployed\n", serviceName)
@@ -417,25 +590,50 @@ func cmdServiceList() error {
 	}
 
 	// Print as table
-	fmt.Printf("%-20s %-40s %-8s %-12s\n", "NAME", "IMAGE", "PORT", "STATUS")
-	fmt.Println(strings.Repeat("-", 84))
+	fmt.Printf("%-20s %-40s %-22s %-8s %-12s\n", "NAME", "IMAGE", "DEPLOYED", "PORT", "STATUS")
+	fmt.Println(strings.Repeat("-", 107))
 	for _, svc := range services {
 		name, _ := svc["name"].(string)
 		image, _ := svc["image"].(string)
+		deployed, _ := svc["deployed_image"].(string)
 		port, _ := svc["internal_port"].(float64)
 		status, _ := svc["status"].(string)
-		if status == "" {
+		if stopped, _ := svc["stopped"].(bool); stopped {
+			status = "stopped"
+		} else if status == "" {
 			status = "unknown"
 		}
+		deployed = deployedLabel(image, deployed)
 		// Truncate long image names
 		if len(image) > 40 {
 			image = image[:37] + "..."
 		}
-		fmt.Printf("%-20s %-40s %-8.0f %-12s\n", name, image, port, status)
+		fmt.Printf("%-20s %-40s %-22s %-8.0f %-12s\n", name, image, deployed, port, status)
 	}
 	return nil
 }
 
+// deployedLabel summarizes the live image next to the configured one: its
+// digest when they match, or the live reference when a change is not deployed.
+func deployedLabel(image, deployed string) string {
+	switch {
+	case deployed == "":
+		return "-"
+	case deployed == image:
+		return "yes"
+	case strings.HasPrefix(deployed, image+"@"):
+		digest := strings.TrimPrefix(deployed, image+"@")
+		if len(digest) > len("sha256:")+12 {
+			digest = digest[:len("sha256:")+12]
+		}
+		return digest
+	}
+	if len(deployed) > 22 {
+		deployed = "..." + deployed[len(deployed)-19:]
+	}
+	return deployed
+}
+
 func cmdServiceRemove(args []string) error {
 	var name string
 	for i := 0; i < len(args); i++ {
@@ -470,6 +668,83 @@ func cmdServiceRemove(args []string) error {
 	return nil
 }
 
+// cmdServiceLifecycle starts, stops or restarts the containers of a service
+// without regenerating config.
+func cmdServiceLifecycle(action string, args []string) error {
+	if len(args) != 1 || strings.HasPrefix(args[0], "-") {
+		return fmt.Errorf("usage: tinyserve service %s NAME", action)
+	}
+	name := args[0]
+	resp, err := http.Post(apiBase()+"/services/"+url.PathEscape(name)+"/"+action, "application/json", nil)
+	if err != nil {
+		return wrapConnError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s failed: %s (%s)", action, resp.Status, strings.TrimSpace(string(data)))
+	}
+	var out struct {
+		Status string `json:"status"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&out)
+	fmt.Printf("Service %q %s\n", name, out.Status)
+	return nil
+}
+
+func cmdServiceScale(args []string) error {
+	var positional []string
+	timeoutSec := 60
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--timeout":
+			i++
+			if i >= len(args) {
+				return fmt.Errorf("--timeout requires a value in seconds")
+			}
+			t, err := strconv.Atoi(args[i])
+			if err != nil {
+				return fmt.Errorf("invalid timeout: %w", err)
+			}
+			timeoutSec = t
+		default:
+			if strings.HasPrefix(args[i], "--") {
+				return fmt.Errorf("unknown flag: %s", args[i])
+			}
+			positional = append(positional, args[i])
+		}
+	}
+	if len(positional) != 2 {
+		return fmt.Errorf("usage: tinyserve service scale NAME N [--timeout SEC]")
+	}
+	name := positional[0]
+	replicas, err := strconv.Atoi(positional[1])
+	if err != nil || replicas < 1 {
+		return fmt.Errorf("invalid replica count: %s", positional[1])
+	}
+
+	body, _ := json.Marshal(map[string]any{
+		"replicas":   replicas,
+		"timeout_ms": timeoutSec * 1000,
+	})
+	req, err := http.NewRequest(http.MethodPost, apiBase()+"/services/"+url.PathEscape(name)+"/scale", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return wrapConnError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("scale failed: %s (%s)", resp.Status, strings.TrimSpace(string(data)))
+	}
+	fmt.Printf("Service %q scaled to %d replicas\n", name, replicas)
+	return nil
+}
+
 func cmdServiceEdit(args []string) error {
 	var name string
 	var deploy bool
@@ -586,7 +861,7 @@ func cmdServiceEdit(args []string) error {
 
 	if deploy {
 		fmt.Println("Deploying...")
-		if _, err := doDeploy([]string{name}, timeoutSec); err != nil {
+		if _, err := doDeploy([]string{name}, "", "", timeoutSec); err != nil {
 			return fmt.Errorf("deploy: %w", err)
 		}
 		fmt.Printf("✓ Service %q deployed\n", name)
@@ -596,19 +871,59 @@ func cmdServiceEdit(args []string) error {
 }
 
 type addOptions struct {
-	Name        string
-	Image       string
-	Port        int
-	Hostnames   []string
-	Env         map[string]string
-	Volumes     []string
-	AutoVolumes bool
-	Healthcheck string
-	Command     string
-	Memory      int
-	Cloudflare  bool
-	Deploy      bool
-	Timeout     int
+	Name               string
+	Image              string
+	GitSource          string
+	GitRef             string
+	Dockerfile         string
+	Static             bool
+	Schedule           string
+	MaxConcurrency     int
+	JobTimeout         int
+	Port               int
+	Hostnames          []string
+	Env                map[string]string
+	Volumes            []string
+	AutoVolumes        bool
+	Healthcheck        string
+	Command            string
+	Memory             int
+	Replicas           int
+	IdleTimeout        int
+	AutoUpdate         bool
+	UpdateSemver       string
+	UpdateInterval     int
+	OnCrashLoop        string
+	CrashRestarts      int
+	CrashWindow        int
+	SmokeChecks        []string
+	SmokeStatus        int
+	SmokeBody          string
+	SmokeTimeout       int
+	PreDeploy          string
+	PostDeploy         string
+	HookTimeout        int
+	RequireApproval    bool
+	ApprovalTTL        int
+	Links              []string
+	DependsOn          []string
+	NoEgress           bool
+	MemoryReservation  int
+	CPUs               float64
+	CPUReservation     float64
+	PidsLimit          int
+	Restart            string
+	User               string
+	ReadOnly           bool
+	Tmpfs              []string
+	CapDrop            []string
+	CapAdd             []string
+	AllowNewPrivileges bool
+	LogMaxSize         int
+	LogMaxFiles        int
+	Cloudflare         bool
+	Deploy             bool
+	Timeout            int
 }
 
 func parseServiceAdd(args []string) (addOptions, error) {
@@ -701,6 +1016,296 @@ func parseServiceAdd(args []string) (addOptions, error) {
 				return opts, fmt.Errorf("--command requires a command")
 			}
 			opts.Command = args[i]
+		case "--mem-reservation":
+			i++
+			if i >= len(args) {
+				return opts, fmt.Errorf("--mem-reservation requires a value")
+			}
+			mem, err := strconv.Atoi(args[i])
+			if err != nil {
+				return opts, fmt.Errorf("invalid mem reservation: %w", err)
+			}
+			opts.MemoryReservation = mem
+		case "--cpus":
+			i++
+			if i >= len(args) {
+				return opts, fmt.Errorf("--cpus requires a value")
+			}
+			cpus, err := strconv.ParseFloat(args[i], 64)
+			if err != nil {
+				return opts, fmt.Errorf("invalid cpus: %w", err)
+			}
+			opts.CPUs = cpus
+		case "--cpu-reservation":
+			i++
+			if i >= len(args) {
+				return opts, fmt.Errorf("--cpu-reservation requires a value")
+			}
+			cpus, err := strconv.ParseFloat(args[i], 64)
+			if err != nil {
+				return opts, fmt.Errorf("invalid cpu reservation: %w", err)
+			}
+			opts.CPUReservation = cpus
+		case "--git":
+			i++
+			if i >= len(args) {
+				return opts, fmt.Errorf("--git requires a repository path or URL")
+			}
+			opts.GitSource = args[i]
+			// Local checkouts are resolved here; the daemon does not share our working directory.
+			if info, err := os.Stat(opts.GitSource); err == nil && info.IsDir() {
+				if abs, err := filepath.Abs(opts.GitSource); err == nil {
+					opts.GitSource = abs
+				}
+			}
+		case "--static":
+			opts.Static = true
+		case "--schedule":
+			i++
+			if i >= len(args) {
+				return opts, fmt.Errorf("--schedule requires a cron expression")
+			}
+			opts.Schedule = args[i]
+		case "--max-concurrency":
+			i++
+			if i >= len(args) {
+				return opts, fmt.Errorf("--max-concurrency requires a value")
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil {
+				return opts, fmt.Errorf("invalid max concurrency: %w", err)
+			}
+			opts.MaxConcurrency = n
+		case "--job-timeout":
+			i++
+			if i >= len(args) {
+				return opts, fmt.Errorf("--job-timeout requires a value in seconds")
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil {
+				return opts, fmt.Errorf("invalid job timeout: %w", err)
+			}
+			opts.JobTimeout = n
+		case "--ref":
+			i++
+			if i >= len(args) {
+				return opts, fmt.Errorf("--ref requires a value")
+			}
+			opts.GitRef = args[i]
+		case "--dockerfile":
+			i++
+			if i >= len(args) {
+				return opts, fmt.Errorf("--dockerfile requires a path")
+			}
+			opts.Dockerfile = args[i]
+		case "--replicas":
+			i++
+			if i >= len(args) {
+				return opts, fmt.Errorf("--replicas requires a value")
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil {
+				return opts, fmt.Errorf("invalid replicas: %w", err)
+			}
+			opts.Replicas = n
+		case "--idle-timeout":
+			i++
+			if i >= len(args) {
+				return opts, fmt.Errorf("--idle-timeout requires minutes")
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n < 0 {
+				return opts, fmt.Errorf("invalid idle timeout: %s", args[i])
+			}
+			opts.IdleTimeout = n
+		case "--auto-update":
+			opts.AutoUpdate = true
+		case "--update-semver":
+			i++
+			if i >= len(args) {
+				return opts, fmt.Errorf("--update-semver requires a range")
+			}
+			opts.UpdateSemver = args[i]
+		case "--update-interval":
+			i++
+			if i >= len(args) {
+				return opts, fmt.Errorf("--update-interval requires minutes")
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n < 0 {
+				return opts, fmt.Errorf("invalid update interval: %s", args[i])
+			}
+			opts.UpdateInterval = n
+		case "--on-crash-loop":
+			i++
+			if i >= len(args) {
+				return opts, fmt.Errorf("--on-crash-loop requires alert, stop or rollback")
+			}
+			opts.OnCrashLoop = args[i]
+		case "--crash-restarts":
+			i++
+			if i >= len(args) {
+				return opts, fmt.Errorf("--crash-restarts requires a count")
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n < 1 {
+				return opts, fmt.Errorf("invalid crash restarts: %s", args[i])
+			}
+			opts.CrashRestarts = n
+		case "--crash-window":
+			i++
+			if i >= len(args) {
+				return opts, fmt.Errorf("--crash-window requires minutes")
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n < 1 {
+				return opts, fmt.Errorf("invalid crash window: %s", args[i])
+			}
+			opts.CrashWindow = n
+		case "--smoke-check":
+			i++
+			if i >= len(args) {
+				return opts, fmt.Errorf("--smoke-check requires a path")
+			}
+			opts.SmokeChecks = append(opts.SmokeChecks, args[i])
+		case "--smoke-status":
+			i++
+			if i >= len(args) {
+				return opts, fmt.Errorf("--smoke-status requires a status code")
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n < 100 || n > 599 {
+				return opts, fmt.Errorf("invalid smoke status: %s", args[i])
+			}
+			opts.SmokeStatus = n
+		case "--smoke-body":
+			i++
+			if i >= len(args) {
+				return opts, fmt.Errorf("--smoke-body requires text")
+			}
+			opts.SmokeBody = args[i]
+		case "--smoke-timeout":
+			i++
+			if i >= len(args) {
+				return opts, fmt.Errorf("--smoke-timeout requires seconds")
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n <= 0 {
+				return opts, fmt.Errorf("invalid smoke timeout: %s", args[i])
+			}
+			opts.SmokeTimeout = n
+		case "--require-approval":
+			opts.RequireApproval = true
+		case "--approval-ttl":
+			i++
+			if i >= len(args) {
+				return opts, fmt.Errorf("--approval-ttl requires minutes")
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n <= 0 {
+				return opts, fmt.Errorf("invalid approval ttl: %s", args[i])
+			}
+			opts.ApprovalTTL = n
+		case "--pre-deploy":
+			i++
+			if i >= len(args) {
+				return opts, fmt.Errorf("--pre-deploy requires a command")
+			}
+			opts.PreDeploy = args[i]
+		case "--post-deploy":
+			i++
+			if i >= len(args) {
+				return opts, fmt.Errorf("--post-deploy requires a command")
+			}
+			opts.PostDeploy = args[i]
+		case "--hook-timeout":
+			i++
+			if i >= len(args) {
+				return opts, fmt.Errorf("--hook-timeout requires seconds")
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n <= 0 {
+				return opts, fmt.Errorf("invalid hook timeout: %s", args[i])
+			}
+			opts.HookTimeout = n
+		case "--pids-limit":
+			i++
+			if i >= len(args) {
+				return opts, fmt.Errorf("--pids-limit requires a value")
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil {
+				return opts, fmt.Errorf("invalid pids limit: %w", err)
+			}
+			opts.PidsLimit = n
+		case "--restart":
+			i++
+			if i >= len(args) {
+				return opts, fmt.Errorf("--restart requires a policy")
+			}
+			opts.Restart = args[i]
+		case "--user":
+			i++
+			if i >= len(args) {
+				return opts, fmt.Errorf("--user requires a value")
+			}
+			opts.User = args[i]
+		case "--read-only":
+			opts.ReadOnly = true
+		case "--tmpfs":
+			i++
+			if i >= len(args) {
+				return opts, fmt.Errorf("--tmpfs requires a path")
+			}
+			opts.Tmpfs = append(opts.Tmpfs, args[i])
+		case "--cap-drop":
+			i++
+			if i >= len(args) {
+				return opts, fmt.Errorf("--cap-drop requires a capability")
+			}
+			opts.CapDrop = append(opts.CapDrop, args[i])
+		case "--cap-add":
+			i++
+			if i >= len(args) {
+				return opts, fmt.Errorf("--cap-add requires a capability")
+			}
+			opts.CapAdd = append(opts.CapAdd, args[i])
+		case "--allow-new-privileges":
+			opts.AllowNewPrivileges = true
+		case "--log-max-size":
+			i++
+			if i >= len(args) {
+				return opts, fmt.Errorf("--log-max-size requires a value in MB")
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil {
+				return opts, fmt.Errorf("invalid log max size: %w", err)
+			}
+			opts.LogMaxSize = n
+		case "--log-max-files":
+			i++
+			if i >= len(args) {
+				return opts, fmt.Errorf("--log-max-files requires a value")
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil {
+				return opts, fmt.Errorf("invalid log max files: %w", err)
+			}
+			opts.LogMaxFiles = n
+		case "--link":
+			i++
+			if i >= len(args) {
+				return opts, fmt.Errorf("--link requires a service name")
+			}
+			opts.Links = append(opts.Links, args[i])
+		case "--depends-on":
+			i++
+			if i >= len(args) {
+				return opts, fmt.Errorf("--depends-on requires a service name")
+			}
+			opts.DependsOn = append(opts.DependsOn, args[i])
+		case "--no-egress":
+			opts.NoEgress = true
 		case "--cloudflare":
 			opts.Cloudflare = true
 		case "--deploy":
@@ -719,8 +1324,50 @@ func parseServiceAdd(args []string) (addOptions, error) {
 			return opts, fmt.Errorf("unknown flag: %s", args[i])
 		}
 	}
-	if opts.Image == "" {
-		return opts, fmt.Errorf("--image is required")
+	sources := 0
+	for _, set := range []bool{opts.Image != "", opts.GitSource != "", opts.Static} {
+		if set {
+			sources++
+		}
+	}
+	if sources == 0 {
+		return opts, fmt.Errorf("--image, --git or --static is required")
+	}
+	if sources > 1 {
+		return opts, fmt.Errorf("--image, --git and --static are mutually exclusive")
+	}
+	if opts.Static && opts.Name == "" {
+		return opts, fmt.Errorf("--static requires --name")
+	}
+	if opts.GitSource == "" && (opts.GitRef != "" || opts.Dockerfile != "") {
+		return opts, fmt.Errorf("--ref and --dockerfile require --git")
+	}
+	if opts.Schedule != "" && opts.Image == "" {
+		return opts, fmt.Errorf("--schedule requires --image")
+	}
+	if opts.Schedule == "" && (opts.MaxConcurrency != 0 || opts.JobTimeout != 0) {
+		return opts, fmt.Errorf("--max-concurrency and --job-timeout require --schedule")
+	}
+	if opts.Schedule != "" && opts.IdleTimeout > 0 {
+		return opts, fmt.Errorf("--idle-timeout cannot be used with --schedule")
+	}
+	if !opts.AutoUpdate && (opts.UpdateSemver != "" || opts.UpdateInterval != 0) {
+		return opts, fmt.Errorf("--update-semver and --update-interval require --auto-update")
+	}
+	if opts.AutoUpdate && opts.GitSource != "" {
+		return opts, fmt.Errorf("--auto-update cannot be used with --git")
+	}
+	if opts.OnCrashLoop == "rollback" && opts.GitSource != "" {
+		return opts, fmt.Errorf("--on-crash-loop rollback cannot be used with --git")
+	}
+	if len(opts.SmokeChecks) == 0 && (opts.SmokeStatus != 0 || opts.SmokeBody != "" || opts.SmokeTimeout != 0) {
+		return opts, fmt.Errorf("--smoke-status, --smoke-body and --smoke-timeout require --smoke-check")
+	}
+	if opts.ApprovalTTL > 0 && !opts.RequireApproval {
+		return opts, fmt.Errorf("--approval-ttl requires --require-approval")
+	}
+	if opts.HookTimeout > 0 && opts.PreDeploy == "" && opts.PostDeploy == "" {
+		return opts, fmt.Errorf("--hook-timeout requires --pre-deploy or --post-deploy")
 	}
 	if opts.Timeout > 0 && !opts.Deploy {
 		return opts, fmt.Errorf("--timeout requires --deploy")
@@ -764,7 +1411,19 @@ func parseEnvFile(path string) (map[string]string, error) {
 }
 
 func cmdDeploy(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "history":
+			return cmdDeployHistory(args[1:])
+		case "show":
+			return cmdDeployShow(args[1:])
+		case "approve", "reject":
+			return cmdDeployDecide(args[0], args[1:])
+		}
+	}
 	var services []string
+	var image, reason string
+	force := false
 	timeoutSec := 60 // default 60 seconds
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
@@ -774,6 +1433,20 @@ func cmdDeploy(args []string) error {
 				return fmt.Errorf("--service requires a value")
 			}
 			services = append(services, args[i])
+		case "--image":
+			i++
+			if i >= len(args) {
+				return fmt.Errorf("--image requires an image reference")
+			}
+			image = args[i]
+		case "--force":
+			force = true
+		case "--reason":
+			i++
+			if i >= len(args) {
+				return fmt.Errorf("--reason requires text")
+			}
+			reason = args[i]
 		case "--timeout":
 			i++
 			if i >= len(args) {
@@ -788,7 +1461,16 @@ func cmdDeploy(args []string) error {
 			return fmt.Errorf("unknown flag: %s", args[i])
 		}
 	}
-	out, err := doDeploy(services, timeoutSec)
+	if image != "" && len(services) != 1 {
+		return fmt.Errorf("--image requires exactly one --service")
+	}
+	if force && strings.TrimSpace(reason) == "" {
+		return fmt.Errorf("--force requires --reason TEXT")
+	}
+	if !force {
+		reason = ""
+	}
+	out, err := doDeploy(services, image, reason, timeoutSec)
 	if err != nil {
 		return err
 	}
@@ -797,10 +1479,19 @@ func cmdDeploy(args []string) error {
 	return enc.Encode(out)
 }
 
-func doDeploy(services []string, timeoutSec int) (map[string]any, error) {
+// doDeploy calls POST /deploy. A non-empty forceReason overrides an active
+// freeze window.
+func doDeploy(services []string, image, forceReason string, timeoutSec int) (map[string]any, error) {
 	payload := map[string]any{
 		"timeout_ms": timeoutSec * 1000,
 	}
+	if image != "" {
+		payload["image"] = image
+	}
+	if forceReason != "" {
+		payload["force"] = true
+		payload["reason"] = forceReason
+	}
 	if len(services) > 0 {
 		payload["services"] = services
 		if len(services) == 1 {
@@ -830,17 +1521,17 @@ func doDeploy(services []string, timeoutSec int) (map[string]any, error) {
 }
 
 func cmdLogs(args []string) error {
-	var service string
-	var follow bool
+	q := url.Values{}
 	tail := 200
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
-		case "--service":
+		case "--service", "--since", "--until", "--grep", "--level":
+			flag := args[i]
 			i++
 			if i >= len(args) {
-				return fmt.Errorf("--service requires a value")
+				return fmt.Errorf("%s requires a value", flag)
 			}
-			service = args[i]
+			q.Add(strings.TrimPrefix(flag, "--"), args[i])
 		case "--tail":
 			i++
 			if i >= len(args) {
@@ -852,20 +1543,17 @@ func cmdLogs(args []string) error {
 			}
 			tail = n
 		case "--follow", "-f":
-			follow = true
+			q.Set("follow", "1")
+		case "--json":
+			q.Set("format", "json")
 		default:
 			return fmt.Errorf("unknown flag: %s", args[i])
 		}
 	}
-	if service == "" {
+	if len(q["service"]) == 0 {
 		return fmt.Errorf("--service is required")
 	}
-	q := url.Values{}
-	q.Set("service", service)
 	q.Set("tail", strconv.Itoa(tail))
-	if follow {
-		q.Set("follow", "1")
-	}
 	resp, err := http.Get(apiBase() + "/logs?" + q.Encode())
 	if err != nil {
 		return wrapConnError(err)
@@ -908,18 +1596,28 @@ func cmdChecklist() error {
 
 	allPassed := true
 
-	// 1. Check Docker installed
-	fmt.Print("Docker installed.............. ")
-	if _, err := exec.LookPath("docker"); err != nil {
+	// The daemon knows whether this host runs Docker or Podman; assume
+	// Docker when it isn't reachable.
+	cli, standalone := "docker", "docker-compose"
+	var platform runtimeSettings
+	if err := getJobJSON("/settings/runtime", &platform); err == nil && platform.Runtime == "podman" {
+		cli, standalone = "podman", "podman-compose"
+	}
+	label := strings.ToUpper(cli[:1]) + cli[1:]
+	dots := func(s string) string { return s + strings.Repeat(".", 30-len(s)) + " " }
+
+	// 1. Check the runtime CLI is installed
+	fmt.Print(dots(label + " installed"))
+	if _, err := exec.LookPath(cli); err != nil {
 		fmt.Println("✗ NOT FOUND")
 		allPassed = false
 	} else {
 		fmt.Println("✓")
 	}
 
-	// 2. Check Docker daemon running
-	fmt.Print("Docker daemon running......... ")
-	cmd := exec.Command("docker", "info")
+	// 2. Check the engine is running
+	fmt.Print(dots(label + " daemon running"))
+	cmd := exec.Command(cli, "info")
 	if err := cmd.Run(); err != nil {
 		fmt.Println("✗ NOT RUNNING")
 		allPassed = false
@@ -927,20 +1625,20 @@ func cmdChecklist() error {
 		fmt.Println("✓")
 	}
 
-	// 3. Check Docker Compose available
-	fmt.Print("Docker Compose available...... ")
+	// 3. Check compose is available
+	fmt.Print(dots(label + " Compose available"))
 	composeOK := false
-	if _, err := exec.LookPath("docker"); err == nil {
-		if err := exec.Command("docker", "compose", "version").Run(); err == nil {
+	if _, err := exec.LookPath(cli); err == nil {
+		if err := exec.Command(cli, "compose", "version").Run(); err == nil {
 			composeOK = true
 			fmt.Println("✓")
 		}
 	}
 	if !composeOK {
-		if _, err := exec.LookPath("docker-compose"); err == nil {
-			if err := exec.Command("docker-compose", "version").Run(); err == nil {
+		if _, err := exec.LookPath(standalone); err == nil {
+			if err := exec.Command(standalone, "version").Run(); err == nil {
 				composeOK = true
-				fmt.Println("✓ (docker-compose)")
+				fmt.Printf("✓ (%s)\n", standalone)
 			}
 		}
 	}
@@ -1702,7 +2400,7 @@ func cmdRemoteEnable(args []string) error {
 		fmt.Println("  Cloudflare DNS configured")
 		if deploy {
 			fmt.Println("  Starting tunnel (traefik + cloudflared)...")
-			if _, err := doDeploy([]string{"traefik", "cloudflared"}, timeoutSec); err != nil {
+			if _, err := doDeploy([]string{"traefik", "cloudflared"}, "", "", timeoutSec); err != nil {
 				return fmt.Errorf("remote enabled but deploy failed: %w", err)
 			}
 			fmt.Println("  Tunnel started")
@@ -1789,8 +2487,11 @@ func cmdRemoteToken(args []string) error {
 func cmdRemoteTokenCreate(args []string) error {
 	var name string
 	var services []string
+	admin := false
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
+		case "--admin":
+			admin = true
 		case "--name":
 			i++
 			if i >= len(args) {
@@ -1815,6 +2516,9 @@ func cmdRemoteTokenCreate(args []string) error {
 	if len(services) > 0 {
 		payload["services"] = services
 	}
+	if admin {
+		payload["admin"] = true
+	}
 	body, _ := json.Marshal(payload)
 	req, err := http.NewRequest(http.MethodPost, apiBase()+"/tokens", bytes.NewReader(body))
 	if err != nil {
@@ -1852,6 +2556,9 @@ func cmdRemoteTokenCreate(args []string) error {
 	} else {
 		fmt.Println("Services: all (unrestricted)")
 	}
+	if isAdmin, _ := result["admin"].(bool); isAdmin {
+		fmt.Println("Admin: yes (may exec and run commands in service containers)")
+	}
 	fmt.Println("\n⚠️  Store this token securely - it won't be shown again")
 	return nil
 }
@@ -1888,6 +2595,9 @@ func cmdRemoteTokenList() error {
 			lastUsed = "never"
 		}
 		services := "all"
+		if admin, _ := t["admin"].(bool); admin {
+			name += " (admin)"
+		}
 		if svcs, ok := t["services"].([]any); ok && len(svcs) > 0 {
 			var names []string
 			for _, s := range svcs {
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+func cmdServiceMaintenance(args []string) error {
+	var positional []string
+	var message string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--message":
+			i++
+			if i >= len(args) {
+				return fmt.Errorf("--message requires a value")
+			}
+			message = args[i]
+		default:
+			if strings.HasPrefix(args[i], "--") {
+				return fmt.Errorf("unknown flag: %s", args[i])
+			}
+			positional = append(positional, args[i])
+		}
+	}
+	if len(positional) != 2 || (positional[0] != "on" && positional[0] != "off") {
+		return fmt.Errorf("usage: tinyserve service maintenance on|off NAME [--message MSG]")
+	}
+	on := positional[0] == "on"
+	if !on && message != "" {
+		return fmt.Errorf("--message only applies to maintenance on")
+	}
+	name := positional[1]
+
+	body, _ := json.Marshal(map[string]any{
+		"enabled": on,
+		"message": message,
+	})
+	if err := postServiceAction(name, "maintenance", http.MethodPost, body); err != nil {
+		return fmt.Errorf("maintenance failed: %w", err)
+	}
+	if on {
+		fmt.Printf("Service %q is in maintenance mode; its hostnames now show the maintenance page\n", name)
+	} else {
+		fmt.Printf("Service %q is out of maintenance mode\n", name)
+	}
+	return nil
+}
+
+func cmdServiceErrorPages(args []string) error {
+	var positional []string
+	var notFoundPath, serverErrorPath string
+	var clear bool
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--404":
+			i++
+			if i >= len(args) {
+				return fmt.Errorf("--404 requires an HTML file")
+			}
+			notFoundPath = args[i]
+		case "--5xx":
+			i++
+			if i >= len(args) {
+				return fmt.Errorf("--5xx requires an HTML file")
+			}
+			serverErrorPath = args[i]
+		case "--clear":
+			clear = true
+		default:
+			if strings.HasPrefix(args[i], "--") {
+				return fmt.Errorf("unknown flag: %s", args[i])
+			}
+			positional = append(positional, args[i])
+		}
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: tinyserve service error-pages NAME [--404 FILE] [--5xx FILE] [--clear]")
+	}
+	name := positional[0]
+	if clear && (notFoundPath != "" || serverErrorPath != "") {
+		return fmt.Errorf("--clear cannot be combined with --404 or --5xx")
+	}
+
+	if clear {
+		if err := postServiceAction(name, "error-pages", http.MethodDelete, nil); err != nil {
+			return fmt.Errorf("clear error pages failed: %w", err)
+		}
+		fmt.Printf("Custom error pages removed from %q; run 'tinyserve deploy --service %s' to apply\n", name, name)
+		return nil
+	}
+	if notFoundPath == "" && serverErrorPath == "" {
+		return printErrorPages(name)
+	}
+
+	payload := map[string]string{}
+	for key, path := range map[string]string{"not_found": notFoundPath, "server_error": serverErrorPath} {
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", path, err)
+		}
+		payload[key] = string(data)
+	}
+	body, _ := json.Marshal(payload)
+	var result struct {
+		DeployRequired bool `json:"deploy_required"`
+	}
+	resp, err := doServiceAction(name, "error-pages", http.MethodPut, body)
+	if err != nil {
+		return fmt.Errorf("set error pages failed: %w", err)
+	}
+	defer resp.Body.Close()
+	_ = json.NewDecoder(resp.Body).Decode(&result)
+	fmt.Printf("Custom error pages updated for %q\n", name)
+	if result.DeployRequired {
+		fmt.Printf("Run 'tinyserve deploy --service %s' to start serving them\n", name)
+	}
+	return nil
+}
+
+func printErrorPages(name string) error {
+	resp, err := doServiceAction(name, "error-pages", http.MethodGet, nil)
+	if err != nil {
+		return fmt.Errorf("get error pages failed: %w", err)
+	}
+	defer resp.Body.Close()
+	var pages struct {
+		NotFound    string `json:"not_found"`
+		ServerError string `json:"server_error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&pages); err != nil {
+		return err
+	}
+	describe := func(page string) string {
+		if page == "" {
+			return "default"
+		}
+		return fmt.Sprintf("custom (%d bytes)", len(page))
+	}
+	fmt.Printf("404: %s\n5xx: %s\n", describe(pages.NotFound), describe(pages.ServerError))
+	return nil
+}
+
+func postServiceAction(name, action, method string, body []byte) error {
+	resp, err := doServiceAction(name, action, method, body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// doServiceAction calls /services/{name}/{action}; a non-2xx response is
+// returned as an error carrying the server's message.
+func doServiceAction(name, action, method string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, apiBase()+"/services/"+url.PathEscape(name)+"/"+action, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, wrapConnError(err)
+	}
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s (%s)", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return resp, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+type runtimeSettings struct {
+	Runtime string `json:"runtime"`
+	Active  struct {
+		Name    string   `json:"name"`
+		Socket  string   `json:"socket"`
+		Compose []string `json:"compose"`
+	} `json:"active"`
+	RestartRequired bool `json:"restart_required"`
+}
+
+func cmdRuntime(args []string) error {
+	var settings runtimeSettings
+	switch len(args) {
+	case 0:
+		if err := getJobJSON("/settings/runtime", &settings); err != nil {
+			return err
+		}
+	case 1:
+		if args[0] != "docker" && args[0] != "podman" {
+			return fmt.Errorf("usage: tinyserve runtime [docker|podman]")
+		}
+		body, _ := json.Marshal(map[string]string{"runtime": args[0]})
+		req, err := http.NewRequest(http.MethodPut, apiBase()+"/settings/runtime", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return wrapConnError(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			data, _ := io.ReadAll(resp.Body)
+			return fmt.Errorf("%s (%s)", resp.Status, strings.TrimSpace(string(data)))
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&settings); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("usage: tinyserve runtime [docker|podman]")
+	}
+
+	fmt.Printf("Runtime: %s\n", settings.Runtime)
+	fmt.Printf("Active:  %s (socket %s, compose %q)\n", settings.Active.Name, settings.Active.Socket, strings.Join(settings.Active.Compose, " "))
+	if settings.RestartRequired {
+		fmt.Println("Restart tinyserved to switch, then run `tinyserve deploy` to recreate the services.")
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+type metricPoint struct {
+	Time             time.Time `json:"time"`
+	CPUPercent       float64   `json:"cpu_percent"`
+	MemoryBytes      uint64    `json:"memory_bytes"`
+	MemoryLimitBytes uint64    `json:"memory_limit_bytes"`
+	NetworkRxRate    float64   `json:"network_rx_bytes_per_sec"`
+	NetworkTxRate    float64   `json:"network_tx_bytes_per_sec"`
+	BlockReadRate    float64   `json:"block_read_bytes_per_sec"`
+	BlockWriteRate   float64   `json:"block_write_bytes_per_sec"`
+	Containers       int       `json:"containers"`
+}
+
+type serviceTop struct {
+	name  string
+	point *metricPoint
+}
+
+func cmdTop(args []string) error {
+	interval := 5 * time.Second
+	once := false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--interval":
+			i++
+			if i >= len(args) {
+				return fmt.Errorf("--interval requires a value")
+			}
+			d, err := time.ParseDuration(args[i])
+			if err != nil || d <= 0 {
+				return fmt.Errorf("--interval must be a duration like 5s")
+			}
+			interval = d
+		case "--once":
+			once = true
+		default:
+			return fmt.Errorf("usage: tinyserve top [--interval DUR] [--once]")
+		}
+	}
+	for {
+		rows, err := loadTop()
+		if err != nil {
+			return err
+		}
+		if !once {
+			// Clear the screen and move the cursor home between refreshes.
+			fmt.Print("\033[H\033[2J")
+			fmt.Printf("tinyserve top - %s (every %s, ctrl-c to quit)\n\n", time.Now().Format("15:04:05"), interval)
+		}
+		printTop(rows)
+		if once {
+			return nil
+		}
+		time.Sleep(interval)
+	}
+}
+
+// loadTop reads the latest metrics sample of every service, sorted by
+// memory use.
+func loadTop() ([]serviceTop, error) {
+	var services []struct {
+		Name string `json:"name"`
+	}
+	if err := getJobJSON("/services", &services); err != nil {
+		return nil, err
+	}
+	rows := make([]serviceTop, 0, len(services))
+	for _, svc := range services {
+		var resp struct {
+			Points []metricPoint `json:"points"`
+		}
+		if err := getJobJSON("/services/"+url.PathEscape(svc.Name)+"/metrics?range=2m", &resp); err != nil {
+			return nil, err
+		}
+		row := serviceTop{name: svc.Name}
+		if n := len(resp.Points); n > 0 {
+			row.point = &resp.Points[n-1]
+		}
+		rows = append(rows, row)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return memoryOf(rows[i]) > memoryOf(rows[j])
+	})
+	return rows, nil
+}
+
+func memoryOf(row serviceTop) uint64 {
+	if row.point == nil {
+		return 0
+	}
+	return row.point.MemoryBytes
+}
+
+func printTop(rows []serviceTop) {
+	if len(rows) == 0 {
+		fmt.Println("No services configured")
+		return
+	}
+	fmt.Printf("%-20s %-10s %-8s %-20s %-22s %s\n", "SERVICE", "CONTAINERS", "CPU%", "MEM / LIMIT", "NET RX / TX", "BLOCK R / W")
+	fmt.Println(strings.Repeat("-", 104))
+	for _, row := range rows {
+		p := row.point
+		if p == nil {
+			fmt.Printf("%-20s %-10s %-8s %-20s %-22s %s\n", row.name, "0", "-", "-", "-", "-")
+			continue
+		}
+		mem := formatBytes(float64(p.MemoryBytes))
+		if p.MemoryLimitBytes > 0 {
+			mem += " / " + formatBytes(float64(p.MemoryLimitBytes))
+		}
+		fmt.Printf("%-20s %-10d %-8.1f %-20s %-22s %s\n",
+			row.name,
+			p.Containers,
+			p.CPUPercent,
+			mem,
+			formatBytes(p.NetworkRxRate)+"/s / "+formatBytes(p.NetworkTxRate)+"/s",
+			formatBytes(p.BlockReadRate)+"/s / "+formatBytes(p.BlockWriteRate)+"/s",
+		)
+	}
+}
+
+func formatBytes(n float64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%.0fB", n)
+	}
+	div, exp := float64(unit), 0
+	for v := n / unit; v >= unit && exp < 4; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", n/div, "KMGTP"[exp])
+}
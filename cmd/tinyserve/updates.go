@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+func cmdServiceCheckUpdate(args []string) error {
+	var name string
+	var dryRun bool
+	for _, arg := range args {
+		switch {
+		case arg == "--dry-run":
+			dryRun = true
+		case strings.HasPrefix(arg, "--"):
+			return fmt.Errorf("unknown flag: %s", arg)
+		case name == "":
+			name = arg
+		default:
+			return fmt.Errorf("usage: tinyserve service check-update NAME [--dry-run]")
+		}
+	}
+	if name == "" {
+		return fmt.Errorf("usage: tinyserve service check-update NAME [--dry-run]")
+	}
+	body, _ := json.Marshal(map[string]bool{"dry_run": dryRun})
+	resp, err := doServiceAction(name, "update-check", http.MethodPost, body)
+	if err != nil {
+		return fmt.Errorf("update check failed: %w", err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Status string `json:"status"`
+		Image  string `json:"image"`
+		Update struct {
+			To     string `json:"to"`
+			Reason string `json:"reason"`
+		} `json:"update"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	switch result.Status {
+	case "up_to_date":
+		fmt.Printf("%s is up to date (%s)\n", name, result.Image)
+	case "update_available":
+		fmt.Printf("Update available for %s: %s (%s)\n", name, result.Update.To, result.Update.Reason)
+	default:
+		fmt.Printf("Updated %s to %s (%s)\n", name, result.Update.To, result.Update.Reason)
+	}
+	return nil
+}
+
+func cmdNotify(args []string) error {
+	if len(args) == 0 {
+		resp, err := notifyRequest(http.MethodGet, "", nil)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		var settings struct {
+			WebhookURL string `json:"webhook_url"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&settings); err != nil {
+			return err
+		}
+		if settings.WebhookURL == "" {
+			fmt.Println("No notification webhook configured")
+		} else {
+			fmt.Printf("Notifications are sent to %s\n", settings.WebhookURL)
+		}
+		return nil
+	}
+
+	switch args[0] {
+	case "set", "clear":
+		webhook := ""
+		if args[0] == "set" {
+			if len(args) != 2 {
+				return fmt.Errorf("usage: tinyserve notify set URL")
+			}
+			webhook = args[1]
+		} else if len(args) != 1 {
+			return fmt.Errorf("usage: tinyserve notify clear")
+		}
+		body, _ := json.Marshal(map[string]string{"webhook_url": webhook})
+		resp, err := notifyRequest(http.MethodPut, "", body)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if webhook == "" {
+			fmt.Println("Notifications disabled")
+		} else {
+			fmt.Printf("Notifications will be sent to %s\n", webhook)
+		}
+		return nil
+	case "test":
+		resp, err := notifyRequest(http.MethodPost, "/test", nil)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		fmt.Println("Test notification sent")
+		return nil
+	default:
+		return fmt.Errorf("unknown notify subcommand: %s", args[0])
+	}
+}
+
+// notifyRequest calls /settings/notifications{suffix}; a non-2xx response is
+// returned as an error carrying the server's message.
+func notifyRequest(method, suffix string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, apiBase()+"/settings/notifications"+suffix, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, wrapConnError(err)
+	}
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s (%s)", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return resp, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+func cmdServiceWebhook(args []string) error {
+	const usage = "usage: tinyserve service webhook NAME [--branch GLOB]... [--tag GLOB]... [--image-tag GLOB]... [--rotate-secret] [--disable]"
+	var name string
+	var branches, tags, imageTags []string
+	var rotate, disable bool
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--branch", "--tag", "--image-tag":
+			flag := args[i]
+			i++
+			if i >= len(args) {
+				return fmt.Errorf("%s requires a pattern", flag)
+			}
+			switch flag {
+			case "--branch":
+				branches = append(branches, args[i])
+			case "--tag":
+				tags = append(tags, args[i])
+			default:
+				imageTags = append(imageTags, args[i])
+			}
+		case "--rotate-secret":
+			rotate = true
+		case "--disable":
+			disable = true
+		default:
+			if strings.HasPrefix(args[i], "--") {
+				return fmt.Errorf("unknown flag: %s", args[i])
+			}
+			if name != "" {
+				return fmt.Errorf("%s", usage)
+			}
+			name = args[i]
+		}
+	}
+	if name == "" {
+		return fmt.Errorf("%s", usage)
+	}
+	configure := rotate || len(branches)+len(tags)+len(imageTags) > 0
+	if disable && configure {
+		return fmt.Errorf("--disable cannot be combined with other flags")
+	}
+
+	if disable {
+		if err := postServiceAction(name, "webhook", http.MethodDelete, nil); err != nil {
+			return fmt.Errorf("disable webhook failed: %w", err)
+		}
+		fmt.Printf("Webhook deploys disabled for %s\n", name)
+		return nil
+	}
+
+	method, body := http.MethodGet, []byte(nil)
+	if configure {
+		method = http.MethodPut
+		body, _ = json.Marshal(map[string]any{
+			"branches":      branches,
+			"tags":          tags,
+			"image_tags":    imageTags,
+			"rotate_secret": rotate,
+		})
+	}
+	resp, err := doServiceAction(name, "webhook", method, body)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	var cfg struct {
+		Secret    string            `json:"secret"`
+		Branches  []string          `json:"branches"`
+		Tags      []string          `json:"tags"`
+		ImageTags []string          `json:"image_tags"`
+		URLs      map[string]string `json:"urls"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&cfg); err != nil {
+		return err
+	}
+	list := func(patterns []string) string {
+		if len(patterns) == 0 {
+			return "-"
+		}
+		return strings.Join(patterns, ", ")
+	}
+	fmt.Printf("Branches:   %s\nTags:       %s\nImage tags: %s\nSecret:     %s\n\n", list(cfg.Branches), list(cfg.Tags), list(cfg.ImageTags), cfg.Secret)
+	fmt.Printf("GitHub:     %s  (content type application/json, secret above)\n", cfg.URLs["github"])
+	fmt.Printf("GitLab:     %s  (secret token above)\n", cfg.URLs["gitlab"])
+	fmt.Printf("Docker Hub: %s\n", cfg.URLs["dockerhub"])
+	return nil
+}
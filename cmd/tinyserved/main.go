@@ -14,6 +14,7 @@ import (
 
 	"tinyserve/internal/api"
 	"tinyserve/internal/docker"
+	"tinyserve/internal/logstore"
 	"tinyserve/internal/state"
 	"tinyserve/internal/version"
 	"tinyserve/webui"
@@ -59,15 +60,30 @@ func run() error {
 	}
 	logRemoteHosts(initialState)
 
+	platform, err := docker.UsePlatform(initialState.Settings.ContainerRuntime)
+	if err != nil {
+		return err
+	}
+	log.Printf("container runtime: %s (socket %s, compose %q)", platform.Name, platform.Socket, strings.Join(platform.Compose, " "))
+
 	generatedRoot := filepath.Join(dataDir, "generated")
 	backupsDir := filepath.Join(dataDir, "backups")
 	cloudflaredDir := filepath.Join(dataDir, "cloudflared")
 
-	autoRecoverServices(ctx, generatedRoot)
+	autoRecoverServices(ctx, generatedRoot, initialState)
 
 	browserAuth := api.NewBrowserAuthMiddleware(store)
 	handler := api.NewHandler(store, generatedRoot, backupsDir, filepath.Join(dataDir, "state.db"), cloudflaredDir)
 	handler.AccessLogs = api.NewAccessLogs(1000)
+	handler.AccessLogs.Persist(logstore.New(filepath.Join(dataDir, "logs", "access")))
+	handler.Jobs.Start(ctx, handler.ListJobs)
+	handler.StartPreviewReaper(ctx)
+	handler.StartIdleManager(ctx)
+	handler.StartUpdateWatcher(ctx)
+	handler.StartApprovalReaper(ctx)
+	handler.StartEventWatcher(ctx)
+	handler.StartMetricsSampler(ctx)
+	handler.StartLogCollector(ctx)
 	mux := http.NewServeMux()
 	handler.RegisterRoutes(mux, browserAuth)
 	mux.Handle("/", browserAuth.Wrap(webui.Handler()))
@@ -83,6 +99,8 @@ func run() error {
 	uiMux.Handle("/services/", browserAuth.Wrap(http.HandlerFunc(handler.HandleServiceActions)))
 	uiMux.Handle("/me", browserAuth.Wrap(http.HandlerFunc(handler.HandleMe)))
 	uiMux.Handle("/logs", browserAuth.Wrap(http.HandlerFunc(handler.HandleLogsReadOnly)))
+	uiMux.Handle("/deploys", browserAuth.Wrap(http.HandlerFunc(handler.HandleDeployApprovals)))
+	uiMux.Handle("/deploys/", browserAuth.Wrap(http.HandlerFunc(handler.HandleDeployApprovals)))
 	uiMux.Handle("/", browserAuth.Wrap(webui.Handler()))
 	uiServer := &http.Server{
 		Addr:    uiAddr(),
@@ -91,13 +109,25 @@ func run() error {
 
 	webhookMux := http.NewServeMux()
 	webhookMux.HandleFunc("/webhook/deploy/", handler.HandleWebhookDeploy)
+	webhookMux.HandleFunc("/webhook/preview/", handler.HandleWebhookPreview)
+	webhookMux.HandleFunc("/webhook/github/", handler.HandleProviderWebhook)
+	webhookMux.HandleFunc("/webhook/gitlab/", handler.HandleProviderWebhook)
+	webhookMux.HandleFunc("/webhook/dockerhub/", handler.HandleProviderWebhook)
+	webhookMux.HandleFunc("/services/", handler.HandleWebhookServices)
 	webhookServer := &http.Server{
 		Addr:    webhookAddr(),
 		Handler: withAccessLogs("webhook", handler.AccessLogs.Webhook, webhookMux),
 	}
 
+	// Traefik routes maintenance pages, custom error pages and requests for
+	// stopped scale-to-zero services to this server.
+	wakeServer := &http.Server{
+		Addr:    wakeAddr(),
+		Handler: http.HandlerFunc(handler.HandleDaemonPages),
+	}
+
 	// Start servers in goroutines
-	errChan := make(chan error, 3)
+	errChan := make(chan error, 4)
 	go func() {
 		log.Printf("tinyserved listening on %s (state: %s)", server.Addr, filepath.Join(dataDir, "state.db"))
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -116,6 +146,12 @@ func run() error {
 			errChan <- err
 		}
 	}()
+	go func() {
+		log.Printf("tinyserved wake listening on %s", wakeServer.Addr)
+		if err := wakeServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			errChan <- err
+		}
+	}()
 
 	// Wait for shutdown signal or server error
 	select {
@@ -132,6 +168,9 @@ func run() error {
 		if err := webhookServer.Shutdown(shutdownCtx); err != nil {
 			return fmt.Errorf("shutdown webhook: %w", err)
 		}
+		if err := wakeServer.Shutdown(shutdownCtx); err != nil {
+			return fmt.Errorf("shutdown wake: %w", err)
+		}
 		log.Println("shutdown complete")
 		return nil
 	case err := <-errChan:
@@ -139,7 +178,7 @@ func run() error {
 	}
 }
 
-func autoRecoverServices(ctx context.Context, generatedRoot string) {
+func autoRecoverServices(ctx context.Context, generatedRoot string, st state.State) {
 	currentDir := filepath.Join(generatedRoot, "current")
 	composePath := filepath.Join(currentDir, "docker-compose.yml")
 	if _, err := os.Stat(composePath); err != nil {
@@ -148,8 +187,9 @@ func autoRecoverServices(ctx context.Context, generatedRoot string) {
 	}
 	log.Printf("auto-recover: bringing up services from %s", currentDir)
 	runner := docker.NewRunner(currentDir)
-	if out, err := runner.Up(ctx); err != nil {
-		log.Printf("auto-recover: docker compose up failed: %v\n%s", err, out)
+	// Services stopped by hand stay down.
+	if out, err := runner.Up(ctx, api.StoppedScaleArgs(st)...); err != nil {
+		log.Printf("auto-recover: compose up failed: %v\n%s", err, out)
 	} else {
 		log.Printf("auto-recover: services started successfully")
 	}
@@ -208,6 +248,13 @@ func webhookAddr() string {
 	return "0.0.0.0:7072"
 }
 
+func wakeAddr() string {
+	if v := os.Getenv("TINYSERVE_WAKE_ADDR"); v != "" {
+		return v
+	}
+	return "0.0.0.0:7073"
+}
+
 type statusRecorder struct {
 	http.ResponseWriter
 	status int
@@ -228,6 +275,18 @@ func (r *statusRecorder) Write(p []byte) (int, error) {
 	return n, err
 }
 
+// Flush lets streaming handlers such as /events and followed logs reach the
+// client through the access log wrapper.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
 func withAccessLogs(kind string, buf *api.LogBuffer, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
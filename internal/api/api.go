@@ -1,31 +1,43 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/fs"
 	"log"
+	"maps"
+	"mime"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/mem"
 	"tinyserve/internal/auth"
+	"tinyserve/internal/build"
 	"tinyserve/internal/cloudflare"
+	"tinyserve/internal/deploys"
 	"tinyserve/internal/docker"
 	"tinyserve/internal/generate"
+	"tinyserve/internal/idle"
+	"tinyserve/internal/jobs"
+	"tinyserve/internal/logstore"
+	"tinyserve/internal/notify"
+	"tinyserve/internal/registry"
+	"tinyserve/internal/site"
 	"tinyserve/internal/state"
 	"tinyserve/internal/validate"
 	"tinyserve/internal/version"
@@ -38,18 +50,61 @@ type Handler struct {
 	StatePath      string
 	CloudflaredDir string
 	AccessLogs     *AccessLogs
+	Jobs           *jobs.Manager
+	Idle           *idle.Tracker
+	Registry       *registry.Client
+	Notifier       *notify.Sender
+	Deploys        *deploys.History
+	SmokeURL       string // Traefik entrypoint that post-deploy smoke checks go through
 	StartedAt      time.Time
+	Docker         docker.Engine                   // container status, logs and images
+	Runtime        func(dir string) docker.Runtime // deploys the compose project in dir
+	Events         state.EventLog                  // container events per service; nil if the store keeps none
+	Metrics        state.MetricsStore              // resource use per service; nil if the store keeps none
+	Audit          state.AuditLog                  // exec and run sessions; nil if the store keeps none
+	Logs           *logstore.Store                 // container output kept by the log collector
+
+	wakes         *idle.Waker
+	updates       *updateTracker
+	status        statusCache
+	eventStreams  *eventHub
+	crashes       *crashTracker
+	lastStats     map[string]docker.Stats // previous stats by container ID, used only by the metrics sampler
+	imageDigests  func(ctx context.Context, svc state.Service) ([]string, error)
+	runHook       hookFunc
+	approvals     sync.Mutex           // serializes pending deploy decisions
+	startApproved func(deploys.Record) // runs an approved deploy in the background
 }
 
 func NewHandler(store state.Store, generatedRoot, backupsDir, statePath, cloudflaredDir string) *Handler {
-	return &Handler{
+	h := &Handler{
 		Store:          store,
 		GeneratedRoot:  generatedRoot,
 		BackupsDir:     backupsDir,
 		StatePath:      statePath,
 		CloudflaredDir: cloudflaredDir,
 		StartedAt:      time.Now(),
-	}
+		Idle:           idle.NewTracker(),
+		Registry:       registry.NewClient(),
+		Notifier:       notify.NewSender(),
+		Docker:         docker.DefaultEngine,
+		SmokeURL:       "http://" + generate.TraefikLocalAddr(),
+		wakes:          idle.NewWaker(),
+		updates:        newUpdateTracker(),
+		eventStreams:   newEventHub(),
+		crashes:        newCrashTracker(),
+	}
+	h.Events, _ = store.(state.EventLog)
+	h.Metrics, _ = store.(state.MetricsStore)
+	h.Audit, _ = store.(state.AuditLog)
+	h.Runtime = h.composeRuntime
+	h.imageDigests = h.deployedImageDigests
+	h.runHook = h.composeHook
+	h.startApproved = func(rec deploys.Record) { go h.runApprovedDeploy(rec) }
+	h.Deploys = deploys.NewHistory(h.deploysRoot())
+	h.Jobs = jobs.NewManager(jobs.NewHistory(h.jobsRoot()), h.runJob)
+	h.Logs = logstore.New(h.logsRoot())
+	return h
 }
 
 func (h *Handler) RegisterRoutes(mux *http.ServeMux, browserAuth *BrowserAuthMiddleware) {
@@ -58,8 +113,18 @@ func (h *Handler) RegisterRoutes(mux *http.ServeMux, browserAuth *BrowserAuthMid
 	mux.HandleFunc("/services", h.handleServices)
 	mux.HandleFunc("/services/", h.handleServiceByName) // DELETE /services/{name}
 	mux.HandleFunc("/deploy", h.handleDeploy)
+	mux.HandleFunc("/deploys", h.handleDeploys)
+	mux.HandleFunc("/deploys/", h.handleDeploys)
+	mux.HandleFunc("/events", h.handleEvents)
+	mux.HandleFunc("/audit", h.handleAudit)
 	mux.HandleFunc("/rollback", h.handleRollback)
 	mux.HandleFunc("/logs", h.handleLogs)
+	mux.HandleFunc("/jobs", h.handleJobs)
+	mux.HandleFunc("/jobs/", h.handleJobByName)
+	mux.HandleFunc("/settings/notifications", h.handleNotificationSettings)
+	mux.HandleFunc("/settings/notifications/test", h.handleNotificationTest)
+	mux.HandleFunc("/settings/freeze", h.handleFreezeSettings)
+	mux.HandleFunc("/settings/runtime", h.handleRuntimeSettings)
 	mux.HandleFunc("/init", h.handleInit)
 	mux.HandleFunc("/init/token", h.handleInitToken)
 	mux.HandleFunc("/health", h.handleHealth)
@@ -107,8 +172,9 @@ func (h *Handler) handleServicesWithAuth(authMw *AuthMiddleware) http.HandlerFun
 
 type serviceResponse struct {
 	state.Service
-	Cloudflare bool   `json:"cloudflare,omitempty"`
-	DataBytes  *int64 `json:"data_bytes,omitempty"`
+	Cloudflare bool       `json:"cloudflare,omitempty"`
+	DataBytes  *int64     `json:"data_bytes,omitempty"`
+	Crash      *crashInfo `json:"crash,omitempty"`
 }
 
 func (h *Handler) handleStatus(w http.ResponseWriter, r *http.Request) {
@@ -148,6 +214,10 @@ func (h *Handler) handleStatus(w http.ResponseWriter, r *http.Request) {
 		"has_cloudflare_token": st.Settings.CloudflareAPIToken != "",
 		"uptime_seconds":       int(time.Since(h.StartedAt).Seconds()),
 	}
+	if active, next := freezeStatus(st.Settings.FreezeWindows, time.Now()); active != nil || next != nil {
+		resp["freeze"] = active
+		resp["next_freeze"] = next
+	}
 	if statusDetail != "" {
 		resp["status_detail"] = statusDetail
 	}
@@ -198,6 +268,10 @@ func (h *Handler) handleServices(w http.ResponseWriter, r *http.Request) {
 			} else if c.Status == "" {
 				c.Status = "unknown"
 			}
+			crash := h.crashes.info(sanitizeName(svc.Name), crashPolicy(svc), time.Now())
+			if crash != nil && crash.Looping {
+				c.Status = "crash-looping"
+			}
 			var dataBytes *int64
 			if withData {
 				root := filepath.Join(dataRoot, "services", c.Name)
@@ -211,6 +285,7 @@ func (h *Handler) handleServices(w http.ResponseWriter, r *http.Request) {
 				Service:    c,
 				Cloudflare: serviceCloudflareEnabled(st, c),
 				DataBytes:  dataBytes,
+				Crash:      crash,
 			})
 		}
 		writeJSON(w, services)
@@ -283,6 +358,26 @@ func (h *Handler) HandleWebhookDeploy(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// The body is optional; CI can pin the deploy to an exact image by
+	// sending {"image": "ghcr.io/acme/app:sha-1234"} as application/json.
+	// Only such bodies are read, and they must be valid JSON. Bodies of any
+	// other content type, such as form data some CI tools send by default,
+	// are ignored.
+	var req webhookDeployRequest
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<16))
+		if err != nil {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if len(bytes.TrimSpace(body)) > 0 {
+			if err := json.Unmarshal(body, &req); err != nil {
+				http.Error(w, "invalid JSON", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
 	ctx := r.Context()
 	st, err := h.Store.Load(ctx)
 	if err != nil {
@@ -307,41 +402,123 @@ func (h *Handler) HandleWebhookDeploy(w http.ResponseWriter, r *http.Request) {
 	}
 
 	target := sanitizeName(st.Services[serviceIdx].Name)
-	if err := h.applyConfig(ctx, st, []string{target}, timeout); err != nil {
+	if req.Image != "" {
+		if err := overrideImage(&st, target, req.Image); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if st.Services[serviceIdx].RequireApproval {
+		rec, err := h.requestApproval(st.Services[serviceIdx], "webhook", strings.TrimSpace(req.Image), "", timeout)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writePendingDeploy(w, rec)
+		return
+	}
+	// Services that need approval still queue a pending deploy above; it can
+	// be approved once the freeze lifts.
+	if p, frozen := activeFreeze(st); frozen {
+		h.refuseFrozen(w, st.Services[serviceIdx].Name, "webhook", p)
+		return
+	}
+	if err := h.applyConfig(ctx, &st, deploys.TriggerWebhook, []string{target}, timeout); err != nil {
 		http.Error(w, fmt.Sprintf("deploy failed: %v", err), http.StatusInternalServerError)
 		return
 	}
 
 	now := time.Now().UTC()
-	st.Services[serviceIdx].LastDeploy = &now
+	h.markDeployed(ctx, &st.Services[serviceIdx], now)
 	if err := h.Store.Save(ctx, st); err != nil {
 		http.Error(w, fmt.Sprintf("save state: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	writeJSON(w, map[string]any{
+	resp := map[string]any{
 		"status":  "deployed",
 		"service": st.Services[serviceIdx].Name,
+		"image":   st.Services[serviceIdx].DeployedImage,
 		"time":    now.Format(time.RFC3339),
-	})
+	}
+	if b := st.Services[serviceIdx].Build; b != nil && b.Commit != "" {
+		resp["commit"] = b.Commit
+	}
+	writeJSON(w, resp)
+}
+
+type webhookDeployRequest struct {
+	Image string `json:"image,omitempty"`
+}
+
+// overrideImage points the target service at image for a single deploy. The
+// caller persists st only after the deploy is healthy, so a failed deploy
+// leaves the stored image untouched.
+func overrideImage(st *state.State, target, image string) error {
+	image = strings.TrimSpace(image)
+	if err := validate.ImageName(image); err != nil {
+		return err
+	}
+	svc := findService(st, target)
+	if svc == nil {
+		return fmt.Errorf("service %q not found", target)
+	}
+	if svc.Type != "" && svc.Type != state.ServiceTypeRegistryImage && svc.Type != state.ServiceTypeJob {
+		return fmt.Errorf("image override is not supported for %s services", svc.Type)
+	}
+	svc.Image = image
+	return nil
+}
+
+// markDeployed records a successful deploy of svc: when it happened and the
+// image it now runs, pinned to the pulled digest when there is one. The image
+// it replaces is kept as the crash-loop rollback target.
+func (h *Handler) markDeployed(ctx context.Context, svc *state.Service, now time.Time) {
+	previous := svc.DeployedImage
+	svc.LastDeploy = &now
+	svc.DeployedImage = svc.Image
+	if svc.Image != "" && !strings.Contains(svc.Image, "@") {
+		if digests, err := docker.ImageRepoDigests(ctx, h.Docker, svc.Image); err == nil && len(digests) > 0 {
+			svc.DeployedImage = svc.Image + "@" + digests[0]
+		}
+	}
+	if previous != "" && previous != svc.DeployedImage {
+		svc.PreviousImage = previous
+	}
 }
 
 type addServiceRequest struct {
-	ID           string                    `json:"id,omitempty"`
-	Name         string                    `json:"name"`
-	Type         string                    `json:"type,omitempty"`
-	Image        string                    `json:"image"`
-	InternalPort int                       `json:"internal_port"`
-	Hostnames    []string                  `json:"hostnames,omitempty"`
-	Env          map[string]string         `json:"env,omitempty"`
-	Volumes      []string                  `json:"volumes,omitempty"`
-	Command      []string                  `json:"command,omitempty"`
-	Entrypoint   []string                  `json:"entrypoint,omitempty"`
-	Healthcheck  *state.ServiceHealthcheck `json:"healthcheck,omitempty"`
-	Resources    state.ServiceResources    `json:"resources"`
-	Enabled      *bool                     `json:"enabled,omitempty"`
-	Cloudflare   bool                      `json:"cloudflare,omitempty"` // If true, setup DNS for auto-generated hostname
-	AutoVolumes  bool                      `json:"auto_volumes,omitempty"`
+	ID              string                     `json:"id,omitempty"`
+	Name            string                     `json:"name"`
+	Type            string                     `json:"type,omitempty"`
+	Image           string                     `json:"image"`
+	InternalPort    int                        `json:"internal_port"`
+	Hostnames       []string                   `json:"hostnames,omitempty"`
+	Env             map[string]string          `json:"env,omitempty"`
+	Volumes         []string                   `json:"volumes,omitempty"`
+	Command         []string                   `json:"command,omitempty"`
+	Entrypoint      []string                   `json:"entrypoint,omitempty"`
+	Healthcheck     *state.ServiceHealthcheck  `json:"healthcheck,omitempty"`
+	SmokeChecks     []state.ServiceSmokeCheck  `json:"smoke_checks,omitempty"`
+	Hooks           *state.ServiceHooks        `json:"hooks,omitempty"`
+	RequireApproval bool                       `json:"require_approval,omitempty"`
+	ApprovalTTL     int                        `json:"approval_ttl_minutes,omitempty"`
+	Build           *state.ServiceBuild        `json:"build,omitempty"`
+	Job             *state.ServiceJob          `json:"job,omitempty"`
+	Resources       state.ServiceResources     `json:"resources"`
+	Replicas        int                        `json:"replicas,omitempty"`
+	IdleTimeout     int                        `json:"idle_timeout_minutes,omitempty"`
+	UpdatePolicy    *state.ServiceUpdatePolicy `json:"update_policy,omitempty"`
+	CrashPolicy     *state.ServiceCrashPolicy  `json:"crash_policy,omitempty"`
+	RestartPolicy   string                     `json:"restart_policy,omitempty"`
+	Security        state.ServiceSecurity      `json:"security"`
+	Logging         state.ServiceLogging       `json:"logging"`
+	Links           []string                   `json:"links,omitempty"`
+	DependsOn       []string                   `json:"depends_on,omitempty"`
+	NoEgress        bool                       `json:"no_egress,omitempty"`
+	Enabled         *bool                      `json:"enabled,omitempty"`
+	Cloudflare      bool                       `json:"cloudflare,omitempty"` // If true, setup DNS for auto-generated hostname
+	AutoVolumes     bool                       `json:"auto_volumes,omitempty"`
 }
 
 type purgeCacheRequest struct {
@@ -357,18 +534,34 @@ func (h *Handler) handleAddService(w http.ResponseWriter, r *http.Request) {
 	}
 
 	svc := state.Service{
-		ID:           payload.ID,
-		Name:         strings.TrimSpace(payload.Name),
-		Type:         payload.Type,
-		Image:        strings.TrimSpace(payload.Image),
-		InternalPort: payload.InternalPort,
-		Hostnames:    payload.Hostnames,
-		Env:          payload.Env,
-		Volumes:      payload.Volumes,
-		Command:      payload.Command,
-		Entrypoint:   payload.Entrypoint,
-		Healthcheck:  payload.Healthcheck,
-		Resources:    payload.Resources,
+		ID:              payload.ID,
+		Name:            strings.TrimSpace(payload.Name),
+		Type:            payload.Type,
+		Image:           strings.TrimSpace(payload.Image),
+		InternalPort:    payload.InternalPort,
+		Hostnames:       payload.Hostnames,
+		Env:             payload.Env,
+		Volumes:         payload.Volumes,
+		Command:         payload.Command,
+		Entrypoint:      payload.Entrypoint,
+		Healthcheck:     payload.Healthcheck,
+		SmokeChecks:     payload.SmokeChecks,
+		Hooks:           payload.Hooks,
+		RequireApproval: payload.RequireApproval,
+		ApprovalTTL:     payload.ApprovalTTL,
+		Build:           payload.Build,
+		Job:             payload.Job,
+		Resources:       payload.Resources,
+		Replicas:        payload.Replicas,
+		IdleTimeout:     payload.IdleTimeout,
+		UpdatePolicy:    payload.UpdatePolicy,
+		CrashPolicy:     payload.CrashPolicy,
+		RestartPolicy:   payload.RestartPolicy,
+		Security:        payload.Security,
+		Logging:         payload.Logging,
+		Links:           payload.Links,
+		DependsOn:       payload.DependsOn,
+		NoEgress:        payload.NoEgress,
 	}
 	if payload.Enabled != nil {
 		svc.Enabled = *payload.Enabled
@@ -376,6 +569,40 @@ func (h *Handler) handleAddService(w http.ResponseWriter, r *http.Request) {
 		svc.Enabled = true
 	}
 
+	gitBuild := svc.Type == state.ServiceTypeGitBuild
+	if gitBuild {
+		if err := validateBuildSpec(svc); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if svc.Name == "" {
+			svc.Name = nameFromImage(strings.TrimSuffix(strings.TrimRight(svc.Build.Source, "/"), ".git"))
+		}
+		if svc.InternalPort == 0 {
+			http.Error(w, "internal_port is required for git-build services", http.StatusBadRequest)
+			return
+		}
+		// Placeholder until the first deploy builds and tags the image.
+		svc.Image = build.ImageRepository(sanitizeName(svc.Name)) + ":latest"
+	}
+	if svc.Type == state.ServiceTypeStatic {
+		if svc.Name == "" {
+			http.Error(w, "name is required for static services", http.StatusBadRequest)
+			return
+		}
+		if err := h.applyStaticSpec(&svc); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	job := svc.Type == state.ServiceTypeJob
+	if job {
+		if err := validateJobSpec(svc); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
 	if svc.Image == "" {
 		http.Error(w, "image is required", http.StatusBadRequest)
 		return
@@ -395,21 +622,21 @@ func (h *Handler) handleAddService(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Auto-generate hostname if no hostname provided and default_domain is configured
-	if len(svc.Hostnames) == 0 && st.Settings.DefaultDomain != "" {
+	if len(svc.Hostnames) == 0 && st.Settings.DefaultDomain != "" && !job {
 		autoHostname := fmt.Sprintf("%s.%s", sanitizeName(svc.Name), st.Settings.DefaultDomain)
 		svc.Hostnames = []string{autoHostname}
 		log.Printf("add service: auto-generated hostname %q", autoHostname)
 	}
 
 	// Auto-detect port and volumes from image when requested
-	needPort := svc.InternalPort == 0
-	needAutoVolumes := payload.AutoVolumes && len(svc.Volumes) == 0
+	needPort := svc.InternalPort == 0 && !job
+	needAutoVolumes := payload.AutoVolumes && len(svc.Volumes) == 0 && !gitBuild && svc.Type != state.ServiceTypeStatic
 	if needPort || needAutoVolumes {
 		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Minute)
 		defer cancel()
 
 		// Pull image first to ensure it's available locally
-		if err := docker.PullImage(ctx, svc.Image); err != nil {
+		if err := h.Docker.PullImage(ctx, svc.Image, nil); err != nil {
 			if needPort {
 				http.Error(w, fmt.Sprintf("failed to pull image for port detection: %v", err), http.StatusBadRequest)
 				return
@@ -417,7 +644,7 @@ func (h *Handler) handleAddService(w http.ResponseWriter, r *http.Request) {
 			log.Printf("add service: auto volume detection skipped (pull failed): %v", err)
 		} else {
 			if needPort {
-				port, err := docker.InspectImagePort(ctx, svc.Image)
+				port, err := docker.InspectImagePort(ctx, h.Docker, svc.Image)
 				if err != nil {
 					http.Error(w, fmt.Sprintf("failed to detect port from image: %v", err), http.StatusBadRequest)
 					return
@@ -429,7 +656,7 @@ func (h *Handler) handleAddService(w http.ResponseWriter, r *http.Request) {
 			}
 
 			if needAutoVolumes {
-				volumePaths, err := docker.InspectImageVolumes(ctx, svc.Image)
+				volumePaths, err := docker.InspectImageVolumes(ctx, h.Docker, svc.Image)
 				if err != nil {
 					log.Printf("add service: auto volume detection failed: %v", err)
 				} else {
@@ -454,10 +681,12 @@ func (h *Handler) handleAddService(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate port
-	if err := validate.Port(svc.InternalPort); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+	// Validate port; jobs are not served so they may have none
+	if !job || svc.InternalPort != 0 {
+		if err := validate.Port(svc.InternalPort); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 	}
 
 	// Validate hostnames
@@ -503,12 +732,22 @@ func (h *Handler) handleAddService(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
+	if err := validateServiceRefs(st, svc.Name, svc.Links, svc.DependsOn); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateRuntimeSpec(svc); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateBuildSpec(svc); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if svc.Type == "" {
 		svc.Type = state.ServiceTypeRegistryImage
 	}
-	if svc.Resources.MemoryLimitMB == 0 {
-		svc.Resources.MemoryLimitMB = 256
-	}
+	applyServiceDefaults(&svc)
 	if svc.Enabled == false {
 		svc.Enabled = true
 	}
@@ -559,6 +798,13 @@ func (h *Handler) handleAddService(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if svc.Type == state.ServiceTypeStatic {
+		if err := site.NewStore(h.siteRoot(svc.Name)).Init(svc.Name, time.Now()); err != nil {
+			http.Error(w, fmt.Sprintf("create site: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
 	st.Services = append(st.Services, svc)
 	if err := h.Store.Save(ctx, st); err != nil {
 		http.Error(w, fmt.Sprintf("save state: %v", err), http.StatusInternalServerError)
@@ -586,6 +832,33 @@ func (h *Handler) handleServiceByName(w http.ResponseWriter, r *http.Request) {
 		case "purge-cache":
 			h.handlePurgeCache(w, r, name)
 			return
+		case "scale":
+			h.handleScaleService(w, r, name)
+			return
+		case "maintenance":
+			h.handleMaintenance(w, r, name)
+			return
+		case "error-pages":
+			h.handleErrorPages(w, r, name)
+			return
+		case "update-check":
+			h.handleUpdateCheck(w, r, name)
+			return
+		case "metrics":
+			h.handleServiceMetrics(w, r, name)
+			return
+		case "webhook":
+			h.handleServiceWebhook(w, r, name)
+			return
+		case "site", "site/rollback":
+			h.handleSite(w, r, name, parts[1])
+			return
+		case "exec", "run":
+			h.handleExec(w, r, name, parts[1])
+			return
+		case "start", "stop", "restart":
+			h.handleLifecycle(w, r, name, parts[1])
+			return
 		default:
 			http.Error(w, "unknown service action", http.StatusNotFound)
 			return
@@ -616,11 +889,14 @@ func (h *Handler) handleServiceActionReadOnly(w http.ResponseWriter, r *http.Req
 		http.Error(w, "invalid service action", http.StatusNotFound)
 		return
 	}
-	if parts[1] != "purge-cache" {
+	switch parts[1] {
+	case "purge-cache":
+		h.handlePurgeCache(w, r, parts[0])
+	case "metrics":
+		h.handleServiceMetrics(w, r, parts[0])
+	default:
 		http.Error(w, "unknown service action", http.StatusNotFound)
-		return
 	}
-	h.handlePurgeCache(w, r, parts[0])
 }
 
 func (h *Handler) handleGetService(w http.ResponseWriter, r *http.Request, name string) {
@@ -669,6 +945,9 @@ func (h *Handler) handleUpdateService(w http.ResponseWriter, r *http.Request, na
 	// Preserve immutable fields
 	updated.ID = st.Services[serviceIdx].ID
 	updated.LastDeploy = st.Services[serviceIdx].LastDeploy
+	updated.DeployedImage = st.Services[serviceIdx].DeployedImage
+	updated.PreviousImage = st.Services[serviceIdx].PreviousImage
+	updated.Stopped = st.Services[serviceIdx].Stopped
 
 	// Validate required fields
 	if updated.Name == "" {
@@ -678,7 +957,7 @@ func (h *Handler) handleUpdateService(w http.ResponseWriter, r *http.Request, na
 		http.Error(w, "image is required", http.StatusBadRequest)
 		return
 	}
-	if updated.InternalPort == 0 {
+	if updated.InternalPort == 0 && !updated.IsJob() {
 		http.Error(w, "internal_port is required", http.StatusBadRequest)
 		return
 	}
@@ -690,6 +969,18 @@ func (h *Handler) handleUpdateService(w http.ResponseWriter, r *http.Request, na
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if err := validateServiceRefs(st, updated.Name, updated.Links, updated.DependsOn); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateRuntimeSpec(updated); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateBuildSpec(updated); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	st.Services[serviceIdx] = updated
 	if err := h.Store.Save(ctx, st); err != nil {
@@ -765,6 +1056,93 @@ func (h *Handler) handlePurgeCache(w http.ResponseWriter, r *http.Request, name
 	})
 }
 
+type scaleRequest struct {
+	Replicas  int `json:"replicas"`
+	TimeoutMs int `json:"timeout_ms,omitempty"`
+}
+
+// handleScaleService changes a service's replica count and applies it without
+// recreating the containers that are already running.
+func (h *Handler) handleScaleService(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req scaleRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Replicas < 1 {
+		http.Error(w, "replicas must be at least 1", http.StatusBadRequest)
+		return
+	}
+	if err := validate.Replicas(req.Replicas); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	timeout := 60 * time.Second
+	if req.TimeoutMs > 0 {
+		timeout = time.Duration(req.TimeoutMs) * time.Millisecond
+	}
+
+	ctx := r.Context()
+	st, err := h.Store.Load(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("load state: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	serviceIdx := -1
+	for i, svc := range st.Services {
+		if strings.EqualFold(svc.Name, name) {
+			serviceIdx = i
+			break
+		}
+	}
+	if serviceIdx == -1 {
+		http.Error(w, fmt.Sprintf("service %q not found", name), http.StatusNotFound)
+		return
+	}
+	if !st.Services[serviceIdx].Enabled {
+		http.Error(w, "service disabled", http.StatusBadRequest)
+		return
+	}
+	if st.Services[serviceIdx].IsJob() {
+		http.Error(w, "job services cannot be scaled; set job max_concurrency instead", http.StatusBadRequest)
+		return
+	}
+
+	previous := st.Services[serviceIdx].ReplicaCount()
+	st.Services[serviceIdx].Replicas = req.Replicas
+	target := sanitizeName(st.Services[serviceIdx].Name)
+	log.Printf("scale: %s %d -> %d", target, previous, req.Replicas)
+
+	err = h.apply(ctx, &st, applyOptions{
+		Targets:  []string{target},
+		Timeout:  timeout,
+		SkipPull: true,
+		UpArgs:   []string{"--no-deps", "--no-recreate"},
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("scale failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.Store.Save(ctx, st); err != nil {
+		http.Error(w, fmt.Sprintf("save state: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]any{
+		"status":   "scaled",
+		"service":  st.Services[serviceIdx].Name,
+		"replicas": req.Replicas,
+		"previous": previous,
+	})
+}
+
 func (h *Handler) handleDeleteService(w http.ResponseWriter, r *http.Request, name string) {
 	ctx := r.Context()
 	st, err := h.Store.Load(ctx)
@@ -801,7 +1179,10 @@ func (h *Handler) handleDeleteService(w http.ResponseWriter, r *http.Request, na
 type deployRequest struct {
 	Service   string   `json:"service,omitempty"`
 	Services  []string `json:"services,omitempty"`
+	Image     string   `json:"image,omitempty"`      // deploy this image reference instead of the stored one; needs a single service
 	TimeoutMs int      `json:"timeout_ms,omitempty"` // health check timeout in milliseconds, default 60000
+	Force     bool     `json:"force,omitempty"`      // deploy during a freeze window; needs Reason
+	Reason    string   `json:"reason,omitempty"`     // why a freeze is overridden, kept on the deploy record
 }
 
 func (h *Handler) handleDeploy(w http.ResponseWriter, r *http.Request) {
@@ -830,15 +1211,6 @@ func (h *Handler) handleDeploy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate staging config from full state.
-	log.Printf("deploy: generating config")
-	out, err := generate.GenerateBaseFiles(ctx, st, h.GeneratedRoot)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("generate: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	runner := docker.NewRunner(out.StagingDir)
 	targets := []string{}
 	if len(req.Services) > 0 {
 		for _, svc := range req.Services {
@@ -852,87 +1224,94 @@ func (h *Handler) handleDeploy(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Printf("deploy: targets=%v", targets)
 
-	log.Printf("deploy: docker pull start")
-	pullOutput := ""
-	if out, err := runner.Pull(ctx, targets...); err != nil && !strings.Contains(err.Error(), "No such service") {
-		log.Printf("deploy: docker pull failed: %v", err)
-		http.Error(w, fmt.Sprintf("docker pull: %v", err), http.StatusInternalServerError)
-		return
-	} else {
-		pullOutput = strings.TrimSpace(out)
+	// An image override is applied to the in-memory state only; it reaches the
+	// store with the rest of st once the deploy is healthy.
+	if req.Image != "" {
+		if len(targets) != 1 {
+			http.Error(w, "image override requires exactly one service", http.StatusBadRequest)
+			return
+		}
+		if err := overrideImage(&st, targets[0], req.Image); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 	}
-	log.Printf("deploy: docker pull complete")
 
-	// Backup current state and config before applying changes
-	ts := time.Now().UTC().Format("20060102-150405")
-	if err := h.backupState(ts); err != nil {
-		http.Error(w, fmt.Sprintf("backup state: %v", err), http.StatusInternalServerError)
-		return
-	}
-	if err := h.backupCurrentConfig(ts); err != nil {
-		http.Error(w, fmt.Sprintf("backup config: %v", err), http.StatusInternalServerError)
-		return
+	p, frozen := activeFreeze(st)
+	if frozen {
+		req.Reason = strings.TrimSpace(req.Reason)
+		if !req.Force {
+			http.Error(w, p.Describe()+"; deploy with --force --reason TEXT to override", http.StatusLocked)
+			return
+		}
+		if req.Reason == "" || len(req.Reason) > maxDecisionReasonLen {
+			http.Error(w, fmt.Sprintf("overriding a freeze needs a reason of at most %d bytes", maxDecisionReasonLen), http.StatusBadRequest)
+			return
+		}
 	}
 
-	// Start containers
-	log.Printf("deploy: docker up start")
-	if _, err := runner.Up(ctx, targets...); err != nil {
-		http.Error(w, fmt.Sprintf("docker up: %v", err), http.StatusInternalServerError)
-		return
+	rec := h.startDeploy(deploys.TriggerAPI, targets)
+	if frozen {
+		rec.FreezeOverride = fmt.Sprintf("%s: %s", p.Name, req.Reason)
+		h.auditFreezeOverride(targets, p, req.Reason)
 	}
-	log.Printf("deploy: docker up complete")
-
-	// Wait for services to become healthy
-	log.Printf("deploy: wait healthy start")
-	if err := runner.WaitHealthy(ctx, targets, timeout); err != nil {
-		// Health check failed - rollback to previous config
-		rollbackErr := h.rollbackFromBackup(ctx, ts)
-		if rollbackErr != nil {
-			http.Error(w, fmt.Sprintf("health check failed: %v; rollback also failed: %v", err, rollbackErr), http.StatusInternalServerError)
-			return
+	var deployErr error
+	defer func() { h.finishDeploy(&rec, deployErr) }()
+	// fail records err on the deploy and reports it to the client.
+	fail := func(err error) {
+		deployErr = err
+		msg := err.Error()
+		if len(rec.Hooks) > 0 || len(rec.Builds) > 0 {
+			msg += fmt.Sprintf("\nbuild and hook output: tinyserve deploy show %s", rec.ID)
 		}
-		http.Error(w, fmt.Sprintf("health check failed, rolled back: %v", err), http.StatusInternalServerError)
-		return
+		http.Error(w, msg, http.StatusInternalServerError)
 	}
-	log.Printf("deploy: wait healthy complete")
 
-	// Health check passed - promote staging to current
-	log.Printf("deploy: promote staging")
-	if err := h.promote(out.StagingDir, ts); err != nil {
-		http.Error(w, fmt.Sprintf("promote staging: %v", err), http.StatusInternalServerError)
+	res, err := h.applyRecorded(ctx, &st, applyOptions{Targets: targets, Timeout: timeout}, &rec)
+	if err != nil {
+		if n := len(rec.Builds); n > 0 && rec.Builds[n-1].Error != "" {
+			err = fmt.Errorf("%v\n%s", err, buildOutput(&rec))
+		}
+		fail(err)
 		return
 	}
 
 	now := time.Now().UTC()
 	for i := range st.Services {
-		if req.Service == "" || strings.EqualFold(st.Services[i].Name, req.Service) {
-			st.Services[i].LastDeploy = &now
+		if len(targets) == 0 || slices.Contains(targets, sanitizeName(st.Services[i].Name)) {
+			h.markDeployed(ctx, &st.Services[i], now)
 		}
 	}
 	if err := h.Store.Save(ctx, st); err != nil {
-		http.Error(w, fmt.Sprintf("save state: %v", err), http.StatusInternalServerError)
+		fail(fmt.Errorf("save state: %v", err))
 		return
 	}
 
 	cachePurge := purgeCacheForServices(ctx, st, selectDeployServices(st, req))
 
-	// Prune old backups
-	maxBackups := st.Settings.MaxBackups
-	if maxBackups == 0 {
-		maxBackups = 10
-	}
-	_ = h.pruneBackups(maxBackups)
-
 	resp := map[string]any{
-		"status": "deployed",
-		"time":   now.Format(time.RFC3339),
+		"status":    "deployed",
+		"time":      now.Format(time.RFC3339),
+		"deploy_id": rec.ID,
+	}
+	if len(rec.Hooks) > 0 {
+		resp["hooks"] = rec.Hooks
+	}
+	if len(targets) == 1 {
+		if svc := findService(&st, targets[0]); svc != nil {
+			resp["image"] = svc.DeployedImage
+		}
 	}
 	if cachePurge != nil {
 		resp["cache_purge"] = cachePurge
 	}
-	if pullOutput != "" {
-		resp["pull_output"] = pullOutput
-		resp["pull_summary"] = summarizePullOutput(pullOutput)
+	if res.PullOutput != "" {
+		resp["pull_output"] = res.PullOutput
+		resp["pull_summary"] = summarizePullOutput(res.PullOutput)
+	}
+	if len(res.Builds) > 0 {
+		resp["builds"] = res.Builds
+		resp["build_output"] = buildOutput(&rec)
 	}
 	writeJSON(w, resp)
 	log.Printf("deploy: complete (duration=%s)", time.Since(start))
@@ -961,8 +1340,8 @@ func (h *Handler) handleRollback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	runner := docker.NewRunner(current)
-	if _, err := runner.Up(ctx); err != nil {
+	runner := h.newRunner(current)
+	if _, err := runner.Up(ctx, h.stoppedUpArgs(ctx)...); err != nil {
 		http.Error(w, fmt.Sprintf("docker up after rollback: %v", err), http.StatusInternalServerError)
 		return
 	}
@@ -980,19 +1359,29 @@ func (h *Handler) handleLogs(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	service := r.URL.Query().Get("service")
-	if service == "" {
+	q := r.URL.Query()
+	services := logServices(q)
+	if len(services) == 0 {
 		http.Error(w, "service is required", http.StatusBadRequest)
 		return
 	}
 	tail := 200
-	if t := r.URL.Query().Get("tail"); t != "" {
+	if t := q.Get("tail"); t != "" {
 		if n, err := strconv.Atoi(t); err == nil {
 			tail = n
 		}
 	}
 
-	follow := r.URL.Query().Get("follow") == "1"
+	follow := q.Get("follow") == "1"
+	if isStoredLogQuery(q, services) {
+		if follow {
+			http.Error(w, "follow works with a single service and without since, until, grep or level", http.StatusBadRequest)
+			return
+		}
+		h.handleStoredLogs(w, r, services, tail)
+		return
+	}
+	service := services[0]
 	if h.AccessLogs != nil {
 		if buf := h.AccessLogs.Get(service); buf != nil {
 			if follow {
@@ -1007,7 +1396,7 @@ func (h *Handler) handleLogs(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
-	runner := docker.NewRunner(h.currentDir())
+	runner := h.newRunner(h.currentDir())
 
 	if follow {
 		w.Header().Set("Content-Type", "text/plain")
@@ -1199,13 +1588,24 @@ func (h *Handler) handleInitToken(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) checkDocker(ctx context.Context) error {
-	cmd := exec.CommandContext(ctx, "docker", "info")
-	if err := cmd.Run(); err != nil {
+	if err := h.Docker.Ping(ctx); err != nil {
 		return fmt.Errorf("docker not available: %w", err)
 	}
 	return nil
 }
 
+// composeRuntime is the default Runtime: docker compose for deploys, with
+// status and logs read through h.Docker.
+func (h *Handler) composeRuntime(dir string) docker.Runtime {
+	r := docker.NewRunner(dir)
+	r.Engine = h.Docker
+	return r
+}
+
+func (h *Handler) newRunner(dir string) docker.Runtime {
+	return h.Runtime(dir)
+}
+
 func (h *Handler) promote(stagingDir, timestamp string) error {
 	current := h.currentDir()
 	backup := filepath.Join(h.BackupsDir, "backup-"+timestamp)
@@ -1222,9 +1622,41 @@ func (h *Handler) promote(stagingDir, timestamp string) error {
 	if err := os.Rename(stagingDir, current); err != nil {
 		return fmt.Errorf("promote staging: %w", err)
 	}
+	if err := h.publishTraefikDynamic(); err != nil {
+		log.Printf("publish traefik config: %v", err)
+	}
 	return nil
 }
 
+// publishTraefikDynamic copies the promoted Traefik file-provider config into
+// the stable directory the running Traefik container watches.
+func (h *Handler) publishTraefikDynamic() error {
+	data, err := os.ReadFile(filepath.Join(h.currentDir(), "traefik", "dynamic.yml"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return h.writeLiveTraefik(data)
+}
+
+// writeLiveTraefik replaces the file-provider config the running Traefik
+// watches; Traefik applies it without restarting any container.
+func (h *Handler) writeLiveTraefik(data []byte) error {
+	dir := filepath.Join(h.GeneratedRoot, "traefik")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	// Write then rename so Traefik never reads a half-written file; the
+	// directory provider only loads .yml/.yaml/.toml files.
+	tmp := filepath.Join(dir, ".dynamic.yml.tmp")
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, "dynamic.yml"))
+}
+
 func (h *Handler) backupState(timestamp string) error {
 	if h.StatePath == "" {
 		return nil
@@ -1263,8 +1695,8 @@ func (h *Handler) rollbackFromBackup(ctx context.Context, timestamp string) erro
 		return fmt.Errorf("restore backup: %w", err)
 	}
 
-	runner := docker.NewRunner(current)
-	if _, err := runner.Up(ctx); err != nil {
+	runner := h.newRunner(current)
+	if _, err := runner.Up(ctx, h.stoppedUpArgs(ctx)...); err != nil {
 		return fmt.Errorf("docker up after rollback: %w", err)
 	}
 	return nil
@@ -1289,44 +1721,132 @@ func copyDir(src, dst string) error {
 	})
 }
 
+// applyOptions controls a single apply run.
+type applyOptions struct {
+	Targets  []string        // compose services to start; empty means all
+	Timeout  time.Duration   // health check timeout
+	SkipPull bool            // reuse local images (e.g. when only scaling)
+	UpArgs   []string        // extra flags for docker compose up
+	Trigger  string          // recorded in the deploy history, e.g. deploys.TriggerWebhook
+	Record   *deploys.Record // record of an approved deploy; a new one is started if nil
+}
+
 // applyConfig generates new config, starts specified containers, waits for health, and promotes staging.
 // If targets is empty, all services are started.
-func (h *Handler) applyConfig(ctx context.Context, st state.State, targets []string, timeout time.Duration) error {
-	out, err := generate.GenerateBaseFiles(ctx, st, h.GeneratedRoot)
+func (h *Handler) applyConfig(ctx context.Context, st *state.State, trigger string, targets []string, timeout time.Duration) error {
+	return h.apply(ctx, st, applyOptions{Targets: targets, Timeout: timeout, Trigger: trigger})
+}
+
+// apply builds and pulls images unless SkipPull is set. Built image tags are
+// written back into st, so callers must save it after a successful apply.
+// Everything but SkipPull runs (which only scale) is a deploy: it runs the
+// services' hooks and is recorded in the deploy history.
+func (h *Handler) apply(ctx context.Context, st *state.State, opts applyOptions) error {
+	if opts.SkipPull {
+		_, err := h.applyRecorded(ctx, st, opts, nil)
+		return err
+	}
+	rec := opts.Record
+	if rec == nil {
+		started := h.startDeploy(opts.Trigger, opts.Targets)
+		rec = &started
+	}
+	_, err := h.applyRecorded(ctx, st, opts, rec)
+	h.finishDeploy(rec, err)
+	return err
+}
+
+// applyResult is what a deploy built and pulled on its way.
+type applyResult struct {
+	Builds     map[string]build.Result
+	PullOutput string
+}
+
+// applyRecorded is the deploy pipeline: build, generate, pull, back up, run
+// the pre-deploy hooks, start the targets, wait until they are healthy, run
+// the smoke checks and post-deploy hooks, and promote. A failure after the
+// start rolls back to the backup. Builds and hooks are recorded on rec,
+// which is nil only for SkipPull runs; finishing it is up to the caller.
+func (h *Handler) applyRecorded(ctx context.Context, st *state.State, opts applyOptions, rec *deploys.Record) (applyResult, error) {
+	var res applyResult
+	if !opts.SkipPull {
+		var err error
+		if res.Builds, err = h.buildServices(ctx, st, opts.Targets, rec); err != nil {
+			return res, err
+		}
+	}
+
+	out, err := generate.GenerateBaseFiles(ctx, *st, h.GeneratedRoot, activeRuntime())
 	if err != nil {
-		return fmt.Errorf("generate: %w", err)
+		return res, fmt.Errorf("generate: %w", err)
 	}
 
-	runner := docker.NewRunner(out.StagingDir)
+	runner := h.newRunner(out.StagingDir)
+	targets := opts.Targets
 
-	log.Printf("applyConfig: docker pull start for %v", targets)
-	if _, err := runner.Pull(ctx, targets...); err != nil && !strings.Contains(err.Error(), "No such service") {
-		log.Printf("applyConfig: docker pull failed: %v", err)
-		return fmt.Errorf("docker pull: %w", err)
+	if !opts.SkipPull {
+		log.Printf("applyConfig: docker pull start for %v", targets)
+		pullOutput, err := runner.Pull(ctx, targets...)
+		if err != nil && !strings.Contains(err.Error(), "No such service") {
+			log.Printf("applyConfig: docker pull failed: %v", err)
+			return res, fmt.Errorf("docker pull: %w", err)
+		}
+		res.PullOutput = strings.TrimSpace(pullOutput)
+		log.Printf("applyConfig: docker pull complete")
 	}
-	log.Printf("applyConfig: docker pull complete")
 
 	ts := time.Now().UTC().Format("20060102-150405")
 	if err := h.backupState(ts); err != nil {
-		return fmt.Errorf("backup state: %w", err)
+		return res, fmt.Errorf("backup state: %w", err)
 	}
 	if err := h.backupCurrentConfig(ts); err != nil {
-		return fmt.Errorf("backup config: %w", err)
+		return res, fmt.Errorf("backup config: %w", err)
 	}
 
-	if _, err := runner.Up(ctx, targets...); err != nil {
-		return fmt.Errorf("docker up: %w", err)
-	}
+	if upList, ok := upTargets(*st, targets); ok {
+		// A full deploy starts every long-running service that isn't
+		// stopped, so each of them runs its hooks and smoke checks.
+		started := upList
+		if len(started) == 0 {
+			started = slices.Collect(maps.Keys(replicaCounts(*st)))
+		}
+		if rec != nil {
+			if err := h.runHooks(ctx, out.StagingDir, *st, started, deploys.PhasePreDeploy, rec); err != nil {
+				return res, fmt.Errorf("deploy aborted: %w", err)
+			}
+		}
+		upArgs := append(append([]string{}, opts.UpArgs...), upList...)
+		if len(upList) == 0 {
+			upArgs = append(upArgs, StoppedScaleArgs(*st)...)
+		}
+		if _, err := runner.Up(ctx, upArgs...); err != nil {
+			return res, fmt.Errorf("docker up: %w", err)
+		}
 
-	if err := runner.WaitHealthy(ctx, targets, timeout); err != nil {
-		if rbErr := h.rollbackFromBackup(ctx, ts); rbErr != nil {
-			return fmt.Errorf("health check failed: %v; rollback also failed: %v", err, rbErr)
+		if err := runner.WaitHealthyReplicas(ctx, upList, replicaCounts(*st), opts.Timeout); err != nil {
+			if rbErr := h.rollbackFromBackup(ctx, ts); rbErr != nil {
+				return res, fmt.Errorf("health check failed: %v; rollback also failed: %v", err, rbErr)
+			}
+			return res, fmt.Errorf("health check failed, rolled back: %w", err)
+		}
+		if err := h.runSmokeChecks(ctx, *st, started); err != nil {
+			if rbErr := h.rollbackFromBackup(ctx, ts); rbErr != nil {
+				return res, fmt.Errorf("smoke check failed: %v; rollback also failed: %v", err, rbErr)
+			}
+			return res, fmt.Errorf("smoke check failed, rolled back: %w", err)
+		}
+		if rec != nil {
+			if err := h.runHooks(ctx, out.StagingDir, *st, started, deploys.PhasePostDeploy, rec); err != nil {
+				if rbErr := h.rollbackFromBackup(ctx, ts); rbErr != nil {
+					return res, fmt.Errorf("%v; rollback also failed: %v", err, rbErr)
+				}
+				return res, fmt.Errorf("%w, rolled back", err)
+			}
 		}
-		return fmt.Errorf("health check failed, rolled back: %w", err)
 	}
 
 	if err := h.promote(out.StagingDir, ts); err != nil {
-		return fmt.Errorf("promote staging: %w", err)
+		return res, fmt.Errorf("promote staging: %w", err)
 	}
 
 	maxBackups := st.Settings.MaxBackups
@@ -1334,8 +1854,23 @@ func (h *Handler) applyConfig(ctx context.Context, st state.State, targets []str
 		maxBackups = 10
 	}
 	_ = h.pruneBackups(maxBackups)
+	pruneBuildImages(ctx, *st, res.Builds)
 
-	return nil
+	return res, nil
+}
+
+// replicaCounts maps compose service names to the number of containers each
+// enabled long-running service should be running, leaving out services
+// stopped by hand.
+func replicaCounts(st state.State) map[string]int {
+	counts := make(map[string]int)
+	for _, svc := range st.Services {
+		if !svc.Enabled || svc.IsJob() || svc.Stopped {
+			continue
+		}
+		counts[sanitizeName(svc.Name)] = svc.ReplicaCount()
+	}
+	return counts
 }
 
 // pruneBackups removes old backups keeping only the most recent maxKeep.
@@ -1424,13 +1959,26 @@ func (h *Handler) currentDir() string {
 	return filepath.Join(h.GeneratedRoot, "current")
 }
 
+// containerStatus returns the status of the project's running containers by
+// lowercased service name, from the status cache while the event watcher
+// follows the project.
 func (h *Handler) containerStatus(ctx context.Context) (map[string]docker.ContainerStatus, error) {
+	current := h.currentDir()
+	if composeExists(current) {
+		if statuses, ok := h.status.get(docker.ProjectName(current)); ok {
+			return statuses, nil
+		}
+	}
+	return h.pollContainerStatus(ctx)
+}
+
+func (h *Handler) pollContainerStatus(ctx context.Context) (map[string]docker.ContainerStatus, error) {
 	current := h.currentDir()
 	if _, err := os.Stat(filepath.Join(current, "docker-compose.yml")); err != nil {
 		return map[string]docker.ContainerStatus{}, nil
 	}
-	runner := docker.NewRunner(current)
-	containers, _, err := runner.PSStatus(ctx)
+	runner := h.newRunner(current)
+	containers, err := runner.PSStatus(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -1612,6 +2160,124 @@ func purgeCacheForServices(ctx context.Context, st state.State, services []state
 	}
 }
 
+// validateRuntimeSpec checks resource limits, scaling, restart policy, hardening,
+// log rotation, update policy, webhook, smoke check, hook, approval and page
+// fields.
+func validateRuntimeSpec(svc state.Service) error {
+	r := svc.Resources
+	if err := validate.MemoryMB("memory limit", r.MemoryLimitMB); err != nil {
+		return err
+	}
+	if err := validate.MemoryMB("memory reservation", r.MemoryReservationMB); err != nil {
+		return err
+	}
+	if r.MemoryLimitMB > 0 && r.MemoryReservationMB > r.MemoryLimitMB {
+		return fmt.Errorf("memory reservation (%d MB) exceeds memory limit (%d MB)", r.MemoryReservationMB, r.MemoryLimitMB)
+	}
+	if err := validate.CPUs("cpu limit", r.CPULimit); err != nil {
+		return err
+	}
+	if err := validate.CPUs("cpu reservation", r.CPUReservation); err != nil {
+		return err
+	}
+	if r.CPULimit > 0 && r.CPUReservation > r.CPULimit {
+		return fmt.Errorf("cpu reservation (%g) exceeds cpu limit (%g)", r.CPUReservation, r.CPULimit)
+	}
+	if err := validate.PidsLimit(r.PidsLimit); err != nil {
+		return err
+	}
+	if err := validate.Replicas(svc.Replicas); err != nil {
+		return err
+	}
+	if err := validate.IdleTimeout(svc.IdleTimeout); err != nil {
+		return err
+	}
+	if err := validateUpdatePolicy(svc); err != nil {
+		return err
+	}
+	if err := validateCrashPolicy(svc); err != nil {
+		return err
+	}
+	if err := validateWebhook(svc); err != nil {
+		return err
+	}
+	if err := validateSmokeChecks(svc); err != nil {
+		return err
+	}
+	if err := validateHooks(svc); err != nil {
+		return err
+	}
+	if err := validateApproval(svc); err != nil {
+		return err
+	}
+	if err := validatePages(svc); err != nil {
+		return err
+	}
+	if err := validate.RestartPolicy(svc.RestartPolicy); err != nil {
+		return err
+	}
+	if err := validate.ContainerUser(svc.Security.User); err != nil {
+		return err
+	}
+	for _, mount := range svc.Security.Tmpfs {
+		if err := validate.TmpfsMount(mount); err != nil {
+			return err
+		}
+	}
+	for _, capability := range append(append([]string{}, svc.Security.CapDrop...), svc.Security.CapAdd...) {
+		if err := validate.Capability(capability); err != nil {
+			return err
+		}
+	}
+	return validate.LogRotation(svc.Logging.MaxSizeMB, svc.Logging.MaxFiles)
+}
+
+// applyServiceDefaults fills in the safe defaults for a newly added service so
+// they are visible (and editable) in the stored config.
+func applyServiceDefaults(svc *state.Service) {
+	if svc.Resources.MemoryLimitMB == 0 {
+		svc.Resources.MemoryLimitMB = state.DefaultMemoryLimitMB
+	}
+	if svc.RestartPolicy == "" {
+		svc.RestartPolicy = state.DefaultRestartPolicy
+	}
+	if svc.Security.NoNewPrivileges == nil {
+		enabled := true
+		svc.Security.NoNewPrivileges = &enabled
+	}
+	if svc.Logging.MaxSizeMB == 0 {
+		svc.Logging.MaxSizeMB = state.DefaultLogMaxSizeMB
+	}
+	if svc.Logging.MaxFiles == 0 {
+		svc.Logging.MaxFiles = state.DefaultLogMaxFiles
+	}
+}
+
+// validateServiceRefs checks that links and dependencies name other existing services.
+func validateServiceRefs(st state.State, self string, refLists ...[]string) error {
+	for _, refs := range refLists {
+		for _, ref := range refs {
+			if err := validate.ServiceName(ref); err != nil {
+				return err
+			}
+			if strings.EqualFold(ref, self) {
+				return fmt.Errorf("service %q cannot link to itself", self)
+			}
+			found := false
+			for _, svc := range st.Services {
+				if strings.EqualFold(svc.Name, ref) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("linked service %q not found", ref)
+			}
+		}
+	}
+	return nil
+}
+
 func selectDeployServices(st state.State, req deployRequest) []state.Service {
 	if len(req.Services) == 0 && req.Service == "" {
 		return st.Services
@@ -2049,12 +2715,14 @@ func (h *Handler) handleHealth(w http.ResponseWriter, r *http.Request) {
 type createTokenRequest struct {
 	Name     string   `json:"name"`
 	Services []string `json:"services,omitempty"` // If empty, token can deploy any service
+	Admin    bool     `json:"admin,omitempty"`    // May exec and run commands in containers
 }
 
 type tokenResponse struct {
 	ID        string     `json:"id"`
 	Name      string     `json:"name"`
 	Services  []string   `json:"services,omitempty"`
+	Admin     bool       `json:"admin,omitempty"`
 	CreatedAt time.Time  `json:"created_at"`
 	LastUsed  *time.Time `json:"last_used,omitempty"`
 }
@@ -2084,6 +2752,7 @@ func (h *Handler) handleListTokens(w http.ResponseWriter, r *http.Request) {
 			ID:        t.ID,
 			Name:      t.Name,
 			Services:  t.Services,
+			Admin:     t.Admin,
 			CreatedAt: t.CreatedAt,
 			LastUsed:  t.LastUsed,
 		})
@@ -2119,6 +2788,7 @@ func (h *Handler) handleCreateToken(w http.ResponseWriter, r *http.Request) {
 		Name:      req.Name,
 		Hash:      hash,
 		Services:  req.Services,
+		Admin:     req.Admin,
 		CreatedAt: time.Now().UTC(),
 	}
 
@@ -2145,6 +2815,9 @@ func (h *Handler) handleCreateToken(w http.ResponseWriter, r *http.Request) {
 	if len(token.Services) > 0 {
 		resp["services"] = token.Services
 	}
+	if token.Admin {
+		resp["admin"] = true
+	}
 	writeJSON(w, resp)
 }
 
@@ -2297,7 +2970,7 @@ func (h *Handler) handleRemoteEnable(w http.ResponseWriter, r *http.Request) {
 		// User can run `tinyserve deploy` to start containers
 		if err := h.checkDocker(ctx); err == nil {
 			log.Printf("remote enable: generating config for cloudflared")
-			out, err := generate.GenerateBaseFiles(ctx, st, h.GeneratedRoot)
+			out, err := generate.GenerateBaseFiles(ctx, st, h.GeneratedRoot, activeRuntime())
 			if err != nil {
 				http.Error(w, fmt.Sprintf("generate config: %v", err), http.StatusInternalServerError)
 				return
@@ -1,15 +1,39 @@
 package api
 
 import (
+	"archive/tar"
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
-
+	"time"
+
+	"tinyserve/internal/auth"
+	"tinyserve/internal/deploys"
+	"tinyserve/internal/docker"
+	"tinyserve/internal/docker/dockertest"
+	"tinyserve/internal/freeze"
+	"tinyserve/internal/jobs"
+	"tinyserve/internal/logstore"
+	"tinyserve/internal/notify"
+	"tinyserve/internal/site"
 	"tinyserve/internal/state"
+	"tinyserve/internal/websocket"
 )
 
 func newTestHandler(t *testing.T) (*Handler, string) {
@@ -32,9 +56,19 @@ func newTestHandler(t *testing.T) (*Handler, string) {
 		filepath.Join(tmpDir, "state.json"),
 		filepath.Join(tmpDir, "cloudflared"),
 	)
+	useFakeDocker(h)
 	return h, tmpDir
 }
 
+// useFakeDocker points h at an in-memory engine and compose, so handlers
+// never reach a real Docker daemon.
+func useFakeDocker(h *Handler) *dockertest.Compose {
+	compose := dockertest.NewCompose(dockertest.New())
+	h.Docker = compose.Engine
+	h.Runtime = compose.Runtime
+	return compose
+}
+
 func TestHandleStatus(t *testing.T) {
 	h, tmpDir := newTestHandler(t)
 	defer os.RemoveAll(tmpDir)
@@ -473,3 +507,2550 @@ func TestMethodNotAllowed(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleAddServiceLinkValidation(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+
+	ctx := context.Background()
+	st, _ := h.Store.Load(ctx)
+	st.Services = []state.Service{{ID: "db-1", Name: "db", Image: "postgres:16", InternalPort: 5432, Enabled: true}}
+	h.Store.Save(ctx, st)
+
+	tests := []struct {
+		name     string
+		links    []string
+		wantCode int
+	}{
+		{"existing service", []string{"db"}, http.StatusOK},
+		{"unknown service", []string{"cache"}, http.StatusBadRequest},
+		{"self reference", []string{"web"}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := map[string]any{
+				"name":          "web",
+				"image":         "nginx:latest",
+				"internal_port": 80,
+				"links":         tt.links,
+			}
+			body, _ := json.Marshal(payload)
+			req := httptest.NewRequest(http.MethodPost, "/services", bytes.NewReader(body))
+			w := httptest.NewRecorder()
+
+			h.handleServices(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d; body: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleAddServiceRuntimeDefaults(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+
+	payload := map[string]any{
+		"name":          "hardened",
+		"image":         "nginx:latest",
+		"internal_port": 80,
+	}
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest(http.MethodPost, "/services", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+
+	h.handleServices(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d; body: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var svc state.Service
+	if err := json.Unmarshal(w.Body.Bytes(), &svc); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if svc.RestartPolicy != state.DefaultRestartPolicy {
+		t.Errorf("restart policy = %q, want %q", svc.RestartPolicy, state.DefaultRestartPolicy)
+	}
+	if !svc.Security.NoNewPrivilegesEnabled() || svc.Security.NoNewPrivileges == nil {
+		t.Error("no_new_privileges should default to an explicit true")
+	}
+	if svc.Logging.MaxSizeMB != state.DefaultLogMaxSizeMB || svc.Logging.MaxFiles != state.DefaultLogMaxFiles {
+		t.Errorf("logging = %+v, want defaults", svc.Logging)
+	}
+}
+
+func TestHandleAddServiceRuntimeValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		extra map[string]any
+	}{
+		{"reservation above limit", map[string]any{"resources": map[string]any{"memory_limit_mb": 128, "memory_reservation_mb": 256}}},
+		{"bad restart policy", map[string]any{"restart_policy": "sometimes"}},
+		{"bad capability", map[string]any{"security": map[string]any{"cap_add": []string{"sys_admin"}}}},
+		{"relative tmpfs", map[string]any{"security": map[string]any{"tmpfs": []string{"tmp"}}}},
+		{"negative cpu", map[string]any{"resources": map[string]any{"cpu_limit": -1}}},
+		{"too many replicas", map[string]any{"replicas": 1000}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, tmpDir := newTestHandler(t)
+			defer os.RemoveAll(tmpDir)
+
+			payload := map[string]any{
+				"name":          "app",
+				"image":         "nginx:latest",
+				"internal_port": 80,
+			}
+			for k, v := range tt.extra {
+				payload[k] = v
+			}
+			body, _ := json.Marshal(payload)
+			req := httptest.NewRequest(http.MethodPost, "/services", bytes.NewReader(body))
+			w := httptest.NewRecorder()
+
+			h.handleServices(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d; body: %s", w.Code, http.StatusBadRequest, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleScaleServiceValidation(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+
+	payload := map[string]any{
+		"name":          "web",
+		"image":         "nginx:latest",
+		"internal_port": 80,
+	}
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest(http.MethodPost, "/services", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	h.handleServices(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("add service failed: %s", w.Body.String())
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		wantCode int
+	}{
+		{"zero replicas", http.MethodPost, "/services/web/scale", `{"replicas":0}`, http.StatusBadRequest},
+		{"too many replicas", http.MethodPost, "/services/web/scale", `{"replicas":1000}`, http.StatusBadRequest},
+		{"invalid json", http.MethodPost, "/services/web/scale", `{`, http.StatusBadRequest},
+		{"unknown service", http.MethodPost, "/services/missing/scale", `{"replicas":2}`, http.StatusNotFound},
+		{"wrong method", http.MethodGet, "/services/web/scale", ``, http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			h.handleServiceByName(w, req)
+			if w.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d; body: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleAddServiceGitBuild(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+
+	payload := map[string]any{
+		"type":          "git-build",
+		"internal_port": 8080,
+		"build": map[string]any{
+			"source":     "https://github.com/example/tool.git",
+			"ref":        "main",
+			"dockerfile": "deploy/Dockerfile",
+		},
+	}
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest(http.MethodPost, "/services", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	h.handleServices(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("add git-build service failed: %d %s", w.Code, w.Body.String())
+	}
+
+	st, err := h.Store.Load(context.Background())
+	if err != nil {
+		t.Fatalf("load state: %v", err)
+	}
+	svc := st.Services[0]
+	if svc.Name != "tool" {
+		t.Errorf("name = %q, want derived from source", svc.Name)
+	}
+	if svc.Type != state.ServiceTypeGitBuild || svc.Build == nil || svc.Build.Dockerfile != "deploy/Dockerfile" {
+		t.Errorf("build spec not stored: %+v", svc)
+	}
+	if svc.Image != "tinyserve-build/tool:latest" {
+		t.Errorf("image = %q, want placeholder build image", svc.Image)
+	}
+}
+
+func TestHandleAddServiceGitBuildValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload map[string]any
+	}{
+		{"missing build", map[string]any{"type": "git-build", "name": "tool", "internal_port": 80}},
+		{"relative source", map[string]any{"type": "git-build", "name": "tool", "internal_port": 80, "build": map[string]any{"source": "src/tool"}}},
+		{"escaping dockerfile", map[string]any{"type": "git-build", "name": "tool", "internal_port": 80, "build": map[string]any{"source": "/srv/tool", "dockerfile": "../Dockerfile"}}},
+		{"missing port", map[string]any{"type": "git-build", "name": "tool", "build": map[string]any{"source": "/srv/tool"}}},
+		{"unknown type", map[string]any{"type": "helm-chart", "name": "tool", "image": "nginx:latest", "internal_port": 80}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, tmpDir := newTestHandler(t)
+			defer os.RemoveAll(tmpDir)
+
+			body, _ := json.Marshal(tt.payload)
+			req := httptest.NewRequest(http.MethodPost, "/services", bytes.NewReader(body))
+			w := httptest.NewRecorder()
+			h.handleServices(w, req)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d; body: %s", w.Code, http.StatusBadRequest, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestStaticSiteUpload(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+
+	body, _ := json.Marshal(map[string]any{"name": "docs", "type": "static"})
+	req := httptest.NewRequest(http.MethodPost, "/services", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	h.handleServices(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("add static service failed: %d %s", w.Code, w.Body.String())
+	}
+
+	var svc state.Service
+	json.Unmarshal(w.Body.Bytes(), &svc)
+	siteRoot := filepath.Join(tmpDir, "services", "docs", "site")
+	if svc.Image != site.ServerImage || svc.InternalPort != 80 {
+		t.Errorf("static service image/port = %q/%d", svc.Image, svc.InternalPort)
+	}
+	if len(svc.Volumes) != 1 || svc.Volumes[0] != siteRoot+":/usr/share/nginx:ro" {
+		t.Errorf("static service volumes = %v", svc.Volumes)
+	}
+	if _, err := os.Stat(filepath.Join(siteRoot, "html", "index.html")); err != nil {
+		t.Errorf("placeholder page missing: %v", err)
+	}
+
+	// Uploads need a deploy token.
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	tw.WriteHeader(&tar.Header{Name: "index.html", Mode: 0o644, Size: 5, Typeflag: tar.TypeReg})
+	tw.Write([]byte("hello"))
+	tw.Close()
+
+	req = httptest.NewRequest(http.MethodPut, "/services/docs/site", bytes.NewReader(archive.Bytes()))
+	w = httptest.NewRecorder()
+	h.handleServiceByName(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("upload without token: status = %d, want 401", w.Code)
+	}
+
+	plaintext, _ := auth.GenerateToken()
+	hash, _ := auth.HashToken(plaintext)
+	st, _ := h.Store.Load(context.Background())
+	st.Tokens = append(st.Tokens, state.APIToken{ID: "t1", Name: "ci", Hash: hash})
+	h.Store.Save(context.Background(), st)
+
+	req = httptest.NewRequest(http.MethodPut, "/services/docs/site", bytes.NewReader(archive.Bytes()))
+	req.Header.Set("Authorization", "Bearer "+plaintext)
+	w = httptest.NewRecorder()
+	h.HandleSite(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload: status = %d; body: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Version string   `json:"version"`
+		Changed []string `json:"changed"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Changed) != 1 || resp.Changed[0] != "index.html" {
+		t.Errorf("changed = %v, want [index.html]", resp.Changed)
+	}
+	if got, _ := os.ReadFile(filepath.Join(siteRoot, "html", "index.html")); string(got) != "hello" {
+		t.Errorf("live index.html = %q", got)
+	}
+
+	// Roll back to the placeholder.
+	req = httptest.NewRequest(http.MethodPost, "/services/docs/site/rollback", nil)
+	req.Header.Set("Authorization", "Bearer "+plaintext)
+	w = httptest.NewRecorder()
+	h.handleServiceByName(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("rollback: status = %d; body: %s", w.Code, w.Body.String())
+	}
+	if got, _ := os.ReadFile(filepath.Join(siteRoot, "html", "index.html")); string(got) == "hello" {
+		t.Error("rollback did not switch the live release")
+	}
+}
+
+func TestStaticSiteRejectsOtherServiceTypes(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+
+	body, _ := json.Marshal(map[string]any{"name": "web", "image": "nginx:latest", "internal_port": 80})
+	req := httptest.NewRequest(http.MethodPost, "/services", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	h.handleServices(w, req)
+
+	req = httptest.NewRequest(http.MethodGet, "/services/web/site", nil)
+	w = httptest.NewRecorder()
+	h.handleServiceByName(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400 for non-static service", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/services/web", nil)
+	w = httptest.NewRecorder()
+	h.HandleSite(w, req)
+	if w.Code == http.StatusOK {
+		t.Error("webhook site handler must not expose other service routes")
+	}
+}
+
+func TestHandleAddServiceJob(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+
+	ctx := context.Background()
+	st, _ := h.Store.Load(ctx)
+	st.Settings.DefaultDomain = "example.com"
+	_ = h.Store.Save(ctx, st)
+
+	invalid := []map[string]any{
+		{"name": "backup", "type": "job", "image": "alpine:3.20"},
+		{"name": "backup", "type": "job", "image": "alpine:3.20", "job": map[string]any{"schedule": "every day"}},
+		{"name": "backup", "type": "job", "image": "alpine:3.20", "job": map[string]any{"schedule": "@daily", "max_concurrency": 100}},
+		{"name": "backup", "type": "job", "image": "alpine:3.20", "hostnames": []string{"backup.example.com"}, "job": map[string]any{"schedule": "@daily"}},
+	}
+	for _, payload := range invalid {
+		body, _ := json.Marshal(payload)
+		req := httptest.NewRequest(http.MethodPost, "/services", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		h.handleServices(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("payload %v: status = %d, want 400 (%s)", payload, w.Code, w.Body.String())
+		}
+	}
+
+	body, _ := json.Marshal(map[string]any{
+		"name":    "backup",
+		"type":    "job",
+		"image":   "alpine:3.20",
+		"command": []string{"sh", "-c", "echo ok"},
+		"job":     map[string]any{"schedule": "0 3 * * *"},
+	})
+	req := httptest.NewRequest(http.MethodPost, "/services", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	h.handleServices(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (%s)", w.Code, w.Body.String())
+	}
+
+	st, _ = h.Store.Load(ctx)
+	svc := st.Services[0]
+	if !svc.IsJob() || svc.Job == nil || svc.Job.Schedule != "0 3 * * *" {
+		t.Errorf("job spec not saved: %+v", svc)
+	}
+	if len(svc.Hostnames) != 0 || svc.InternalPort != 0 {
+		t.Errorf("job should have no hostname or port, got %v / %d", svc.Hostnames, svc.InternalPort)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/services/backup/scale", strings.NewReader(`{"replicas":2}`))
+	w = httptest.NewRecorder()
+	h.handleServiceByName(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("scale job status = %d, want 400", w.Code)
+	}
+}
+
+func TestJobRunNowAndHistory(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+
+	h.Jobs = jobs.NewManager(jobs.NewHistory(h.jobsRoot()), func(ctx context.Context, service string, w io.Writer) (int, error) {
+		_, _ = io.WriteString(w, "hello from "+service+"\n")
+		return 0, nil
+	})
+
+	ctx := context.Background()
+	st, _ := h.Store.Load(ctx)
+	st.Services = []state.Service{
+		{Name: "backup", Type: state.ServiceTypeJob, Image: "alpine:3.20", Enabled: true, Job: &state.ServiceJob{Schedule: "@daily"}},
+		{Name: "web", Type: state.ServiceTypeRegistryImage, Image: "nginx:latest", InternalPort: 80, Enabled: true},
+	}
+	_ = h.Store.Save(ctx, st)
+
+	req := httptest.NewRequest(http.MethodPost, "/jobs/web/run", nil)
+	w := httptest.NewRecorder()
+	h.handleJobByName(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("run non-job status = %d, want 400", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/jobs/backup/run", nil)
+	w = httptest.NewRecorder()
+	h.handleJobByName(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("run-now status = %d, want 200 (%s)", w.Code, w.Body.String())
+	}
+	var run jobs.Run
+	if err := json.Unmarshal(w.Body.Bytes(), &run); err != nil {
+		t.Fatalf("decode run: %v", err)
+	}
+	h.Jobs.Wait()
+
+	req = httptest.NewRequest(http.MethodGet, "/jobs/backup/runs", nil)
+	w = httptest.NewRecorder()
+	h.handleJobByName(w, req)
+	var runs []jobs.Run
+	if err := json.Unmarshal(w.Body.Bytes(), &runs); err != nil {
+		t.Fatalf("decode runs: %v", err)
+	}
+	if len(runs) != 1 || runs[0].ID != run.ID || runs[0].Status != jobs.StatusSucceeded || runs[0].Trigger != jobs.TriggerManual {
+		t.Errorf("history = %+v", runs)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/jobs/backup/runs/"+run.ID+"/logs", nil)
+	w = httptest.NewRecorder()
+	h.handleJobByName(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "hello from backup\n" {
+		t.Errorf("logs = %d %q", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/jobs", nil)
+	w = httptest.NewRecorder()
+	h.handleJobs(w, req)
+	if !strings.Contains(w.Body.String(), `"next_run"`) || !strings.Contains(w.Body.String(), run.ID) {
+		t.Errorf("job list missing next or last run: %s", w.Body.String())
+	}
+}
+
+func TestUpTargetsSkipsJobs(t *testing.T) {
+	st := state.NewState()
+	st.Services = []state.Service{
+		{Name: "backup", Type: state.ServiceTypeJob, Enabled: true},
+		{Name: "web", Enabled: true},
+	}
+	if got, ok := upTargets(st, nil); !ok || got != nil {
+		t.Errorf("upTargets(nil) = %v, %v; want all services", got, ok)
+	}
+	if got, ok := upTargets(st, []string{"web", "backup"}); !ok || len(got) != 1 || got[0] != "web" {
+		t.Errorf("upTargets(web, backup) = %v, %v", got, ok)
+	}
+	if _, ok := upTargets(st, []string{"backup"}); ok {
+		t.Error("upTargets(backup) should report nothing to start")
+	}
+	if counts := replicaCounts(st); counts["backup"] != 0 {
+		t.Errorf("replicaCounts should exclude jobs, got %v", counts)
+	}
+}
+
+func TestWebhookPreviewValidation(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+
+	scoped, _ := auth.GenerateToken()
+	scopedHash, _ := auth.HashToken(scoped)
+	ctx := context.Background()
+	st, _ := h.Store.Load(ctx)
+	st.Tokens = append(st.Tokens, state.APIToken{ID: "t1", Name: "ci", Hash: scopedHash, Services: []string{"api"}})
+	st.Services = []state.Service{
+		{Name: "api", Type: state.ServiceTypeRegistryImage, Image: "ghcr.io/acme/api:latest", InternalPort: 8080, Hostnames: []string{"api.example.com"}, Enabled: true},
+		{Name: "web", Type: state.ServiceTypeRegistryImage, Image: "nginx:latest", InternalPort: 80, Enabled: true},
+		{Name: "docs", Type: state.ServiceTypeStatic, Image: "nginx:1.27-alpine", InternalPort: 80, Enabled: true},
+	}
+	h.Store.Save(ctx, st)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"other service", http.MethodPost, "/webhook/preview/web", `{"pr":1,"tag":"pr-1"}`, http.StatusForbidden},
+		{"missing pr", http.MethodPost, "/webhook/preview/api", `{"tag":"pr-1"}`, http.StatusBadRequest},
+		{"bad tag", http.MethodPost, "/webhook/preview/api", `{"pr":1,"tag":"../x"}`, http.StatusBadRequest},
+		{"ttl too long", http.MethodPost, "/webhook/preview/api", `{"pr":1,"tag":"pr-1","ttl_hours":10000}`, http.StatusBadRequest},
+		{"unknown preview", http.MethodDelete, "/webhook/preview/api/7", "", http.StatusNotFound},
+		{"bad pr number", http.MethodDelete, "/webhook/preview/api/abc", "", http.StatusBadRequest},
+		{"wrong method", http.MethodGet, "/webhook/preview/api", "", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+scoped)
+			w := httptest.NewRecorder()
+			h.HandleWebhookPreview(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d (%s)", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook/preview/api", strings.NewReader(`{"pr":1,"tag":"pr-1"}`))
+	w := httptest.NewRecorder()
+	h.HandleWebhookPreview(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("without token: status = %d, want 401", w.Code)
+	}
+}
+
+func TestNewPreviewService(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+
+	dataRoot := h.dataRoot()
+	parent := state.Service{
+		ID:        "api-1",
+		Name:      "api",
+		Image:     "ghcr.io/acme/api:latest@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+		Hostnames: []string{"api.example.com"},
+		Env:       map[string]string{"MODE": "prod"},
+		Volumes:   []string{filepath.Join(dataRoot, "services", "api", "data") + ":/data", "/srv/shared:/shared:ro"},
+		Replicas:  3,
+		Enabled:   true,
+	}
+	expires := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	host := previewHostname(parent, 12, "example.com")
+	svc, err := h.newPreviewService(parent, 12, imageWithTag(parent.Image, "sha-abc"), host, expires)
+	if err != nil {
+		t.Fatalf("newPreviewService() error = %v", err)
+	}
+
+	if svc.Name != "api-pr-12" || svc.ID == parent.ID {
+		t.Errorf("name/id = %q/%q", svc.Name, svc.ID)
+	}
+	if svc.Image != "ghcr.io/acme/api:sha-abc" {
+		t.Errorf("image = %q", svc.Image)
+	}
+	if len(svc.Hostnames) != 1 || svc.Hostnames[0] != "pr-12.api.example.com" {
+		t.Errorf("hostnames = %v", svc.Hostnames)
+	}
+	if svc.Replicas != 0 || svc.Preview == nil || svc.Preview.Parent != "api" || !svc.Preview.ExpiresAt.Equal(expires) {
+		t.Errorf("preview fields = replicas %d, %+v", svc.Replicas, svc.Preview)
+	}
+	wantData := filepath.Join(dataRoot, "services", "api-pr-12", "data")
+	if svc.Volumes[0] != wantData+":/data" || svc.Volumes[1] != "/srv/shared:/shared:ro" {
+		t.Errorf("volumes = %v", svc.Volumes)
+	}
+	if info, err := os.Stat(wantData); err != nil || !info.IsDir() {
+		t.Errorf("preview data dir not created: %v", err)
+	}
+	svc.Env["MODE"] = "preview"
+	if parent.Env["MODE"] != "prod" {
+		t.Error("preview env must not alias the parent's")
+	}
+
+	if got := previewHostname(state.Service{Name: "Web App"}, 3, "example.com"); got != "pr-3.web-app.example.com" {
+		t.Errorf("previewHostname() fallback = %q", got)
+	}
+	if got := imageWithTag("localhost:5000/api", "v2"); got != "localhost:5000/api:v2" {
+		t.Errorf("imageWithTag() with registry port = %q", got)
+	}
+}
+
+func TestIdleServiceForHost(t *testing.T) {
+	st := state.NewState()
+	st.Settings.DefaultDomain = "example.com"
+	st.Services = []state.Service{
+		{Name: "blog", IdleTimeout: 30, Enabled: true},
+		{Name: "shop", Hostnames: []string{"shop.example.org"}, IdleTimeout: 10, Enabled: true},
+		{Name: "api", Enabled: true},
+		{Name: "old", IdleTimeout: 5, Enabled: false},
+	}
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"blog.example.com", "blog"},
+		{"BLOG.example.com:80", "blog"},
+		{"shop.example.org", "shop"},
+		{"api.example.com", ""},
+		{"old.example.com", ""},
+		{"unknown.example.com", ""},
+	}
+	for _, tt := range tests {
+		svc, ok := idleServiceForHost(st, tt.host)
+		if got := svc.Name; ok != (tt.want != "") || got != tt.want {
+			t.Errorf("idleServiceForHost(%q) = %q, %v; want %q", tt.host, got, ok, tt.want)
+		}
+	}
+
+	if got := idleTimeouts(st); len(got) != 2 || got["shop"] != 10*time.Minute {
+		t.Errorf("idleTimeouts() = %v", got)
+	}
+}
+
+func TestHandleWakeUnknownHost(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+
+	req := httptest.NewRequest(http.MethodGet, "http://api.example.com/", nil)
+	w := httptest.NewRecorder()
+	h.HandleWake(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("HandleWake() status = %d, want 404", w.Code)
+	}
+}
+
+func TestPromotePublishesTraefikConfig(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+
+	staging := filepath.Join(h.GeneratedRoot, ".staging-test")
+	os.MkdirAll(filepath.Join(staging, "traefik"), 0o755)
+	os.WriteFile(filepath.Join(staging, "traefik", "dynamic.yml"), []byte("http:\n  routers: {}\n"), 0o600)
+
+	if err := h.promote(staging, "20260101-000000"); err != nil {
+		t.Fatalf("promote() error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(h.GeneratedRoot, "traefik", "dynamic.yml"))
+	if err != nil {
+		t.Fatalf("live traefik config not published: %v", err)
+	}
+	if string(data) != "http:\n  routers: {}\n" {
+		t.Errorf("published config = %q", data)
+	}
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+
+	st := state.NewState()
+	st.Settings.DefaultDomain = "example.com"
+	st.Services = []state.Service{{Name: "shop", Image: "shop:1", InternalPort: 80, Enabled: true}}
+	h.Store.Save(context.Background(), st)
+
+	body := strings.NewReader(`{"enabled":true,"message":"Migrating <db>"}`)
+	req := httptest.NewRequest(http.MethodPost, "/services/shop/maintenance", body)
+	w := httptest.NewRecorder()
+	h.handleServiceByName(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("maintenance on status = %d: %s", w.Code, w.Body.String())
+	}
+	live, err := os.ReadFile(filepath.Join(h.GeneratedRoot, "traefik", "dynamic.yml"))
+	if err != nil || !strings.Contains(string(live), "shop-maintenance:") {
+		t.Fatalf("live traefik config missing maintenance router: %v\n%s", err, live)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://shop.example.com/cart", nil)
+	w = httptest.NewRecorder()
+	h.HandleDaemonPages(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("maintenance page status = %d, want 503", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "Migrating &lt;db&gt;") {
+		t.Errorf("maintenance page should show the escaped message: %s", w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/services/shop/maintenance", strings.NewReader(`{"enabled":false}`))
+	w = httptest.NewRecorder()
+	h.handleServiceByName(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("maintenance off status = %d: %s", w.Code, w.Body.String())
+	}
+	live, _ = os.ReadFile(filepath.Join(h.GeneratedRoot, "traefik", "dynamic.yml"))
+	if strings.Contains(string(live), "shop-maintenance") {
+		t.Errorf("maintenance router should be removed\n%s", live)
+	}
+	loaded, _ := h.Store.Load(context.Background())
+	if loaded.Services[0].Maintenance != nil {
+		t.Error("maintenance should be cleared in state")
+	}
+}
+
+func TestErrorPages(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+
+	st := state.NewState()
+	st.Services = []state.Service{{Name: "shop", Image: "shop:1", InternalPort: 80, Enabled: true}}
+	h.Store.Save(context.Background(), st)
+
+	req := httptest.NewRequest(http.MethodPut, "/services/shop/error-pages", strings.NewReader(`{"server_error":"<h1>Oops</h1>"}`))
+	w := httptest.NewRecorder()
+	h.handleServiceByName(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"deploy_required": true`) {
+		t.Fatalf("set error pages = %d: %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/_tinyserve/errors/shop/502", nil)
+	w = httptest.NewRecorder()
+	h.HandleDaemonPages(w, req)
+	if w.Code != http.StatusBadGateway || w.Body.String() != "<h1>Oops</h1>" {
+		t.Errorf("5xx page = %d %q", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/_tinyserve/errors/shop/404", nil)
+	w = httptest.NewRecorder()
+	h.HandleDaemonPages(w, req)
+	if w.Code != http.StatusNotFound || strings.Contains(w.Body.String(), "Oops") {
+		t.Errorf("404 without a page = %d %q", w.Code, w.Body.String())
+	}
+
+	big := strings.Repeat("x", maxErrorPageBytes+1)
+	req = httptest.NewRequest(http.MethodPut, "/services/shop/error-pages", strings.NewReader(`{"not_found":"`+big+`"}`))
+	w = httptest.NewRecorder()
+	h.handleServiceByName(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("oversized page status = %d, want 400", w.Code)
+	}
+}
+
+// fakeRegistryServer serves tag lists and manifest digests for team/app
+// without authentication.
+func fakeRegistryServer(t *testing.T, tags []string, digests map[string]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/team/app/tags/list":
+			json.NewEncoder(w).Encode(map[string]any{"name": "team/app", "tags": tags})
+		case strings.HasPrefix(r.URL.Path, "/v2/team/app/manifests/"):
+			digest, ok := digests[strings.TrimPrefix(r.URL.Path, "/v2/team/app/manifests/")]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Docker-Content-Digest", digest)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCheckForUpdate(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+
+	srv := fakeRegistryServer(t, []string{"1.4.0", "1.4.2", "1.5.0", "2.0.0", "latest"}, map[string]string{"latest": "sha256:new"})
+	repo := strings.TrimPrefix(srv.URL, "http://") + "/team/app"
+	h.imageDigests = func(ctx context.Context, svc state.Service) ([]string, error) {
+		return []string{"sha256:old"}, nil
+	}
+	ctx := context.Background()
+
+	svc := state.Service{Name: "app", Image: repo + ":1.4.0", UpdatePolicy: &state.ServiceUpdatePolicy{Semver: "^1.4"}}
+	upd, ok, err := h.checkForUpdate(ctx, svc)
+	if err != nil || !ok || upd.To != repo+":1.5.0" {
+		t.Errorf("semver check = %+v, %v, %v; want %s:1.5.0", upd, ok, err, repo)
+	}
+	svc.Image = repo + ":1.5.0"
+	if _, ok, err := h.checkForUpdate(ctx, svc); ok || err != nil {
+		t.Errorf("semver check at the newest version = %v, %v; want no update", ok, err)
+	}
+
+	svc = state.Service{Name: "app", Image: repo + ":latest", UpdatePolicy: &state.ServiceUpdatePolicy{}}
+	upd, ok, err = h.checkForUpdate(ctx, svc)
+	if err != nil || !ok || upd.To != svc.Image {
+		t.Errorf("digest check = %+v, %v, %v; want a redeploy of the same tag", upd, ok, err)
+	}
+	h.imageDigests = func(ctx context.Context, svc state.Service) ([]string, error) {
+		return []string{"sha256:new"}, nil
+	}
+	if _, ok, err := h.checkForUpdate(ctx, svc); ok || err != nil {
+		t.Errorf("digest check with the remote digest running = %v, %v; want no update", ok, err)
+	}
+
+	// Without a running container, e.g. a job between runs or a stopped
+	// service, the local image is compared instead.
+	h.imageDigests = h.deployedImageDigests
+	useFakeDocker(h)
+	if _, _, err := h.checkForUpdate(ctx, svc); err == nil {
+		t.Error("digest check without a container or local image succeeded")
+	}
+	h.Docker.(*dockertest.Engine).AddImage(docker.Image{ID: "sha256:local", RepoTags: []string{svc.Image}, RepoDigests: []string{repo + "@sha256:old"}})
+	if upd, ok, err := h.checkForUpdate(ctx, svc); err != nil || !ok || upd.To != svc.Image {
+		t.Errorf("digest check against the local image = %+v, %v, %v; want an update", upd, ok, err)
+	}
+	h.Docker.(*dockertest.Engine).AddImage(docker.Image{ID: "sha256:local", RepoTags: []string{svc.Image}, RepoDigests: []string{repo + "@sha256:new"}})
+	if _, ok, err := h.checkForUpdate(ctx, svc); ok || err != nil {
+		t.Errorf("digest check with the remote digest pulled = %v, %v; want no update", ok, err)
+	}
+}
+
+func TestHandleAddServiceUpdatePolicyValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"bad range", `{"name":"a","image":"nginx:1.25","internal_port":80,"update_policy":{"semver":"newest"}}`},
+		{"short interval", `{"name":"a","image":"nginx:1.25","internal_port":80,"update_policy":{"interval_minutes":1}}`},
+		{"pinned digest", `{"name":"a","image":"nginx@sha256:abc","internal_port":80,"update_policy":{}}`},
+		{"static site", `{"name":"a","type":"static","update_policy":{}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, tmpDir := newTestHandler(t)
+			defer os.RemoveAll(tmpDir)
+			req := httptest.NewRequest(http.MethodPost, "/services", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			h.handleServices(w, req)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestNotificationSettings(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+
+	received := make(chan map[string]any, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev map[string]any
+		json.NewDecoder(r.Body).Decode(&ev)
+		received <- ev
+	}))
+	defer hook.Close()
+
+	req := httptest.NewRequest(http.MethodPut, "/settings/notifications", strings.NewReader(`{"webhook_url":"ftp://example.com"}`))
+	w := httptest.NewRecorder()
+	h.handleNotificationSettings(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("non-http webhook status = %d, want 400", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPut, "/settings/notifications", strings.NewReader(`{"webhook_url":"`+hook.URL+`"}`))
+	w = httptest.NewRecorder()
+	h.handleNotificationSettings(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("set webhook status = %d: %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/settings/notifications/test", nil)
+	w = httptest.NewRecorder()
+	h.handleNotificationTest(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("test notification status = %d: %s", w.Code, w.Body.String())
+	}
+	ev := <-received
+	if ev["event"] != "test" || ev["text"] == "" {
+		t.Errorf("test event = %v", ev)
+	}
+}
+
+func TestProviderWebhookAuthAndFilters(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+
+	const secret = "0123456789abcdef0123456789abcdef"
+	st := state.NewState()
+	st.Services = []state.Service{{
+		Name: "app", Image: "ghcr.io/acme/app:latest", InternalPort: 80, Enabled: true,
+		Webhook: &state.ServiceWebhook{Secret: secret, Branches: []string{"main"}, ImageTags: []string{"v*"}},
+	}}
+	h.Store.Save(context.Background(), st)
+
+	sign := func(body string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	send := func(provider, event, body, signature string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/webhook/"+provider+"/app", strings.NewReader(body))
+		req.Header.Set("X-GitHub-Event", event)
+		req.Header.Set("X-Hub-Signature-256", signature)
+		w := httptest.NewRecorder()
+		h.HandleProviderWebhook(w, req)
+		return w
+	}
+
+	push := `{"ref":"refs/heads/feature"}`
+	if w := send("github", "push", push, sign(push+"x")); w.Code != http.StatusUnauthorized {
+		t.Errorf("bad signature status = %d, want 401", w.Code)
+	}
+	if w := send("github", "ping", `{}`, sign(`{}`)); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "pong") {
+		t.Errorf("ping = %d %s", w.Code, w.Body.String())
+	}
+	if w := send("github", "push", push, sign(push)); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "ignored") {
+		t.Errorf("unmatched branch = %d %s", w.Code, w.Body.String())
+	}
+	pkg := `{"action":"published","package":{"name":"other","namespace":"acme","package_type":"container","package_version":{"container_metadata":{"tag":{"name":"v1.2.0"}}}}}`
+	if w := send("github", "package", pkg, sign(pkg)); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "not the service's repository") {
+		t.Errorf("package of another repository = %d %s", w.Code, w.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook/dockerhub/app?token=wrong", strings.NewReader(`{"push_data":{"tag":"v1"}}`))
+	w := httptest.NewRecorder()
+	h.HandleProviderWebhook(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("dockerhub with a wrong token = %d, want 401", w.Code)
+	}
+}
+
+func TestParseProviderWebhookEvents(t *testing.T) {
+	tests := []struct {
+		name  string
+		parse func() (webhookEvent, string, error)
+		want  webhookEvent
+	}{
+		{"github push", func() (webhookEvent, string, error) {
+			return parseGitHubEvent("push", []byte(`{"ref":"refs/heads/main"}`))
+		}, webhookEvent{Kind: webhookBranch, Ref: "main"}},
+		{"github tag push", func() (webhookEvent, string, error) {
+			return parseGitHubEvent("push", []byte(`{"ref":"refs/tags/v1.2.0"}`))
+		}, webhookEvent{Kind: webhookTag, Ref: "v1.2.0"}},
+		{"github release", func() (webhookEvent, string, error) {
+			return parseGitHubEvent("release", []byte(`{"action":"published","release":{"tag_name":"v2.0.0"}}`))
+		}, webhookEvent{Kind: webhookTag, Ref: "v2.0.0"}},
+		{"ghcr package", func() (webhookEvent, string, error) {
+			return parseGitHubEvent("registry_package", []byte(`{"action":"published","registry_package":{"name":"app","namespace":"acme","package_type":"CONTAINER","package_version":{"container_metadata":{"tag":{"name":"1.4.0"}}}}}`))
+		}, webhookEvent{Kind: webhookImage, Ref: "1.4.0", Repository: "acme/app"}},
+		{"gitlab tag push", func() (webhookEvent, string, error) {
+			return parseGitLabEvent("Tag Push Hook", []byte(`{"ref":"refs/tags/v3","after":"abc123"}`))
+		}, webhookEvent{Kind: webhookTag, Ref: "v3"}},
+		{"docker hub", func() (webhookEvent, string, error) {
+			return parseDockerHubEvent([]byte(`{"push_data":{"tag":"latest"},"repository":{"repo_name":"acme/app"}}`))
+		}, webhookEvent{Kind: webhookImage, Ref: "latest", Repository: "acme/app"}},
+	}
+	for _, tt := range tests {
+		got, reason, err := tt.parse()
+		if err != nil || reason != "" || got != tt.want {
+			t.Errorf("%s = %+v, %q, %v; want %+v", tt.name, got, reason, err, tt.want)
+		}
+	}
+
+	if _, reason, _ := parseGitLabEvent("Push Hook", []byte(`{"ref":"refs/heads/main","after":"0000000000000000000000000000000000000000"}`)); reason == "" {
+		t.Error("a deleted GitLab branch should be ignored")
+	}
+	if _, reason, _ := parseGitHubEvent("issues", []byte(`{}`)); reason == "" {
+		t.Error("unsupported GitHub events should be ignored")
+	}
+}
+
+func TestWebhookDeploySpec(t *testing.T) {
+	img := state.Service{Name: "app", Image: "ghcr.io/acme/app:latest", Webhook: &state.ServiceWebhook{Branches: []string{"main"}, Tags: []string{"v*"}, ImageTags: []string{"*"}}}
+	if got := webhookDeploySpec(img, webhookEvent{Kind: webhookTag, Ref: "v1.3.0"}); got.Image != "ghcr.io/acme/app:v1.3.0" {
+		t.Errorf("tag deploy image = %q", got.Image)
+	}
+	if got := webhookDeploySpec(img, webhookEvent{Kind: webhookBranch, Ref: "main"}); got.Image != img.Image {
+		t.Errorf("branch deploy should keep the image, got %q", got.Image)
+	}
+	if reason := webhookIgnoreReason(img, webhookEvent{Kind: webhookImage, Ref: "1.0", Repository: "acme/app"}); reason != "" {
+		t.Errorf("matching image push ignored: %s", reason)
+	}
+
+	src := state.Service{Name: "site", Type: state.ServiceTypeGitBuild, Build: &state.ServiceBuild{Source: "https://example.com/site.git", Ref: "main"}, Webhook: &state.ServiceWebhook{Tags: []string{"release-*"}}}
+	got := webhookDeploySpec(src, webhookEvent{Kind: webhookTag, Ref: "release-7"})
+	if got.Build.Ref != "release-7" || src.Build.Ref != "main" {
+		t.Errorf("git-build deploy ref = %q (original %q)", got.Build.Ref, src.Build.Ref)
+	}
+	if reason := webhookIgnoreReason(src, webhookEvent{Kind: webhookBranch, Ref: "main"}); reason == "" {
+		t.Error("a branch without a branch filter should be ignored")
+	}
+}
+
+func TestServiceWebhookConfig(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+
+	st := state.NewState()
+	st.Services = []state.Service{{Name: "app", Image: "nginx:latest", InternalPort: 80, Enabled: true}}
+	h.Store.Save(context.Background(), st)
+
+	put := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/services/app/webhook", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		h.handleServiceByName(w, req)
+		return w
+	}
+	if w := put(`{}`); w.Code != http.StatusBadRequest {
+		t.Errorf("webhook without filters = %d, want 400", w.Code)
+	}
+	if w := put(`{"tags":["[bad"]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid pattern = %d, want 400", w.Code)
+	}
+	if w := put(`{"branches":["main"]}`); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "/webhook/github/app") {
+		t.Fatalf("set webhook = %d %s", w.Code, w.Body.String())
+	}
+	loaded, _ := h.Store.Load(context.Background())
+	first := loaded.Services[0].Webhook.Secret
+	if len(first) != 2*webhookSecretBytes {
+		t.Fatalf("secret = %q", first)
+	}
+
+	if w := put(`{"rotate_secret":true}`); w.Code != http.StatusOK {
+		t.Fatalf("rotate = %d %s", w.Code, w.Body.String())
+	}
+	loaded, _ = h.Store.Load(context.Background())
+	if wh := loaded.Services[0].Webhook; wh.Secret == first || len(wh.Branches) != 1 {
+		t.Errorf("rotate should replace the secret and keep filters: %+v", wh)
+	}
+}
+
+func TestDeployImageOverride(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+
+	st := state.NewState()
+	st.Services = []state.Service{
+		{ID: "web-1", Name: "web", Type: state.ServiceTypeRegistryImage, Image: "ghcr.io/acme/web:prod", InternalPort: 80, Enabled: true},
+		{ID: "api-1", Name: "api", Type: state.ServiceTypeRegistryImage, Image: "ghcr.io/acme/api:prod", InternalPort: 80, Enabled: true},
+		{ID: "site-1", Name: "site", Type: state.ServiceTypeGitBuild, Image: "tinyserve/site:abc", InternalPort: 80, Enabled: true, Build: &state.ServiceBuild{Source: "https://example.com/site.git"}},
+	}
+	h.Store.Save(context.Background(), st)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"several services", `{"services":["web","api"],"image":"ghcr.io/acme/web:sha-1"}`},
+		{"no service", `{"image":"ghcr.io/acme/web:sha-1"}`},
+		{"invalid image", `{"service":"web","image":"ghcr.io/acme/web:bad tag"}`},
+		{"git-build service", `{"service":"site","image":"ghcr.io/acme/site:sha-1"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/deploy", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			h.handleDeploy(w, req)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+
+	// A deploy that fails after the override is applied must not change the
+	// stored image.
+	useFakeDocker(h).SetBehavior("ghcr.io/acme/web:sha-1", dockertest.Unhealthy)
+	req := httptest.NewRequest(http.MethodPost, "/deploy", strings.NewReader(`{"service":"web","image":"ghcr.io/acme/web:sha-1","timeout_ms":50}`))
+	w := httptest.NewRecorder()
+	h.handleDeploy(w, req)
+	if w.Code == http.StatusOK {
+		t.Fatalf("deploy of an unhealthy image succeeded")
+	}
+	loaded, _ := h.Store.Load(context.Background())
+	if svc := findService(&loaded, "web"); svc.Image != "ghcr.io/acme/web:prod" || svc.DeployedImage != "" {
+		t.Errorf("failed deploy changed the service: image %q, deployed %q", svc.Image, svc.DeployedImage)
+	}
+}
+
+func TestMarkDeployed(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+
+	svc := state.Service{Image: "ghcr.io/acme/web@sha256:0123"}
+	now := time.Now()
+	h.markDeployed(context.Background(), &svc, now)
+	if svc.DeployedImage != svc.Image || svc.LastDeploy == nil || !svc.LastDeploy.Equal(now) {
+		t.Errorf("h.markDeployed() = %q, %v", svc.DeployedImage, svc.LastDeploy)
+	}
+}
+
+func TestHandleAddServiceSmokeCheckValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"relative path", `{"name":"a","image":"nginx:1.25","internal_port":80,"smoke_checks":[{"path":"healthz"}]}`},
+		{"absolute url", `{"name":"a","image":"nginx:1.25","internal_port":80,"smoke_checks":[{"path":"http://evil/"}]}`},
+		{"bad status", `{"name":"a","image":"nginx:1.25","internal_port":80,"smoke_checks":[{"path":"/","expect_status":42}]}`},
+		{"long timeout", `{"name":"a","image":"nginx:1.25","internal_port":80,"smoke_checks":[{"path":"/","timeout_seconds":3600}]}`},
+		{"job", `{"name":"a","type":"job","image":"busybox:1","job":{"schedule":"@daily"},"smoke_checks":[{"path":"/"}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, tmpDir := newTestHandler(t)
+			defer os.RemoveAll(tmpDir)
+			req := httptest.NewRequest(http.MethodPost, "/services", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			h.handleServices(w, req)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRunSmokeChecks(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+
+	var hosts []string
+	traefik := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts = append(hosts, r.Host+r.URL.Path)
+		if r.Host == "broken.example.com" {
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer traefik.Close()
+	h.SmokeURL = traefik.URL
+
+	st := state.State{
+		Settings: state.GlobalSettings{DefaultDomain: "example.com"},
+		Services: []state.Service{
+			{Name: "web", Enabled: true, Hostnames: []string{"a.example.com", "b.example.com"}, SmokeChecks: []state.ServiceSmokeCheck{{Path: "/healthz", BodyContains: "ok"}}},
+			{Name: "api", Enabled: true, SmokeChecks: []state.ServiceSmokeCheck{{Path: "/"}}},
+			{Name: "broken", Enabled: true, Hostnames: []string{"broken.example.com"}, SmokeChecks: []state.ServiceSmokeCheck{{Path: "/", TimeoutSeconds: 1}}},
+			{Name: "down", Enabled: true, Hostnames: []string{"broken.example.com"}, Maintenance: &state.ServiceMaintenance{}, SmokeChecks: []state.ServiceSmokeCheck{{Path: "/"}}},
+		},
+	}
+
+	if err := h.runSmokeChecks(context.Background(), st, []string{"web", "api", "down"}); err != nil {
+		t.Fatalf("runSmokeChecks: %v", err)
+	}
+	want := []string{"a.example.com/healthz", "b.example.com/healthz", "api.example.com/"}
+	if !slices.Equal(hosts, want) {
+		t.Errorf("requests = %v, want %v", hosts, want)
+	}
+
+	err := h.runSmokeChecks(context.Background(), st, []string{"broken"})
+	if err == nil || !strings.Contains(err.Error(), "502") {
+		t.Errorf("broken service err = %v, want a 502 failure", err)
+	}
+}
+
+func TestHandleAddServiceHookValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"empty command", `{"name":"a","image":"app:1","internal_port":80,"hooks":{"pre_deploy":{"command":[]}}}`},
+		{"long timeout", `{"name":"a","image":"app:1","internal_port":80,"hooks":{"post_deploy":{"command":["true"],"timeout_seconds":7200}}}`},
+		{"static site", `{"name":"a","type":"static","hooks":{"pre_deploy":{"command":["true"]}}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, tmpDir := newTestHandler(t)
+			defer os.RemoveAll(tmpDir)
+			req := httptest.NewRequest(http.MethodPost, "/services", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			h.handleServices(w, req)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRunHooks(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+
+	var calls []string
+	h.runHook = func(ctx context.Context, dir, phase, service string, command []string, w io.Writer) (int, error) {
+		calls = append(calls, phase+":"+service+":"+strings.Join(command, " "))
+		switch service {
+		case "broken":
+			fmt.Fprintln(w, "Applying migrations...")
+			fmt.Fprintln(w, "relation \"users\" already exists")
+			return 1, nil
+		case "slow":
+			<-ctx.Done()
+			return -1, ctx.Err()
+		}
+		fmt.Fprintln(w, "ok")
+		return 0, nil
+	}
+
+	hook := func(cmd string, timeout int) *state.ServiceHook {
+		return &state.ServiceHook{Command: strings.Fields(cmd), TimeoutSeconds: timeout}
+	}
+	st := state.State{Services: []state.Service{
+		{Name: "web", Enabled: true, Hooks: &state.ServiceHooks{PreDeploy: hook("./manage.py migrate", 0), PostDeploy: hook("./manage.py warm", 0)}},
+		{Name: "api", Enabled: true},
+		{Name: "broken", Enabled: true, Hooks: &state.ServiceHooks{PreDeploy: hook("migrate", 0)}},
+		{Name: "slow", Enabled: true, Hooks: &state.ServiceHooks{PreDeploy: hook("sleep 60", 1)}},
+	}}
+
+	rec := deploys.NewRecord(deploys.TriggerAPI, nil)
+	if err := h.runHooks(context.Background(), tmpDir, st, []string{"web", "api"}, deploys.PhasePreDeploy, &rec); err != nil {
+		t.Fatalf("runHooks: %v", err)
+	}
+	if len(calls) != 1 || calls[0] != "pre_deploy:web:./manage.py migrate" {
+		t.Errorf("calls = %v", calls)
+	}
+	if len(rec.Hooks) != 1 || rec.Hooks[0].Output != "ok\n" || rec.Hooks[0].Failed() {
+		t.Errorf("recorded hooks = %+v", rec.Hooks)
+	}
+
+	err := h.runHooks(context.Background(), tmpDir, st, []string{"broken", "web"}, deploys.PhasePreDeploy, &rec)
+	if err == nil || !strings.Contains(err.Error(), "pre-deploy hook for broken failed: exited with code 1: relation") {
+		t.Errorf("broken hook err = %v", err)
+	}
+	if !slices.Equal(calls[1:], []string{"pre_deploy:web:./manage.py migrate", "pre_deploy:broken:migrate"}) {
+		t.Errorf("hooks should run in service order, got %v", calls[1:])
+	}
+
+	err = h.runHooks(context.Background(), tmpDir, st, []string{"slow"}, deploys.PhasePreDeploy, &rec)
+	if err == nil || !strings.Contains(err.Error(), "timed out after 1s") {
+		t.Errorf("slow hook err = %v", err)
+	}
+}
+
+func TestDeployHistory(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+
+	rec := h.startDeploy(deploys.TriggerWebhook, []string{"web"})
+	rec.Hooks = []deploys.HookRun{{Service: "web", Phase: deploys.PhasePreDeploy, Command: []string{"migrate"}, Output: "done"}}
+	h.finishDeploy(&rec, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/deploys?service=api", nil)
+	w := httptest.NewRecorder()
+	h.handleDeploys(w, req)
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Errorf("GET /deploys?service=api = %d %s, want an empty list", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/deploys?service=web", nil)
+	w = httptest.NewRecorder()
+	h.handleDeploys(w, req)
+	var list []deploys.Record
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list) != 1 {
+		t.Fatalf("GET /deploys = %s, %v", w.Body.String(), err)
+	}
+	if list[0].Status != deploys.StatusSucceeded || list[0].Trigger != deploys.TriggerWebhook || list[0].Hooks[0].Output != "" {
+		t.Errorf("listed record = %+v, want succeeded webhook deploy without hook output", list[0])
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/deploys/"+rec.ID, nil)
+	w = httptest.NewRecorder()
+	h.handleDeploys(w, req)
+	var got deploys.Record
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || got.Hooks[0].Output != "done" {
+		t.Errorf("GET /deploys/%s = %s, %v", rec.ID, w.Body.String(), err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/deploys/nope", nil)
+	w = httptest.NewRecorder()
+	h.handleDeploys(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown deploy status = %d, want 404", w.Code)
+	}
+}
+
+func TestDeployApprovals(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+
+	var started []deploys.Record
+	h.startApproved = func(rec deploys.Record) { started = append(started, rec) }
+
+	const secret = "0123456789abcdef0123456789abcdef"
+	st := state.NewState()
+	st.Services = []state.Service{{
+		Name: "app", Type: state.ServiceTypeRegistryImage, Image: "ghcr.io/acme/app:latest", InternalPort: 80, Enabled: true,
+		RequireApproval: true, ApprovalTTL: 60,
+		Webhook: &state.ServiceWebhook{Secret: secret, ImageTags: []string{"v*"}},
+	}}
+	h.Store.Save(context.Background(), st)
+
+	push := func(tag string) deploys.Record {
+		t.Helper()
+		body := fmt.Sprintf(`{"push_data":{"tag":%q},"repository":{"repo_name":"acme/app"}}`, tag)
+		req := httptest.NewRequest(http.MethodPost, "/webhook/dockerhub/app?token="+secret, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		h.HandleProviderWebhook(w, req)
+		if w.Code != http.StatusAccepted || !strings.Contains(w.Body.String(), "pending_approval") {
+			t.Fatalf("webhook = %d %s, want 202 pending_approval", w.Code, w.Body.String())
+		}
+		var resp struct {
+			DeployID string `json:"deploy_id"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		rec, err := h.Deploys.Get(resp.DeployID)
+		if err != nil {
+			t.Fatalf("pending deploy %q: %v", resp.DeployID, err)
+		}
+		return rec
+	}
+
+	first := push("v1.0.0")
+	if first.Status != deploys.StatusPending || first.Image != "ghcr.io/acme/app:v1.0.0" || first.Source != "dockerhub image v1.0.0" {
+		t.Errorf("pending record = %+v", first)
+	}
+	if got := first.ExpiresAt.Sub(*first.RequestedAt); got != time.Hour {
+		t.Errorf("approval window = %s, want 1h", got)
+	}
+	loaded, _ := h.Store.Load(context.Background())
+	if svc := findService(&loaded, "app"); svc.Image != "ghcr.io/acme/app:latest" || svc.LastDeploy != nil {
+		t.Errorf("pending deploy touched the service: %+v", svc)
+	}
+
+	// A newer request supersedes the first one.
+	second := push("v1.1.0")
+	if rec, _ := h.Deploys.Get(first.ID); rec.Status != deploys.StatusSuperseded {
+		t.Errorf("first deploy status = %q, want superseded", rec.Status)
+	}
+
+	decide := func(handler http.HandlerFunc, id, action string, ctx context.Context) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/deploys/"+id+"/"+action, strings.NewReader(`{"reason":"looks good"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler(w, req.WithContext(ctx))
+		return w
+	}
+
+	// The web UI needs a signed-in user.
+	if w := decide(h.HandleDeployApprovals, second.ID, "approve", context.Background()); w.Code != http.StatusForbidden {
+		t.Errorf("anonymous UI approval = %d, want 403", w.Code)
+	}
+	userCtx := auth.ContextWithBrowserUser(context.Background(), &auth.BrowserUser{Email: "ops@example.com"})
+	if w := decide(h.HandleDeployApprovals, first.ID, "approve", userCtx); w.Code != http.StatusConflict {
+		t.Errorf("approving a superseded deploy = %d, want 409", w.Code)
+	}
+	if w := decide(h.HandleDeployApprovals, second.ID, "approve", userCtx); w.Code != http.StatusAccepted {
+		t.Fatalf("UI approval = %d %s, want 202", w.Code, w.Body.String())
+	}
+	if len(started) != 1 || started[0].ID != second.ID || started[0].Status != deploys.StatusRunning || started[0].DecidedBy != "ops@example.com" {
+		t.Errorf("started deploys = %+v", started)
+	}
+	if w := decide(h.handleDeploys, second.ID, "reject", context.Background()); w.Code != http.StatusConflict {
+		t.Errorf("rejecting an approved deploy = %d, want 409", w.Code)
+	}
+
+	third := push("v1.2.0")
+	if w := decide(h.handleDeploys, third.ID, "reject", context.Background()); w.Code != http.StatusOK {
+		t.Fatalf("CLI reject = %d %s", w.Code, w.Body.String())
+	}
+	if rec, _ := h.Deploys.Get(third.ID); rec.Status != deploys.StatusRejected || rec.DecidedBy != "cli" || rec.Reason != "looks good" {
+		t.Errorf("rejected record = %+v", rec)
+	}
+
+	fourth := push("v1.3.0")
+	h.expirePendingDeploys(time.Now().Add(2 * time.Hour))
+	if rec, _ := h.Deploys.Get(fourth.ID); rec.Status != deploys.StatusExpired {
+		t.Errorf("status after the approval window = %q, want expired", rec.Status)
+	}
+	if len(started) != 1 {
+		t.Errorf("expired or rejected deploys were started: %+v", started)
+	}
+}
+
+func TestHandleAddServiceApprovalValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"ttl without approval", `{"name":"a","image":"app:1","internal_port":80,"approval_ttl_minutes":30}`},
+		{"ttl too long", `{"name":"a","image":"app:1","internal_port":80,"require_approval":true,"approval_ttl_minutes":100000}`},
+		{"static site", `{"name":"a","type":"static","require_approval":true}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, tmpDir := newTestHandler(t)
+			defer os.RemoveAll(tmpDir)
+			req := httptest.NewRequest(http.MethodPost, "/services", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			h.handleServices(w, req)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestDeployFreeze(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+	h.startApproved = func(deploys.Record) { t.Error("approved deploy started during a freeze") }
+
+	const secret = "0123456789abcdef0123456789abcdef"
+	hook := &state.ServiceWebhook{Secret: secret, ImageTags: []string{"v*"}}
+	st := state.NewState()
+	st.Services = []state.Service{
+		{Name: "app", Type: state.ServiceTypeRegistryImage, Image: "ghcr.io/acme/app:latest", InternalPort: 80, Enabled: true, Webhook: hook},
+		{Name: "api", Type: state.ServiceTypeRegistryImage, Image: "ghcr.io/acme/api:latest", InternalPort: 80, Enabled: true, Webhook: hook, RequireApproval: true},
+	}
+	h.Store.Save(context.Background(), st)
+
+	put := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/settings/freeze", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		h.handleFreezeSettings(w, req)
+		return w
+	}
+	if w := put(`{"windows":[{"name":"weekend","cron":"0 17 * * fri"}]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("window without duration = %d, want 400", w.Code)
+	}
+	start := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	end := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	w := put(fmt.Sprintf(`{"windows":[{"name":"release","start":%q,"end":%q,"reason":"quarter close"}]}`, start, end))
+	var settings freezeSettings
+	json.Unmarshal(w.Body.Bytes(), &settings)
+	if w.Code != http.StatusOK || settings.Active == nil || settings.Active.Name != "release" {
+		t.Fatalf("set freeze = %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	h.handleStatus(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+	var status struct {
+		Freeze *freeze.Period `json:"freeze"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &status)
+	if status.Freeze == nil || status.Freeze.Name != "release" {
+		t.Errorf("status does not report the freeze: %s", w.Body.String())
+	}
+
+	push := func(service string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"push_data":{"tag":"v2.0.0"},"repository":{"repo_name":"acme/%s"}}`, service)
+		req := httptest.NewRequest(http.MethodPost, "/webhook/dockerhub/"+service+"?token="+secret, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		h.HandleProviderWebhook(w, req)
+		return w
+	}
+	if w := push("app"); w.Code != http.StatusLocked || !strings.Contains(w.Body.String(), "quarter close") {
+		t.Errorf("webhook during freeze = %d %s, want 423", w.Code, w.Body.String())
+	}
+	// Services behind approval queue the deploy instead, but it can't be
+	// approved until the freeze lifts.
+	w = push("api")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("approval webhook during freeze = %d %s, want 202", w.Code, w.Body.String())
+	}
+	var pending struct {
+		DeployID string `json:"deploy_id"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &pending)
+	req := httptest.NewRequest(http.MethodPost, "/deploys/"+pending.DeployID+"/approve", strings.NewReader(`{}`))
+	w = httptest.NewRecorder()
+	h.handleDeploys(w, req)
+	if w.Code != http.StatusLocked {
+		t.Errorf("approval during freeze = %d %s, want 423", w.Code, w.Body.String())
+	}
+	if rec, _ := h.Deploys.Get(pending.DeployID); rec.Status != deploys.StatusPending {
+		t.Errorf("deploy status = %q, want still pending", rec.Status)
+	}
+
+	deploy := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/deploy", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		h.handleDeploy(w, req)
+		return w
+	}
+	if w := deploy(`{"service":"app"}`); w.Code != http.StatusLocked || !strings.Contains(w.Body.String(), "--force") {
+		t.Errorf("deploy during freeze = %d %s, want 423", w.Code, w.Body.String())
+	}
+	if w := deploy(`{"service":"app","force":true}`); w.Code != http.StatusBadRequest {
+		t.Errorf("forced deploy without a reason = %d, want 400", w.Code)
+	}
+}
+
+// postDeploy runs handleDeploy with body and returns the response.
+func postDeploy(h *Handler, ctx context.Context, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/deploy", strings.NewReader(body)).WithContext(ctx)
+	w := httptest.NewRecorder()
+	h.handleDeploy(w, req)
+	return w
+}
+
+// runningImages returns the image of each container of service.
+func runningImages(t *testing.T, eng docker.Engine, service string) []string {
+	t.Helper()
+	containers, err := eng.ListContainers(context.Background(), docker.ListOptions{Service: service})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var images []string
+	for _, c := range containers {
+		images = append(images, c.Image)
+	}
+	return images
+}
+
+func TestDeployPipeline(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+	compose := useFakeDocker(h)
+	os.WriteFile(h.StatePath, []byte("{}"), 0o600)
+	ctx := context.Background()
+
+	st := state.NewState()
+	st.Services = []state.Service{
+		{ID: "web-1", Name: "web", Type: state.ServiceTypeRegistryImage, Image: "ghcr.io/acme/web:v1", InternalPort: 80, Enabled: true, Replicas: 2},
+	}
+	h.Store.Save(ctx, st)
+	compose.Engine.AddImage(docker.Image{ID: "sha256:v1", RepoTags: []string{"ghcr.io/acme/web:v1"}, RepoDigests: []string{"ghcr.io/acme/web@sha256:aaa"}})
+
+	if w := postDeploy(h, ctx, `{"service":"web"}`); w.Code != http.StatusOK {
+		t.Fatalf("first deploy = %d %s", w.Code, w.Body.String())
+	}
+	if got := runningImages(t, h.Docker, "web"); !slices.Equal(got, []string{"ghcr.io/acme/web:v1", "ghcr.io/acme/web:v1"}) {
+		t.Fatalf("running after deploy = %v, want two v1 replicas", got)
+	}
+	loaded, _ := h.Store.Load(ctx)
+	if svc := findService(&loaded, "web"); svc.DeployedImage != "ghcr.io/acme/web:v1@sha256:aaa" || svc.LastDeploy == nil {
+		t.Errorf("deployed image = %q, want the pulled digest", svc.DeployedImage)
+	}
+	if !slices.Equal(compose.Calls(), []string{"pull web", "up web"}) {
+		t.Errorf("compose calls = %v", compose.Calls())
+	}
+
+	// Failing deploys roll back to the promoted config and leave the state alone.
+	failures := []struct {
+		name     string
+		image    string
+		behavior dockertest.Behavior
+		ctx      func() (context.Context, context.CancelFunc)
+		want     string
+	}{
+		{"unhealthy", "ghcr.io/acme/web:v2", dockertest.Unhealthy, nil, "health check failed, rolled back"},
+		{"crash loop", "ghcr.io/acme/web:v3", dockertest.CrashLoop, nil, "health check failed, rolled back"},
+		{"slow pull", "ghcr.io/acme/web:v4", dockertest.SlowPull, func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(ctx, 50*time.Millisecond)
+		}, "docker pull"},
+	}
+	for _, tc := range failures {
+		t.Run(tc.name, func(t *testing.T) {
+			compose.SetBehavior(tc.image, tc.behavior)
+			reqCtx, cancel := context.WithCancel(ctx)
+			if tc.ctx != nil {
+				reqCtx, cancel = tc.ctx()
+			}
+			defer cancel()
+			w := postDeploy(h, reqCtx, `{"service":"web","image":"`+tc.image+`","timeout_ms":50}`)
+			if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), tc.want) {
+				t.Fatalf("deploy = %d %s, want 500 %q", w.Code, w.Body.String(), tc.want)
+			}
+			if got := runningImages(t, h.Docker, "web"); !slices.Equal(got, []string{"ghcr.io/acme/web:v1", "ghcr.io/acme/web:v1"}) {
+				t.Errorf("running after failed deploy = %v, want v1 restored", got)
+			}
+			current, _ := os.ReadFile(filepath.Join(h.currentDir(), "docker-compose.yml"))
+			if strings.Contains(string(current), tc.image) {
+				t.Errorf("failed deploy of %s was promoted", tc.image)
+			}
+			loaded, _ := h.Store.Load(ctx)
+			if svc := findService(&loaded, "web"); svc.Image != "ghcr.io/acme/web:v1" {
+				t.Errorf("stored image = %q after failed deploy", svc.Image)
+			}
+		})
+	}
+
+	// A slow pull that finishes in time deploys.
+	compose.PullDelay = 10 * time.Millisecond
+	if w := postDeploy(h, ctx, `{"service":"web","image":"ghcr.io/acme/web:v4"}`); w.Code != http.StatusOK {
+		t.Fatalf("slow pull deploy = %d %s", w.Code, w.Body.String())
+	}
+	if got := runningImages(t, h.Docker, "web"); len(got) != 2 || got[0] != "ghcr.io/acme/web:v4" {
+		t.Fatalf("running after slow pull = %v, want v4", got)
+	}
+
+	// IDs only order deploys to the second, so count rather than compare.
+	list, _ := h.Deploys.List("web")
+	statuses := make(map[string]int)
+	for _, rec := range list {
+		statuses[rec.Status]++
+	}
+	if statuses[deploys.StatusSucceeded] != 2 || statuses[deploys.StatusFailed] != 3 {
+		t.Errorf("deploy history = %v, want 2 succeeded and 3 failed", statuses)
+	}
+
+	// A manual rollback restores the previous promoted config.
+	req := httptest.NewRequest(http.MethodPost, "/rollback", nil)
+	w := httptest.NewRecorder()
+	h.handleRollback(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("rollback = %d %s", w.Code, w.Body.String())
+	}
+	if got := runningImages(t, h.Docker, "web"); len(got) != 2 || got[0] != "ghcr.io/acme/web:v1" {
+		t.Errorf("running after rollback = %v, want v1", got)
+	}
+	if calls := compose.Calls(); calls[len(calls)-1] != "up" {
+		t.Errorf("rollback ran %q, want a full up", calls[len(calls)-1])
+	}
+
+	// A full deploy runs the smoke checks of every started service.
+	traefik := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}))
+	defer traefik.Close()
+	h.SmokeURL = traefik.URL
+	loaded, _ = h.Store.Load(ctx)
+	svc := findService(&loaded, "web")
+	svc.Image = "ghcr.io/acme/web:v5"
+	svc.Hostnames = []string{"web.example.com"}
+	svc.SmokeChecks = []state.ServiceSmokeCheck{{Path: "/", TimeoutSeconds: 1}}
+	h.Store.Save(ctx, loaded)
+	if w := postDeploy(h, ctx, `{}`); w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "smoke check failed, rolled back") {
+		t.Fatalf("full deploy with failing smoke check = %d %s", w.Code, w.Body.String())
+	}
+	if got := runningImages(t, h.Docker, "web"); len(got) != 2 || got[0] != "ghcr.io/acme/web:v1" {
+		t.Errorf("running after failed smoke check = %v, want v1 restored", got)
+	}
+	if current, _ := os.ReadFile(filepath.Join(h.currentDir(), "docker-compose.yml")); strings.Contains(string(current), "web:v5") {
+		t.Error("full deploy that failed its smoke check was promoted")
+	}
+}
+
+func TestContainerStatusFromRuntime(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+	compose := useFakeDocker(h)
+	os.WriteFile(h.StatePath, []byte("{}"), 0o600)
+	ctx := context.Background()
+
+	st := state.NewState()
+	st.Services = []state.Service{
+		{ID: "web-1", Name: "web", Type: state.ServiceTypeRegistryImage, Image: "ghcr.io/acme/web:v1", InternalPort: 80, Enabled: true},
+	}
+	h.Store.Save(ctx, st)
+	if w := postDeploy(h, ctx, `{}`); w.Code != http.StatusOK {
+		t.Fatalf("deploy = %d %s", w.Code, w.Body.String())
+	}
+
+	status, err := h.containerStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	web, ok := status["web"]
+	if !ok || !containerHealthy(web) || web.StartedAt == nil {
+		t.Fatalf("web status = %+v", web)
+	}
+	if _, ok := status["traefik"]; !ok {
+		t.Errorf("a full deploy should start traefik: %v", status)
+	}
+
+	compose.Engine.SetState(web.Name, "restarting", "")
+	status, _ = h.containerStatus(ctx)
+	if containerHealthy(status["web"]) {
+		t.Errorf("restarting container reported healthy")
+	}
+}
+
+func TestRuntimeSettings(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+
+	put := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/settings/runtime", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		h.handleRuntimeSettings(w, req)
+		return w
+	}
+	if w := put(`{"runtime":"containerd"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown runtime = %d, want 400", w.Code)
+	}
+
+	w := put(`{"runtime":"podman"}`)
+	var got runtimeSettings
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("PUT = %d %s", w.Code, w.Body.String())
+	}
+	if got.Runtime != "podman" || got.Active.Name != docker.PlatformDocker || !got.RestartRequired {
+		t.Errorf("after switching to podman = %+v, want a pending restart", got)
+	}
+	st, _ := h.Store.Load(context.Background())
+	if st.Settings.ContainerRuntime != "podman" {
+		t.Errorf("stored runtime = %q", st.Settings.ContainerRuntime)
+	}
+
+	w = put(`{"runtime":"docker"}`)
+	json.Unmarshal(w.Body.Bytes(), &got)
+	if got.Runtime != "docker" || got.RestartRequired {
+		t.Errorf("back to docker = %+v", got)
+	}
+	st, _ = h.Store.Load(context.Background())
+	if st.Settings.ContainerRuntime != "" {
+		t.Errorf("docker should be stored as the default, got %q", st.Settings.ContainerRuntime)
+	}
+}
+
+func TestEventWatcher(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+	compose := useFakeDocker(h)
+	os.WriteFile(h.StatePath, []byte("{}"), 0o600)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	st := state.NewState()
+	st.Services = []state.Service{
+		{ID: "web-1", Name: "web", Type: state.ServiceTypeRegistryImage, Image: "ghcr.io/acme/web:v1", InternalPort: 80, Enabled: true},
+	}
+	h.Store.Save(ctx, st)
+	if w := postDeploy(h, ctx, `{}`); w.Code != http.StatusOK {
+		t.Fatalf("deploy = %d %s", w.Code, w.Body.String())
+	}
+	project := docker.ProjectName(h.currentDir())
+
+	h.StartEventWatcher(ctx)
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		for deadline := time.Now().Add(2 * time.Second); !cond(); time.Sleep(5 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+		}
+	}
+	waitFor("the status cache", func() bool {
+		_, ok := h.status.get(project)
+		return ok
+	})
+
+	srv := httptest.NewServer(http.HandlerFunc(h.handleEvents))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "?follow=1&service=web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type = %q", ct)
+	}
+
+	// A change without an event is not seen until the cache is refreshed.
+	web := runningContainer(t, h.Docker, "web")
+	compose.Engine.SetState(web.Name, "exited", "")
+	if status, _ := h.containerStatus(ctx); status["web"].State != "running" {
+		t.Fatalf("status = %+v, want the cached running container", status["web"])
+	}
+
+	attrs := map[string]string{docker.LabelProject: project, docker.LabelService: "web", "exitCode": "137"}
+	compose.Engine.Emit(docker.Event{Type: "container", Action: "oom", ID: web.ID, Name: web.Name, Service: "web", Attributes: attrs})
+	compose.Engine.Emit(docker.Event{Type: "container", Action: "die", ID: web.ID, Name: web.Name, Service: "web", Attributes: attrs})
+	waitFor("the crash to reach the cache", func() bool {
+		status, _ := h.containerStatus(ctx)
+		_, running := status["web"]
+		return !running
+	})
+
+	sc := bufio.NewScanner(resp.Body)
+	var streamed []state.ServiceEvent
+	for len(streamed) < 2 && sc.Scan() {
+		if data, ok := strings.CutPrefix(sc.Text(), "data: "); ok {
+			var ev state.ServiceEvent
+			if err := json.Unmarshal([]byte(data), &ev); err != nil {
+				t.Fatalf("event %q: %v", data, err)
+			}
+			streamed = append(streamed, ev)
+		}
+	}
+	if len(streamed) != 2 || streamed[0].Action != state.EventOOM || streamed[1].Action != state.EventDie {
+		t.Fatalf("streamed = %+v", streamed)
+	}
+	if streamed[1].ExitCode == nil || *streamed[1].ExitCode != 137 || streamed[1].Container != web.Name || streamed[1].ID == 0 {
+		t.Errorf("die event = %+v", streamed[1])
+	}
+
+	// Replays start after Last-Event-ID.
+	req := httptest.NewRequest(http.MethodGet, "/events?service=web", nil)
+	req.Header.Set("Last-Event-ID", strconv.FormatInt(streamed[0].ID, 10))
+	w := httptest.NewRecorder()
+	h.handleEvents(w, req)
+	if body := w.Body.String(); strings.Count(body, "data: ") != 1 || !strings.Contains(body, `"action":"die"`) {
+		t.Errorf("replay after %d = %q", streamed[0].ID, body)
+	}
+}
+
+// runningContainer returns the first running container of service.
+func runningContainer(t *testing.T, eng docker.Engine, service string) docker.Container {
+	t.Helper()
+	containers, err := eng.ListContainers(context.Background(), docker.ListOptions{Service: service})
+	if err != nil || len(containers) == 0 {
+		t.Fatalf("no running %s container: %v", service, err)
+	}
+	return containers[0]
+}
+
+func TestServiceEvent(t *testing.T) {
+	cases := []struct {
+		ev     docker.Event
+		action string
+		health string
+	}{
+		{docker.Event{Action: "health_status: unhealthy", Service: "web"}, state.EventHealthStatus, "unhealthy"},
+		{docker.Event{Action: "health_status", Service: "web", Attributes: map[string]string{"health_status": "healthy"}}, state.EventHealthStatus, "healthy"},
+		{docker.Event{Action: "restart", Service: "web"}, state.EventRestart, ""},
+		{docker.Event{Action: "start", Service: "web"}, "", ""},
+		{docker.Event{Action: "exec_start: /bin/sh -c curl", Service: "web"}, "", ""},
+		{docker.Event{Action: "die"}, "", ""},
+	}
+	for _, tc := range cases {
+		se, ok := serviceEvent(tc.ev)
+		if ok != (tc.action != "") || se.Action != tc.action || se.Health != tc.health {
+			t.Errorf("serviceEvent(%q) = %+v, %v", tc.ev.Action, se, ok)
+		}
+	}
+}
+
+func TestServiceMetrics(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+	compose := useFakeDocker(h)
+	os.WriteFile(h.StatePath, []byte("{}"), 0o600)
+	ctx := context.Background()
+
+	st := state.NewState()
+	st.Services = []state.Service{
+		{ID: "web-1", Name: "Web", Type: state.ServiceTypeRegistryImage, Image: "ghcr.io/acme/web:v1", InternalPort: 80, Enabled: true, Replicas: 2},
+	}
+	h.Store.Save(ctx, st)
+	if w := postDeploy(h, ctx, `{}`); w.Code != http.StatusOK {
+		t.Fatalf("deploy = %d %s", w.Code, w.Body.String())
+	}
+	containers, _ := h.Docker.ListContainers(ctx, docker.ListOptions{Service: "web"})
+	if len(containers) != 2 {
+		t.Fatalf("web containers = %+v", containers)
+	}
+
+	now := time.Now().Add(-time.Minute)
+	for _, c := range containers {
+		compose.Engine.SetStats(c.ID, docker.Stats{Read: now, CPUPercent: 25, MemoryBytes: 100 << 20, MemoryLimitBytes: 512 << 20, NetworkRxBytes: 1000})
+	}
+	h.sampleMetrics(ctx, now)
+	later := now.Add(15 * time.Second)
+	for _, c := range containers {
+		compose.Engine.SetStats(c.ID, docker.Stats{Read: later, CPUPercent: 50, MemoryBytes: 150 << 20, MemoryLimitBytes: 512 << 20, NetworkRxBytes: 4000})
+	}
+	h.sampleMetrics(ctx, later)
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/services/web/metrics"+query, nil)
+		w := httptest.NewRecorder()
+		h.handleServiceByName(w, req)
+		return w
+	}
+	w := get("?range=1h")
+	var resp metricsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("GET metrics = %d %s", w.Code, w.Body.String())
+	}
+	if resp.Service != "Web" || resp.StepSeconds != 15 || len(resp.Points) != 2 {
+		t.Fatalf("metrics = %+v", resp)
+	}
+	first, last := resp.Points[0], resp.Points[1]
+	if first.CPUPercent != 50 || first.MemoryBytes != 200<<20 || first.Containers != 2 || first.NetworkRxRate != 0 {
+		t.Errorf("first sample = %+v, want replicas summed and no rate yet", first)
+	}
+	if last.CPUPercent != 100 || last.MemoryLimitBytes != 512<<20 || last.NetworkRxRate != 400 {
+		t.Errorf("second sample = %+v, want 2 x 3000 bytes over 15s", last)
+	}
+
+	if w := get("?range=7d"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"step_seconds": 300`) {
+		t.Errorf("7d range = %d %s", w.Code, w.Body.String())
+	}
+	if w := get("?range=1y"); w.Code != http.StatusBadRequest {
+		t.Errorf("bad range = %d", w.Code)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/services/api/metrics", nil)
+	w = httptest.NewRecorder()
+	h.handleServiceActionReadOnly(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown service = %d", w.Code)
+	}
+}
+
+func TestCrashTracker(t *testing.T) {
+	tr := newCrashTracker()
+	policy := state.ServiceCrashPolicy{Action: state.CrashActionAlert, MaxRestarts: 3, WindowMinutes: 10}
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	send := func(id, action string, at time.Time) bool {
+		return tr.observe(docker.Event{Type: "container", Action: action, ID: id, Service: "web", Time: at})
+	}
+
+	// Docker stops with kill, die, stop; Podman with die, stop. Neither a
+	// later start nor a manual restart is a crash.
+	for _, seq := range [][]string{{"kill", "die", "stop", "start"}, {"die", "stop", "start"}, {"kill", "die", "start"}} {
+		for _, action := range seq {
+			if send("a", action, start) {
+				t.Errorf("%v counted as a restart", seq)
+			}
+		}
+	}
+	if tr.info("web", policy, start) != nil {
+		t.Error("stopped container has crash info")
+	}
+
+	// The restart policy starts a crashed container again.
+	send("a", "oom", start)
+	send("a", "die", start)
+	if !send("a", "start", start) {
+		t.Fatal("die then start was not a restart")
+	}
+	for i := 1; i < 3; i++ {
+		at := start.Add(time.Duration(i) * time.Minute)
+		send("a", "die", at)
+		send("a", "start", at)
+	}
+	n, loop := tr.check("web", policy, start.Add(3*time.Minute))
+	if n != 3 || !loop {
+		t.Fatalf("check = %d, %v; want a loop of 3", n, loop)
+	}
+	if _, loop := tr.check("web", policy, start.Add(3*time.Minute)); loop {
+		t.Error("loop was reported twice")
+	}
+	info := tr.info("web", policy, start.Add(3*time.Minute))
+	if info == nil || !info.Looping || info.Restarts != 3 || info.OOMKills != 1 || !info.LastRestart.Equal(start.Add(2*time.Minute)) {
+		t.Errorf("info = %+v", info)
+	}
+
+	// Restarts age out of the window; the total stays.
+	info = tr.info("web", policy, start.Add(11*time.Minute+30*time.Second))
+	if info.Looping || info.RecentRestarts != 1 || info.Restarts != 3 {
+		t.Errorf("info after window = %+v", info)
+	}
+	tr.settle("web")
+	if info := tr.info("web", policy, start.Add(11*time.Minute)); info.RecentRestarts != 0 {
+		t.Errorf("info after settle = %+v", info)
+	}
+	send("a", "destroy", start)
+	if len(tr.containers) != 0 {
+		t.Errorf("destroyed container still tracked")
+	}
+}
+
+func TestCrashLoopPolicies(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+	compose := useFakeDocker(h)
+	os.WriteFile(h.StatePath, []byte("{}"), 0o600)
+	ctx := context.Background()
+
+	received := make(chan notify.Event, 4)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev notify.Event
+		json.NewDecoder(r.Body).Decode(&ev)
+		received <- ev
+	}))
+	defer hook.Close()
+
+	st := state.NewState()
+	st.Settings.Notifications.WebhookURL = hook.URL
+	st.Services = []state.Service{
+		{ID: "web-1", Name: "web", Type: state.ServiceTypeRegistryImage, Image: "ghcr.io/acme/web:v1", InternalPort: 80, Enabled: true,
+			CrashPolicy: &state.ServiceCrashPolicy{Action: state.CrashActionRollback, MaxRestarts: 2}},
+		{ID: "api-1", Name: "api", Type: state.ServiceTypeRegistryImage, Image: "ghcr.io/acme/api:v1", InternalPort: 80, Enabled: true,
+			CrashPolicy: &state.ServiceCrashPolicy{Action: state.CrashActionStop, MaxRestarts: 2}},
+	}
+	h.Store.Save(ctx, st)
+	if w := postDeploy(h, ctx, `{}`); w.Code != http.StatusOK {
+		t.Fatalf("deploy = %d %s", w.Code, w.Body.String())
+	}
+	if w := postDeploy(h, ctx, `{"service":"web","image":"ghcr.io/acme/web:v2"}`); w.Code != http.StatusOK {
+		t.Fatalf("deploy v2 = %d %s", w.Code, w.Body.String())
+	}
+	loaded, _ := h.Store.Load(ctx)
+	if svc := findService(&loaded, "web"); !strings.HasPrefix(svc.PreviousImage, "ghcr.io/acme/web:v1") {
+		t.Fatalf("previous image = %q, want v1", svc.PreviousImage)
+	}
+
+	crash := func(service string) {
+		c := runningContainer(t, h.Docker, service)
+		for range 2 {
+			for _, action := range []string{"die", "start"} {
+				if h.crashes.observe(docker.Event{Type: "container", Action: action, ID: c.ID, Name: c.Name, Service: service}) {
+					h.checkCrashLoop(ctx, service, time.Now())
+				}
+			}
+		}
+	}
+
+	crash("web")
+	if got := runningImages(t, h.Docker, "web"); len(got) != 1 || !strings.HasPrefix(got[0], "ghcr.io/acme/web:v1") {
+		t.Errorf("running after crash loop = %v, want v1", got)
+	}
+	loaded, _ = h.Store.Load(ctx)
+	if svc := findService(&loaded, "web"); !strings.HasPrefix(svc.Image, "ghcr.io/acme/web:v1") || svc.PreviousImage != "" {
+		t.Errorf("after rollback image = %q, previous = %q", svc.Image, svc.PreviousImage)
+	}
+	ev := <-received
+	if ev.Kind != notify.KindCrashLoop || ev.Service != "web" || ev.Details["action"] != "rollback" || !strings.HasPrefix(ev.Details["to"], "ghcr.io/acme/web:v1") {
+		t.Errorf("rollback notification = %+v", ev)
+	}
+
+	// A second loop has nothing left to roll back to and only alerts.
+	crash("web")
+	if ev := <-received; ev.Details["error"] != errNoRollbackImage.Error() {
+		t.Errorf("second loop notification = %+v", ev)
+	}
+
+	crash("api")
+	if ev := <-received; ev.Service != "api" || !strings.Contains(ev.Text, "stopped it") || !strings.Contains(ev.Text, "tinyserve service start api") {
+		t.Errorf("stop notification = %+v", ev)
+	}
+	if calls := compose.Calls(); calls[len(calls)-1] != "stop api" {
+		t.Errorf("last compose call = %q, want stop api", calls[len(calls)-1])
+	}
+	// The stop is remembered, so a deploy keeps the service down.
+	loaded, _ = h.Store.Load(ctx)
+	if svc := findService(&loaded, "api"); !svc.Stopped {
+		t.Error("api not marked stopped after the crash loop")
+	}
+	if w := postDeploy(h, ctx, `{}`); w.Code != http.StatusOK {
+		t.Fatalf("deploy after stop = %d %s", w.Code, w.Body.String())
+	}
+	if got := runningImages(t, h.Docker, "api"); len(got) != 0 {
+		t.Errorf("api running after deploy = %v, want stopped", got)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/services", nil)
+	w := httptest.NewRecorder()
+	h.handleServices(w, req)
+	var services []serviceResponse
+	if err := json.NewDecoder(w.Body).Decode(&services); err != nil {
+		t.Fatal(err)
+	}
+	for _, svc := range services {
+		switch svc.Name {
+		case "web":
+			// Not settled, since the rollback failed.
+			if svc.Status != "crash-looping" || svc.Crash == nil || svc.Crash.Restarts != 4 || !svc.Crash.Looping {
+				t.Errorf("web = %s %+v", svc.Status, svc.Crash)
+			}
+		case "api":
+			if svc.Status == "crash-looping" || svc.Crash == nil || svc.Crash.Restarts != 2 || svc.Crash.Looping {
+				t.Errorf("api = %s %+v", svc.Status, svc.Crash)
+			}
+		}
+	}
+}
+
+func TestValidateCrashPolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		svc  state.Service
+		ok   bool
+	}{
+		{"default", state.Service{CrashPolicy: &state.ServiceCrashPolicy{}}, true},
+		{"rollback image", state.Service{Type: state.ServiceTypeRegistryImage, CrashPolicy: &state.ServiceCrashPolicy{Action: "rollback"}}, true},
+		{"rollback build", state.Service{Type: state.ServiceTypeGitBuild, CrashPolicy: &state.ServiceCrashPolicy{Action: "rollback"}}, false},
+		{"stop build", state.Service{Type: state.ServiceTypeGitBuild, CrashPolicy: &state.ServiceCrashPolicy{Action: "stop"}}, true},
+		{"unknown action", state.Service{CrashPolicy: &state.ServiceCrashPolicy{Action: "restart"}}, false},
+		{"job", state.Service{Type: state.ServiceTypeJob, CrashPolicy: &state.ServiceCrashPolicy{}}, false},
+		{"window too long", state.Service{CrashPolicy: &state.ServiceCrashPolicy{WindowMinutes: 2000}}, false},
+	}
+	for _, tc := range tests {
+		if err := validateCrashPolicy(tc.svc); (err == nil) != tc.ok {
+			t.Errorf("%s: err = %v", tc.name, err)
+		}
+	}
+}
+
+func TestExecSessions(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+	compose := useFakeDocker(h)
+	ctx := context.Background()
+
+	admin, _ := auth.GenerateToken()
+	adminHash, _ := auth.HashToken(admin)
+	deployer, _ := auth.GenerateToken()
+	deployerHash, _ := auth.HashToken(deployer)
+	scoped, _ := auth.GenerateToken()
+	scopedHash, _ := auth.HashToken(scoped)
+	st, _ := h.Store.Load(ctx)
+	st.Services = append(st.Services, state.Service{Name: "web", Image: "nginx:1", Enabled: true})
+	st.Tokens = append(st.Tokens,
+		state.APIToken{ID: "t1", Name: "ops", Hash: adminHash, Admin: true},
+		state.APIToken{ID: "t2", Name: "ci", Hash: deployerHash},
+		state.APIToken{ID: "t3", Name: "api-ops", Hash: scopedHash, Admin: true, Services: []string{"api"}},
+	)
+	h.Store.Save(ctx, st)
+
+	current := h.currentDir()
+	os.MkdirAll(current, 0o755)
+	os.WriteFile(filepath.Join(current, "docker-compose.yml"), []byte("name: apps\nservices: {}\n"), 0o644)
+	compose.Engine.AddContainer(docker.ContainerDetails{Container: docker.Container{ID: "c1", Project: "apps", Service: "web"}})
+	compose.Engine.ExecFunc = func(c docker.Container, opts docker.ExecOptions) int {
+		input, _ := io.ReadAll(opts.Stdin)
+		fmt.Fprintf(opts.Stdout, "%s in %s: %s", strings.Join(opts.Cmd, " "), c.ID, input)
+		if opts.Tty {
+			select {
+			case size := <-opts.Resize:
+				fmt.Fprintf(opts.Stdout, " at %dx%d", size.Cols, size.Rows)
+			default:
+			}
+		} else {
+			io.WriteString(opts.Stderr, "warning")
+		}
+		return 7
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(h.HandleWebhookServices))
+	defer srv.Close()
+	dial := func(token, path string) (*websocket.Conn, error) {
+		return websocket.Dial(ctx, srv.URL+path, http.Header{"Authorization": {"Bearer " + token}})
+	}
+	// session sends input and returns stdout, stderr and the final control
+	// message.
+	session := func(conn *websocket.Conn, input string) (string, string, execControl) {
+		t.Helper()
+		defer conn.Close()
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"resize","rows":24,"cols":80}`))
+		conn.WriteMessage(websocket.BinaryMessage, append([]byte{streamStdin}, input...))
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"eof"}`))
+		var stdout, stderr strings.Builder
+		for {
+			typ, data, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			if typ == websocket.BinaryMessage {
+				if data[0] == streamStdout {
+					stdout.Write(data[1:])
+				} else {
+					stderr.Write(data[1:])
+				}
+				continue
+			}
+			var msg execControl
+			json.Unmarshal(data, &msg)
+			return stdout.String(), stderr.String(), msg
+		}
+	}
+
+	for _, tc := range []struct {
+		token, path string
+		status      int
+	}{
+		{deployer, "/services/web/exec?cmd=sh", http.StatusForbidden},
+		{scoped, "/services/web/exec?cmd=sh", http.StatusForbidden},
+		{"not-a-token", "/services/web/exec?cmd=sh", http.StatusUnauthorized},
+		{admin, "/services/web/exec", http.StatusBadRequest},
+		{admin, "/services/web/run?cmd=sh&tty=1", http.StatusBadRequest},
+		{admin, "/services/missing/exec?cmd=sh", http.StatusNotFound},
+	} {
+		_, err := dial(tc.token, tc.path)
+		var hs *websocket.HandshakeError
+		if !errors.As(err, &hs) || hs.Status != tc.status {
+			t.Errorf("%s = %v, want status %d", tc.path, err, tc.status)
+		}
+	}
+
+	conn, err := dial(admin, "/services/web/exec?cmd=cat&cmd=-n&stdin=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr, end := session(conn, "hello")
+	if stdout != "cat -n in c1: hello" || stderr != "warning" {
+		t.Errorf("exec stdout = %q, stderr = %q", stdout, stderr)
+	}
+	if end.Type != "exit" || end.Code == nil || *end.Code != 7 {
+		t.Errorf("exec ended with %+v, want exit 7", end)
+	}
+
+	conn, err = dial(admin, "/services/web/exec?cmd=sh&stdin=1&tty=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdout, _, _ := session(conn, "ls"); stdout != "sh in c1: ls at 80x24" {
+		t.Errorf("tty exec stdout = %q, want the resize applied", stdout)
+	}
+
+	conn, err = dial(admin, "/services/web/run?cmd=migrate&stdin=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdout, _, end := session(conn, "input"); stdout != "input" || end.Type != "exit" || *end.Code != 0 {
+		t.Errorf("run = %q, %+v", stdout, end)
+	}
+	if calls := compose.Calls(); !slices.Contains(calls, "run web migrate") {
+		t.Errorf("compose calls = %v, want a one-off run", calls)
+	}
+
+	compose.Engine.SetState("c1", "exited", "")
+	if _, err := dial(admin, "/services/web/exec?cmd=sh"); err == nil || !strings.Contains(err.Error(), "no running container") {
+		t.Errorf("exec without a container = %v", err)
+	}
+
+	entries, _ := h.Audit.ListAudit(ctx, state.AuditFilter{})
+	if len(entries) != 3 {
+		t.Fatalf("audit log has %d entries, want one per session", len(entries))
+	}
+	first := entries[0]
+	if first.Actor != "ops" || first.Action != state.AuditExec || first.Service != "web" ||
+		!slices.Equal(first.Command, []string{"cat", "-n"}) || first.ExitCode == nil || *first.ExitCode != 7 {
+		t.Errorf("audit entry = %+v", first)
+	}
+	if !entries[1].TTY || entries[2].Action != state.AuditRun {
+		t.Errorf("audit entries = %+v", entries[1:])
+	}
+
+	w := httptest.NewRecorder()
+	h.handleAudit(w, httptest.NewRequest(http.MethodGet, "/audit?limit=1", nil))
+	var listed []state.AuditEntry
+	json.Unmarshal(w.Body.Bytes(), &listed)
+	if w.Code != http.StatusOK || len(listed) != 1 || listed[0].Action != state.AuditRun {
+		t.Errorf("GET /audit?limit=1 = %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestServiceLifecycle(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+	compose := useFakeDocker(h)
+	os.WriteFile(h.StatePath, []byte("{}"), 0o600)
+	ctx := context.Background()
+
+	st := state.NewState()
+	st.Services = []state.Service{
+		{ID: "web-1", Name: "web", Type: state.ServiceTypeRegistryImage, Image: "ghcr.io/acme/web:v1", InternalPort: 80, Enabled: true},
+		{ID: "api-1", Name: "api", Type: state.ServiceTypeRegistryImage, Image: "ghcr.io/acme/api:v1", InternalPort: 80, Enabled: true},
+	}
+	h.Store.Save(ctx, st)
+
+	post := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		w := httptest.NewRecorder()
+		h.handleServiceByName(w, req)
+		return w
+	}
+	if w := post("/services/web/stop"); w.Code != http.StatusConflict {
+		t.Fatalf("stop before any deploy = %d %s", w.Code, w.Body.String())
+	}
+	if w := postDeploy(h, ctx, `{}`); w.Code != http.StatusOK {
+		t.Fatalf("deploy = %d %s", w.Code, w.Body.String())
+	}
+
+	if w := post("/services/web/stop"); w.Code != http.StatusOK {
+		t.Fatalf("stop = %d %s", w.Code, w.Body.String())
+	}
+	if got := runningImages(t, h.Docker, "web"); len(got) != 0 {
+		t.Errorf("running after stop = %v", got)
+	}
+	loaded, _ := h.Store.Load(ctx)
+	if !findService(&loaded, "web").Stopped {
+		t.Error("stop was not recorded")
+	}
+	if got := StoppedScaleArgs(loaded); !slices.Equal(got, []string{"--scale", "web=0"}) {
+		t.Errorf("StoppedScaleArgs = %v", got)
+	}
+	if w := post("/services/web/restart"); w.Code != http.StatusConflict {
+		t.Errorf("restart of a stopped service = %d %s", w.Code, w.Body.String())
+	}
+
+	// Deploys leave the stopped service down but keep its new config.
+	if w := postDeploy(h, ctx, `{}`); w.Code != http.StatusOK {
+		t.Fatalf("full deploy = %d %s", w.Code, w.Body.String())
+	}
+	if w := postDeploy(h, ctx, `{"service":"web","image":"ghcr.io/acme/web:v2"}`); w.Code != http.StatusOK {
+		t.Fatalf("deploy of stopped service = %d %s", w.Code, w.Body.String())
+	}
+	if got := runningImages(t, h.Docker, "web"); len(got) != 0 {
+		t.Errorf("running after deploys = %v, want web still stopped", got)
+	}
+	if got := runningImages(t, h.Docker, "api"); len(got) != 1 {
+		t.Errorf("api running = %v", got)
+	}
+
+	if w := post("/services/web/start"); w.Code != http.StatusOK {
+		t.Fatalf("start = %d %s", w.Code, w.Body.String())
+	}
+	if got := runningImages(t, h.Docker, "web"); !slices.Equal(got, []string{"ghcr.io/acme/web:v2"}) {
+		t.Errorf("running after start = %v, want the deployed v2", got)
+	}
+	loaded, _ = h.Store.Load(ctx)
+	if findService(&loaded, "web").Stopped {
+		t.Error("start did not clear Stopped")
+	}
+
+	before := runningContainer(t, h.Docker, "web")
+	if w := post("/services/web/restart"); w.Code != http.StatusOK {
+		t.Fatalf("restart = %d %s", w.Code, w.Body.String())
+	}
+	if after := runningContainer(t, h.Docker, "web"); after.ID != before.ID {
+		t.Errorf("restart replaced container %s with %s", before.ID, after.ID)
+	}
+	if calls := compose.Calls(); calls[len(calls)-1] != "restart web" {
+		t.Errorf("last compose call = %q, want restart web", calls[len(calls)-1])
+	}
+
+	if w := post("/services/nope/start"); w.Code != http.StatusNotFound {
+		t.Errorf("start of unknown service = %d", w.Code)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/services/web/restart", nil)
+	w := httptest.NewRecorder()
+	h.handleServiceByName(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET restart = %d", w.Code)
+	}
+}
+
+func TestLogCollectorAndQuery(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+	useFakeDocker(h)
+	os.WriteFile(h.StatePath, []byte("{}"), 0o600)
+	ctx := context.Background()
+
+	st := state.NewState()
+	st.Services = []state.Service{
+		{ID: "web-1", Name: "web", Type: state.ServiceTypeRegistryImage, Image: "ghcr.io/acme/web:v1", InternalPort: 80, Enabled: true},
+		{ID: "worker-1", Name: "worker", Type: state.ServiceTypeRegistryImage, Image: "ghcr.io/acme/worker:v1", InternalPort: 80, Enabled: true},
+	}
+	h.Store.Save(ctx, st)
+	if w := postDeploy(h, ctx, `{}`); w.Code != http.StatusOK {
+		t.Fatalf("deploy = %d %s", w.Code, w.Body.String())
+	}
+	base := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	ts := func(d time.Duration) string { return base.Add(d).Format(time.RFC3339Nano) }
+	logs := map[string]string{
+		"web":    ts(0) + " GET / 200\n" + ts(2*time.Second) + " ERROR: upstream timed out\n",
+		"worker": ts(time.Second) + ` {"level":"warn","msg":"slow query"}` + "\n" + ts(3*time.Second) + " level=debug msg=tick\n",
+	}
+	containers, _ := h.Docker.ListContainers(ctx, docker.ListOptions{})
+	for _, c := range containers {
+		h.Docker.(*dockertest.Engine).SetLogs(c.ID, logs[c.Service])
+	}
+
+	collector := &logCollector{h: h, containers: make(map[string]*followedContainer)}
+	waitCollected := func() {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			collector.mu.Lock()
+			busy := false
+			for _, fc := range collector.containers {
+				busy = busy || fc.following
+			}
+			collector.mu.Unlock()
+			if !busy {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("collector still following")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	collector.scan(ctx, true)
+	waitCollected()
+	// A second follow of the same containers stores nothing twice.
+	collector.scan(ctx, false)
+	waitCollected()
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/logs?"+query, nil)
+		w := httptest.NewRecorder()
+		h.handleLogs(w, req)
+		return w
+	}
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"service=web&service=worker&since=2h", []string{
+			"[web] GET / 200", `[worker] {"level":"warn","msg":"slow query"}`, "[web] ERROR: upstream timed out", "[worker] level=debug msg=tick"}},
+		{"service=web,worker&level=warn", []string{`[worker] {"level":"warn","msg":"slow query"}`, "[web] ERROR: upstream timed out"}},
+		{"service=web,worker&grep=slow|tick&tail=1", []string{"[worker] level=debug msg=tick"}},
+		{"service=web&since=" + url.QueryEscape(ts(time.Second)), []string{"ERROR: upstream timed out"}},
+		{"service=web,worker&until=" + url.QueryEscape(ts(time.Second)), []string{"[web] GET / 200"}},
+	}
+	for _, tc := range tests {
+		w := get(tc.query)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s = %d %s", tc.query, w.Code, w.Body.String())
+		}
+		var got []string
+		for _, line := range strings.Split(strings.TrimSpace(w.Body.String()), "\n") {
+			if _, rest, ok := strings.Cut(line, " "); ok {
+				got = append(got, rest)
+			}
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%s = %q, want %q", tc.query, got, tc.want)
+		}
+	}
+
+	w := get("service=web&format=json")
+	var entries []logstore.Entry
+	if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil || len(entries) != 2 {
+		t.Fatalf("json = %s", w.Body.String())
+	}
+	if e := entries[1]; e.Service != "web" || e.Level != logstore.LevelError || !e.Time.Equal(base.Add(2*time.Second)) {
+		t.Errorf("entry = %+v", e)
+	}
+	for _, query := range []string{"service=web,worker&follow=1", "service=web&grep=(", "service=web&level=loud", "service=web&until=soon"} {
+		if w := get(query); w.Code != http.StatusBadRequest {
+			t.Errorf("%s = %d, want 400", query, w.Code)
+		}
+	}
+
+	// Access logs are stored too and can be searched with the services.
+	h.AccessLogs = NewAccessLogs(10)
+	h.AccessLogs.Persist(logstore.New(filepath.Join(tmpDir, "logs", "access")))
+	h.AccessLogs.API.Add("GET /status 200")
+	// The line reaches the store in the background.
+	var body string
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		body = get("service=api&service=web&grep=status|upstream").Body.String()
+		if strings.Contains(body, "[api] GET /status 200") {
+			break
+		}
+	}
+	if !strings.Contains(body, "[web] ERROR: upstream timed out") || !strings.Contains(body, "[api] GET /status 200") {
+		t.Errorf("access and service logs = %s", body)
+	}
+}
+
+func TestBuildLogWriterSavesOutput(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+
+	rec := h.startDeploy(deploys.TriggerAPI, []string{"site"})
+	rec.Builds = append(rec.Builds, deploys.BuildRun{Service: "site", Ref: "main"})
+	lw := &buildLogWriter{h: h, prefix: "build: site: ", rec: &rec}
+	lw.Write([]byte("Step 1/2 : FROM alpine\n"))
+	saved, err := h.Deploys.Get(rec.ID)
+	if err != nil || len(saved.Builds) != 1 || saved.Builds[0].Output != "Step 1/2 : FROM alpine\n" {
+		t.Fatalf("record while building = %+v, %v", saved, err)
+	}
+	lw.Write([]byte("Step 2/2 : RUN make"))
+	lw.Flush()
+	saved, _ = h.Deploys.Get(rec.ID)
+	if got := saved.Builds[0].Output; got != "Step 1/2 : FROM alpine\nStep 2/2 : RUN make" {
+		t.Errorf("output after flush = %q", got)
+	}
+	if got := buildOutput(&rec); got != "Step 1/2 : FROM alpine\nStep 2/2 : RUN make" {
+		t.Errorf("buildOutput = %q", got)
+	}
+}
+
+func TestWebhookDeployBody(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+	useFakeDocker(h)
+	os.WriteFile(h.StatePath, []byte("{}"), 0o600)
+	ctx := context.Background()
+
+	plaintext, _ := auth.GenerateToken()
+	hash, _ := auth.HashToken(plaintext)
+	st := state.NewState()
+	st.Tokens = []state.APIToken{{ID: "t1", Name: "ci", Hash: hash}}
+	st.Services = []state.Service{
+		{ID: "web-1", Name: "web", Type: state.ServiceTypeRegistryImage, Image: "ghcr.io/acme/web:v1", InternalPort: 80, Enabled: true},
+	}
+	h.Store.Save(ctx, st)
+
+	post := func(contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/webhook/deploy/web", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+plaintext)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		w := httptest.NewRecorder()
+		h.HandleWebhookDeploy(w, req)
+		return w
+	}
+	tests := []struct {
+		name, contentType, body string
+		code                    int
+		image                   string
+	}{
+		{"no body", "", "", http.StatusOK, "ghcr.io/acme/web:v1"},
+		{"form data", "application/x-www-form-urlencoded", "ref=main&sha=4f2c1e9", http.StatusOK, "ghcr.io/acme/web:v1"},
+		{"pin", "application/json; charset=utf-8", `{"image": "ghcr.io/acme/web:v2"}`, http.StatusOK, "ghcr.io/acme/web:v2"},
+		// Only the Content-Type decides whether the body is read.
+		{"pin without content type", "", `{"image": "ghcr.io/acme/web:v3"}`, http.StatusOK, "ghcr.io/acme/web:v2"},
+		{"text mentioning image", "text/plain", `built "image" for 4f2c1e9`, http.StatusOK, "ghcr.io/acme/web:v2"},
+		{"broken pin", "application/json", `{"image": "ghcr.io/acme/web:v3"`, http.StatusBadRequest, ""},
+		{"empty JSON", "application/json", "", http.StatusOK, "ghcr.io/acme/web:v2"},
+	}
+	for _, tc := range tests {
+		w := post(tc.contentType, tc.body)
+		if w.Code != tc.code {
+			t.Errorf("%s = %d %s, want %d", tc.name, w.Code, w.Body.String(), tc.code)
+			continue
+		}
+		if tc.image != "" {
+			if got := runningImages(t, h.Docker, "web"); !slices.Equal(got, []string{tc.image}) {
+				t.Errorf("%s: running %v, want %s", tc.name, got, tc.image)
+			}
+		}
+	}
+}
+
+// Every deploy trigger goes through applyRecorded, so hooks run and are
+// recorded the same way whether the API, a webhook or an update started it.
+func TestDeployHooksOnEveryTrigger(t *testing.T) {
+	h, tmpDir := newTestHandler(t)
+	defer os.RemoveAll(tmpDir)
+	useFakeDocker(h)
+	os.WriteFile(h.StatePath, []byte("{}"), 0o600)
+	ctx := context.Background()
+
+	failPost := false
+	var calls []string
+	h.runHook = func(ctx context.Context, dir, phase, service string, command []string, w io.Writer) (int, error) {
+		calls = append(calls, phase+":"+service)
+		if phase == deploys.PhasePostDeploy && failPost {
+			fmt.Fprintln(w, "cache warm failed")
+			return 1, nil
+		}
+		return 0, nil
+	}
+	hooks := &state.ServiceHooks{
+		PreDeploy:  &state.ServiceHook{Command: []string{"migrate"}},
+		PostDeploy: &state.ServiceHook{Command: []string{"warm"}},
+	}
+	st := state.NewState()
+	st.Services = []state.Service{
+		{ID: "web-1", Name: "web", Type: state.ServiceTypeRegistryImage, Image: "ghcr.io/acme/web:v1", InternalPort: 80, Enabled: true, Hooks: hooks},
+		{ID: "api-1", Name: "api", Type: state.ServiceTypeRegistryImage, Image: "ghcr.io/acme/api:v1", InternalPort: 80, Enabled: true, Stopped: true, Hooks: hooks},
+	}
+	h.Store.Save(ctx, st)
+
+	// A full API deploy runs the hooks of the services it starts, not of
+	// the stopped one.
+	if w := postDeploy(h, ctx, `{}`); w.Code != http.StatusOK {
+		t.Fatalf("deploy = %d %s", w.Code, w.Body.String())
+	}
+	if !slices.Equal(calls, []string{"pre_deploy:web", "post_deploy:web"}) {
+		t.Errorf("API deploy hooks = %v", calls)
+	}
+	if got := runningImages(t, h.Docker, "api"); len(got) != 0 {
+		t.Errorf("stopped api running %v after a full deploy", got)
+	}
+
+	calls = nil
+	if err := h.applyConfig(ctx, &st, deploys.TriggerWebhook, []string{"web"}, time.Minute); err != nil {
+		t.Fatalf("webhook deploy: %v", err)
+	}
+	if !slices.Equal(calls, []string{"pre_deploy:web", "post_deploy:web"}) {
+		t.Errorf("webhook deploy hooks = %v", calls)
+	}
+
+	// A failing post-deploy hook rolls an API deploy back like any other.
+	failPost = true
+	w := postDeploy(h, ctx, `{"service":"web","image":"ghcr.io/acme/web:v2"}`)
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "post-deploy hook for web failed") || !strings.Contains(w.Body.String(), "rolled back") {
+		t.Fatalf("deploy with failing hook = %d %s", w.Code, w.Body.String())
+	}
+	if got := runningImages(t, h.Docker, "web"); !slices.Equal(got, []string{"ghcr.io/acme/web:v1"}) {
+		t.Errorf("running after rollback = %v", got)
+	}
+	recs, _ := h.Deploys.List("web")
+	if len(recs) != 3 {
+		t.Fatalf("%d deploy records, want 3", len(recs))
+	}
+	for _, rec := range recs {
+		want := deploys.StatusSucceeded
+		if rec.Trigger == deploys.TriggerAPI && len(rec.Services) == 1 {
+			want = deploys.StatusFailed
+		}
+		if rec.Status != want || len(rec.Hooks) != 2 {
+			t.Errorf("%s deploy of %v: status %s with %d hooks, want %s with 2", rec.Trigger, rec.Services, rec.Status, len(rec.Hooks), want)
+		}
+	}
+}
@@ -0,0 +1,367 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"tinyserve/internal/auth"
+	"tinyserve/internal/deploys"
+	"tinyserve/internal/notify"
+	"tinyserve/internal/state"
+)
+
+const (
+	defaultApprovalTTL    = 24 * time.Hour
+	maxApprovalTTLMinutes = 30 * 24 * 60
+	approvalReapInterval  = time.Minute
+	maxDecisionReasonLen  = 500
+)
+
+// errNotPending is returned when approving or rejecting a deploy that is no
+// longer waiting for a decision.
+var errNotPending = errors.New("deploy is not pending")
+
+func validateApproval(svc state.Service) error {
+	if svc.ApprovalTTL < 0 || svc.ApprovalTTL > maxApprovalTTLMinutes {
+		return fmt.Errorf("approval_ttl_minutes must be at most %d", maxApprovalTTLMinutes)
+	}
+	if svc.ApprovalTTL > 0 && !svc.RequireApproval {
+		return fmt.Errorf("approval_ttl_minutes requires require_approval")
+	}
+	if svc.RequireApproval && svc.Type == state.ServiceTypeStatic {
+		return fmt.Errorf("static sites are deployed by upload and can't require approval")
+	}
+	return nil
+}
+
+// requestApproval records a webhook deploy of svc as pending instead of
+// running it. Older pending deploys of the service are superseded, so only
+// the latest request can be approved.
+func (h *Handler) requestApproval(svc state.Service, source, image, buildRef string, timeout time.Duration) (deploys.Record, error) {
+	ttl := defaultApprovalTTL
+	if svc.ApprovalTTL > 0 {
+		ttl = time.Duration(svc.ApprovalTTL) * time.Minute
+	}
+	name := sanitizeName(svc.Name)
+
+	h.approvals.Lock()
+	defer h.approvals.Unlock()
+
+	rec := deploys.NewPendingRecord(deploys.TriggerWebhook, []string{name}, ttl)
+	rec.Source = source
+	rec.Image = image
+	rec.BuildRef = buildRef
+	rec.TimeoutSeconds = int(timeout / time.Second)
+	if err := h.Deploys.Save(rec); err != nil {
+		return deploys.Record{}, fmt.Errorf("save pending deploy: %w", err)
+	}
+
+	earlier, err := h.Deploys.List(name)
+	if err != nil {
+		log.Printf("approvals: list deploys of %s: %v", name, err)
+	}
+	for _, old := range earlier {
+		if old.ID == rec.ID || old.Status != deploys.StatusPending || len(old.Services) != 1 {
+			continue
+		}
+		old.Decide(deploys.StatusSuperseded, "", "superseded by "+rec.ID)
+		if err := h.Deploys.Save(old); err != nil {
+			log.Printf("approvals: supersede %s: %v", old.ID, err)
+		}
+	}
+
+	log.Printf("approvals: %s deploy of %s is pending as %s", source, name, rec.ID)
+	h.notify(notify.Event{
+		Kind:    notify.KindDeployPending,
+		Service: svc.Name,
+		Text:    fmt.Sprintf("tinyserve: %s deploy of %s is waiting for approval (tinyserve deploy approve %s)", source, svc.Name, rec.ID),
+		Details: pendingDetails(rec),
+	})
+	return rec, nil
+}
+
+func pendingDetails(rec deploys.Record) map[string]string {
+	details := map[string]string{"deploy_id": rec.ID, "source": rec.Source}
+	if rec.Image != "" {
+		details["image"] = rec.Image
+	}
+	if rec.BuildRef != "" {
+		details["build_ref"] = rec.BuildRef
+	}
+	if rec.ExpiresAt != nil {
+		details["expires_at"] = rec.ExpiresAt.Format(time.RFC3339)
+	}
+	if rec.DecidedBy != "" {
+		details["decided_by"] = rec.DecidedBy
+	}
+	if rec.Reason != "" {
+		details["reason"] = rec.Reason
+	}
+	return details
+}
+
+// writePendingDeploy answers a webhook whose deploy now waits for approval.
+func writePendingDeploy(w http.ResponseWriter, rec deploys.Record) {
+	resp := map[string]any{
+		"status":     "pending_approval",
+		"deploy_id":  rec.ID,
+		"service":    rec.Services[0],
+		"expires_at": rec.ExpiresAt.Format(time.RFC3339),
+	}
+	if rec.Image != "" {
+		resp["image"] = rec.Image
+	}
+	if rec.BuildRef != "" {
+		resp["build_ref"] = rec.BuildRef
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// decideDeploy approves or rejects a pending deploy. An approved deploy is
+// started in the background.
+func (h *Handler) decideDeploy(id string, approve bool, by, reason string) (deploys.Record, error) {
+	h.approvals.Lock()
+	defer h.approvals.Unlock()
+
+	rec, err := h.Deploys.Get(id)
+	if err != nil {
+		return deploys.Record{}, err
+	}
+	if rec.Expired(time.Now()) {
+		h.expireDeploy(rec)
+		return deploys.Record{}, fmt.Errorf("%w: it expired at %s", errNotPending, rec.ExpiresAt.Format(time.RFC3339))
+	}
+	if rec.Status != deploys.StatusPending {
+		return deploys.Record{}, fmt.Errorf("%w: it is %s", errNotPending, rec.Status)
+	}
+	if approve {
+		st, err := h.Store.Load(context.Background())
+		if err != nil {
+			return deploys.Record{}, fmt.Errorf("load state: %w", err)
+		}
+		if p, frozen := activeFreeze(st); frozen {
+			return deploys.Record{}, fmt.Errorf("%w: %s; approve it after that", errFrozen, p.Describe())
+		}
+	}
+
+	kind, verb := notify.KindDeployRejected, "rejected"
+	if approve {
+		rec.Decide(deploys.StatusRunning, by, reason)
+		kind, verb = notify.KindDeployApproved, "approved"
+	} else {
+		rec.Decide(deploys.StatusRejected, by, reason)
+	}
+	if err := h.Deploys.Save(rec); err != nil {
+		return deploys.Record{}, fmt.Errorf("save deploy: %w", err)
+	}
+
+	service := rec.Services[0]
+	log.Printf("approvals: %s %s deploy %s of %s", by, verb, rec.ID, service)
+	text := fmt.Sprintf("tinyserve: %s %s the %s deploy of %s", by, verb, rec.Source, service)
+	if reason != "" {
+		text += ": " + reason
+	}
+	h.notify(notify.Event{Kind: kind, Service: service, Text: text, Details: pendingDetails(rec)})
+
+	if approve {
+		h.startApproved(rec)
+	}
+	return rec, nil
+}
+
+// runApprovedDeploy deploys what a pending record asked for, finishing the
+// record and sending the outcome as a notification.
+func (h *Handler) runApprovedDeploy(rec deploys.Record) {
+	ctx := context.Background()
+	name := rec.Services[0]
+	details := pendingDetails(rec)
+	fail := func(err error, finish bool) {
+		log.Printf("approvals: deploy %s of %s: %v", rec.ID, name, err)
+		if finish {
+			h.finishDeploy(&rec, err)
+		}
+		details["error"] = err.Error()
+		h.notify(notify.Event{
+			Kind:    notify.KindDeployFailed,
+			Service: name,
+			Text:    fmt.Sprintf("tinyserve: approved deploy of %s failed: %v", name, err),
+			Details: details,
+		})
+	}
+
+	st, err := h.Store.Load(ctx)
+	if err != nil {
+		fail(fmt.Errorf("load state: %w", err), true)
+		return
+	}
+	svc := findService(&st, name)
+	if svc == nil {
+		fail(fmt.Errorf("service no longer exists"), true)
+		return
+	}
+	if rec.Image != "" {
+		if err := overrideImage(&st, name, rec.Image); err != nil {
+			fail(err, true)
+			return
+		}
+	}
+	if rec.BuildRef != "" && svc.Build != nil {
+		b := *svc.Build
+		b.Ref = rec.BuildRef
+		svc.Build = &b
+	}
+	timeout := providerDeployTimeout
+	if rec.TimeoutSeconds > 0 {
+		timeout = time.Duration(rec.TimeoutSeconds) * time.Second
+	}
+	if err := h.apply(ctx, &st, applyOptions{Targets: []string{name}, Timeout: timeout, Record: &rec}); err != nil {
+		fail(err, false)
+		return
+	}
+	h.markDeployed(ctx, svc, time.Now().UTC())
+	if err := h.Store.Save(ctx, st); err != nil {
+		fail(fmt.Errorf("save state: %w", err), false)
+		return
+	}
+	details["image"] = svc.DeployedImage
+	h.notify(notify.Event{
+		Kind:    notify.KindDeploySucceeded,
+		Service: name,
+		Text:    fmt.Sprintf("tinyserve: deployed %s (approved by %s)", name, rec.DecidedBy),
+		Details: details,
+	})
+}
+
+// StartApprovalReaper expires pending deploys that were not approved in time.
+func (h *Handler) StartApprovalReaper(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(approvalReapInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				h.expirePendingDeploys(time.Now())
+			}
+		}
+	}()
+}
+
+func (h *Handler) expirePendingDeploys(now time.Time) {
+	h.approvals.Lock()
+	defer h.approvals.Unlock()
+
+	recs, err := h.Deploys.List("")
+	if err != nil {
+		log.Printf("approvals: list deploys: %v", err)
+		return
+	}
+	for _, rec := range recs {
+		if rec.Expired(now) {
+			h.expireDeploy(rec)
+		}
+	}
+}
+
+// expireDeploy marks rec expired. The caller holds h.approvals.
+func (h *Handler) expireDeploy(rec deploys.Record) {
+	rec.Decide(deploys.StatusExpired, "", "")
+	if err := h.Deploys.Save(rec); err != nil {
+		log.Printf("approvals: expire %s: %v", rec.ID, err)
+		return
+	}
+	service := rec.Services[0]
+	log.Printf("approvals: deploy %s of %s expired", rec.ID, service)
+	h.notify(notify.Event{
+		Kind:    notify.KindDeployExpired,
+		Service: service,
+		Text:    fmt.Sprintf("tinyserve: the %s deploy of %s expired without approval", rec.Source, service),
+		Details: pendingDetails(rec),
+	})
+}
+
+// handleDeployDecision serves POST /deploys/{id}/approve|reject with an
+// optional {"reason": "..."} body.
+func (h *Handler) handleDeployDecision(w http.ResponseWriter, r *http.Request, id, action, by string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if action != "approve" && action != "reject" {
+		http.Error(w, "unknown deploy action", http.StatusNotFound)
+		return
+	}
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if len(req.Reason) > maxDecisionReasonLen {
+		http.Error(w, fmt.Sprintf("reason is longer than %d bytes", maxDecisionReasonLen), http.StatusBadRequest)
+		return
+	}
+
+	rec, err := h.decideDeploy(id, action == "approve", by, req.Reason)
+	switch {
+	case errors.Is(err, deploys.ErrNotFound):
+		http.Error(w, fmt.Sprintf("deploy %q not found", id), http.StatusNotFound)
+		return
+	case errors.Is(err, errNotPending):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, errFrozen):
+		http.Error(w, err.Error(), http.StatusLocked)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if action == "approve" {
+		// The deploy itself runs in the background.
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(rec)
+		return
+	}
+	writeJSON(w, rec)
+}
+
+// HandleDeployApprovals serves deploy records to the web UI and lets a
+// signed-in user approve or reject pending deploys. Deciding needs a browser
+// identity, so the UI must sit behind Cloudflare Access or another browser
+// auth provider.
+func (h *Handler) HandleDeployApprovals(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		h.handleDeploys(w, r)
+		return
+	}
+	user := auth.BrowserUserFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "approving deploys from the web UI requires browser authentication (tinyserve remote auth)", http.StatusForbidden)
+		return
+	}
+	// A JSON content type can't be sent cross-site without a CORS preflight.
+	if ct := r.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		http.Error(w, "content type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+	id, action, _ := strings.Cut(strings.Trim(strings.TrimPrefix(r.URL.Path, "/deploys"), "/"), "/")
+	by := user.Email
+	if by == "" {
+		by = user.ID
+	}
+	h.handleDeployDecision(w, r, id, action, by)
+}
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"tinyserve/internal/build"
+	"tinyserve/internal/deploys"
+	"tinyserve/internal/state"
+	"tinyserve/internal/validate"
+)
+
+// maxBuildOutput bounds how much build output is returned in deploy responses.
+const maxBuildOutput = 16 << 10
+
+func (h *Handler) buildRoot() string {
+	return filepath.Join(h.dataRoot(), "builds")
+}
+
+// buildServices builds every enabled git-build service among targets (all when
+// targets is empty) and points st at the new images. Each build is added to
+// rec, whose saved copy is updated with the output while the build runs.
+// Output lines also go to the daemon log.
+func (h *Handler) buildServices(ctx context.Context, st *state.State, targets []string, rec *deploys.Record) (map[string]build.Result, error) {
+	want := make(map[string]bool, len(targets))
+	for _, t := range targets {
+		want[t] = true
+	}
+
+	builder := build.NewBuilder(h.buildRoot())
+	results := make(map[string]build.Result)
+	for i := range st.Services {
+		svc := &st.Services[i]
+		if svc.Type != state.ServiceTypeGitBuild || !svc.Enabled || svc.Build == nil {
+			continue
+		}
+		name := sanitizeName(svc.Name)
+		if len(want) > 0 && !want[name] {
+			continue
+		}
+
+		log.Printf("build: %s start (source=%s ref=%s)", name, svc.Build.Source, svc.Build.Ref)
+		rec.Builds = append(rec.Builds, deploys.BuildRun{Service: name, Ref: svc.Build.Ref})
+		lw := &buildLogWriter{h: h, prefix: "build: " + name + ": ", rec: rec, run: len(rec.Builds) - 1}
+		start := time.Now()
+		res, err := builder.Build(ctx, name, *svc.Build, lw)
+		lw.Flush()
+		run := &rec.Builds[lw.run]
+		run.DurationMs = time.Since(start).Milliseconds()
+		if err != nil {
+			run.Error = err.Error()
+			return results, fmt.Errorf("build %s: %w", svc.Name, err)
+		}
+		log.Printf("build: %s complete (image=%s cached=%v)", name, res.Image, res.Cached)
+		run.Commit, run.Image, run.Cached = res.Commit, res.Image, res.Cached
+
+		svc.Image = res.Image
+		svc.Build.Commit = res.Commit
+		results[svc.Name] = res
+	}
+	return results, nil
+}
+
+// buildOutput returns the end of the output of rec's builds, for deploy
+// responses and errors.
+func buildOutput(rec *deploys.Record) string {
+	var sb strings.Builder
+	for _, run := range rec.Builds {
+		sb.WriteString(run.Output)
+		if run.Output != "" && !strings.HasSuffix(run.Output, "\n") {
+			sb.WriteString("\n")
+		}
+	}
+	return tailOutput(sb.String())
+}
+
+// pruneBuildImages drops old images for services that were just built.
+func pruneBuildImages(ctx context.Context, st state.State, results map[string]build.Result) {
+	for _, svc := range st.Services {
+		res, ok := results[svc.Name]
+		if !ok || res.Cached {
+			continue
+		}
+		if removed := build.Prune(ctx, sanitizeName(svc.Name), build.DefaultKeep, svc.Image); len(removed) > 0 {
+			log.Printf("build: pruned %d old image(s) for %s", len(removed), svc.Name)
+		}
+	}
+}
+
+// validateBuildSpec checks the service type and, for git-build services, the build source.
+func validateBuildSpec(svc state.Service) error {
+	switch svc.Type {
+	case "", state.ServiceTypeRegistryImage, state.ServiceTypeStatic:
+		return nil
+	case state.ServiceTypeJob:
+		return validateJobSpec(svc)
+	case state.ServiceTypeGitBuild:
+	default:
+		return fmt.Errorf("unknown service type %q", svc.Type)
+	}
+	if svc.Build == nil {
+		return fmt.Errorf("build.source is required for %s services", state.ServiceTypeGitBuild)
+	}
+	if err := validate.BuildSource(svc.Build.Source); err != nil {
+		return err
+	}
+	if err := validate.GitRef(svc.Build.Ref); err != nil {
+		return err
+	}
+	return validate.DockerfilePath(svc.Build.Dockerfile)
+}
+
+func tailOutput(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) <= maxBuildOutput {
+		return s
+	}
+	s = s[len(s)-maxBuildOutput:]
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[i+1:]
+	}
+	return s
+}
+
+// buildOutputSaveInterval is how often the output of a running build is
+// saved to its deploy record.
+const buildOutputSaveInterval = 2 * time.Second
+
+// buildLogWriter forwards complete lines to the daemon log and copies the
+// output to its build run on rec.
+type buildLogWriter struct {
+	h       *Handler
+	prefix  string
+	rec     *deploys.Record
+	run     int // index in rec.Builds
+	out     deploys.TailBuffer
+	pending []byte
+	saved   time.Time
+}
+
+func (w *buildLogWriter) Write(p []byte) (int, error) {
+	w.out.Write(p)
+	w.pending = append(w.pending, p...)
+	for {
+		i := bytes.IndexAny(w.pending, "\r\n")
+		if i < 0 {
+			break
+		}
+		if line := strings.TrimSpace(string(w.pending[:i])); line != "" {
+			log.Printf("%s%s", w.prefix, line)
+		}
+		w.pending = w.pending[i+1:]
+	}
+	if time.Since(w.saved) >= buildOutputSaveInterval {
+		w.save()
+	}
+	return len(p), nil
+}
+
+// Flush logs any trailing partial line and saves the output.
+func (w *buildLogWriter) Flush() {
+	if line := strings.TrimSpace(string(w.pending)); line != "" {
+		log.Printf("%s%s", w.prefix, line)
+	}
+	w.pending = nil
+	w.save()
+}
+
+func (w *buildLogWriter) save() {
+	w.saved = time.Now()
+	run := &w.rec.Builds[w.run]
+	run.Output, run.OutputTruncated = w.out.String(), w.out.Truncated
+	if err := w.h.Deploys.Save(*w.rec); err != nil {
+		log.Printf("deploy %s: save record: %v", w.rec.ID, err)
+	}
+}
@@ -0,0 +1,350 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tinyserve/internal/deploys"
+	"tinyserve/internal/docker"
+	"tinyserve/internal/notify"
+	"tinyserve/internal/state"
+)
+
+const (
+	maxCrashRestarts      = 1000
+	maxCrashWindowMinutes = 24 * 60
+)
+
+var errNoRollbackImage = errors.New("no earlier deploy to roll back to")
+
+// crashInfo is the restart history of a service as reported by /services.
+type crashInfo struct {
+	Restarts       int        `json:"restarts"` // since the daemon started
+	OOMKills       int        `json:"oom_kills"`
+	RecentRestarts int        `json:"recent_restarts"` // within the crash policy window
+	LastRestart    *time.Time `json:"last_restart,omitempty"`
+	Looping        bool       `json:"crash_looping"`
+}
+
+// crashTracker counts the restarts of each service from container events. A
+// restart is a container starting again after it died without being killed
+// or stopped, which is what the restart policy does after a crash; deploys
+// replace containers instead and manual stops come with kill or stop events.
+type crashTracker struct {
+	mu         sync.Mutex
+	containers map[string]*containerRun // by container ID
+	services   map[string]*crashStats   // by compose service
+}
+
+type containerRun struct {
+	stopping bool // a kill came in; the next die is not a crash
+	died     bool // died on its own; a start now is a restart
+}
+
+type crashStats struct {
+	restarts    int
+	oomKills    int
+	lastRestart time.Time
+	recent      []time.Time // restart times, oldest first
+	handled     bool        // the current loop was acted on
+}
+
+func newCrashTracker() *crashTracker {
+	return &crashTracker{containers: make(map[string]*containerRun), services: make(map[string]*crashStats)}
+}
+
+// observe updates the tracker with a container event and reports whether it
+// was a restart.
+func (t *crashTracker) observe(ev docker.Event) bool {
+	if ev.Service == "" || ev.ID == "" {
+		return false
+	}
+	at := ev.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+	action, _, _ := strings.Cut(ev.Action, ":")
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if action == "destroy" {
+		delete(t.containers, ev.ID)
+		return false
+	}
+	run := t.containers[ev.ID]
+	if run == nil {
+		run = &containerRun{}
+		t.containers[ev.ID] = run
+	}
+	switch action {
+	case "kill":
+		run.stopping = true
+	case "stop":
+		run.stopping = false
+		run.died = false
+	case "die":
+		run.died = !run.stopping
+		run.stopping = false
+	case "oom":
+		t.stats(ev.Service).oomKills++
+	case "start":
+		restarted := run.died
+		run.died = false
+		run.stopping = false
+		if restarted {
+			s := t.stats(ev.Service)
+			s.restarts++
+			s.lastRestart = at
+			s.recent = append(s.recent, at)
+			if len(s.recent) > maxCrashRestarts {
+				s.recent = s.recent[len(s.recent)-maxCrashRestarts:]
+			}
+		}
+		return restarted
+	}
+	return false
+}
+
+// stats returns the counters of service; t.mu must be held.
+func (t *crashTracker) stats(service string) *crashStats {
+	s := t.services[service]
+	if s == nil {
+		s = &crashStats{}
+		t.services[service] = s
+	}
+	return s
+}
+
+// inWindow drops restarts older than the policy window and returns how many
+// are left. A service that calmed down may loop and be acted on again.
+func (s *crashStats) inWindow(p state.ServiceCrashPolicy, now time.Time) int {
+	cutoff := now.Add(-time.Duration(p.WindowMinutes) * time.Minute)
+	i := 0
+	for i < len(s.recent) && s.recent[i].Before(cutoff) {
+		i++
+	}
+	s.recent = s.recent[i:]
+	if len(s.recent) < p.MaxRestarts {
+		s.handled = false
+	}
+	return len(s.recent)
+}
+
+// check reports how many times service restarted within the policy window
+// and whether that starts a crash loop that nothing was done about yet.
+func (t *crashTracker) check(service string, p state.ServiceCrashPolicy, now time.Time) (int, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.services[service]
+	if s == nil {
+		return 0, false
+	}
+	n := s.inWindow(p, now)
+	if n < p.MaxRestarts || s.handled {
+		return n, false
+	}
+	s.handled = true
+	return n, true
+}
+
+// settle forgets the recent restarts of service once it was stopped or
+// rolled back, so it no longer shows as crash-looping.
+func (t *crashTracker) settle(service string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if s := t.services[service]; s != nil {
+		s.recent = nil
+		s.handled = false
+	}
+}
+
+// info returns the restart history of service, or nil if it never restarted
+// or ran out of memory.
+func (t *crashTracker) info(service string, p state.ServiceCrashPolicy, now time.Time) *crashInfo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.services[service]
+	if s == nil {
+		return nil
+	}
+	n := s.inWindow(p, now)
+	info := &crashInfo{
+		Restarts:       s.restarts,
+		OOMKills:       s.oomKills,
+		RecentRestarts: n,
+		Looping:        n >= p.MaxRestarts,
+	}
+	if !s.lastRestart.IsZero() {
+		last := s.lastRestart
+		info.LastRestart = &last
+	}
+	return info
+}
+
+// crashPolicy returns the crash policy of svc with defaults filled in.
+func crashPolicy(svc state.Service) state.ServiceCrashPolicy {
+	var p state.ServiceCrashPolicy
+	if svc.CrashPolicy != nil {
+		p = *svc.CrashPolicy
+	}
+	if p.Action == "" {
+		p.Action = state.CrashActionAlert
+	}
+	if p.MaxRestarts <= 0 {
+		p.MaxRestarts = state.DefaultCrashMaxRestarts
+	}
+	if p.WindowMinutes <= 0 {
+		p.WindowMinutes = state.DefaultCrashWindowMinutes
+	}
+	return p
+}
+
+func validateCrashPolicy(svc state.Service) error {
+	p := svc.CrashPolicy
+	if p == nil {
+		return nil
+	}
+	switch p.Action {
+	case "", state.CrashActionAlert, state.CrashActionStop:
+	case state.CrashActionRollback:
+		if svc.Type != "" && svc.Type != state.ServiceTypeRegistryImage {
+			return fmt.Errorf("crash rollback needs a registry image, not a %s service", svc.Type)
+		}
+	default:
+		return fmt.Errorf("crash policy action must be alert, stop or rollback, got %q", p.Action)
+	}
+	if svc.IsJob() {
+		return errors.New("jobs have no crash policy; their runs are not restarted")
+	}
+	if p.MaxRestarts < 0 || p.MaxRestarts > maxCrashRestarts {
+		return fmt.Errorf("crash policy restarts must be between 1 and %d, got %d", maxCrashRestarts, p.MaxRestarts)
+	}
+	if p.WindowMinutes < 0 || p.WindowMinutes > maxCrashWindowMinutes {
+		return fmt.Errorf("crash policy window must be between 1 and %d minutes, got %d", maxCrashWindowMinutes, p.WindowMinutes)
+	}
+	return nil
+}
+
+// checkCrashLoop applies the crash policy of the compose service that just
+// restarted once it restarted too often.
+func (h *Handler) checkCrashLoop(ctx context.Context, service string, now time.Time) {
+	st, err := h.Store.Load(ctx)
+	if err != nil {
+		log.Printf("crash loop: load state: %v", err)
+		return
+	}
+	var svc *state.Service
+	for i := range st.Services {
+		if sanitizeName(st.Services[i].Name) == service {
+			svc = &st.Services[i]
+			break
+		}
+	}
+	if svc == nil {
+		return
+	}
+	p := crashPolicy(*svc)
+	restarts, loop := h.crashes.check(service, p, now)
+	if !loop {
+		return
+	}
+
+	window := time.Duration(p.WindowMinutes) * time.Minute
+	summary := fmt.Sprintf("%s restarted %d times in %s", svc.Name, restarts, window)
+	details := map[string]string{"action": p.Action, "restarts": strconv.Itoa(restarts), "window": window.String()}
+	text := "tinyserve: " + summary
+	switch p.Action {
+	case state.CrashActionStop:
+		if err := h.stopCrashLoop(ctx, svc.Name); err != nil {
+			details["error"] = err.Error()
+			text += fmt.Sprintf("; stopping it failed: %v", err)
+		} else {
+			h.crashes.settle(service)
+			text += fmt.Sprintf("; stopped it until `tinyserve service start %s`", svc.Name)
+		}
+	case state.CrashActionRollback:
+		from, to, err := h.rollbackCrashLoop(ctx, svc.Name)
+		if err != nil {
+			details["error"] = err.Error()
+			text += fmt.Sprintf("; rollback failed: %v", err)
+		} else {
+			h.crashes.settle(service)
+			details["from"] = from
+			details["to"] = to
+			text += "; rolled back to " + to
+		}
+	}
+	log.Printf("crash loop: %s", strings.TrimPrefix(text, "tinyserve: "))
+	h.notify(notify.Event{Kind: notify.KindCrashLoop, Service: svc.Name, Text: text, Details: details})
+}
+
+// stopCrashLoop stops the containers of the named service and remembers
+// the stop like `tinyserve service stop`, so deploys and daemon restarts
+// leave the service down until it is started again.
+func (h *Handler) stopCrashLoop(ctx context.Context, name string) error {
+	if !h.updates.begin(name) {
+		return errors.New("a deploy of the service is already in progress")
+	}
+	defer h.updates.end(name)
+
+	service := sanitizeName(name)
+	if out, err := h.newRunner(h.currentDir()).Stop(ctx, service); err != nil {
+		log.Printf("crash loop: stop %s: %v\n%s", service, err, out)
+		return err
+	}
+	st, err := h.Store.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("load state: %w", err)
+	}
+	svc := findService(&st, name)
+	if svc == nil {
+		return fmt.Errorf("service %q not found", name)
+	}
+	svc.Stopped = true
+	if err := h.Store.Save(ctx, st); err != nil {
+		return fmt.Errorf("save state: %w", err)
+	}
+	return nil
+}
+
+// rollbackCrashLoop redeploys the image the named service ran before its
+// last deploy. Like a restore it is not held back by freeze windows. The
+// crashing image is not kept as a rollback target.
+func (h *Handler) rollbackCrashLoop(ctx context.Context, name string) (from, to string, err error) {
+	if !h.updates.begin(name) {
+		return "", "", errors.New("a deploy of the service is already in progress")
+	}
+	defer h.updates.end(name)
+
+	st, err := h.Store.Load(ctx)
+	if err != nil {
+		return "", "", fmt.Errorf("load state: %w", err)
+	}
+	svc := findService(&st, name)
+	if svc == nil {
+		return "", "", fmt.Errorf("service %q no longer exists", name)
+	}
+	if svc.Type != "" && svc.Type != state.ServiceTypeRegistryImage {
+		return "", "", fmt.Errorf("rollback needs a registry image, not a %s service", svc.Type)
+	}
+	if svc.PreviousImage == "" {
+		return "", "", errNoRollbackImage
+	}
+	from = svc.DeployedImage
+	svc.Image = svc.PreviousImage
+	if err := h.applyConfig(ctx, &st, deploys.TriggerCrash, []string{sanitizeName(svc.Name)}, updateDeployTimeout); err != nil {
+		return "", "", fmt.Errorf("deploy %s: %w", svc.Image, err)
+	}
+	h.markDeployed(ctx, svc, time.Now().UTC())
+	svc.PreviousImage = ""
+	if err := h.Store.Save(ctx, st); err != nil {
+		return "", "", fmt.Errorf("save state: %w", err)
+	}
+	return from, svc.Image, nil
+}
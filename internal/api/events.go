@@ -0,0 +1,390 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tinyserve/internal/docker"
+	"tinyserve/internal/state"
+)
+
+const (
+	// statusResyncInterval is how often the status cache is rebuilt from a
+	// full container list, in case an event was missed.
+	statusResyncInterval = 30 * time.Second
+	// eventRetention is how long recorded service events are kept.
+	eventRetention     = 30 * 24 * time.Hour
+	eventPruneInterval = time.Hour
+	// eventKeepalive is how often an idle /events stream gets a comment, so
+	// proxies don't close it.
+	eventKeepalive = 15 * time.Second
+	// defaultEventLimit is how many past events /events replays when the
+	// request doesn't say where to start.
+	defaultEventLimit = 100
+)
+
+// statusActions are the container event actions that can change what
+// containerStatus reports. Exec events from healthchecks are not among them.
+var statusActions = map[string]bool{
+	"create": true, "start": true, "restart": true, "die": true, "stop": true, "kill": true,
+	"oom": true, "pause": true, "unpause": true, "destroy": true, "rename": true, "health_status": true,
+}
+
+// statusCache holds the container status of the compose project while the
+// event watcher keeps it current. Maps handed out are never modified.
+type statusCache struct {
+	mu       sync.RWMutex
+	project  string
+	statuses map[string]docker.ContainerStatus
+	live     bool
+}
+
+// get returns the cached status if the watcher is following project.
+func (c *statusCache) get(project string) (map[string]docker.ContainerStatus, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.live || c.project != project {
+		return nil, false
+	}
+	return c.statuses, true
+}
+
+func (c *statusCache) set(project string, statuses map[string]docker.ContainerStatus) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.project = project
+	c.statuses = statuses
+	c.live = true
+}
+
+// invalidate makes status requests list containers again until the watcher
+// has resubscribed.
+func (c *statusCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.live = false
+	c.statuses = nil
+}
+
+// eventHub fans recorded events out to /events streams.
+type eventHub struct {
+	mu   sync.Mutex
+	subs map[chan state.ServiceEvent]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subs: make(map[chan state.ServiceEvent]struct{})}
+}
+
+func (hub *eventHub) subscribe() (<-chan state.ServiceEvent, func()) {
+	ch := make(chan state.ServiceEvent, 64)
+	hub.mu.Lock()
+	hub.subs[ch] = struct{}{}
+	hub.mu.Unlock()
+	return ch, func() {
+		hub.mu.Lock()
+		delete(hub.subs, ch)
+		hub.mu.Unlock()
+	}
+}
+
+// publish never blocks; a stream too slow to keep up misses events.
+func (hub *eventHub) publish(ev state.ServiceEvent) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	for ch := range hub.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// StartEventWatcher follows the container events of the deployed compose
+// project. It records crashes and health changes per service and keeps the
+// status cache used by /status, /services and /health current. When the
+// event stream fails, status requests list containers again until it is
+// back.
+func (h *Handler) StartEventWatcher(ctx context.Context) {
+	go func() {
+		backoff := time.Second
+		for {
+			started := time.Now()
+			err := h.watchEvents(ctx)
+			h.status.invalidate()
+			if ctx.Err() != nil {
+				return
+			}
+			if err == nil {
+				// The project changed or was deployed for the first time.
+				continue
+			}
+			if time.Since(started) > time.Minute {
+				backoff = time.Second
+			}
+			log.Printf("events: %v; resubscribing in %s", err, backoff)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, time.Minute)
+		}
+	}()
+	go func() {
+		ticker := time.NewTicker(eventPruneInterval)
+		defer ticker.Stop()
+		for {
+			h.pruneEvents(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// watchEvents follows one subscription. It returns nil when the compose
+// project it follows is no longer the deployed one.
+func (h *Handler) watchEvents(ctx context.Context) error {
+	dir := h.currentDir()
+	if !composeExists(dir) {
+		select {
+		case <-ctx.Done():
+		case <-time.After(statusResyncInterval):
+		}
+		return nil
+	}
+	project := docker.ProjectName(dir)
+
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	changed := make(chan struct{}, 1)
+	done := make(chan error, 1)
+	opts := docker.EventOptions{Project: project, Types: []string{"container"}, Since: time.Now()}
+	go func() {
+		done <- h.Docker.Events(subCtx, opts, func(ev docker.Event) {
+			h.recordEvent(subCtx, ev)
+			if h.crashes.observe(ev) {
+				go h.checkCrashLoop(ctx, ev.Service, time.Now())
+			}
+			action, _, _ := strings.Cut(ev.Action, ":")
+			if statusActions[action] {
+				select {
+				case changed <- struct{}{}:
+				default:
+				}
+			}
+		})
+	}()
+
+	ticker := time.NewTicker(statusResyncInterval)
+	defer ticker.Stop()
+	for {
+		if !composeExists(dir) || docker.ProjectName(dir) != project {
+			return nil
+		}
+		statuses, err := h.pollContainerStatus(ctx)
+		if err != nil {
+			return fmt.Errorf("list containers: %w", err)
+		}
+		h.status.set(project, statuses)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-done:
+			if err == nil {
+				err = errors.New("event stream ended")
+			}
+			return err
+		case <-changed:
+		case <-ticker.C:
+		}
+	}
+}
+
+// serviceEvent converts the engine events that are recorded per service;
+// ok is false for the rest, such as start and destroy.
+func serviceEvent(ev docker.Event) (state.ServiceEvent, bool) {
+	if ev.Service == "" {
+		return state.ServiceEvent{}, false
+	}
+	se := state.ServiceEvent{Service: ev.Service, Container: ev.Name, Time: ev.Time}
+	if se.Time.IsZero() {
+		se.Time = time.Now()
+	}
+	action, detail, _ := strings.Cut(ev.Action, ":")
+	switch action {
+	case state.EventDie:
+		if code, err := strconv.Atoi(ev.Attributes["exitCode"]); err == nil {
+			se.ExitCode = &code
+		}
+	case state.EventOOM, state.EventRestart:
+	case state.EventHealthStatus:
+		// Docker puts the health in the action, Podman in an attribute.
+		se.Health = strings.TrimSpace(detail)
+		if se.Health == "" {
+			se.Health = ev.Attributes["health_status"]
+		}
+	default:
+		return state.ServiceEvent{}, false
+	}
+	se.Action = action
+	return se, true
+}
+
+func (h *Handler) recordEvent(ctx context.Context, ev docker.Event) {
+	se, ok := serviceEvent(ev)
+	if !ok {
+		return
+	}
+	if h.Events != nil {
+		saved, err := h.Events.AppendEvent(ctx, se)
+		if err != nil {
+			log.Printf("events: record %s %s: %v", se.Service, se.Action, err)
+		} else {
+			se = saved
+		}
+	}
+	h.eventStreams.publish(se)
+}
+
+func (h *Handler) pruneEvents(ctx context.Context) {
+	if h.Events == nil {
+		return
+	}
+	if err := h.Events.PruneEvents(ctx, time.Now().Add(-eventRetention)); err != nil {
+		log.Printf("events: %v", err)
+	}
+}
+
+// handleEvents streams recorded service events as server-sent events. It
+// replays past events, the newest 100 unless since, after or a
+// Last-Event-ID header says where to start, and with follow=1 keeps the
+// stream open for new ones.
+func (h *Handler) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.Events == nil {
+		http.Error(w, "event log not available", http.StatusNotImplemented)
+		return
+	}
+	q := r.URL.Query()
+	filter := state.EventFilter{Limit: defaultEventLimit}
+	if service := q.Get("service"); service != "" {
+		filter.Service = sanitizeName(service)
+	}
+	if since := q.Get("since"); since != "" {
+		t, err := parseSince(since, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.Since = t
+		filter.Limit = 0
+	}
+	after := q.Get("after")
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		after = id
+	}
+	if after != "" {
+		id, err := strconv.ParseInt(after, 10, 64)
+		if err != nil || id < 0 {
+			http.Error(w, "after must be an event ID", http.StatusBadRequest)
+			return
+		}
+		filter.AfterID = id
+		filter.Limit = 0
+	}
+	if n := q.Get("limit"); n != "" {
+		limit, err := strconv.Atoi(n)
+		if err != nil || limit < 0 {
+			http.Error(w, "limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = limit
+	}
+	follow := parseBoolQuery(q.Get("follow"))
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	ctx := r.Context()
+	// Subscribe before reading the log so nothing falls between the two.
+	var live <-chan state.ServiceEvent
+	if follow {
+		ch, unsubscribe := h.eventStreams.subscribe()
+		defer unsubscribe()
+		live = ch
+	}
+	past, err := h.Events.ListEvents(ctx, filter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("list events: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	lastID := filter.AfterID
+	for _, ev := range past {
+		writeEvent(w, ev)
+		lastID = ev.ID
+	}
+	flusher.Flush()
+	if !follow {
+		return
+	}
+
+	keepalive := time.NewTicker(eventKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case ev := <-live:
+			if ev.ID != 0 && ev.ID <= lastID || filter.Service != "" && ev.Service != filter.Service {
+				continue
+			}
+			writeEvent(w, ev)
+			lastID = ev.ID
+		}
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, ev state.ServiceEvent) {
+	data, _ := json.Marshal(ev)
+	if ev.ID != 0 {
+		fmt.Fprintf(w, "id: %d\n", ev.ID)
+	}
+	fmt.Fprintf(w, "data: %s\n\n", data)
+}
+
+// parseSince accepts an RFC 3339 time or a duration before now, like "2h".
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("since must be an RFC 3339 time or a duration like 2h")
+	}
+	return now.Add(-d), nil
+}
@@ -0,0 +1,332 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"tinyserve/internal/docker"
+	"tinyserve/internal/state"
+	"tinyserve/internal/websocket"
+)
+
+// Exec and run sessions carry a command's streams over a WebSocket. Binary
+// messages are one stream byte followed by data; text messages are JSON
+// execControl messages: resize and eof from the client, exit and error from
+// the daemon, which closes the connection after either.
+const (
+	streamStdin  = 0
+	streamStdout = 1
+	streamStderr = 2
+)
+
+const (
+	maxExecArgs        = 256
+	defaultAuditLimit  = 100
+	execOutputChunkMax = 32 << 10
+)
+
+type execControl struct {
+	Type    string `json:"type"` // resize, eof, exit or error
+	Rows    uint16 `json:"rows,omitempty"`
+	Cols    uint16 `json:"cols,omitempty"`
+	Code    *int   `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// HandleWebhookServices serves the per-service endpoints of the webhook
+// listener: site uploads and rollbacks, and exec and run sessions.
+func (h *Handler) HandleWebhookServices(w http.ResponseWriter, r *http.Request) {
+	raw := strings.TrimPrefix(r.URL.Path, "/services/")
+	parts := strings.SplitN(raw, "/", 2)
+	if len(parts) == 2 && parts[0] != "" && (parts[1] == "exec" || parts[1] == "run") {
+		name, err := url.PathUnescape(parts[0])
+		if err != nil {
+			http.Error(w, "invalid service name", http.StatusBadRequest)
+			return
+		}
+		h.handleExec(w, r, name, parts[1])
+		return
+	}
+	h.HandleSite(w, r)
+}
+
+// handleExec runs a command in a running container of the service (exec)
+// or in a throwaway container with the service's image, env and volumes
+// (run), streaming it over a WebSocket. Both need an admin token scoped to
+// the service, on every listener, and every session is audited.
+//
+// The command is given as repeated cmd query parameters; tty=1 allocates a
+// terminal (exec only) and stdin=1 attaches stdin.
+func (h *Handler) handleExec(w http.ResponseWriter, r *http.Request, name, action string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token, status, msg := h.requireWebhookToken(r)
+	if status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+	if !token.Admin {
+		http.Error(w, action+" needs an admin token", http.StatusForbidden)
+		return
+	}
+	if !isTokenAllowedForService(token, name) {
+		http.Error(w, "token not authorized for this service", http.StatusForbidden)
+		return
+	}
+
+	q := r.URL.Query()
+	command := q["cmd"]
+	if len(command) == 0 || command[0] == "" {
+		http.Error(w, "cmd is required", http.StatusBadRequest)
+		return
+	}
+	if len(command) > maxExecArgs {
+		http.Error(w, fmt.Sprintf("cmd has more than %d arguments", maxExecArgs), http.StatusBadRequest)
+		return
+	}
+	tty := q.Get("tty") == "1"
+	attachStdin := q.Get("stdin") == "1"
+	if tty && action == "run" {
+		http.Error(w, "run does not support a TTY; use exec", http.StatusBadRequest)
+		return
+	}
+	if !websocket.IsUpgrade(r) {
+		http.Error(w, "websocket upgrade required", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	st, err := h.Store.Load(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("load state: %v", err), http.StatusInternalServerError)
+		return
+	}
+	svc := findService(&st, name)
+	if svc == nil {
+		http.Error(w, fmt.Sprintf("service %q not found", name), http.StatusNotFound)
+		return
+	}
+	service := sanitizeName(svc.Name)
+	dir := h.currentDir()
+	if !composeExists(dir) {
+		http.Error(w, "no deployed project", http.StatusConflict)
+		return
+	}
+	var containerID string
+	if action == "exec" {
+		containers, err := h.Docker.ListContainers(ctx, docker.ListOptions{Project: docker.ProjectName(dir), Service: service})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("list containers: %v", err), http.StatusBadGateway)
+			return
+		}
+		if len(containers) == 0 {
+			http.Error(w, fmt.Sprintf("%s has no running container", svc.Name), http.StatusConflict)
+			return
+		}
+		containerID = containers[0].ID
+	}
+
+	conn, err := websocket.Accept(w, r)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	entry := state.AuditEntry{
+		Time:       time.Now().UTC(),
+		Actor:      token.Name,
+		Action:     action,
+		Service:    svc.Name,
+		Command:    command,
+		TTY:        tty,
+		RemoteAddr: remoteAddr(r),
+	}
+	if h.Audit != nil {
+		if entry, err = h.Audit.AppendAudit(ctx, entry); err != nil {
+			log.Printf("%s: audit: %v", action, err)
+		}
+	}
+	log.Printf("%s: %s started %q in %s from %s", action, entry.Actor, strings.Join(command, " "), svc.Name, entry.RemoteAddr)
+
+	code, err := h.runExecSession(ctx, conn, action, service, containerID, command, tty, attachStdin)
+	if err != nil {
+		conn.WriteMessage(websocket.TextMessage, mustJSON(execControl{Type: "error", Message: err.Error()}))
+		entry.Error = err.Error()
+	} else {
+		conn.WriteMessage(websocket.TextMessage, mustJSON(execControl{Type: "exit", Code: &code}))
+		entry.ExitCode = &code
+	}
+	entry.DurationMs = time.Since(entry.Time).Milliseconds()
+	if h.Audit != nil && entry.ID != 0 {
+		if err := h.Audit.FinishAudit(context.WithoutCancel(ctx), entry); err != nil {
+			log.Printf("%s: audit: %v", action, err)
+		}
+	}
+	if entry.Error != "" {
+		log.Printf("%s: %q in %s failed after %s: %s", action, strings.Join(command, " "), svc.Name, time.Duration(entry.DurationMs)*time.Millisecond, entry.Error)
+	} else {
+		log.Printf("%s: %q in %s exited with %d after %s", action, strings.Join(command, " "), svc.Name, code, time.Duration(entry.DurationMs)*time.Millisecond)
+	}
+}
+
+// runExecSession runs the command with its streams connected to conn and
+// returns its exit code. The client going away cancels the command.
+func (h *Handler) runExecSession(ctx context.Context, conn *websocket.Conn, action, service, containerID string, command []string, tty, attachStdin bool) (int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var stdin io.Reader
+	stdinR, stdinW := io.Pipe()
+	defer stdinW.Close()
+	if attachStdin {
+		stdin = stdinR
+	}
+	resize := make(chan docker.TermSize, 1)
+
+	go func() {
+		defer cancel()
+		for {
+			typ, data, err := conn.ReadMessage()
+			if err != nil {
+				stdinW.CloseWithError(io.ErrUnexpectedEOF)
+				return
+			}
+			if typ == websocket.BinaryMessage {
+				if len(data) > 1 && data[0] == streamStdin {
+					if _, err := stdinW.Write(data[1:]); err != nil {
+						// The command closed its stdin; keep reading for
+						// resizes and the close.
+						continue
+					}
+				}
+				continue
+			}
+			var msg execControl
+			if json.Unmarshal(data, &msg) != nil {
+				continue
+			}
+			switch msg.Type {
+			case "eof":
+				stdinW.Close()
+			case "resize":
+				if msg.Rows == 0 || msg.Cols == 0 {
+					continue
+				}
+				// Only the latest size matters.
+				select {
+				case <-resize:
+				default:
+				}
+				resize <- docker.TermSize{Rows: msg.Rows, Cols: msg.Cols}
+			}
+		}
+	}()
+
+	stdout := &execStreamWriter{conn: conn, stream: streamStdout}
+	stderr := &execStreamWriter{conn: conn, stream: streamStderr}
+	if action == "run" {
+		return h.newRunner(h.currentDir()).RunAttached(ctx, service, command, stdin, stdout, stderr)
+	}
+	var resizes <-chan docker.TermSize
+	if tty {
+		resizes = resize
+	}
+	code, err := h.Docker.Exec(ctx, containerID, docker.ExecOptions{
+		Cmd:    command,
+		Tty:    tty,
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: stderr,
+		Resize: resizes,
+	})
+	if err != nil && errors.Is(ctx.Err(), context.Canceled) {
+		return -1, errors.New("client disconnected")
+	}
+	return code, err
+}
+
+// execStreamWriter sends what is written as binary messages of one stream.
+type execStreamWriter struct {
+	conn   *websocket.Conn
+	stream byte
+}
+
+func (s *execStreamWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), execOutputChunkMax)
+		msg := make([]byte, 0, n+1)
+		msg = append(append(msg, s.stream), p[:n]...)
+		if err := s.conn.WriteMessage(websocket.BinaryMessage, msg); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func mustJSON(v any) []byte {
+	data, _ := json.Marshal(v)
+	return data
+}
+
+// remoteAddr is the client address, as cloudflared reports it for requests
+// through the tunnel.
+func remoteAddr(r *http.Request) string {
+	if ip := r.Header.Get("CF-Connecting-IP"); ip != "" {
+		return ip
+	}
+	return r.RemoteAddr
+}
+
+// handleAudit lists audit entries, the newest 100 unless limit says
+// otherwise, optionally of one service.
+func (h *Handler) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.Audit == nil {
+		http.Error(w, "audit log not available", http.StatusNotImplemented)
+		return
+	}
+	q := r.URL.Query()
+	filter := state.AuditFilter{Service: q.Get("service"), Limit: defaultAuditLimit}
+	if since := q.Get("since"); since != "" {
+		t, err := parseSince(since, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.Since = t
+	}
+	if n := q.Get("limit"); n != "" {
+		limit, err := strconv.Atoi(n)
+		if err != nil || limit < 0 {
+			http.Error(w, "limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = limit
+	}
+	entries, err := h.Audit.ListAudit(r.Context(), filter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("list audit log: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []state.AuditEntry{}
+	}
+	writeJSON(w, entries)
+}
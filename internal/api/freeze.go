@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"tinyserve/internal/freeze"
+	"tinyserve/internal/notify"
+	"tinyserve/internal/state"
+)
+
+// errFrozen marks a deploy refused because a freeze window is active.
+var errFrozen = errors.New("deploys are frozen")
+
+// activeFreeze reports the freeze window in effect right now, if any.
+func activeFreeze(st state.State) (freeze.Period, bool) {
+	return freeze.Active(st.Settings.FreezeWindows, time.Now())
+}
+
+// refuseFrozen answers a webhook deploy that arrived during a freeze and tells
+// the notification webhook, so a dropped release doesn't go unnoticed.
+func (h *Handler) refuseFrozen(w http.ResponseWriter, service, source string, p freeze.Period) {
+	log.Printf("freeze: refused %s deploy of %s: %s", source, service, p.Describe())
+	h.notify(notify.Event{
+		Kind:    notify.KindDeployBlocked,
+		Service: service,
+		Text:    fmt.Sprintf("tinyserve: %s deploy of %s refused: %s", source, service, p.Describe()),
+		Details: map[string]string{"source": source, "freeze": p.Name, "until": p.End.Format(time.RFC3339)},
+	})
+	http.Error(w, p.Describe(), http.StatusLocked)
+}
+
+// auditFreezeOverride records who deployed through a freeze and why.
+func (h *Handler) auditFreezeOverride(targets []string, p freeze.Period, reason string) {
+	services := "all services"
+	if len(targets) > 0 {
+		services = fmt.Sprint(targets)
+	}
+	log.Printf("freeze: deploy of %s forced during %s: %s", services, p.Name, reason)
+	h.notify(notify.Event{
+		Kind: notify.KindFreezeOverride,
+		Text: fmt.Sprintf("tinyserve: deploy of %s forced during freeze %s: %s", services, p.Name, reason),
+		Details: map[string]string{
+			"freeze": p.Name,
+			"until":  p.End.Format(time.RFC3339),
+			"reason": reason,
+		},
+	})
+}
+
+type freezeSettings struct {
+	Windows []state.FreezeWindow `json:"windows"`
+	Active  *freeze.Period       `json:"active,omitempty"`
+	Next    *freeze.Period       `json:"next,omitempty"`
+}
+
+func freezeStatus(windows []state.FreezeWindow, now time.Time) (active, next *freeze.Period) {
+	if p, ok := freeze.Active(windows, now); ok {
+		active = &p
+	}
+	// While frozen, the next window worth mentioning is one that starts
+	// after this one lifts.
+	after := now
+	if active != nil {
+		after = active.End
+	}
+	if p, ok := freeze.Next(windows, after); ok {
+		next = &p
+	}
+	return active, next
+}
+
+// handleFreezeSettings serves /settings/freeze: GET lists the windows with
+// the active and next freeze, PUT replaces the list.
+func (h *Handler) handleFreezeSettings(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	st, err := h.Store.Load(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("load state: %v", err), http.StatusInternalServerError)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		h.writeFreezeSettings(w, st)
+	case http.MethodPut:
+		var req struct {
+			Windows []state.FreezeWindow `json:"windows"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := freeze.ValidateAll(req.Windows); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		st.Settings.FreezeWindows = req.Windows
+		if err := h.Store.Save(ctx, st); err != nil {
+			http.Error(w, fmt.Sprintf("save state: %v", err), http.StatusInternalServerError)
+			return
+		}
+		h.writeFreezeSettings(w, st)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) writeFreezeSettings(w http.ResponseWriter, st state.State) {
+	resp := freezeSettings{Windows: st.Settings.FreezeWindows}
+	if resp.Windows == nil {
+		resp.Windows = []state.FreezeWindow{}
+	}
+	resp.Active, resp.Next = freezeStatus(st.Settings.FreezeWindows, time.Now())
+	writeJSON(w, resp)
+}
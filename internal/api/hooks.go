@@ -0,0 +1,201 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"tinyserve/internal/deploys"
+	"tinyserve/internal/state"
+)
+
+const (
+	defaultHookTimeout    = 5 * time.Minute
+	maxHookTimeoutSeconds = 3600
+)
+
+// hookFunc runs a deploy hook for service against the compose project in dir.
+type hookFunc func(ctx context.Context, dir, phase, service string, command []string, w io.Writer) (int, error)
+
+func (h *Handler) deploysRoot() string {
+	return filepath.Join(h.dataRoot(), "deploys")
+}
+
+// composeHook runs pre-deploy hooks in a one-off container and post-deploy
+// hooks inside the running container.
+func (h *Handler) composeHook(ctx context.Context, dir, phase, service string, command []string, w io.Writer) (int, error) {
+	runner := h.newRunner(dir)
+	if phase == deploys.PhasePreDeploy {
+		return runner.RunCommand(ctx, service, command, w)
+	}
+	return runner.Exec(ctx, service, command, w)
+}
+
+func validateHooks(svc state.Service) error {
+	if svc.Hooks == nil {
+		return nil
+	}
+	if svc.IsJob() || svc.Type == state.ServiceTypeStatic {
+		return fmt.Errorf("deploy hooks are only supported for image and git-build services")
+	}
+	for _, hk := range []struct {
+		phase string
+		hook  *state.ServiceHook
+	}{
+		{deploys.PhasePreDeploy, svc.Hooks.PreDeploy},
+		{deploys.PhasePostDeploy, svc.Hooks.PostDeploy},
+	} {
+		if hk.hook == nil {
+			continue
+		}
+		if len(hk.hook.Command) == 0 || strings.TrimSpace(hk.hook.Command[0]) == "" {
+			return fmt.Errorf("%s hook needs a command", hk.phase)
+		}
+		if hk.hook.TimeoutSeconds < 0 || hk.hook.TimeoutSeconds > maxHookTimeoutSeconds {
+			return fmt.Errorf("%s hook timeout_seconds must be at most %d", hk.phase, maxHookTimeoutSeconds)
+		}
+	}
+	return nil
+}
+
+// runHooks runs the phase hook of every started target in order and records
+// each run on rec. It stops at the first failing hook.
+func (h *Handler) runHooks(ctx context.Context, dir string, st state.State, targets []string, phase string, rec *deploys.Record) error {
+	for _, svc := range st.Services {
+		name := sanitizeName(svc.Name)
+		if !svc.Enabled || svc.Hooks == nil || !slices.Contains(targets, name) {
+			continue
+		}
+		hook := svc.Hooks.PreDeploy
+		if phase == deploys.PhasePostDeploy {
+			hook = svc.Hooks.PostDeploy
+		}
+		if hook == nil {
+			continue
+		}
+		timeout := defaultHookTimeout
+		if hook.TimeoutSeconds > 0 {
+			timeout = time.Duration(hook.TimeoutSeconds) * time.Second
+		}
+
+		log.Printf("deploy %s: %s hook for %s: %s", rec.ID, phase, name, strings.Join(hook.Command, " "))
+		hctx, cancel := context.WithTimeout(ctx, timeout)
+		var out deploys.OutputBuffer
+		start := time.Now()
+		code, err := h.runHook(hctx, dir, phase, name, hook.Command, &out)
+		cancel()
+
+		run := deploys.HookRun{
+			Service:         name,
+			Phase:           phase,
+			Command:         hook.Command,
+			ExitCode:        code,
+			DurationMs:      time.Since(start).Milliseconds(),
+			Output:          out.String(),
+			OutputTruncated: out.Truncated,
+		}
+		switch {
+		case errors.Is(hctx.Err(), context.DeadlineExceeded):
+			run.Error = fmt.Sprintf("timed out after %s", timeout)
+		case err != nil:
+			run.Error = err.Error()
+		}
+		rec.Hooks = append(rec.Hooks, run)
+		if run.Failed() {
+			return hookError(run)
+		}
+	}
+	return nil
+}
+
+func hookError(run deploys.HookRun) error {
+	reason := run.Error
+	if reason == "" {
+		reason = fmt.Sprintf("exited with code %d", run.ExitCode)
+	}
+	lines := strings.Split(strings.TrimSpace(run.Output), "\n")
+	if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+		reason += ": " + last
+	}
+	return fmt.Errorf("%s hook for %s failed: %s", strings.ReplaceAll(run.Phase, "_", "-"), run.Service, reason)
+}
+
+// startDeploy saves a running record for a deploy of targets.
+func (h *Handler) startDeploy(trigger string, targets []string) deploys.Record {
+	rec := deploys.NewRecord(trigger, targets)
+	if err := h.Deploys.Save(rec); err != nil {
+		log.Printf("deploy %s: save record: %v", rec.ID, err)
+	}
+	return rec
+}
+
+// finishDeploy saves the outcome of rec and prunes old records.
+func (h *Handler) finishDeploy(rec *deploys.Record, err error) {
+	rec.Finish(err)
+	if err := h.Deploys.Save(*rec); err != nil {
+		log.Printf("deploy %s: save record: %v", rec.ID, err)
+	}
+	if err := h.Deploys.Prune(deploys.DefaultHistoryLimit); err != nil {
+		log.Printf("deploy: prune records: %v", err)
+	}
+}
+
+// handleDeploys serves the deploy history:
+//
+//	GET  /deploys[?service=NAME][&status=pending]   records, newest first
+//	GET  /deploys/{id}                               one record with build and hook output
+//	POST /deploys/{id}/approve|reject                decide a pending deploy
+func (h *Handler) handleDeploys(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.Trim(strings.TrimPrefix(r.URL.Path, "/deploys"), "/"), "/")
+	if action != "" {
+		h.handleDeployDecision(w, r, id, action, "cli")
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if id == "" {
+		service := sanitizeName(r.URL.Query().Get("service"))
+		status := r.URL.Query().Get("status")
+		all, err := h.Deploys.List(service)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("list deploys: %v", err), http.StatusInternalServerError)
+			return
+		}
+		recs := []deploys.Record{}
+		for _, rec := range all {
+			if status != "" && rec.Status != status {
+				continue
+			}
+			// Build and hook output can be large; the list only says how
+			// each went.
+			for j := range rec.Builds {
+				rec.Builds[j].Output = ""
+			}
+			for j := range rec.Hooks {
+				rec.Hooks[j].Output = ""
+			}
+			recs = append(recs, rec)
+		}
+		writeJSON(w, recs)
+		return
+	}
+	rec, err := h.Deploys.Get(id)
+	if errors.Is(err, deploys.ErrNotFound) {
+		http.Error(w, fmt.Sprintf("deploy %q not found", id), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("load deploy: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, rec)
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"tinyserve/internal/idle"
+	"tinyserve/internal/state"
+)
+
+const (
+	idleCheckInterval = time.Minute
+	wakeTimeout       = 2 * time.Minute
+	// accessLogReplay is how many recent Traefik log lines are re-read when
+	// the follower (re)connects; their timestamps keep replays harmless.
+	accessLogReplay = 200
+)
+
+// StartIdleManager tracks request activity from Traefik's access log and
+// stops services that have been idle for longer than their idle timeout.
+func (h *Handler) StartIdleManager(ctx context.Context) {
+	go idle.Watch(ctx, h.Idle, func(ctx context.Context, w io.Writer) error {
+		return h.newRunner(h.currentDir()).LogsFollow(ctx, "traefik", accessLogReplay, w)
+	})
+	go func() {
+		ticker := time.NewTicker(idleCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				h.stopIdleServices(ctx, now)
+			}
+		}
+	}()
+}
+
+// stopIdleServices stops every running service whose last request is older
+// than its idle timeout.
+func (h *Handler) stopIdleServices(ctx context.Context, now time.Time) {
+	st, err := h.Store.Load(ctx)
+	if err != nil {
+		log.Printf("idle: load state: %v", err)
+		return
+	}
+	timeouts := idleTimeouts(st)
+	if len(timeouts) == 0 {
+		return
+	}
+
+	runner := h.newRunner(h.currentDir())
+	statuses, err := runner.PSStatus(ctx)
+	if err != nil {
+		log.Printf("idle: container status: %v", err)
+		return
+	}
+	running := make(map[string]bool)
+	for _, c := range statuses {
+		if strings.EqualFold(c.State, "running") {
+			running[c.Service] = true
+		}
+	}
+
+	for name, timeout := range timeouts {
+		if !running[name] {
+			// Start a fresh grace period whenever it comes back up.
+			h.Idle.Forget(name)
+			continue
+		}
+		idleFor := h.Idle.IdleFor(name, now)
+		if idleFor < timeout {
+			continue
+		}
+		if out, err := runner.Stop(ctx, name); err != nil {
+			log.Printf("idle: stop %s: %v\n%s", name, err, out)
+			continue
+		}
+		h.Idle.Forget(name)
+		log.Printf("idle: stopped %s after %s without requests", name, idleFor.Round(time.Minute))
+	}
+}
+
+// idleTimeouts returns the idle timeout of every service that scales to zero.
+func idleTimeouts(st state.State) map[string]time.Duration {
+	timeouts := make(map[string]time.Duration)
+	for _, svc := range st.Services {
+		if !svc.Enabled || svc.IsJob() || svc.IdleTimeout <= 0 {
+			continue
+		}
+		timeouts[sanitizeName(svc.Name)] = time.Duration(svc.IdleTimeout) * time.Minute
+	}
+	return timeouts
+}
+
+// idleServiceForHost returns the scale-to-zero service that serves host.
+func idleServiceForHost(st state.State, host string) (state.Service, bool) {
+	svc, ok := serviceForHost(st, host)
+	if !ok || svc.IdleTimeout <= 0 {
+		return state.Service{}, false
+	}
+	return svc, true
+}
+
+// serviceForHost returns the enabled service Traefik routes host to.
+func serviceForHost(st state.State, host string) (state.Service, bool) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	for _, svc := range st.Services {
+		if !svc.Enabled || svc.IsJob() {
+			continue
+		}
+		for _, hn := range routedHostnames(st, svc) {
+			if strings.EqualFold(hn, host) {
+				return svc, true
+			}
+		}
+	}
+	return state.Service{}, false
+}
+
+// HandleWake serves requests that Traefik's fallback router sends while a
+// scale-to-zero service is stopped. The first request starts the service;
+// every request gets a self-refreshing "starting" page until the service is
+// healthy, then a redirect back to the same URL, which Traefik now routes to
+// the running container.
+func (h *Handler) HandleWake(w http.ResponseWriter, r *http.Request) {
+	st, err := h.Store.Load(r.Context())
+	if err != nil {
+		http.Error(w, "service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	svc, ok := idleServiceForHost(st, r.Host)
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if svc.Stopped {
+		http.Error(w, svc.Name+" is stopped", http.StatusServiceUnavailable)
+		return
+	}
+	name := sanitizeName(svc.Name)
+	counts := replicaCounts(st)
+
+	// The wake-up outlives this request: later page refreshes pick up its result.
+	ctx := context.WithoutCancel(r.Context())
+	ready, err := h.wakes.Wake(ctx, name, func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, wakeTimeout)
+		defer cancel()
+		log.Printf("idle: waking %s for %s", name, r.Host)
+		runner := h.newRunner(h.currentDir())
+		if out, err := runner.Up(ctx, name); err != nil {
+			return fmt.Errorf("compose up: %w\n%s", err, out)
+		}
+		if err := runner.WaitHealthyReplicas(ctx, []string{name}, counts, wakeTimeout); err != nil {
+			return err
+		}
+		h.Idle.Touch(name, time.Now())
+		return nil
+	})
+	if ready {
+		http.Redirect(w, r, r.URL.RequestURI(), http.StatusFound)
+		return
+	}
+	if err != nil {
+		log.Printf("idle: wake %s failed: %v", name, err)
+	}
+	writeWakePage(w, svc.Name, err)
+}
+
+func writeWakePage(w http.ResponseWriter, name string, wakeErr error) {
+	message := "Starting up, this page will refresh automatically…"
+	if wakeErr != nil {
+		message = "The service failed to start. Retrying…"
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Retry-After", "2")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	fmt.Fprintf(w, `<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="2">
+<title>Starting %[1]s</title>
+<style>body{font-family:system-ui,sans-serif;display:flex;align-items:center;justify-content:center;height:100vh;margin:0;color:#333}</style>
+</head>
+<body>
+<div><h1>%[1]s</h1><p>%[2]s</p></div>
+</body>
+</html>
+`, html.EscapeString(name), html.EscapeString(message))
+}
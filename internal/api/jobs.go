@@ -0,0 +1,244 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"tinyserve/internal/jobs"
+	"tinyserve/internal/state"
+)
+
+// Limits for per-job settings; zero means the default.
+const (
+	maxJobConcurrency  = 16
+	maxJobHistoryLimit = 1000
+)
+
+func (h *Handler) jobsRoot() string {
+	return filepath.Join(h.dataRoot(), "jobs")
+}
+
+// runJob runs one job container against the current (promoted) compose project.
+func (h *Handler) runJob(ctx context.Context, service string, w io.Writer) (int, error) {
+	return h.newRunner(h.currentDir()).RunOnce(ctx, service, w)
+}
+
+// ListJobs returns the enabled job services for the scheduler.
+func (h *Handler) ListJobs(ctx context.Context) ([]jobs.Job, error) {
+	st, err := h.Store.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var list []jobs.Job
+	for _, svc := range st.Services {
+		if !svc.Enabled || !svc.IsJob() || svc.Job == nil {
+			continue
+		}
+		list = append(list, jobs.Job{Name: sanitizeName(svc.Name), Spec: *svc.Job})
+	}
+	return list, nil
+}
+
+func validateJobSpec(svc state.Service) error {
+	if svc.Job == nil || strings.TrimSpace(svc.Job.Schedule) == "" {
+		return fmt.Errorf("job.schedule is required for %s services", state.ServiceTypeJob)
+	}
+	if _, err := jobs.ParseSchedule(svc.Job.Schedule); err != nil {
+		return fmt.Errorf("invalid job schedule: %w", err)
+	}
+	if svc.Job.MaxConcurrency < 0 || svc.Job.MaxConcurrency > maxJobConcurrency {
+		return fmt.Errorf("job max_concurrency must be between 1 and %d, got %d", maxJobConcurrency, svc.Job.MaxConcurrency)
+	}
+	if svc.Job.TimeoutSeconds < 0 {
+		return fmt.Errorf("job timeout_seconds must not be negative")
+	}
+	if svc.Job.HistoryLimit < 0 || svc.Job.HistoryLimit > maxJobHistoryLimit {
+		return fmt.Errorf("job history_limit must be between 1 and %d, got %d", maxJobHistoryLimit, svc.Job.HistoryLimit)
+	}
+	if len(svc.Hostnames) > 0 {
+		return fmt.Errorf("job services cannot have hostnames")
+	}
+	if svc.Replicas > 1 {
+		return fmt.Errorf("job services cannot be scaled; use job.max_concurrency")
+	}
+	if svc.IdleTimeout > 0 {
+		return fmt.Errorf("job services cannot have an idle timeout")
+	}
+	return nil
+}
+
+// upTargets drops job services from a deploy's target list: jobs are started
+// by the scheduler, never by "compose up". Services stopped by hand are
+// dropped too; their new config applies when they are started. ok is false
+// when no target is left, meaning there is nothing to start or health-check.
+func upTargets(st state.State, targets []string) (filtered []string, ok bool) {
+	if len(targets) == 0 {
+		return nil, true
+	}
+	skip := make(map[string]bool)
+	for _, svc := range st.Services {
+		if svc.IsJob() || svc.Stopped {
+			skip[sanitizeName(svc.Name)] = true
+		}
+	}
+	for _, t := range targets {
+		if !skip[t] {
+			filtered = append(filtered, t)
+		}
+	}
+	return filtered, len(filtered) > 0
+}
+
+// handleJobs serves GET /jobs: every job service with its next and last run.
+func (h *Handler) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	st, err := h.Store.Load(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("load state: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	list := []map[string]any{}
+	for _, svc := range st.Services {
+		if !svc.IsJob() || svc.Job == nil {
+			continue
+		}
+		item := map[string]any{
+			"name":     svc.Name,
+			"enabled":  svc.Enabled,
+			"schedule": svc.Job.Schedule,
+		}
+		if sched, err := jobs.ParseSchedule(svc.Job.Schedule); err == nil && svc.Enabled {
+			if next := sched.Next(now); !next.IsZero() {
+				item["next_run"] = next.UTC()
+			}
+		}
+		if h.Jobs != nil {
+			if runs, err := h.Jobs.History.List(sanitizeName(svc.Name)); err == nil && len(runs) > 0 {
+				item["last_run"] = runs[0]
+			}
+		}
+		list = append(list, item)
+	}
+	writeJSON(w, list)
+}
+
+// handleJobByName serves the per-job actions:
+//
+//	POST /jobs/{name}/run              start a run now
+//	GET  /jobs/{name}/runs             run history, newest first
+//	GET  /jobs/{name}/runs/{id}        a single run
+//	GET  /jobs/{name}/runs/{id}/logs   captured output of a run
+func (h *Handler) handleJobByName(w http.ResponseWriter, r *http.Request) {
+	raw := strings.TrimPrefix(r.URL.Path, "/jobs/")
+	parts := strings.Split(raw, "/")
+	if len(parts) < 2 || parts[0] == "" {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	name, err := url.PathUnescape(parts[0])
+	if err != nil {
+		http.Error(w, "invalid job name", http.StatusBadRequest)
+		return
+	}
+	if h.Jobs == nil {
+		http.Error(w, "job scheduler not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	st, err := h.Store.Load(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("load state: %v", err), http.StatusInternalServerError)
+		return
+	}
+	var svc *state.Service
+	for i := range st.Services {
+		if strings.EqualFold(st.Services[i].Name, name) {
+			svc = &st.Services[i]
+			break
+		}
+	}
+	if svc == nil {
+		http.Error(w, fmt.Sprintf("service %q not found", name), http.StatusNotFound)
+		return
+	}
+	if !svc.IsJob() || svc.Job == nil {
+		http.Error(w, fmt.Sprintf("service %q is not a job", svc.Name), http.StatusBadRequest)
+		return
+	}
+	jobName := sanitizeName(svc.Name)
+
+	switch {
+	case len(parts) == 2 && parts[1] == "run":
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		run, err := h.Jobs.Trigger(jobs.Job{Name: jobName, Spec: *svc.Job}, jobs.TriggerManual)
+		if errors.Is(err, jobs.ErrConcurrencyLimit) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("start job: %v", err), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, run)
+	case len(parts) == 2 && parts[1] == "runs":
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		runs, err := h.Jobs.History.List(jobName)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("list runs: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if runs == nil {
+			runs = []jobs.Run{}
+		}
+		writeJSON(w, runs)
+	case (len(parts) == 3 || len(parts) == 4) && parts[1] == "runs":
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if len(parts) == 4 && parts[3] != "logs" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		run, err := h.Jobs.History.Get(jobName, parts[2])
+		if errors.Is(err, jobs.ErrRunNotFound) {
+			http.Error(w, fmt.Sprintf("run %q not found", parts[2]), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("load run: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if len(parts) == 3 {
+			writeJSON(w, run)
+			return
+		}
+		output, err := h.Jobs.History.Output(jobName, run.ID)
+		if err != nil && !errors.Is(err, jobs.ErrRunNotFound) {
+			http.Error(w, fmt.Sprintf("read output: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write(output)
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"tinyserve/internal/state"
+)
+
+const lifecycleTimeout = 60 * time.Second
+
+// handleLifecycle serves POST /services/{name}/start, stop and restart.
+// They act on the containers of the promoted project and never regenerate
+// config. A stop is remembered: deploys and daemon restarts leave the
+// service down until it is started again.
+func (h *Handler) handleLifecycle(w http.ResponseWriter, r *http.Request, name, action string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	st, err := h.Store.Load(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("load state: %v", err), http.StatusInternalServerError)
+		return
+	}
+	svc := findService(&st, name)
+	if svc == nil {
+		http.Error(w, fmt.Sprintf("service %q not found", name), http.StatusNotFound)
+		return
+	}
+	if !svc.Enabled {
+		http.Error(w, "service disabled", http.StatusBadRequest)
+		return
+	}
+	if svc.IsJob() {
+		http.Error(w, "job services are started by their schedule; use tinyserve job run-now", http.StatusBadRequest)
+		return
+	}
+	dir := h.currentDir()
+	if !composeExists(dir) {
+		http.Error(w, "no deployed project", http.StatusConflict)
+		return
+	}
+	if action == "restart" && svc.Stopped {
+		http.Error(w, fmt.Sprintf("%s is stopped; start it instead", svc.Name), http.StatusConflict)
+		return
+	}
+	if !h.updates.begin(svc.Name) {
+		http.Error(w, "a deploy of the service is in progress", http.StatusConflict)
+		return
+	}
+	defer h.updates.end(svc.Name)
+
+	service := sanitizeName(svc.Name)
+	runner := h.newRunner(dir)
+	log.Printf("lifecycle: %s %s", action, service)
+	var status string
+	switch action {
+	case "stop":
+		if out, err := runner.Stop(ctx, service); err != nil {
+			http.Error(w, fmt.Sprintf("stop failed: %v\n%s", err, out), http.StatusInternalServerError)
+			return
+		}
+		svc.Stopped = true
+		status = "stopped"
+	case "start":
+		if out, err := runner.Up(ctx, "--no-deps", service); err != nil {
+			http.Error(w, fmt.Sprintf("start failed: %v\n%s", err, out), http.StatusInternalServerError)
+			return
+		}
+		svc.Stopped = false
+		status = "started"
+	case "restart":
+		if out, err := runner.Restart(ctx, service); err != nil {
+			http.Error(w, fmt.Sprintf("restart failed: %v\n%s", err, out), http.StatusInternalServerError)
+			return
+		}
+		status = "restarted"
+	}
+	if err := h.Store.Save(ctx, st); err != nil {
+		http.Error(w, fmt.Sprintf("save state: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if action != "stop" {
+		if err := runner.WaitHealthyReplicas(ctx, []string{service}, replicaCounts(st), lifecycleTimeout); err != nil {
+			http.Error(w, fmt.Sprintf("%s is not healthy: %v", svc.Name, err), http.StatusInternalServerError)
+			return
+		}
+	}
+	writeJSON(w, map[string]any{
+		"status":  status,
+		"service": svc.Name,
+	})
+}
+
+// StoppedScaleArgs returns compose up arguments that keep the services
+// stopped by hand down: a project-wide up would otherwise start them.
+func StoppedScaleArgs(st state.State) []string {
+	var args []string
+	for _, svc := range st.Services {
+		if svc.Stopped && svc.Enabled && !svc.IsJob() {
+			args = append(args, "--scale", sanitizeName(svc.Name)+"=0")
+		}
+	}
+	return args
+}
+
+// stoppedUpArgs is StoppedScaleArgs for the stored state, for the full ups
+// of rollbacks. Without state every service is started.
+func (h *Handler) stoppedUpArgs(ctx context.Context) []string {
+	st, err := h.Store.Load(ctx)
+	if err != nil {
+		log.Printf("load state: %v", err)
+		return nil
+	}
+	return StoppedScaleArgs(st)
+}
@@ -0,0 +1,230 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"tinyserve/internal/docker"
+	"tinyserve/internal/logstore"
+)
+
+const (
+	// logCollectInterval is how often the collector looks for containers it
+	// does not follow yet.
+	logCollectInterval = 5 * time.Second
+	logPruneInterval   = time.Hour
+)
+
+func (h *Handler) logsRoot() string {
+	return filepath.Join(h.dataRoot(), "logs", "services")
+}
+
+// logCollector follows the output of every container of the deployed
+// project into h.Logs.
+type logCollector struct {
+	h *Handler
+
+	mu         sync.Mutex
+	containers map[string]*followedContainer // by container ID
+}
+
+type followedContainer struct {
+	following bool
+	// cursor is the time of the newest stored line. A new follow asks the
+	// engine for lines from that second on and drops those already stored.
+	cursor time.Time
+}
+
+// StartLogCollector copies the stdout and stderr of the project's
+// containers to the log store, so logs outlive the containers, and prunes
+// the store. Containers that exist when the daemon starts resume after the
+// newest line stored for their service; later ones are read from their
+// first line.
+func (h *Handler) StartLogCollector(ctx context.Context) {
+	if h.Logs == nil {
+		return
+	}
+	c := &logCollector{h: h, containers: make(map[string]*followedContainer)}
+	go func() {
+		ticker := time.NewTicker(logCollectInterval)
+		defer ticker.Stop()
+		first := true
+		for {
+			c.scan(ctx, first)
+			first = false
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	go func() {
+		ticker := time.NewTicker(logPruneInterval)
+		defer ticker.Stop()
+		for {
+			h.pruneLogs()
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (h *Handler) pruneLogs() {
+	now := time.Now()
+	if err := h.Logs.Prune(now); err != nil {
+		log.Printf("logs: prune: %v", err)
+	}
+	if h.AccessLogs != nil && h.AccessLogs.Store != nil {
+		if err := h.AccessLogs.Store.Prune(now); err != nil {
+			log.Printf("logs: prune access logs: %v", err)
+		}
+	}
+}
+
+// scan starts following the running containers that are not followed yet
+// and forgets removed ones.
+func (c *logCollector) scan(ctx context.Context, startup bool) {
+	dir := c.h.currentDir()
+	if !composeExists(dir) {
+		return
+	}
+	containers, err := c.h.Docker.ListContainers(ctx, docker.ListOptions{Project: docker.ProjectName(dir), All: true})
+	if err != nil {
+		log.Printf("logs: list containers: %v", err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	seen := make(map[string]bool, len(containers))
+	for _, ctr := range containers {
+		seen[ctr.ID] = true
+		if ctr.Service == "" {
+			continue
+		}
+		fc := c.containers[ctr.ID]
+		if fc == nil {
+			fc = &followedContainer{}
+			if startup {
+				fc.cursor = c.h.Logs.Last(ctr.Service)
+			}
+			c.containers[ctr.ID] = fc
+		}
+		if fc.following || ctr.State != "running" {
+			continue
+		}
+		fc.following = true
+		go c.follow(ctx, ctr, fc)
+	}
+	for id, fc := range c.containers {
+		if !seen[id] && !fc.following {
+			delete(c.containers, id)
+		}
+	}
+}
+
+// follow stores the container's output until it stops or ctx is done.
+func (c *logCollector) follow(ctx context.Context, ctr docker.Container, fc *followedContainer) {
+	w := &logLineWriter{store: c.h.Logs, service: ctr.Service, stream: logstore.StreamStdout, skipUntil: fc.cursor}
+	ew := &logLineWriter{store: c.h.Logs, service: ctr.Service, stream: logstore.StreamStderr, skipUntil: fc.cursor}
+	opts := docker.LogOptions{Follow: true, Timestamps: true, Since: fc.cursor, Stderr: ew}
+	if err := c.h.Docker.ContainerLogs(ctx, ctr.ID, opts, w); err != nil && ctx.Err() == nil {
+		log.Printf("logs: follow %s: %v", ctr.Name, err)
+	}
+	w.flush()
+	ew.flush()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fc.following = false
+	if ew.last.After(w.last) {
+		w.last = ew.last
+	}
+	if w.last.After(fc.cursor) {
+		fc.cursor = w.last
+	}
+}
+
+// logLineWriter turns the timestamped output of a container stream into
+// store entries.
+type logLineWriter struct {
+	store     *logstore.Store
+	service   string
+	stream    string
+	skipUntil time.Time // lines at or before it are already stored
+	last      time.Time
+	partial   []byte
+}
+
+func (w *logLineWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	var entries []logstore.Entry
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		if e, ok := w.entry(string(w.partial[:i])); ok {
+			entries = append(entries, e)
+		}
+		w.partial = w.partial[i+1:]
+	}
+	if len(w.partial) > logstore.MaxLineBytes {
+		// A line this long is cut rather than held forever.
+		if e, ok := w.entry(string(w.partial)); ok {
+			entries = append(entries, e)
+		}
+		w.partial = nil
+	}
+	w.append(entries)
+	return len(p), nil
+}
+
+// flush stores an unterminated last line.
+func (w *logLineWriter) flush() {
+	if len(w.partial) == 0 {
+		return
+	}
+	if e, ok := w.entry(string(w.partial)); ok {
+		w.append([]logstore.Entry{e})
+	}
+	w.partial = nil
+}
+
+func (w *logLineWriter) append(entries []logstore.Entry) {
+	if len(entries) == 0 {
+		return
+	}
+	if err := w.store.Append(entries...); err != nil {
+		log.Printf("logs: store %s: %v", w.service, err)
+	}
+}
+
+// entry parses a line the engine prefixed with its RFC 3339 timestamp.
+func (w *logLineWriter) entry(line string) (logstore.Entry, bool) {
+	line = strings.TrimSuffix(line, "\r")
+	e := logstore.Entry{Service: w.service, Stream: w.stream, Line: line}
+	if ts, rest, ok := strings.Cut(line, " "); ok {
+		if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+			e.Time, e.Line = t, rest
+		}
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	} else if !w.skipUntil.IsZero() && !e.Time.After(w.skipUntil) {
+		return e, false
+	}
+	if e.Time.After(w.last) {
+		w.last = e.Time
+	}
+	return e, true
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"tinyserve/internal/logstore"
+)
+
+// logServices returns the services of a /logs request, given as repeated or
+// comma-separated service parameters.
+func logServices(q url.Values) []string {
+	var services []string
+	seen := make(map[string]bool)
+	for _, v := range q["service"] {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+			if name != "" && !seen[name] {
+				seen[name] = true
+				services = append(services, name)
+			}
+		}
+	}
+	return services
+}
+
+// isStoredLogQuery reports whether a /logs request reads the log store.
+// A plain request for one service keeps showing the live output of its
+// containers.
+func isStoredLogQuery(q url.Values, services []string) bool {
+	if len(services) > 1 || q.Get("format") == "json" {
+		return true
+	}
+	for _, key := range []string{"since", "until", "grep", "level"} {
+		if q.Get(key) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// storedLogTimeLayout is RFC 3339 with fixed milliseconds, so lines align.
+const storedLogTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// handleStoredLogs answers a /logs request from the stored logs of the
+// services and the access logs, merged oldest first.
+func (h *Handler) handleStoredLogs(w http.ResponseWriter, r *http.Request, services []string, tail int) {
+	q := r.URL.Query()
+	now := time.Now()
+	query := logstore.Query{Limit: tail}
+	if s := q.Get("since"); s != "" {
+		t, err := parseSince(s, now)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		query.Since = t
+	}
+	if s := q.Get("until"); s != "" {
+		t, err := parseSince(s, now)
+		if err != nil {
+			http.Error(w, "until must be an RFC 3339 time or a duration like 2h", http.StatusBadRequest)
+			return
+		}
+		query.Until = t
+	}
+	if s := q.Get("grep"); s != "" {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid grep: %v", err), http.StatusBadRequest)
+			return
+		}
+		query.Grep = re
+	}
+	if s := q.Get("level"); s != "" {
+		if _, err := logstore.ParseLevel(s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		query.Level = s
+	}
+
+	var serviceLogs, accessLogs []string
+	for _, name := range services {
+		if h.AccessLogs.Get(name) != nil {
+			accessLogs = append(accessLogs, name)
+		} else {
+			serviceLogs = append(serviceLogs, sanitizeName(name))
+		}
+	}
+	var entries []logstore.Entry
+	for _, part := range []struct {
+		store   *logstore.Store
+		sources []string
+	}{
+		{h.Logs, serviceLogs},
+		{h.AccessLogs.storeOrNil(), accessLogs},
+	} {
+		if len(part.sources) == 0 {
+			continue
+		}
+		if part.store == nil {
+			http.Error(w, "logs are not stored", http.StatusServiceUnavailable)
+			return
+		}
+		query.Services = part.sources
+		found, err := part.store.Query(query)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("logs: %v", err), http.StatusInternalServerError)
+			return
+		}
+		entries = append(entries, found...)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+	if tail > 0 && len(entries) > tail {
+		entries = entries[len(entries)-tail:]
+	}
+
+	if q.Get("format") == "json" {
+		if entries == nil {
+			entries = []logstore.Entry{}
+		}
+		writeJSON(w, entries)
+		return
+	}
+	var b strings.Builder
+	for _, e := range entries {
+		b.WriteString(e.Time.UTC().Format(storedLogTimeLayout))
+		if len(services) > 1 {
+			b.WriteString(" [" + e.Service + "]")
+		}
+		b.WriteString(" " + e.Line + "\n")
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = w.Write([]byte(b.String()))
+}
@@ -1,12 +1,20 @@
 package api
 
-import "sync"
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
 
-// LogBuffer stores recent log lines in memory.
+	"tinyserve/internal/logstore"
+)
+
+// LogBuffer stores recent log lines in memory, and on disk once persisted.
 type LogBuffer struct {
 	mu    sync.Mutex
 	lines []string
 	max   int
+	sink  func(line string)
 }
 
 func NewLogBuffer(max int) *LogBuffer {
@@ -21,14 +29,18 @@ func (b *LogBuffer) Add(line string) {
 		return
 	}
 	b.mu.Lock()
-	defer b.mu.Unlock()
+	sink := b.sink
 	if len(b.lines) >= b.max {
 		// Drop oldest line.
 		copy(b.lines, b.lines[1:])
 		b.lines[len(b.lines)-1] = line
-		return
+	} else {
+		b.lines = append(b.lines, line)
+	}
+	b.mu.Unlock()
+	if sink != nil {
+		sink(line)
 	}
-	b.lines = append(b.lines, line)
 }
 
 func (b *LogBuffer) Lines(tail int) []string {
@@ -51,6 +63,7 @@ type AccessLogs struct {
 	API     *LogBuffer
 	UI      *LogBuffer
 	Webhook *LogBuffer
+	Store   *logstore.Store // set by Persist
 }
 
 func NewAccessLogs(max int) *AccessLogs {
@@ -76,3 +89,42 @@ func (l *AccessLogs) Get(name string) *LogBuffer {
 		return nil
 	}
 }
+
+// accessLogQueue is how many access log lines may wait for the disk before
+// new ones are dropped from the store. They still reach the memory buffer.
+const accessLogQueue = 1024
+
+// Persist also writes every access log line to store, under the name of
+// its listener. Lines are written by a single goroutine, so requests never
+// wait for the disk or a log rotation.
+func (l *AccessLogs) Persist(store *logstore.Store) {
+	l.Store = store
+	entries := make(chan logstore.Entry, accessLogQueue)
+	var dropped atomic.Int64
+	for _, name := range []string{"api", "ui", "webhook"} {
+		l.Get(name).sink = func(line string) {
+			select {
+			case entries <- logstore.Entry{Time: time.Now(), Service: name, Stream: logstore.StreamAccess, Line: line}:
+			default:
+				dropped.Add(1)
+			}
+		}
+	}
+	go func() {
+		for e := range entries {
+			if n := dropped.Swap(0); n > 0 {
+				log.Printf("logs: dropped %d access log lines while the store fell behind", n)
+			}
+			if err := store.Append(e); err != nil {
+				log.Printf("logs: store %s access log: %v", e.Service, err)
+			}
+		}
+	}()
+}
+
+func (l *AccessLogs) storeOrNil() *logstore.Store {
+	if l == nil {
+		return nil
+	}
+	return l.Store
+}
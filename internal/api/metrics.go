@@ -0,0 +1,206 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tinyserve/internal/docker"
+	"tinyserve/internal/state"
+)
+
+// metricsSampleTimeout bounds one round of stats requests. The engine takes
+// about a second per container to measure CPU use, but they run in parallel.
+const metricsSampleTimeout = 10 * time.Second
+
+// defaultMetricsRange is the span /services/{name}/metrics returns without
+// a range parameter.
+const defaultMetricsRange = time.Hour
+
+type metricsResponse struct {
+	Service     string               `json:"service"`
+	Range       string               `json:"range"`
+	StepSeconds int                  `json:"step_seconds"`
+	Points      []state.MetricSample `json:"points"`
+}
+
+// StartMetricsSampler records the resource use of each service at the
+// finest metrics step and compacts older samples into the coarser ones.
+func (h *Handler) StartMetricsSampler(ctx context.Context) {
+	if h.Metrics == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(state.MetricTiers[0].Step)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				h.sampleMetrics(ctx, now)
+			}
+		}
+	}()
+}
+
+// sampleMetrics takes one sample of every running container of the project
+// and stores the sums per service. Network and block IO rates come from the
+// counters of the previous sample of the same container.
+func (h *Handler) sampleMetrics(ctx context.Context, now time.Time) {
+	dir := h.currentDir()
+	if !composeExists(dir) {
+		return
+	}
+	containers, err := h.Docker.ListContainers(ctx, docker.ListOptions{Project: docker.ProjectName(dir)})
+	if err != nil {
+		log.Printf("metrics: list containers: %v", err)
+		return
+	}
+
+	statsCtx, cancel := context.WithTimeout(ctx, metricsSampleTimeout)
+	defer cancel()
+	stats := make([]docker.Stats, len(containers))
+	errs := make([]error, len(containers))
+	var wg sync.WaitGroup
+	for i, c := range containers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stats[i], errs[i] = h.Docker.ContainerStats(statsCtx, c.ID)
+		}()
+	}
+	wg.Wait()
+
+	at := now.UTC().Truncate(time.Second)
+	byService := make(map[string]*state.MetricSample)
+	seen := make(map[string]docker.Stats, len(containers))
+	for i, c := range containers {
+		if err := errs[i]; err != nil {
+			if !errors.Is(err, docker.ErrNotFound) {
+				log.Printf("metrics: stats of %s: %v", c.Name, err)
+			}
+			continue
+		}
+		s := stats[i]
+		if s.Read.IsZero() {
+			s.Read = now
+		}
+		m := byService[c.Service]
+		if m == nil {
+			m = &state.MetricSample{Service: c.Service, Time: at}
+			byService[c.Service] = m
+		}
+		m.Containers++
+		m.CPUPercent += s.CPUPercent
+		m.MemoryBytes += s.MemoryBytes
+		m.MemoryLimitBytes = max(m.MemoryLimitBytes, s.MemoryLimitBytes)
+		if prev, ok := h.lastStats[c.ID]; ok {
+			if secs := s.Read.Sub(prev.Read).Seconds(); secs > 0 {
+				m.NetworkRxRate += counterRate(prev.NetworkRxBytes, s.NetworkRxBytes, secs)
+				m.NetworkTxRate += counterRate(prev.NetworkTxBytes, s.NetworkTxBytes, secs)
+				m.BlockReadRate += counterRate(prev.BlockReadBytes, s.BlockReadBytes, secs)
+				m.BlockWriteRate += counterRate(prev.BlockWriteBytes, s.BlockWriteBytes, secs)
+			}
+		}
+		seen[c.ID] = s
+	}
+	h.lastStats = seen
+
+	samples := make([]state.MetricSample, 0, len(byService))
+	for _, m := range byService {
+		samples = append(samples, *m)
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].Service < samples[j].Service })
+	if err := h.Metrics.AppendMetrics(ctx, samples); err != nil {
+		log.Printf("metrics: %v", err)
+		return
+	}
+	if err := h.Metrics.CompactMetrics(ctx, now); err != nil {
+		log.Printf("metrics: %v", err)
+	}
+}
+
+// counterRate is the per-second increase of a counter, or zero if it went
+// down because the container restarted.
+func counterRate(prev, cur uint64, secs float64) float64 {
+	if cur < prev {
+		return 0
+	}
+	return float64(cur-prev) / secs
+}
+
+func (h *Handler) handleServiceMetrics(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.Metrics == nil {
+		http.Error(w, "metrics not available", http.StatusNotImplemented)
+		return
+	}
+	ctx := r.Context()
+	st, err := h.Store.Load(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("load state: %v", err), http.StatusInternalServerError)
+		return
+	}
+	svc := findService(&st, name)
+	if svc == nil {
+		http.Error(w, fmt.Sprintf("service %q not found", name), http.StatusNotFound)
+		return
+	}
+
+	span := defaultMetricsRange
+	rangeParam := r.URL.Query().Get("range")
+	if rangeParam != "" {
+		span, err = parseMetricsRange(rangeParam)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		rangeParam = "1h"
+	}
+	tier := state.TierFor(span)
+	points, err := h.Metrics.QueryMetrics(ctx, sanitizeName(svc.Name), tier.Step, time.Now().Add(-span))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("query metrics: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if points == nil {
+		points = []state.MetricSample{}
+	}
+	writeJSON(w, metricsResponse{
+		Service:     svc.Name,
+		Range:       rangeParam,
+		StepSeconds: int(tier.Step.Seconds()),
+		Points:      points,
+	})
+}
+
+// parseMetricsRange accepts Go durations and whole days such as "7d", up to
+// the retention of the coarsest metrics.
+func parseMetricsRange(s string) (time.Duration, error) {
+	var d time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(s)
+	}
+	longest := state.MetricTiers[len(state.MetricTiers)-1].Retention
+	if err != nil || d <= 0 || d > longest {
+		return 0, fmt.Errorf("range must be a duration like 24h or 7d, up to %dd", int(longest.Hours()/24))
+	}
+	return d, nil
+}
@@ -0,0 +1,283 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"tinyserve/internal/generate"
+	"tinyserve/internal/state"
+)
+
+// Limits for daemon-served pages.
+const (
+	maxErrorPageBytes        = 64 << 10
+	maxMaintenanceMessageLen = 500
+)
+
+type maintenanceRequest struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message,omitempty"`
+}
+
+type errorPagesRequest struct {
+	NotFound    string `json:"not_found,omitempty"`
+	ServerError string `json:"server_error,omitempty"`
+}
+
+func validatePages(svc state.Service) error {
+	if svc.Maintenance != nil && len(svc.Maintenance.Message) > maxMaintenanceMessageLen {
+		return fmt.Errorf("maintenance message must be at most %d bytes", maxMaintenanceMessageLen)
+	}
+	if svc.ErrorPages != nil {
+		if len(svc.ErrorPages.NotFound) > maxErrorPageBytes || len(svc.ErrorPages.ServerError) > maxErrorPageBytes {
+			return fmt.Errorf("error pages must be at most %d KB each", maxErrorPageBytes>>10)
+		}
+	}
+	if (svc.Maintenance != nil || svc.ErrorPages != nil) && svc.IsJob() {
+		return fmt.Errorf("job services have no hostnames to serve pages on")
+	}
+	return nil
+}
+
+// HandleDaemonPages serves everything Traefik routes to the daemon: custom
+// error pages, maintenance pages and wake-ups of stopped idle services.
+func (h *Handler) HandleDaemonPages(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, generate.ErrorPagesPath) {
+		h.serveErrorPage(w, r)
+		return
+	}
+	st, err := h.Store.Load(r.Context())
+	if err != nil {
+		http.Error(w, "service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if svc, ok := serviceForHost(st, r.Host); ok && svc.Maintenance != nil {
+		writeMaintenancePage(w, svc)
+		return
+	}
+	h.HandleWake(w, r)
+}
+
+// serveErrorPage serves GET /_tinyserve/errors/{service}/{status}, the
+// target of a service's Traefik errors middleware.
+func (h *Handler) serveErrorPage(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, generate.ErrorPagesPath), "/")
+	if len(parts) != 2 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	status, err := strconv.Atoi(parts[1])
+	if err != nil || status < 400 || status > 599 {
+		http.Error(w, "invalid status", http.StatusBadRequest)
+		return
+	}
+	st, err := h.Store.Load(r.Context())
+	if err != nil {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	var page string
+	for _, svc := range st.Services {
+		if sanitizeName(svc.Name) != parts[0] || svc.ErrorPages == nil {
+			continue
+		}
+		switch {
+		case status == http.StatusNotFound:
+			page = svc.ErrorPages.NotFound
+		case status >= 500:
+			page = svc.ErrorPages.ServerError
+		}
+		break
+	}
+	if page == "" {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(page))
+}
+
+func writeMaintenancePage(w http.ResponseWriter, svc state.Service) {
+	message := svc.Maintenance.Message
+	if message == "" {
+		message = "This service is down for scheduled maintenance. Please check back soon."
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Retry-After", "300")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	fmt.Fprintf(w, `<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>%[1]s is under maintenance</title>
+<style>body{font-family:system-ui,sans-serif;display:flex;align-items:center;justify-content:center;height:100vh;margin:0;color:#333}</style>
+</head>
+<body>
+<div><h1>Down for maintenance</h1><p>%[2]s</p></div>
+</body>
+</html>
+`, html.EscapeString(svc.Name), html.EscapeString(message))
+}
+
+// handleMaintenance serves POST /services/{name}/maintenance. It reroutes the
+// service's hostnames to the maintenance page, or back, by rewriting Traefik's
+// live file-provider config; the app container is left running untouched.
+func (h *Handler) handleMaintenance(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req maintenanceRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	req.Message = strings.TrimSpace(req.Message)
+	if len(req.Message) > maxMaintenanceMessageLen {
+		http.Error(w, fmt.Sprintf("message must be at most %d bytes", maxMaintenanceMessageLen), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	st, err := h.Store.Load(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("load state: %v", err), http.StatusInternalServerError)
+		return
+	}
+	svc := findService(&st, name)
+	if svc == nil {
+		http.Error(w, fmt.Sprintf("service %q not found", name), http.StatusNotFound)
+		return
+	}
+	if req.Enabled {
+		if !svc.Enabled || svc.IsJob() {
+			http.Error(w, "maintenance mode needs an enabled, routed service", http.StatusBadRequest)
+			return
+		}
+		if len(svc.Hostnames) == 0 && st.Settings.DefaultDomain == "" {
+			http.Error(w, "service has no hostnames", http.StatusBadRequest)
+			return
+		}
+		since := time.Now().UTC()
+		if svc.Maintenance != nil {
+			since = svc.Maintenance.Since
+		}
+		svc.Maintenance = &state.ServiceMaintenance{Message: req.Message, Since: since}
+	} else {
+		svc.Maintenance = nil
+	}
+
+	if err := h.Store.Save(ctx, st); err != nil {
+		http.Error(w, fmt.Sprintf("save state: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if err := h.writeLiveTraefik(generate.TraefikDynamic(st, activeRuntime())); err != nil {
+		http.Error(w, fmt.Sprintf("update traefik routes: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	status := "maintenance_off"
+	if req.Enabled {
+		status = "maintenance_on"
+	}
+	log.Printf("maintenance: %s %s", svc.Name, strings.TrimPrefix(status, "maintenance_"))
+	writeJSON(w, map[string]any{
+		"status":      status,
+		"service":     svc.Name,
+		"maintenance": svc.Maintenance,
+	})
+}
+
+// handleErrorPages serves the custom error pages of a service:
+//
+//	GET    /services/{name}/error-pages   current pages
+//	PUT    /services/{name}/error-pages   replace the pages
+//	DELETE /services/{name}/error-pages   remove all pages
+//
+// Page content is served live. Adding or removing a page class changes the
+// service's Traefik errors middleware, which takes effect on the next deploy.
+func (h *Handler) handleErrorPages(w http.ResponseWriter, r *http.Request, name string) {
+	ctx := r.Context()
+	st, err := h.Store.Load(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("load state: %v", err), http.StatusInternalServerError)
+		return
+	}
+	svc := findService(&st, name)
+	if svc == nil {
+		http.Error(w, fmt.Sprintf("service %q not found", name), http.StatusNotFound)
+		return
+	}
+
+	var pages *state.ServiceErrorPages
+	switch r.Method {
+	case http.MethodGet:
+		if svc.ErrorPages == nil {
+			writeJSON(w, state.ServiceErrorPages{})
+			return
+		}
+		writeJSON(w, svc.ErrorPages)
+		return
+	case http.MethodPut:
+		var req errorPagesRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 2*maxErrorPageBytes+(1<<16))).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if req.NotFound != "" || req.ServerError != "" {
+			pages = &state.ServiceErrorPages{NotFound: req.NotFound, ServerError: req.ServerError}
+		}
+	case http.MethodDelete:
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	updated := *svc
+	updated.ErrorPages = pages
+	if err := validatePages(updated); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	deployRequired := errorPageClasses(svc.ErrorPages) != errorPageClasses(pages)
+	svc.ErrorPages = pages
+	if err := h.Store.Save(ctx, st); err != nil {
+		http.Error(w, fmt.Sprintf("save state: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]any{
+		"status":          "updated",
+		"service":         svc.Name,
+		"not_found":       pages != nil && pages.NotFound != "",
+		"server_error":    pages != nil && pages.ServerError != "",
+		"deploy_required": deployRequired,
+	})
+}
+
+// errorPageClasses summarizes which status classes have a page configured.
+func errorPageClasses(pages *state.ServiceErrorPages) [2]bool {
+	if pages == nil {
+		return [2]bool{}
+	}
+	return [2]bool{pages.NotFound != "", pages.ServerError != ""}
+}
+
+// findService returns a pointer into st for the service called name.
+func findService(st *state.State, name string) *state.Service {
+	for i := range st.Services {
+		if strings.EqualFold(st.Services[i].Name, name) {
+			return &st.Services[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,448 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"tinyserve/internal/cloudflare"
+	"tinyserve/internal/deploys"
+	"tinyserve/internal/state"
+	"tinyserve/internal/validate"
+)
+
+const (
+	defaultPreviewTTL   = 72 * time.Hour
+	maxPreviewTTL       = 30 * 24 * time.Hour
+	previewReapInterval = 5 * time.Minute
+)
+
+type previewRequest struct {
+	PR       int    `json:"pr"`
+	Tag      string `json:"tag"`                 // image tag of the parent's repository
+	TTLHours int    `json:"ttl_hours,omitempty"` // defaults to 72
+}
+
+// HandleWebhookPreview serves pull request previews on the webhook listener:
+//
+//	POST   /webhook/preview/{service}       create or update the preview for a PR
+//	DELETE /webhook/preview/{service}/{pr}  tear it down
+//
+// Tokens scoped to a service may only manage previews of that service.
+func (h *Handler) HandleWebhookPreview(w http.ResponseWriter, r *http.Request) {
+	raw := strings.TrimPrefix(r.URL.Path, "/webhook/preview/")
+	parts := strings.Split(raw, "/")
+	if parts[0] == "" || len(parts) > 2 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	parent, err := url.PathUnescape(parts[0])
+	if err != nil {
+		http.Error(w, "invalid service name", http.StatusBadRequest)
+		return
+	}
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodPost:
+	case len(parts) == 2 && r.Method == http.MethodDelete:
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token, status, msg := h.requireWebhookToken(r)
+	if status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+	if !isTokenAllowedForService(token, parent) {
+		http.Error(w, "token not authorized for this service", http.StatusForbidden)
+		return
+	}
+
+	if len(parts) == 1 {
+		h.handleCreatePreview(w, r, parent)
+		return
+	}
+	pr, err := strconv.Atoi(parts[1])
+	if err != nil || pr < 1 {
+		http.Error(w, "invalid pull request number", http.StatusBadRequest)
+		return
+	}
+	h.handleDeletePreview(w, r, parent, pr)
+}
+
+func (h *Handler) handleCreatePreview(w http.ResponseWriter, r *http.Request, parentName string) {
+	var req previewRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.PR < 1 {
+		http.Error(w, "pr must be a positive pull request number", http.StatusBadRequest)
+		return
+	}
+	if err := validate.ImageTag(req.Tag); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ttl := defaultPreviewTTL
+	if req.TTLHours != 0 {
+		ttl = time.Duration(req.TTLHours) * time.Hour
+		if req.TTLHours < 0 || ttl > maxPreviewTTL {
+			http.Error(w, fmt.Sprintf("ttl_hours must be between 1 and %d", int(maxPreviewTTL.Hours())), http.StatusBadRequest)
+			return
+		}
+	}
+	timeout := 60 * time.Second
+	if q := r.URL.Query().Get("timeout"); q != "" {
+		seconds, err := strconv.Atoi(q)
+		if err != nil || seconds <= 0 {
+			http.Error(w, "invalid timeout", http.StatusBadRequest)
+			return
+		}
+		timeout = time.Duration(seconds) * time.Second
+	}
+
+	ctx := r.Context()
+	st, err := h.Store.Load(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("load state: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	var parent *state.Service
+	for i := range st.Services {
+		if strings.EqualFold(st.Services[i].Name, parentName) {
+			parent = &st.Services[i]
+			break
+		}
+	}
+	if parent == nil {
+		http.Error(w, "service not found", http.StatusNotFound)
+		return
+	}
+	if parent.Preview != nil {
+		http.Error(w, "cannot preview a preview", http.StatusBadRequest)
+		return
+	}
+	if parent.Type != "" && parent.Type != state.ServiceTypeRegistryImage {
+		http.Error(w, fmt.Sprintf("previews are only supported for %s services", state.ServiceTypeRegistryImage), http.StatusBadRequest)
+		return
+	}
+	if !parent.Enabled {
+		http.Error(w, "service disabled", http.StatusBadRequest)
+		return
+	}
+
+	image := imageWithTag(parent.Image, req.Tag)
+	if err := validate.ImageName(image); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	hostname := previewHostname(*parent, req.PR, st.Settings.DefaultDomain)
+	if hostname == "" {
+		http.Error(w, "service has no hostname and no default_domain is configured", http.StatusBadRequest)
+		return
+	}
+	if err := validate.Hostname(hostname); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	name := previewName(parent.Name, req.PR)
+	existing := -1
+	for i, svc := range st.Services {
+		if strings.EqualFold(svc.Name, name) {
+			if svc.Preview == nil || !strings.EqualFold(svc.Preview.Parent, parent.Name) {
+				http.Error(w, fmt.Sprintf("service %q already exists and is not a preview of %q", svc.Name, parent.Name), http.StatusConflict)
+				return
+			}
+			existing = i
+			continue
+		}
+		for _, host := range svc.Hostnames {
+			if strings.EqualFold(host, hostname) {
+				http.Error(w, fmt.Sprintf("hostname %q already used by service %q", hostname, svc.Name), http.StatusConflict)
+				return
+			}
+		}
+	}
+
+	preview, err := h.newPreviewService(*parent, req.PR, image, hostname, time.Now().UTC().Add(ttl))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("prepare preview: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if existing >= 0 {
+		preview.ID = st.Services[existing].ID
+		st.Services[existing] = preview
+	} else {
+		st.Services = append(st.Services, preview)
+	}
+
+	dns := "skipped"
+	if st.Settings.CloudflareAPIToken != "" && st.Settings.Tunnel.TunnelID != "" {
+		cfClient := cloudflare.NewClient(st.Settings.CloudflareAPIToken)
+		zoneID, err := cfClient.GetZoneID(ctx, hostname)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("get zone ID for %s: %v", hostname, err), http.StatusBadRequest)
+			return
+		}
+		target := fmt.Sprintf("%s.cfargotunnel.com", st.Settings.Tunnel.TunnelID)
+		if err := cfClient.EnsureCNAME(ctx, zoneID, hostname, target, true); err != nil {
+			http.Error(w, fmt.Sprintf("configure DNS for %s: %v", hostname, err), http.StatusInternalServerError)
+			return
+		}
+		dns = "configured"
+	}
+
+	// cloudflared is redeployed so it picks up the new ingress rule.
+	target := sanitizeName(name)
+	log.Printf("preview: deploying %s (%s) at %s", target, image, hostname)
+	if err := h.applyConfig(ctx, &st, deploys.TriggerPreview, []string{target, "cloudflared"}, timeout); err != nil {
+		if existing < 0 && dns == "configured" {
+			if dnsErr := deletePreviewDNS(ctx, st, []string{hostname}); dnsErr != nil {
+				log.Printf("preview: remove DNS for failed preview %s: %v", target, dnsErr)
+			}
+		}
+		http.Error(w, fmt.Sprintf("deploy failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().UTC()
+	for i := range st.Services {
+		if strings.EqualFold(st.Services[i].Name, name) {
+			h.markDeployed(ctx, &st.Services[i], now)
+		}
+	}
+	if err := h.Store.Save(ctx, st); err != nil {
+		http.Error(w, fmt.Sprintf("save state: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]any{
+		"status":     "deployed",
+		"service":    preview.Name,
+		"parent":     parent.Name,
+		"pr":         req.PR,
+		"image":      image,
+		"hostname":   hostname,
+		"url":        "https://" + hostname,
+		"dns":        dns,
+		"expires_at": preview.Preview.ExpiresAt.Format(time.RFC3339),
+	})
+}
+
+func (h *Handler) handleDeletePreview(w http.ResponseWriter, r *http.Request, parentName string, pr int) {
+	ctx := r.Context()
+	st, err := h.Store.Load(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("load state: %v", err), http.StatusInternalServerError)
+		return
+	}
+	name := previewName(parentName, pr)
+	idx := -1
+	for i, svc := range st.Services {
+		if strings.EqualFold(svc.Name, name) && svc.Preview != nil && strings.EqualFold(svc.Preview.Parent, parentName) {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		http.Error(w, "preview not found", http.StatusNotFound)
+		return
+	}
+	if err := h.teardownPreview(ctx, &st, idx); err != nil {
+		http.Error(w, fmt.Sprintf("teardown preview: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]any{"status": "removed", "service": name})
+}
+
+// teardownPreview removes a preview's container, DNS record and data
+// directory, drops it from st and regenerates the config without it.
+func (h *Handler) teardownPreview(ctx context.Context, st *state.State, idx int) error {
+	svc := st.Services[idx]
+	if svc.Preview == nil {
+		return fmt.Errorf("service %q is not a preview", svc.Name)
+	}
+	name := sanitizeName(svc.Name)
+
+	current := h.currentDir()
+	if _, err := os.Stat(filepath.Join(current, "docker-compose.yml")); err == nil {
+		if _, err := h.newRunner(current).Remove(ctx, name); err != nil && !strings.Contains(err.Error(), "No such service") {
+			return fmt.Errorf("remove container: %w", err)
+		}
+	}
+	if err := deletePreviewDNS(ctx, *st, svc.Hostnames); err != nil {
+		log.Printf("preview: remove DNS for %s: %v", name, err)
+	}
+	if root := h.dataRoot(); root != "" {
+		if err := os.RemoveAll(filepath.Join(root, "services", name)); err != nil {
+			log.Printf("preview: remove data for %s: %v", name, err)
+		}
+	}
+
+	st.Services = append(st.Services[:idx], st.Services[idx+1:]...)
+	if err := h.Store.Save(ctx, *st); err != nil {
+		return fmt.Errorf("save state: %w", err)
+	}
+	log.Printf("preview: removed %s", name)
+
+	// Redeploy cloudflared so it drops the ingress rule.
+	if err := h.apply(ctx, st, applyOptions{Targets: []string{"cloudflared"}, Timeout: 60 * time.Second, SkipPull: true}); err != nil {
+		return fmt.Errorf("preview removed but config refresh failed: %w", err)
+	}
+	return nil
+}
+
+// StartPreviewReaper tears down expired previews until ctx is cancelled.
+func (h *Handler) StartPreviewReaper(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(previewReapInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				h.reapExpiredPreviews(ctx, time.Now())
+			}
+		}
+	}()
+}
+
+func (h *Handler) reapExpiredPreviews(ctx context.Context, now time.Time) {
+	st, err := h.Store.Load(ctx)
+	if err != nil {
+		log.Printf("preview: load state: %v", err)
+		return
+	}
+	for {
+		idx := -1
+		for i, svc := range st.Services {
+			if svc.Preview != nil && now.After(svc.Preview.ExpiresAt) {
+				idx = i
+				break
+			}
+		}
+		if idx == -1 {
+			return
+		}
+		name := st.Services[idx].Name
+		log.Printf("preview: %s expired at %s", name, st.Services[idx].Preview.ExpiresAt.Format(time.RFC3339))
+		if err := h.teardownPreview(ctx, &st, idx); err != nil {
+			log.Printf("preview: teardown %s: %v", name, err)
+			return
+		}
+	}
+}
+
+// newPreviewService clones parent into a preview with its own image, hostname
+// and data directory.
+func (h *Handler) newPreviewService(parent state.Service, pr int, image, hostname string, expires time.Time) (state.Service, error) {
+	name := previewName(parent.Name, pr)
+	svc := parent
+	svc.ID = fmt.Sprintf("%s-%d", name, time.Now().Unix())
+	svc.Name = name
+	svc.Image = image
+	svc.Hostnames = []string{hostname}
+	svc.Replicas = 0
+	svc.LastDeploy = nil
+	svc.DeployedImage = ""
+	svc.Status = ""
+	svc.UptimeSeconds = 0
+	svc.UpdatePolicy = nil
+	svc.Webhook = nil
+	// The env is shared with the parent, so a migration hook could run a pull
+	// request's migrations against the parent's database.
+	svc.Hooks = nil
+	svc.Preview = &state.ServicePreview{Parent: parent.Name, PR: pr, ExpiresAt: expires}
+	if parent.Env != nil {
+		svc.Env = make(map[string]string, len(parent.Env))
+		for k, v := range parent.Env {
+			svc.Env[k] = v
+		}
+	}
+	volumes, err := previewVolumes(h.dataRoot(), parent.Name, name, parent.Volumes)
+	if err != nil {
+		return state.Service{}, err
+	}
+	svc.Volumes = volumes
+	return svc, nil
+}
+
+// previewVolumes points mounts under the parent's managed data directory at an
+// empty directory of the preview's own; other mounts are shared unchanged.
+func previewVolumes(dataRoot, parent, preview string, volumes []string) ([]string, error) {
+	if len(volumes) == 0 {
+		return nil, nil
+	}
+	parentDir := filepath.Join(dataRoot, "services", sanitizeName(parent))
+	previewDir := filepath.Join(dataRoot, "services", sanitizeName(preview))
+	out := make([]string, 0, len(volumes))
+	for _, v := range volumes {
+		host, rest, ok := strings.Cut(v, ":")
+		if ok && dataRoot != "" && strings.HasPrefix(host+string(filepath.Separator), parentDir+string(filepath.Separator)) {
+			host = previewDir + strings.TrimPrefix(host, parentDir)
+			if err := os.MkdirAll(host, 0o700); err != nil {
+				return nil, fmt.Errorf("create volume dir %s: %w", host, err)
+			}
+			v = host + ":" + rest
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func previewName(parent string, pr int) string {
+	return fmt.Sprintf("%s-pr-%d", sanitizeName(parent), pr)
+}
+
+// previewHostname returns pr-<n>.<service hostname>, falling back to
+// pr-<n>.<service>.<default domain> when the service has no hostname.
+func previewHostname(parent state.Service, pr int, defaultDomain string) string {
+	if len(parent.Hostnames) > 0 {
+		return fmt.Sprintf("pr-%d.%s", pr, parent.Hostnames[0])
+	}
+	if defaultDomain == "" {
+		return ""
+	}
+	return fmt.Sprintf("pr-%d.%s.%s", pr, sanitizeName(parent.Name), defaultDomain)
+}
+
+// imageWithTag replaces the tag (and any digest) of image with tag.
+func imageWithTag(image, tag string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image + ":" + tag
+}
+
+func deletePreviewDNS(ctx context.Context, st state.State, hostnames []string) error {
+	if st.Settings.CloudflareAPIToken == "" {
+		return nil
+	}
+	cfClient := cloudflare.NewClient(st.Settings.CloudflareAPIToken)
+	for _, hostname := range hostnames {
+		zoneID, err := cfClient.GetZoneID(ctx, hostname)
+		if err != nil {
+			return fmt.Errorf("get zone ID for %s: %w", hostname, err)
+		}
+		if err := cfClient.DeleteCNAME(ctx, zoneID, hostname); err != nil {
+			return fmt.Errorf("delete CNAME %s: %w", hostname, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"tinyserve/internal/docker"
+	"tinyserve/internal/generate"
+	"tinyserve/internal/state"
+)
+
+// runtimeSettings is the body of GET and PUT /settings/runtime. The daemon
+// picks its platform at startup, so a changed setting shows up in Active
+// only after a restart.
+type runtimeSettings struct {
+	Runtime         string          `json:"runtime"`
+	Active          docker.Platform `json:"active"`
+	RestartRequired bool            `json:"restart_required"`
+}
+
+func (h *Handler) handleRuntimeSettings(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	st, err := h.Store.Load(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("load state: %v", err), http.StatusInternalServerError)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeRuntimeSettings(w, st)
+	case http.MethodPut:
+		var req struct {
+			Runtime string `json:"runtime"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<12)).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if !docker.ValidPlatform(req.Runtime) {
+			http.Error(w, fmt.Sprintf("runtime must be %s or %s", docker.PlatformDocker, docker.PlatformPodman), http.StatusBadRequest)
+			return
+		}
+		if req.Runtime == docker.PlatformDocker {
+			req.Runtime = ""
+		}
+		st.Settings.ContainerRuntime = req.Runtime
+		if err := h.Store.Save(ctx, st); err != nil {
+			http.Error(w, fmt.Sprintf("save state: %v", err), http.StatusInternalServerError)
+			return
+		}
+		writeRuntimeSettings(w, st)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeRuntimeSettings(w http.ResponseWriter, st state.State) {
+	resp := runtimeSettings{Runtime: st.Settings.ContainerRuntime, Active: docker.CurrentPlatform()}
+	if resp.Runtime == "" {
+		resp.Runtime = docker.PlatformDocker
+	}
+	resp.RestartRequired = resp.Runtime != resp.Active.Name
+	writeJSON(w, resp)
+}
+
+// activeRuntime is the engine generated files are written for: the one the
+// daemon started on, not a changed setting waiting for the restart.
+func activeRuntime() generate.Runtime {
+	p := docker.CurrentPlatform()
+	return generate.Runtime{Name: p.Name, Socket: p.Socket}
+}
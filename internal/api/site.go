@@ -0,0 +1,222 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"tinyserve/internal/cloudflare"
+	"tinyserve/internal/site"
+	"tinyserve/internal/state"
+)
+
+// maxPurgeURLs is Cloudflare's per-request limit on purge-by-URL; larger
+// changes fall back to purging everything for the service's hostnames.
+const maxPurgeURLs = 30
+
+type siteRollbackRequest struct {
+	Version string `json:"version,omitempty"` // defaults to the previous release
+}
+
+func (h *Handler) siteRoot(name string) string {
+	return filepath.Join(h.dataRoot(), "services", sanitizeName(name), "site")
+}
+
+// applyStaticSpec points a static service at the managed server container and its site root.
+func (h *Handler) applyStaticSpec(svc *state.Service) error {
+	if h.dataRoot() == "" {
+		return fmt.Errorf("unable to resolve data root for static site")
+	}
+	svc.Image = site.ServerImage
+	if svc.InternalPort == 0 {
+		svc.InternalPort = 80
+	}
+	svc.Volumes = []string{h.siteRoot(svc.Name) + ":" + site.MountPath + ":ro"}
+	if svc.Healthcheck == nil {
+		svc.Healthcheck = &state.ServiceHealthcheck{
+			Command:         []string{"wget", "-q", "-O", "/dev/null", fmt.Sprintf("http://127.0.0.1:%d/", svc.InternalPort)},
+			IntervalSeconds: 30,
+			TimeoutSeconds:  5,
+			Retries:         3,
+		}
+	}
+	return nil
+}
+
+// HandleSite serves site uploads on the webhook listener, which only exposes
+// PUT /services/{name}/site and POST /services/{name}/site/rollback.
+func (h *Handler) HandleSite(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	raw := strings.TrimPrefix(r.URL.Path, "/services/")
+	parts := strings.SplitN(raw, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || (parts[1] != "site" && parts[1] != "site/rollback") {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	name, err := url.PathUnescape(parts[0])
+	if err != nil {
+		http.Error(w, "invalid service name", http.StatusBadRequest)
+		return
+	}
+	h.handleSite(w, r, name, parts[1])
+}
+
+func (h *Handler) handleSite(w http.ResponseWriter, r *http.Request, name, action string) {
+	switch {
+	case action == "site" && r.Method == http.MethodGet:
+	case action == "site" && r.Method == http.MethodPut:
+	case action == "site/rollback" && r.Method == http.MethodPost:
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Uploads and rollbacks change what is served, so they need a deploy token.
+	if r.Method != http.MethodGet {
+		token, status, msg := h.requireWebhookToken(r)
+		if status != 0 {
+			http.Error(w, msg, status)
+			return
+		}
+		if !isTokenAllowedForService(token, name) {
+			http.Error(w, "token not authorized for this service", http.StatusForbidden)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	st, err := h.Store.Load(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("load state: %v", err), http.StatusInternalServerError)
+		return
+	}
+	var svc *state.Service
+	for i := range st.Services {
+		if strings.EqualFold(st.Services[i].Name, name) {
+			svc = &st.Services[i]
+			break
+		}
+	}
+	if svc == nil {
+		http.Error(w, fmt.Sprintf("service %q not found", name), http.StatusNotFound)
+		return
+	}
+	if svc.Type != state.ServiceTypeStatic {
+		http.Error(w, fmt.Sprintf("service %q is not a static site", svc.Name), http.StatusBadRequest)
+		return
+	}
+
+	store := site.NewStore(h.siteRoot(svc.Name))
+	if r.Method == http.MethodGet {
+		releases, err := store.Releases()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("list releases: %v", err), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, map[string]any{
+			"service":  svc.Name,
+			"current":  store.Current(),
+			"releases": releases,
+		})
+		return
+	}
+
+	var (
+		version string
+		changed []string
+	)
+	status := "published"
+	if action == "site" {
+		body := http.MaxBytesReader(w, r.Body, site.MaxUploadBytes)
+		release, diff, err := store.Publish(body, time.Now())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("publish site: %v", err), http.StatusBadRequest)
+			return
+		}
+		version, changed = release.Version, diff
+	} else {
+		status = "rolled_back"
+		var req siteRollbackRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil && err != io.EOF {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+		version = req.Version
+		if version == "" {
+			if version, err = store.Previous(); err != nil {
+				http.Error(w, "no previous release to roll back to", http.StatusConflict)
+				return
+			}
+		}
+		if changed, err = store.Activate(version); err != nil {
+			if errors.Is(err, site.ErrNotFound) {
+				http.Error(w, fmt.Sprintf("release %q not found", version), http.StatusNotFound)
+				return
+			}
+			http.Error(w, fmt.Sprintf("activate release: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+	log.Printf("site: %s now serving %s (%d changed files)", svc.Name, version, len(changed))
+
+	keep := st.Settings.MaxSiteVersions
+	if keep == 0 {
+		keep = site.DefaultKeep
+	}
+	if removed, err := store.Prune(keep); err != nil {
+		log.Printf("site: prune %s: %v", svc.Name, err)
+	} else if len(removed) > 0 {
+		log.Printf("site: pruned %d old release(s) for %s", len(removed), svc.Name)
+	}
+
+	writeJSON(w, map[string]any{
+		"status":      status,
+		"service":     svc.Name,
+		"version":     version,
+		"changed":     changed,
+		"cache_purge": purgeSiteCache(ctx, st, *svc, changed),
+	})
+}
+
+// purgeSiteCache purges the changed files from Cloudflare for the service's hostnames.
+func purgeSiteCache(ctx context.Context, st state.State, svc state.Service, changed []string) map[string]any {
+	if len(changed) == 0 {
+		return map[string]any{"status": "skipped", "reason": "no changed files"}
+	}
+	if st.Settings.CloudflareAPIToken == "" {
+		return map[string]any{"status": "skipped", "reason": "cloudflare api token not configured"}
+	}
+	hostnames := filterCloudflareHostnames(svc.Hostnames)
+	if len(hostnames) == 0 {
+		return map[string]any{"status": "skipped", "reason": "no cloudflare hostnames"}
+	}
+
+	paths := site.URLPaths(changed)
+	req := purgeCacheRequest{Files: paths}
+	if len(paths)*len(hostnames) > maxPurgeURLs {
+		req = purgeCacheRequest{PurgeEverything: true}
+	}
+	cfClient := cloudflare.NewClient(st.Settings.CloudflareAPIToken)
+	if err := purgeCacheForHostnames(ctx, cfClient, hostnames, req); err != nil {
+		log.Printf("site: purge cache for %s: %v", svc.Name, err)
+		return map[string]any{"status": "failed", "error": err.Error(), "hostnames": hostnames}
+	}
+	resp := map[string]any{"status": "purged", "hostnames": hostnames}
+	if req.PurgeEverything {
+		resp["purge_everything"] = true
+	} else {
+		resp["files"] = paths
+	}
+	return resp
+}
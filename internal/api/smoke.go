@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"tinyserve/internal/smoke"
+	"tinyserve/internal/state"
+)
+
+const (
+	maxSmokeChecks          = 10
+	maxSmokeTimeoutSeconds  = 300
+	maxSmokeBodyContainsLen = 1024
+)
+
+func validateSmokeChecks(svc state.Service) error {
+	if len(svc.SmokeChecks) == 0 {
+		return nil
+	}
+	if svc.IsJob() {
+		return fmt.Errorf("jobs have no hostname to smoke check")
+	}
+	if len(svc.SmokeChecks) > maxSmokeChecks {
+		return fmt.Errorf("at most %d smoke checks are allowed", maxSmokeChecks)
+	}
+	for _, c := range svc.SmokeChecks {
+		u, err := url.ParseRequestURI(c.Path)
+		if err != nil || !strings.HasPrefix(c.Path, "/") || u.Host != "" || strings.ContainsAny(c.Path, " \t") {
+			return fmt.Errorf("smoke check path must start with /, got %q", c.Path)
+		}
+		if c.ExpectStatus != 0 && (c.ExpectStatus < 100 || c.ExpectStatus > 599) {
+			return fmt.Errorf("smoke check %s: invalid expected status %d", c.Path, c.ExpectStatus)
+		}
+		if c.TimeoutSeconds < 0 || c.TimeoutSeconds > maxSmokeTimeoutSeconds {
+			return fmt.Errorf("smoke check %s: timeout_seconds must be at most %d", c.Path, maxSmokeTimeoutSeconds)
+		}
+		if len(c.BodyContains) > maxSmokeBodyContainsLen {
+			return fmt.Errorf("smoke check %s: body_contains is longer than %d bytes", c.Path, maxSmokeBodyContainsLen)
+		}
+	}
+	return nil
+}
+
+// routedHostnames returns the hostnames Traefik routes to svc, falling back
+// to name.default_domain like the generated labels do.
+func routedHostnames(st state.State, svc state.Service) []string {
+	if len(svc.Hostnames) == 0 && st.Settings.DefaultDomain != "" {
+		return []string{fmt.Sprintf("%s.%s", sanitizeName(svc.Name), st.Settings.DefaultDomain)}
+	}
+	return svc.Hostnames
+}
+
+// smokeChecksFor expands the smoke checks of the started targets into one
+// request per check and hostname. Services in maintenance mode are skipped:
+// Traefik sends their hostnames to the maintenance page.
+func smokeChecksFor(st state.State, targets []string) []smoke.Check {
+	var checks []smoke.Check
+	for _, svc := range st.Services {
+		if len(svc.SmokeChecks) == 0 || !svc.Enabled || svc.IsJob() || !slices.Contains(targets, sanitizeName(svc.Name)) {
+			continue
+		}
+		if svc.Maintenance != nil {
+			log.Printf("smoke: skipping %s, it is in maintenance mode", svc.Name)
+			continue
+		}
+		hosts := routedHostnames(st, svc)
+		if len(hosts) == 0 {
+			log.Printf("smoke: skipping %s, it has no hostname to route through Traefik", svc.Name)
+			continue
+		}
+		for _, host := range hosts {
+			for _, c := range svc.SmokeChecks {
+				checks = append(checks, smoke.Check{
+					Host:         host,
+					Path:         c.Path,
+					ExpectStatus: c.ExpectStatus,
+					BodyContains: c.BodyContains,
+					Timeout:      time.Duration(c.TimeoutSeconds) * time.Second,
+				})
+			}
+		}
+	}
+	return checks
+}
+
+// runSmokeChecks runs the smoke checks of the started targets through
+// Traefik and returns the first failure.
+func (h *Handler) runSmokeChecks(ctx context.Context, st state.State, targets []string) error {
+	checks := smokeChecksFor(st, targets)
+	if len(checks) == 0 {
+		return nil
+	}
+	runner := smoke.NewRunner(h.SmokeURL)
+	for _, c := range checks {
+		log.Printf("smoke: checking %s", c)
+		if err := runner.Run(ctx, c); err != nil {
+			return err
+		}
+	}
+	log.Printf("smoke: %d checks passed", len(checks))
+	return nil
+}
@@ -0,0 +1,424 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"tinyserve/internal/deploys"
+	"tinyserve/internal/docker"
+	"tinyserve/internal/notify"
+	"tinyserve/internal/registry"
+	"tinyserve/internal/state"
+)
+
+const (
+	defaultUpdateIntervalMinutes = 60
+	minUpdateIntervalMinutes     = 5
+	maxUpdateIntervalMinutes     = 7 * 24 * 60
+	updateCheckTick              = time.Minute
+	updateDeployTimeout          = 2 * time.Minute
+)
+
+// imageUpdate is a pending image change found by an update check.
+type imageUpdate struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Reason string `json:"reason"`
+}
+
+// updateTracker remembers when each service was last checked and which
+// updates are in flight, so slow deploys never overlap.
+type updateTracker struct {
+	mu        sync.Mutex
+	lastCheck map[string]time.Time
+	applying  map[string]bool
+}
+
+func newUpdateTracker() *updateTracker {
+	return &updateTracker{lastCheck: make(map[string]time.Time), applying: make(map[string]bool)}
+}
+
+// due reports whether name should be checked now and, if so, records the check.
+func (t *updateTracker) due(name string, interval time.Duration, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if last, ok := t.lastCheck[name]; ok && now.Sub(last) < interval {
+		return false
+	}
+	t.lastCheck[name] = now
+	return true
+}
+
+func (t *updateTracker) begin(name string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.applying[name] {
+		return false
+	}
+	t.applying[name] = true
+	return true
+}
+
+func (t *updateTracker) end(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.applying, name)
+}
+
+func validateUpdatePolicy(svc state.Service) error {
+	p := svc.UpdatePolicy
+	if p == nil {
+		return nil
+	}
+	if svc.Type != "" && svc.Type != state.ServiceTypeRegistryImage && svc.Type != state.ServiceTypeJob {
+		return fmt.Errorf("automatic updates need a registry image, not a %s service", svc.Type)
+	}
+	if p.IntervalMinutes != 0 && (p.IntervalMinutes < minUpdateIntervalMinutes || p.IntervalMinutes > maxUpdateIntervalMinutes) {
+		return fmt.Errorf("update interval must be between %d and %d minutes, got %d", minUpdateIntervalMinutes, maxUpdateIntervalMinutes, p.IntervalMinutes)
+	}
+	if _, err := registry.ParseReference(svc.Image); err != nil {
+		return fmt.Errorf("automatic updates: %w", err)
+	}
+	if p.Semver != "" {
+		if _, err := registry.ParseRange(p.Semver); err != nil {
+			return fmt.Errorf("automatic updates: %w", err)
+		}
+	}
+	return nil
+}
+
+func updateInterval(p *state.ServiceUpdatePolicy) time.Duration {
+	if p.IntervalMinutes <= 0 {
+		return defaultUpdateIntervalMinutes * time.Minute
+	}
+	return time.Duration(p.IntervalMinutes) * time.Minute
+}
+
+// watchesUpdates reports whether the watcher should poll for svc.
+func watchesUpdates(svc state.Service) bool {
+	return svc.UpdatePolicy != nil && svc.Enabled && svc.Preview == nil
+}
+
+// StartUpdateWatcher polls registries for services with an update policy and
+// deploys new images through the normal health-checked apply flow.
+func (h *Handler) StartUpdateWatcher(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(updateCheckTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				h.checkUpdates(ctx, now)
+			}
+		}
+	}()
+}
+
+func (h *Handler) checkUpdates(ctx context.Context, now time.Time) {
+	st, err := h.Store.Load(ctx)
+	if err != nil {
+		log.Printf("updates: load state: %v", err)
+		return
+	}
+	// Nothing is marked as checked while frozen, so due services are checked
+	// on the first tick after the freeze lifts.
+	if _, frozen := activeFreeze(st); frozen {
+		return
+	}
+	for _, svc := range st.Services {
+		if !watchesUpdates(svc) || !h.updates.due(sanitizeName(svc.Name), updateInterval(svc.UpdatePolicy), now) {
+			continue
+		}
+		upd, ok, err := h.checkForUpdate(ctx, svc)
+		if err != nil {
+			log.Printf("updates: check %s: %v", svc.Name, err)
+			continue
+		}
+		if ok {
+			if err := h.applyUpdate(ctx, svc.Name, upd); err != nil {
+				log.Printf("updates: %s: %v", svc.Name, err)
+			}
+		}
+	}
+}
+
+// checkForUpdate asks the registry whether svc's policy calls for a new image.
+// With a semver range the highest matching tag above the current one wins;
+// otherwise the tag's remote digest is compared with the deployed image's.
+func (h *Handler) checkForUpdate(ctx context.Context, svc state.Service) (imageUpdate, bool, error) {
+	ref, err := registry.ParseReference(svc.Image)
+	if err != nil {
+		return imageUpdate{}, false, err
+	}
+
+	if svc.UpdatePolicy.Semver != "" {
+		rng, err := registry.ParseRange(svc.UpdatePolicy.Semver)
+		if err != nil {
+			return imageUpdate{}, false, err
+		}
+		tags, err := h.Registry.Tags(ctx, ref)
+		if err != nil {
+			return imageUpdate{}, false, err
+		}
+		best, found := registry.Latest(tags, rng)
+		if !found || best.Tag == ref.Tag {
+			return imageUpdate{}, false, nil
+		}
+		if current, ok := registry.ParseVersion(ref.Tag); ok && best.Compare(current) <= 0 {
+			return imageUpdate{}, false, nil
+		}
+		return imageUpdate{
+			From:   svc.Image,
+			To:     imageWithTag(svc.Image, best.Tag),
+			Reason: fmt.Sprintf("new version %s matches %s", best.Tag, svc.UpdatePolicy.Semver),
+		}, true, nil
+	}
+
+	remote, err := h.Registry.Digest(ctx, ref)
+	if err != nil {
+		return imageUpdate{}, false, err
+	}
+	deployed, err := h.imageDigests(ctx, svc)
+	if err != nil {
+		return imageUpdate{}, false, err
+	}
+	if slices.Contains(deployed, remote) {
+		return imageUpdate{}, false, nil
+	}
+	return imageUpdate{
+		From:   svc.Image,
+		To:     svc.Image,
+		Reason: fmt.Sprintf("tag %s now points to %s", ref.Tag, shortDigest(remote)),
+	}, true, nil
+}
+
+// deployedImageDigests returns the repo digests of the image a running
+// container of svc uses. Jobs between runs and services that are stopped or
+// idle have no running container; for them the local image of svc.Image,
+// which deploys pull, stands in.
+func (h *Handler) deployedImageDigests(ctx context.Context, svc state.Service) ([]string, error) {
+	service := sanitizeName(svc.Name)
+	containers, err := h.newRunner(h.currentDir()).PSStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range containers {
+		if strings.EqualFold(c.Service, service) && strings.HasPrefix(strings.ToLower(c.State), "running") {
+			return docker.ContainerRepoDigests(ctx, h.Docker, c.Name)
+		}
+	}
+	digests, err := docker.ImageRepoDigests(ctx, h.Docker, svc.Image)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not running and its image is not available locally: %w", svc.Name, err)
+	}
+	return digests, nil
+}
+
+// applyUpdate deploys upd for the named service. A failed health check rolls
+// back inside apply; the state keeps the previous image in that case.
+func (h *Handler) applyUpdate(ctx context.Context, name string, upd imageUpdate) error {
+	if !h.updates.begin(name) {
+		return fmt.Errorf("an update is already in progress")
+	}
+	defer h.updates.end(name)
+
+	details := map[string]string{"from": upd.From, "to": upd.To, "reason": upd.Reason}
+	h.notify(notify.Event{
+		Kind:    notify.KindUpdateAvailable,
+		Service: name,
+		Text:    fmt.Sprintf("tinyserve: updating %s to %s (%s)", name, upd.To, upd.Reason),
+		Details: details,
+	})
+
+	st, err := h.Store.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("load state: %w", err)
+	}
+	svc := findService(&st, name)
+	if svc == nil {
+		return fmt.Errorf("service %q no longer exists", name)
+	}
+	if svc.Image != upd.From {
+		return fmt.Errorf("image changed to %s while checking; skipping", svc.Image)
+	}
+	svc.Image = upd.To
+	target := sanitizeName(svc.Name)
+
+	log.Printf("updates: deploying %s: %s", target, upd.Reason)
+	if err := h.applyConfig(ctx, &st, deploys.TriggerUpdate, []string{target}, updateDeployTimeout); err != nil {
+		details["error"] = err.Error()
+		h.notify(notify.Event{
+			Kind:    notify.KindUpdateFailed,
+			Service: name,
+			Text:    fmt.Sprintf("tinyserve: update of %s to %s failed: %v", name, upd.To, err),
+			Details: details,
+		})
+		return fmt.Errorf("deploy %s: %w", upd.To, err)
+	}
+
+	h.markDeployed(ctx, svc, time.Now().UTC())
+	if err := h.Store.Save(ctx, st); err != nil {
+		return fmt.Errorf("save state: %w", err)
+	}
+	h.notify(notify.Event{
+		Kind:    notify.KindUpdateSucceeded,
+		Service: name,
+		Text:    fmt.Sprintf("tinyserve: %s is now running %s", name, upd.To),
+		Details: details,
+	})
+	return nil
+}
+
+// notify delivers ev to the configured webhook in the background.
+func (h *Handler) notify(ev notify.Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	st, err := h.Store.Load(ctx)
+	if err != nil || st.Settings.Notifications.WebhookURL == "" {
+		cancel()
+		return
+	}
+	go func() {
+		defer cancel()
+		if err := h.Notifier.Send(ctx, st.Settings.Notifications.WebhookURL, ev); err != nil {
+			log.Printf("notify: %s: %v", ev.Kind, err)
+		}
+	}()
+}
+
+func shortDigest(digest string) string {
+	if len(digest) > len("sha256:")+12 {
+		return digest[:len("sha256:")+12]
+	}
+	return digest
+}
+
+// handleUpdateCheck serves POST /services/{name}/update-check: check the
+// registry now and deploy if the policy finds a newer image. With
+// {"dry_run": true} it only reports what it would do.
+func (h *Handler) handleUpdateCheck(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		DryRun bool `json:"dry_run"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	st, err := h.Store.Load(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("load state: %v", err), http.StatusInternalServerError)
+		return
+	}
+	svc := findService(&st, name)
+	if svc == nil {
+		http.Error(w, fmt.Sprintf("service %q not found", name), http.StatusNotFound)
+		return
+	}
+	if svc.UpdatePolicy == nil {
+		http.Error(w, "service has no update policy", http.StatusBadRequest)
+		return
+	}
+
+	upd, ok, err := h.checkForUpdate(ctx, *svc)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("update check: %v", err), http.StatusBadGateway)
+		return
+	}
+	if !ok {
+		writeJSON(w, map[string]any{"status": "up_to_date", "service": svc.Name, "image": svc.Image})
+		return
+	}
+	if req.DryRun {
+		writeJSON(w, map[string]any{"status": "update_available", "service": svc.Name, "update": upd})
+		return
+	}
+	if p, frozen := activeFreeze(st); frozen {
+		http.Error(w, p.Describe(), http.StatusLocked)
+		return
+	}
+	if err := h.applyUpdate(ctx, svc.Name, upd); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]any{"status": "updated", "service": svc.Name, "update": upd})
+}
+
+// handleNotificationSettings serves GET and PUT /settings/notifications.
+func (h *Handler) handleNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	st, err := h.Store.Load(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("load state: %v", err), http.StatusInternalServerError)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, st.Settings.Notifications)
+	case http.MethodPut:
+		var req state.NotificationSettings
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+		req.WebhookURL = strings.TrimSpace(req.WebhookURL)
+		if req.WebhookURL != "" {
+			u, err := url.Parse(req.WebhookURL)
+			if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+				http.Error(w, "webhook_url must be an http(s) URL", http.StatusBadRequest)
+				return
+			}
+		}
+		st.Settings.Notifications = req
+		if err := h.Store.Save(ctx, st); err != nil {
+			http.Error(w, fmt.Sprintf("save state: %v", err), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, st.Settings.Notifications)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleNotificationTest serves POST /settings/notifications/test, sending a
+// test event synchronously so delivery errors reach the caller.
+func (h *Handler) handleNotificationTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	st, err := h.Store.Load(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("load state: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if st.Settings.Notifications.WebhookURL == "" {
+		http.Error(w, "no notification webhook configured", http.StatusBadRequest)
+		return
+	}
+	err = h.Notifier.Send(r.Context(), st.Settings.Notifications.WebhookURL, notify.Event{
+		Kind: notify.KindTest,
+		Text: "tinyserve: test notification",
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, map[string]any{"status": "sent"})
+}
@@ -0,0 +1,569 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"tinyserve/internal/auth"
+	"tinyserve/internal/deploys"
+	"tinyserve/internal/notify"
+	"tinyserve/internal/registry"
+	"tinyserve/internal/state"
+	"tinyserve/internal/validate"
+)
+
+const (
+	webhookSecretBytes     = 32
+	minWebhookSecretLen    = 16
+	maxWebhookPayloadBytes = 10 << 20
+	providerDeployTimeout  = 5 * time.Minute
+)
+
+// Webhook providers, as they appear in /webhook/{provider}/{service}.
+const (
+	providerGitHub    = "github"
+	providerGitLab    = "gitlab"
+	providerDockerHub = "dockerhub"
+)
+
+// Kinds of webhookEvent.
+const (
+	webhookBranch = "branch" // a push to a git branch
+	webhookTag    = "tag"    // a git tag push or a release
+	webhookImage  = "image"  // an image tag pushed to a registry
+)
+
+// webhookEvent is a provider payload reduced to what can trigger a deploy.
+type webhookEvent struct {
+	Kind       string
+	Ref        string // branch, git tag or image tag
+	Repository string // image repository of image events, e.g. "acme/app"
+}
+
+// HandleProviderWebhook serves signed webhooks from code hosts and registries
+// on the webhook listener:
+//
+//	POST /webhook/github/{service}     X-Hub-Signature-256 over the body
+//	POST /webhook/gitlab/{service}     X-Gitlab-Token header
+//	POST /webhook/dockerhub/{service}  ?token= query parameter
+//
+// Each service has its own secret. Events that match its filters are
+// acknowledged with 202 and deployed in the background, since providers time
+// out after ~10s; other valid events get 200 with the reason they were ignored.
+func (h *Handler) HandleProviderWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	provider, rawName, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/webhook/"), "/")
+	if !ok || rawName == "" || strings.Contains(rawName, "/") {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	name, err := url.PathUnescape(rawName)
+	if err != nil {
+		http.Error(w, "invalid service name", http.StatusBadRequest)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookPayloadBytes))
+	if err != nil {
+		http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	st, err := h.Store.Load(r.Context())
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	svc := findService(&st, name)
+	if svc == nil || svc.Webhook == nil || svc.Webhook.Secret == "" {
+		http.Error(w, "service not found", http.StatusNotFound)
+		return
+	}
+
+	var ev webhookEvent
+	var reason string
+	switch provider {
+	case providerGitHub:
+		if !verifyGitHubSignature(body, r.Header.Get("X-Hub-Signature-256"), svc.Webhook.Secret) {
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("X-GitHub-Event") == "ping" {
+			writeJSON(w, map[string]any{"status": "pong", "service": svc.Name})
+			return
+		}
+		ev, reason, err = parseGitHubEvent(r.Header.Get("X-GitHub-Event"), body)
+	case providerGitLab:
+		if !auth.ConstantTimeCompare(r.Header.Get("X-Gitlab-Token"), svc.Webhook.Secret) {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		ev, reason, err = parseGitLabEvent(r.Header.Get("X-Gitlab-Event"), body)
+	case providerDockerHub:
+		// Docker Hub does not sign its webhooks, so the secret goes in the URL.
+		if !auth.ConstantTimeCompare(r.URL.Query().Get("token"), svc.Webhook.Secret) {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		ev, reason, err = parseDockerHubEvent(body)
+	default:
+		http.Error(w, "unknown webhook provider", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if reason == "" {
+		reason = webhookIgnoreReason(*svc, ev)
+	}
+	if reason != "" {
+		writeJSON(w, map[string]any{"status": "ignored", "reason": reason})
+		return
+	}
+	if !svc.Enabled {
+		http.Error(w, "service disabled", http.StatusBadRequest)
+		return
+	}
+
+	updated := webhookDeploySpec(*svc, ev)
+	if svc.RequireApproval {
+		var image, buildRef string
+		if updated.Build != nil {
+			buildRef = updated.Build.Ref
+		} else if updated.Image != svc.Image {
+			image = updated.Image
+		}
+		rec, err := h.requestApproval(*svc, fmt.Sprintf("%s %s %s", provider, ev.Kind, ev.Ref), image, buildRef, providerDeployTimeout)
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		writePendingDeploy(w, rec)
+		return
+	}
+	if p, frozen := activeFreeze(st); frozen {
+		h.refuseFrozen(w, svc.Name, fmt.Sprintf("%s %s %s", provider, ev.Kind, ev.Ref), p)
+		return
+	}
+	log.Printf("webhook: %s %s %q triggers a deploy of %s", provider, ev.Kind, ev.Ref, svc.Name)
+	go h.deployFromWebhook(svc.Name, provider, ev, updated)
+
+	resp := map[string]any{"status": "deploying", "service": svc.Name, "event": ev.Kind, "ref": ev.Ref}
+	if updated.Build != nil {
+		resp["build_ref"] = updated.Build.Ref
+	} else {
+		resp["image"] = updated.Image
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func verifyGitHubSignature(body []byte, header, secret string) bool {
+	sig, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// parseGitHubEvent understands push, release and package (GHCR) events. A
+// non-empty reason means the event is valid but does not deploy anything.
+func parseGitHubEvent(event string, body []byte) (webhookEvent, string, error) {
+	switch event {
+	case "push":
+		var p struct {
+			Ref     string `json:"ref"`
+			Deleted bool   `json:"deleted"`
+		}
+		if err := json.Unmarshal(body, &p); err != nil {
+			return webhookEvent{}, "", fmt.Errorf("invalid push payload")
+		}
+		if p.Deleted {
+			return webhookEvent{}, "ref deleted", nil
+		}
+		return gitRefEvent(p.Ref)
+	case "release":
+		var p struct {
+			Action  string `json:"action"`
+			Release struct {
+				TagName string `json:"tag_name"`
+			} `json:"release"`
+		}
+		if err := json.Unmarshal(body, &p); err != nil {
+			return webhookEvent{}, "", fmt.Errorf("invalid release payload")
+		}
+		if p.Action != "published" {
+			return webhookEvent{}, fmt.Sprintf("release action %q", p.Action), nil
+		}
+		return webhookEvent{Kind: webhookTag, Ref: p.Release.TagName}, "", nil
+	case "package", "registry_package":
+		var p struct {
+			Action  string          `json:"action"`
+			Package json.RawMessage `json:"package"`
+			// registry_package events carry the same object under another key.
+			RegistryPackage json.RawMessage `json:"registry_package"`
+		}
+		if err := json.Unmarshal(body, &p); err != nil {
+			return webhookEvent{}, "", fmt.Errorf("invalid package payload")
+		}
+		raw := p.Package
+		if len(raw) == 0 {
+			raw = p.RegistryPackage
+		}
+		var pkg struct {
+			Name           string `json:"name"`
+			Namespace      string `json:"namespace"`
+			PackageType    string `json:"package_type"`
+			PackageVersion struct {
+				ContainerMetadata struct {
+					Tag struct {
+						Name string `json:"name"`
+					} `json:"tag"`
+				} `json:"container_metadata"`
+			} `json:"package_version"`
+		}
+		if err := json.Unmarshal(raw, &pkg); err != nil {
+			return webhookEvent{}, "", fmt.Errorf("invalid package payload")
+		}
+		if p.Action != "published" {
+			return webhookEvent{}, fmt.Sprintf("package action %q", p.Action), nil
+		}
+		if !strings.EqualFold(pkg.PackageType, "container") {
+			return webhookEvent{}, fmt.Sprintf("package type %q", pkg.PackageType), nil
+		}
+		tag := pkg.PackageVersion.ContainerMetadata.Tag.Name
+		if tag == "" {
+			return webhookEvent{}, "untagged image", nil
+		}
+		repo := pkg.Name
+		if pkg.Namespace != "" {
+			repo = pkg.Namespace + "/" + pkg.Name
+		}
+		return webhookEvent{Kind: webhookImage, Ref: tag, Repository: repo}, "", nil
+	default:
+		return webhookEvent{}, fmt.Sprintf("unsupported event %q", event), nil
+	}
+}
+
+// parseGitLabEvent understands push, tag push and release hooks.
+func parseGitLabEvent(event string, body []byte) (webhookEvent, string, error) {
+	switch event {
+	case "Push Hook", "Tag Push Hook":
+		var p struct {
+			Ref   string `json:"ref"`
+			After string `json:"after"`
+		}
+		if err := json.Unmarshal(body, &p); err != nil {
+			return webhookEvent{}, "", fmt.Errorf("invalid push payload")
+		}
+		if strings.Trim(p.After, "0") == "" {
+			return webhookEvent{}, "ref deleted", nil
+		}
+		return gitRefEvent(p.Ref)
+	case "Release Hook":
+		var p struct {
+			Action string `json:"action"`
+			Tag    string `json:"tag"`
+		}
+		if err := json.Unmarshal(body, &p); err != nil {
+			return webhookEvent{}, "", fmt.Errorf("invalid release payload")
+		}
+		if p.Action != "create" {
+			return webhookEvent{}, fmt.Sprintf("release action %q", p.Action), nil
+		}
+		return webhookEvent{Kind: webhookTag, Ref: p.Tag}, "", nil
+	default:
+		return webhookEvent{}, fmt.Sprintf("unsupported event %q", event), nil
+	}
+}
+
+// parseDockerHubEvent understands Docker Hub repository push webhooks.
+func parseDockerHubEvent(body []byte) (webhookEvent, string, error) {
+	var p struct {
+		PushData struct {
+			Tag string `json:"tag"`
+		} `json:"push_data"`
+		Repository struct {
+			RepoName string `json:"repo_name"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(body, &p); err != nil || p.PushData.Tag == "" {
+		return webhookEvent{}, "", fmt.Errorf("invalid Docker Hub payload")
+	}
+	return webhookEvent{Kind: webhookImage, Ref: p.PushData.Tag, Repository: p.Repository.RepoName}, "", nil
+}
+
+func gitRefEvent(ref string) (webhookEvent, string, error) {
+	if branch, ok := strings.CutPrefix(ref, "refs/heads/"); ok {
+		return webhookEvent{Kind: webhookBranch, Ref: branch}, "", nil
+	}
+	if tag, ok := strings.CutPrefix(ref, "refs/tags/"); ok {
+		return webhookEvent{Kind: webhookTag, Ref: tag}, "", nil
+	}
+	return webhookEvent{}, "", fmt.Errorf("invalid ref %q", ref)
+}
+
+// webhookIgnoreReason says why ev does not deploy svc, or "" if it does.
+func webhookIgnoreReason(svc state.Service, ev webhookEvent) string {
+	var patterns []string
+	switch ev.Kind {
+	case webhookBranch:
+		patterns = svc.Webhook.Branches
+	case webhookTag:
+		patterns = svc.Webhook.Tags
+	case webhookImage:
+		patterns = svc.Webhook.ImageTags
+	}
+	if !matchesAnyPattern(patterns, ev.Ref) {
+		return fmt.Sprintf("%s %q does not match the service's %s filters", ev.Kind, ev.Ref, ev.Kind)
+	}
+
+	if svc.Type == state.ServiceTypeGitBuild {
+		if ev.Kind == webhookImage {
+			return "image pushes do not apply to git-build services"
+		}
+		if err := validate.GitRef(ev.Ref); err != nil {
+			return err.Error()
+		}
+		return ""
+	}
+	if ev.Kind != webhookBranch {
+		if err := validate.ImageTag(ev.Ref); err != nil {
+			return err.Error()
+		}
+	}
+	if ev.Kind == webhookImage && ev.Repository != "" {
+		ref, err := registry.ParseReference(svc.Image)
+		if err != nil {
+			return err.Error()
+		}
+		repo := strings.ToLower(ev.Repository)
+		if ref.Repository != repo && !strings.HasSuffix(ref.Repository, "/"+repo) && ref.Repository != "library/"+repo {
+			return fmt.Sprintf("image %s is not the service's repository %s", ev.Repository, ref.Repository)
+		}
+	}
+	return ""
+}
+
+func matchesAnyPattern(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// webhookDeploySpec returns svc as ev deploys it: git-build services build the
+// pushed branch or tag, and image services switch to the pushed tag. A branch
+// push to an image service redeploys its current tag.
+func webhookDeploySpec(svc state.Service, ev webhookEvent) state.Service {
+	if svc.Type == state.ServiceTypeGitBuild && svc.Build != nil {
+		b := *svc.Build
+		b.Ref = ev.Ref
+		svc.Build = &b
+		return svc
+	}
+	if ev.Kind != webhookBranch {
+		svc.Image = imageWithTag(svc.Image, ev.Ref)
+	}
+	return svc
+}
+
+// deployFromWebhook applies the image or build ref chosen by a webhook and
+// reports the outcome through the notification webhook.
+func (h *Handler) deployFromWebhook(name, provider string, ev webhookEvent, updated state.Service) {
+	ctx := context.Background()
+	details := map[string]string{"provider": provider, "event": ev.Kind, "ref": ev.Ref}
+	fail := func(err error) {
+		log.Printf("webhook: deploy %s: %v", name, err)
+		details["error"] = err.Error()
+		h.notify(notify.Event{
+			Kind:    notify.KindDeployFailed,
+			Service: name,
+			Text:    fmt.Sprintf("tinyserve: %s deploy of %s (%s %s) failed: %v", provider, name, ev.Kind, ev.Ref, err),
+			Details: details,
+		})
+	}
+
+	st, err := h.Store.Load(ctx)
+	if err != nil {
+		fail(fmt.Errorf("load state: %w", err))
+		return
+	}
+	svc := findService(&st, name)
+	if svc == nil {
+		fail(fmt.Errorf("service no longer exists"))
+		return
+	}
+	svc.Image = updated.Image
+	svc.Build = updated.Build
+	if err := h.applyConfig(ctx, &st, deploys.TriggerWebhook, []string{sanitizeName(svc.Name)}, providerDeployTimeout); err != nil {
+		fail(err)
+		return
+	}
+	h.markDeployed(ctx, svc, time.Now().UTC())
+	if err := h.Store.Save(ctx, st); err != nil {
+		fail(fmt.Errorf("save state: %w", err))
+		return
+	}
+	h.notify(notify.Event{
+		Kind:    notify.KindDeploySucceeded,
+		Service: name,
+		Text:    fmt.Sprintf("tinyserve: deployed %s from %s %s %s", name, provider, ev.Kind, ev.Ref),
+		Details: details,
+	})
+}
+
+func validateWebhook(svc state.Service) error {
+	wh := svc.Webhook
+	if wh == nil {
+		return nil
+	}
+	if svc.Type == state.ServiceTypeStatic {
+		return fmt.Errorf("static sites are deployed by upload, not webhooks")
+	}
+	if len(wh.Secret) < minWebhookSecretLen {
+		return fmt.Errorf("webhook secret must be at least %d characters", minWebhookSecretLen)
+	}
+	if len(wh.Branches)+len(wh.Tags)+len(wh.ImageTags) == 0 {
+		return fmt.Errorf("webhook needs at least one branch, tag or image tag filter")
+	}
+	if svc.Type == state.ServiceTypeGitBuild && len(wh.ImageTags) > 0 {
+		return fmt.Errorf("image tag filters do not apply to git-build services")
+	}
+	for _, list := range [][]string{wh.Branches, wh.Tags, wh.ImageTags} {
+		for _, p := range list {
+			if _, err := path.Match(p, ""); err != nil || p == "" {
+				return fmt.Errorf("invalid webhook filter %q", p)
+			}
+		}
+	}
+	return nil
+}
+
+func generateWebhookSecret() (string, error) {
+	b := make([]byte, webhookSecretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+type webhookConfigRequest struct {
+	Branches     []string `json:"branches"`
+	Tags         []string `json:"tags"`
+	ImageTags    []string `json:"image_tags"`
+	RotateSecret bool     `json:"rotate_secret,omitempty"`
+}
+
+// handleServiceWebhook manages a service's provider webhook:
+//
+//	GET    /services/{name}/webhook  show filters, secret and endpoint URLs
+//	PUT    /services/{name}/webhook  set filters; creates the secret on first use
+//	                                 and keeps the filters when none are given
+//	DELETE /services/{name}/webhook  stop accepting provider webhooks
+func (h *Handler) handleServiceWebhook(w http.ResponseWriter, r *http.Request, name string) {
+	ctx := r.Context()
+	st, err := h.Store.Load(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("load state: %v", err), http.StatusInternalServerError)
+		return
+	}
+	svc := findService(&st, name)
+	if svc == nil {
+		http.Error(w, fmt.Sprintf("service %q not found", name), http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if svc.Webhook == nil {
+			http.Error(w, "no webhook configured", http.StatusNotFound)
+			return
+		}
+	case http.MethodPut:
+		var req webhookConfigRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+		wh := &state.ServiceWebhook{Branches: req.Branches, Tags: req.Tags, ImageTags: req.ImageTags}
+		if svc.Webhook != nil {
+			if req.Branches == nil && req.Tags == nil && req.ImageTags == nil {
+				wh.Branches, wh.Tags, wh.ImageTags = svc.Webhook.Branches, svc.Webhook.Tags, svc.Webhook.ImageTags
+			}
+			if !req.RotateSecret {
+				wh.Secret = svc.Webhook.Secret
+			}
+		}
+		if wh.Secret == "" {
+			if wh.Secret, err = generateWebhookSecret(); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		updated := *svc
+		updated.Webhook = wh
+		if err := validateWebhook(updated); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		svc.Webhook = wh
+		if err := h.Store.Save(ctx, st); err != nil {
+			http.Error(w, fmt.Sprintf("save state: %v", err), http.StatusInternalServerError)
+			return
+		}
+	case http.MethodDelete:
+		svc.Webhook = nil
+		if err := h.Store.Save(ctx, st); err != nil {
+			http.Error(w, fmt.Sprintf("save state: %v", err), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, map[string]any{"status": "removed", "service": svc.Name})
+		return
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	base := ""
+	if host := st.Settings.Remote.APIHostname; host != "" {
+		base = "https://" + host
+	}
+	escaped := url.PathEscape(svc.Name)
+	writeJSON(w, map[string]any{
+		"service":    svc.Name,
+		"secret":     svc.Webhook.Secret,
+		"branches":   svc.Webhook.Branches,
+		"tags":       svc.Webhook.Tags,
+		"image_tags": svc.Webhook.ImageTags,
+		"urls": map[string]string{
+			providerGitHub:    base + "/webhook/github/" + escaped,
+			providerGitLab:    base + "/webhook/gitlab/" + escaped,
+			providerDockerHub: base + "/webhook/dockerhub/" + escaped + "?token=" + svc.Webhook.Secret,
+		},
+	})
+}
@@ -0,0 +1,177 @@
+package build
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"tinyserve/internal/docker"
+	"tinyserve/internal/state"
+)
+
+// RepositoryPrefix namespaces locally built images so they never collide with registry images.
+const RepositoryPrefix = "tinyserve-build/"
+
+// DefaultKeep is how many previous images per service survive pruning, so
+// rollbacks to an older config still find their image.
+const DefaultKeep = 3
+
+// Builder checks out service sources under Root and builds them with the docker CLI.
+type Builder struct {
+	Root string
+}
+
+// Result describes a finished build.
+type Result struct {
+	Image  string `json:"image"`
+	Commit string `json:"commit"`
+	Cached bool   `json:"cached,omitempty"` // image for this commit already existed
+}
+
+func NewBuilder(root string) *Builder {
+	return &Builder{Root: root}
+}
+
+// ImageRepository returns the local repository used for a service's builds.
+func ImageRepository(service string) string {
+	return RepositoryPrefix + strings.ToLower(service)
+}
+
+// ImageTag returns the image reference for a service built at commit.
+func ImageTag(service, commit string) string {
+	short := commit
+	if len(short) > 12 {
+		short = short[:12]
+	}
+	return ImageRepository(service) + ":" + short
+}
+
+// Build fetches spec.Ref from spec.Source, builds the Dockerfile at that commit
+// and tags the image with the commit SHA. Git and docker output go to w.
+func (b *Builder) Build(ctx context.Context, service string, spec state.ServiceBuild, w io.Writer) (Result, error) {
+	if w == nil {
+		w = io.Discard
+	}
+	dockerfile := spec.Dockerfile
+	if dockerfile == "" {
+		dockerfile = "Dockerfile"
+	}
+	if !filepath.IsLocal(dockerfile) {
+		return Result{}, fmt.Errorf("dockerfile %q must be a path inside the repository", dockerfile)
+	}
+
+	dir := filepath.Join(b.Root, strings.ToLower(service))
+	commit, err := checkout(ctx, dir, spec.Source, spec.Ref, w)
+	if err != nil {
+		return Result{}, err
+	}
+
+	res := Result{Image: ImageTag(service, commit), Commit: commit}
+	if docker.ImageExists(ctx, res.Image) {
+		fmt.Fprintf(w, "image %s already built, skipping\n", res.Image)
+		res.Cached = true
+		return res, nil
+	}
+
+	fmt.Fprintf(w, "building %s from %s\n", res.Image, dockerfile)
+	labels := map[string]string{
+		"tinyserve.service":                 service,
+		"org.opencontainers.image.revision": commit,
+		"org.opencontainers.image.source":   spec.Source,
+	}
+	if err := docker.BuildImage(ctx, dir, dockerfile, res.Image, labels, w); err != nil {
+		return Result{}, err
+	}
+	return res, nil
+}
+
+// Prune removes old build images for a service, keeping the newest keep
+// tags and anything listed in inUse. Removal failures are not fatal.
+func Prune(ctx context.Context, service string, keep int, inUse ...string) []string {
+	tags, err := docker.ListImageTags(ctx, ImageRepository(service))
+	if err != nil {
+		return nil
+	}
+	protected := make(map[string]bool, len(inUse))
+	for _, ref := range inUse {
+		protected[ref] = true
+	}
+
+	var removed []string
+	kept := 0
+	for _, tag := range tags {
+		ref := ImageRepository(service) + ":" + tag
+		if protected[ref] {
+			continue
+		}
+		if kept < keep {
+			kept++
+			continue
+		}
+		if err := docker.RemoveImage(ctx, ref); err == nil {
+			removed = append(removed, ref)
+		}
+	}
+	return removed
+}
+
+// checkout fetches ref from source into dir and returns the checked-out commit SHA.
+// The working copy is reused between builds so only new objects are fetched.
+func checkout(ctx context.Context, dir, source, ref string, w io.Writer) (string, error) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return "", fmt.Errorf("create build dir: %w", err)
+		}
+		if _, err := git(ctx, dir, w, "init", "--quiet"); err != nil {
+			return "", err
+		}
+	}
+
+	fmt.Fprintf(w, "fetching %s %s\n", source, ref)
+	if _, err := git(ctx, dir, w, "fetch", "--force", "--no-tags", "--depth", "1", source, ref); err != nil {
+		return "", err
+	}
+	if _, err := git(ctx, dir, w, "checkout", "--force", "--detach", "--quiet", "FETCH_HEAD"); err != nil {
+		return "", err
+	}
+	if _, err := git(ctx, dir, w, "clean", "-ffdx", "--quiet"); err != nil {
+		return "", err
+	}
+	out, err := git(ctx, dir, nil, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	commit := strings.TrimSpace(out)
+	fmt.Fprintf(w, "checked out %s\n", commit)
+	return commit, nil
+}
+
+// git runs a git command in dir. Stderr (progress) is copied to w when set.
+func git(ctx context.Context, dir string, w io.Writer, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	if w != nil {
+		cmd.Stderr = io.MultiWriter(&stderr, w)
+	} else {
+		cmd.Stderr = &stderr
+	}
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg != "" {
+			return "", fmt.Errorf("git %s: %w\n%s", args[0], err, msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return stdout.String(), nil
+}
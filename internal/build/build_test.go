@@ -0,0 +1,98 @@
+package build
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tinyserve/internal/state"
+)
+
+func initRepo(t *testing.T) (string, string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	run := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+		)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	run("init", "--quiet", "--initial-branch", "main")
+	if err := os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	run("add", "Dockerfile")
+	run("commit", "--quiet", "-m", "initial")
+	return dir, run("rev-parse", "HEAD")
+}
+
+func TestImageTag(t *testing.T) {
+	got := ImageTag("MyApp", "0123456789abcdef0123")
+	if got != "tinyserve-build/myapp:0123456789ab" {
+		t.Errorf("ImageTag() = %q", got)
+	}
+	if got := ImageTag("app", "abc"); got != "tinyserve-build/app:abc" {
+		t.Errorf("ImageTag() short commit = %q", got)
+	}
+}
+
+func TestCheckoutLocalRepo(t *testing.T) {
+	src, head := initRepo(t)
+	work := filepath.Join(t.TempDir(), "app")
+
+	commit, err := checkout(context.Background(), work, src, "main", io.Discard)
+	if err != nil {
+		t.Fatalf("checkout() error = %v", err)
+	}
+	if commit != head {
+		t.Errorf("checkout() commit = %q, want %q", commit, head)
+	}
+	if _, err := os.Stat(filepath.Join(work, "Dockerfile")); err != nil {
+		t.Errorf("Dockerfile not checked out: %v", err)
+	}
+
+	// A second checkout reuses the working copy.
+	if err := os.WriteFile(filepath.Join(work, "stray"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	commit, err = checkout(context.Background(), work, src, "", io.Discard)
+	if err != nil {
+		t.Fatalf("second checkout() error = %v", err)
+	}
+	if commit != head {
+		t.Errorf("second checkout() commit = %q, want %q", commit, head)
+	}
+	if _, err := os.Stat(filepath.Join(work, "stray")); !os.IsNotExist(err) {
+		t.Error("checkout() should remove untracked files")
+	}
+}
+
+func TestCheckoutUnknownRef(t *testing.T) {
+	src, _ := initRepo(t)
+	work := filepath.Join(t.TempDir(), "app")
+	if _, err := checkout(context.Background(), work, src, "does-not-exist", io.Discard); err == nil {
+		t.Error("checkout() of unknown ref should fail")
+	}
+}
+
+func TestBuildRejectsDockerfileOutsideRepo(t *testing.T) {
+	b := NewBuilder(t.TempDir())
+	_, err := b.Build(context.Background(), "app", state.ServiceBuild{Source: "/nowhere", Dockerfile: "../Dockerfile"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "inside the repository") {
+		t.Errorf("Build() error = %v, want dockerfile path error", err)
+	}
+}
@@ -330,6 +330,21 @@ func (c *Client) DeleteDNSRecord(ctx context.Context, zoneID, recordID string) e
 	return nil
 }
 
+// DeleteCNAME deletes every CNAME record with the given name. It is not an
+// error if none exist.
+func (c *Client) DeleteCNAME(ctx context.Context, zoneID, name string) error {
+	records, err := c.ListDNSRecords(ctx, zoneID, "CNAME", name)
+	if err != nil {
+		return err
+	}
+	for _, rec := range records {
+		if err := c.DeleteDNSRecord(ctx, zoneID, rec.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // PurgeCache purges cache for a zone based on the request.
 func (c *Client) PurgeCache(ctx context.Context, zoneID string, req PurgeCacheRequest) error {
 	var resp apiResponse[map[string]any]
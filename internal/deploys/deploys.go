@@ -0,0 +1,324 @@
+// Package deploys records deploy runs and the output of their hooks.
+package deploys
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxHookOutputBytes caps the output kept per hook run.
+const MaxHookOutputBytes = 64 << 10
+
+// MaxBuildOutputBytes caps the output kept per build. The end is kept,
+// since that is where a build fails.
+const MaxBuildOutputBytes = 256 << 10
+
+// DefaultHistoryLimit is how many finished deploy records are kept.
+const DefaultHistoryLimit = 100
+
+const (
+	StatusPending    = "pending" // waiting for approval
+	StatusRunning    = "running"
+	StatusSucceeded  = "succeeded"
+	StatusFailed     = "failed"
+	StatusRejected   = "rejected"
+	StatusExpired    = "expired"    // not approved in time
+	StatusSuperseded = "superseded" // a newer deploy of the service was requested
+)
+
+const (
+	TriggerAPI     = "api"
+	TriggerWebhook = "webhook"
+	TriggerUpdate  = "update"
+	TriggerPreview = "preview"
+	TriggerCrash   = "crash" // rollback of a crash-looping service
+)
+
+const (
+	PhasePreDeploy  = "pre_deploy"
+	PhasePostDeploy = "post_deploy"
+)
+
+// ErrNotFound is returned when a deploy record does not exist.
+var ErrNotFound = errors.New("deploy not found")
+
+// HookRun is the outcome of one pre- or post-deploy hook.
+type HookRun struct {
+	Service         string   `json:"service"`
+	Phase           string   `json:"phase"`
+	Command         []string `json:"command"`
+	ExitCode        int      `json:"exit_code"`
+	DurationMs      int64    `json:"duration_ms"`
+	Error           string   `json:"error,omitempty"`
+	Output          string   `json:"output,omitempty"`
+	OutputTruncated bool     `json:"output_truncated,omitempty"`
+}
+
+// Failed reports whether the hook failed to run or exited non-zero.
+func (h HookRun) Failed() bool {
+	return h.Error != "" || h.ExitCode != 0
+}
+
+// BuildRun is the build of one git-build service. Output grows while the
+// build runs.
+type BuildRun struct {
+	Service         string `json:"service"`
+	Ref             string `json:"ref,omitempty"`
+	Commit          string `json:"commit,omitempty"`
+	Image           string `json:"image,omitempty"`
+	Cached          bool   `json:"cached,omitempty"`
+	DurationMs      int64  `json:"duration_ms"`
+	Error           string `json:"error,omitempty"`
+	Output          string `json:"output,omitempty"`
+	OutputTruncated bool   `json:"output_truncated,omitempty"`
+}
+
+// Record describes one deploy. Services lists the compose services it
+// targeted; empty means all of them.
+//
+// A deploy that needs approval starts out pending with the image or build
+// ref it was asked for, and becomes running once approved.
+type Record struct {
+	ID         string     `json:"id"`
+	Services   []string   `json:"services,omitempty"`
+	Trigger    string     `json:"trigger"`
+	Source     string     `json:"source,omitempty"`    // what asked for it, e.g. "github push main"
+	Image      string     `json:"image,omitempty"`     // requested image, if not the stored one
+	BuildRef   string     `json:"build_ref,omitempty"` // requested git ref for git-build services
+	Status     string     `json:"status"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	DurationMs int64      `json:"duration_ms,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	Builds     []BuildRun `json:"builds,omitempty"`
+	Hooks      []HookRun  `json:"hooks,omitempty"`
+
+	RequestedAt    *time.Time `json:"requested_at,omitempty"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	DecidedBy      string     `json:"decided_by,omitempty"`
+	DecidedAt      *time.Time `json:"decided_at,omitempty"`
+	Reason         string     `json:"reason,omitempty"`          // given when rejecting
+	TimeoutSeconds int        `json:"timeout_seconds,omitempty"` // health check timeout for the approved deploy
+	FreezeOverride string     `json:"freeze_override,omitempty"` // "window: reason" when forced through a freeze
+}
+
+// NewRecord returns a running record started now.
+func NewRecord(trigger string, services []string) Record {
+	now := time.Now().UTC()
+	return Record{
+		ID:        newID(now),
+		Services:  services,
+		Trigger:   trigger,
+		Status:    StatusRunning,
+		StartedAt: now,
+	}
+}
+
+// NewPendingRecord returns a record that waits ttl for approval.
+func NewPendingRecord(trigger string, services []string, ttl time.Duration) Record {
+	rec := NewRecord(trigger, services)
+	rec.Status = StatusPending
+	requested := rec.StartedAt
+	expires := requested.Add(ttl)
+	rec.RequestedAt = &requested
+	rec.ExpiresAt = &expires
+	return rec
+}
+
+// Expired reports whether a pending record has outlived its approval window.
+func (r Record) Expired(now time.Time) bool {
+	return r.Status == StatusPending && r.ExpiresAt != nil && now.After(*r.ExpiresAt)
+}
+
+// Decide records who approved or rejected a pending record. Approving makes
+// it running from now; any other status finishes it.
+func (r *Record) Decide(status, by, reason string) {
+	now := time.Now().UTC()
+	r.DecidedBy = by
+	r.DecidedAt = &now
+	r.Reason = reason
+	r.Status = status
+	if status == StatusRunning {
+		r.StartedAt = now
+		return
+	}
+	r.FinishedAt = &now
+}
+
+// Finish marks the record succeeded, or failed with err.
+func (r *Record) Finish(err error) {
+	finished := time.Now().UTC()
+	r.FinishedAt = &finished
+	r.DurationMs = finished.Sub(r.StartedAt).Milliseconds()
+	if err != nil {
+		r.Status = StatusFailed
+		r.Error = err.Error()
+		return
+	}
+	r.Status = StatusSucceeded
+}
+
+// Targets reports whether the deploy included service.
+func (r Record) Targets(service string) bool {
+	return len(r.Services) == 0 || slices.Contains(r.Services, service)
+}
+
+// History stores records as <root>/<id>.json.
+type History struct {
+	Root string
+}
+
+func NewHistory(root string) *History {
+	return &History{Root: root}
+}
+
+// Save writes the record, replacing any earlier version of it.
+func (h *History) Save(rec Record) error {
+	if err := os.MkdirAll(h.Root, 0o700); err != nil {
+		return fmt.Errorf("create deploy history dir: %w", err)
+	}
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(h.Root, rec.ID+".json.tmp")
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(h.Root, rec.ID+".json"))
+}
+
+// List returns records newest first. A non-empty service limits the result
+// to deploys that included it.
+func (h *History) List(service string) ([]Record, error) {
+	entries, err := os.ReadDir(h.Root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var recs []Record
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(h.Root, e.Name()))
+		if err != nil {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(data, &rec); err != nil {
+			continue
+		}
+		if service != "" && !rec.Targets(service) {
+			continue
+		}
+		recs = append(recs, rec)
+	}
+	sort.Slice(recs, func(i, j int) bool { return recs[i].ID > recs[j].ID })
+	return recs, nil
+}
+
+// Get returns a single record.
+func (h *History) Get(id string) (Record, error) {
+	if !validID(id) {
+		return Record{}, ErrNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(h.Root, id+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Record{}, ErrNotFound
+		}
+		return Record{}, err
+	}
+	var rec Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return Record{}, err
+	}
+	return rec, nil
+}
+
+// Prune removes finished records beyond the newest keep.
+func (h *History) Prune(keep int) error {
+	recs, err := h.List("")
+	if err != nil {
+		return err
+	}
+	kept := 0
+	for _, rec := range recs {
+		if rec.Status == StatusRunning || rec.Status == StatusPending || kept < keep {
+			kept++
+			continue
+		}
+		_ = os.Remove(filepath.Join(h.Root, rec.ID+".json"))
+	}
+	return nil
+}
+
+func newID(t time.Time) string {
+	var b [3]byte
+	_, _ = rand.Read(b[:])
+	return t.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(b[:])
+}
+
+func validID(id string) bool {
+	return id != "" && !strings.ContainsAny(id, `/\.`)
+}
+
+// OutputBuffer keeps the first MaxHookOutputBytes written to it.
+type OutputBuffer struct {
+	buf       []byte
+	Truncated bool
+}
+
+func (b *OutputBuffer) Write(p []byte) (int, error) {
+	room := MaxHookOutputBytes - len(b.buf)
+	if len(p) > room {
+		b.buf = append(b.buf, p[:max(room, 0)]...)
+		b.Truncated = true
+		return len(p), nil
+	}
+	b.buf = append(b.buf, p...)
+	return len(p), nil
+}
+
+func (b *OutputBuffer) String() string {
+	return string(b.buf)
+}
+
+// TailBuffer keeps the last MaxBuildOutputBytes written to it.
+type TailBuffer struct {
+	buf       []byte
+	Truncated bool
+}
+
+func (b *TailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	if over := len(b.buf) - MaxBuildOutputBytes; over > 0 {
+		b.buf = append(b.buf[:0], b.buf[over:]...)
+		b.Truncated = true
+	}
+	return len(p), nil
+}
+
+// String returns the kept output, starting at a line boundary once
+// truncated.
+func (b *TailBuffer) String() string {
+	s := string(b.buf)
+	if b.Truncated {
+		if i := strings.IndexByte(s, '\n'); i >= 0 {
+			s = s[i+1:]
+		}
+	}
+	return s
+}
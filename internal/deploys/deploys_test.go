@@ -0,0 +1,100 @@
+package deploys
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistorySaveListPrune(t *testing.T) {
+	h := NewHistory(t.TempDir())
+
+	base := time.Date(2026, 3, 2, 3, 0, 0, 0, time.UTC)
+	var ids []string
+	for i, services := range [][]string{{"web"}, {"api"}, nil} {
+		rec := NewRecord(TriggerAPI, services)
+		rec.ID = newID(base.Add(time.Duration(i) * time.Minute))
+		rec.Finish(nil)
+		if err := h.Save(rec); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+		ids = append(ids, rec.ID)
+	}
+
+	all, err := h.List("")
+	if err != nil || len(all) != 3 || all[0].ID != ids[2] {
+		t.Fatalf("List() = %+v, %v; want 3 records newest first", all, err)
+	}
+	web, _ := h.List("web")
+	if len(web) != 2 || web[0].ID != ids[2] || web[1].ID != ids[0] {
+		t.Errorf("List(web) = %+v, want the web deploy and the full deploy", web)
+	}
+
+	if err := h.Prune(1); err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	all, _ = h.List("")
+	if len(all) != 1 || all[0].ID != ids[2] {
+		t.Errorf("after Prune(1) = %+v", all)
+	}
+	if _, err := h.Get(ids[0]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(pruned) error = %v, want ErrNotFound", err)
+	}
+	if _, err := h.Get("../state"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(../state) error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestRecordFinish(t *testing.T) {
+	rec := NewRecord(TriggerWebhook, []string{"web"})
+	rec.Finish(errors.New("pre-deploy hook failed"))
+	if rec.Status != StatusFailed || rec.Error != "pre-deploy hook failed" || rec.FinishedAt == nil {
+		t.Errorf("failed record = %+v", rec)
+	}
+}
+
+func TestOutputBuffer(t *testing.T) {
+	var b OutputBuffer
+	b.Write([]byte(strings.Repeat("a", MaxHookOutputBytes-1)))
+	if b.Truncated {
+		t.Fatal("truncated too early")
+	}
+	n, _ := b.Write([]byte("bcd"))
+	if n != 3 || !b.Truncated || len(b.String()) != MaxHookOutputBytes || !strings.HasSuffix(b.String(), "ab") {
+		t.Errorf("n=%d truncated=%v len=%d", n, b.Truncated, len(b.String()))
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	var b TailBuffer
+	b.Write([]byte("first\n"))
+	if b.Truncated || b.String() != "first\n" {
+		t.Fatalf("String() = %q", b.String())
+	}
+	b.Write([]byte(strings.Repeat("x", MaxBuildOutputBytes) + "\nlast\n"))
+	if !b.Truncated || b.String() != "last\n" {
+		t.Errorf("truncated=%v String() = %q", b.Truncated, b.String())
+	}
+}
+
+func TestPendingRecord(t *testing.T) {
+	rec := NewPendingRecord(TriggerWebhook, []string{"web"}, time.Hour)
+	if rec.Expired(rec.StartedAt.Add(59*time.Minute)) || !rec.Expired(rec.StartedAt.Add(61*time.Minute)) {
+		t.Errorf("Expired() does not follow the one hour window: %+v", rec)
+	}
+
+	h := NewHistory(t.TempDir())
+	h.Save(rec)
+	if err := h.Prune(0); err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	if _, err := h.Get(rec.ID); err != nil {
+		t.Errorf("Prune removed a pending deploy: %v", err)
+	}
+
+	rec.Decide(StatusRunning, "ops@example.com", "")
+	if rec.Status != StatusRunning || rec.FinishedAt != nil || rec.DecidedAt == nil || rec.Expired(rec.StartedAt.Add(2*time.Hour)) {
+		t.Errorf("approved record = %+v", rec)
+	}
+}
@@ -0,0 +1,788 @@
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiVersion is the Engine API version requested. 1.41 is Docker 20.10,
+// which every supported Docker Desktop and Engine release speaks.
+const apiVersion = "v1.41"
+
+// Client is an Engine API client over the daemon's Unix socket.
+type Client struct {
+	Socket string
+	CLI    string // command for credentialed pulls; "docker" if empty
+	// InspectHealth fills in the health of running containers that the
+	// list endpoint reports without one, as Podman's compat API can.
+	InspectHealth bool
+	http          *http.Client
+}
+
+// userSockets are the per-user sockets of Docker Desktop, Colima and
+// Rancher Desktop, relative to the home directory.
+var userSockets = []string{
+	".docker/run/docker.sock",
+	".colima/default/docker.sock",
+	".rd/docker.sock",
+}
+
+// DefaultSocket returns the socket named by DOCKER_HOST, else the first
+// per-user runtime socket that exists, else /var/run/docker.sock.
+func DefaultSocket() string {
+	if host := os.Getenv("DOCKER_HOST"); strings.HasPrefix(host, "unix://") {
+		return strings.TrimPrefix(host, "unix://")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		for _, rel := range userSockets {
+			socket := filepath.Join(home, rel)
+			if _, err := os.Stat(socket); err == nil {
+				return socket
+			}
+		}
+	}
+	return "/var/run/docker.sock"
+}
+
+func NewClient(socket string) *Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	return &Client{
+		Socket: socket,
+		http: &http.Client{
+			// No overall timeout: logs and events stream until ctx is done.
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", socket)
+				},
+				MaxIdleConns:    10,
+				IdleConnTimeout: 30 * time.Second,
+			},
+		},
+	}
+}
+
+// apiError is a non-2xx response from the engine.
+type apiError struct {
+	Status  int
+	Message string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("docker engine: %s (status %d)", e.Message, e.Status)
+}
+
+func (e *apiError) Is(target error) bool {
+	return target == ErrNotFound && e.Status == http.StatusNotFound
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body io.Reader) (*http.Response, error) {
+	u := "http://docker/" + apiVersion + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("docker engine at %s: %w", c.Socket, err)
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		var msg struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &msg) != nil || msg.Message == "" {
+			msg.Message = strings.TrimSpace(string(data))
+		}
+		return nil, &apiError{Status: resp.StatusCode, Message: msg.Message}
+	}
+	return resp, nil
+}
+
+func (c *Client) getJSON(ctx context.Context, path string, query url.Values, out any) error {
+	resp, err := c.do(ctx, http.MethodGet, path, query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode %s: %w", path, err)
+	}
+	return nil
+}
+
+// filterQuery encodes Engine API filters, e.g. {"label": ["a=b"]}.
+func filterQuery(filters map[string][]string) string {
+	data, _ := json.Marshal(filters)
+	return string(data)
+}
+
+func (c *Client) Ping(ctx context.Context) error {
+	resp, err := c.do(ctx, http.MethodGet, "/_ping", nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// ListContainers filters one-off containers out itself: podman-compose
+// doesn't set the oneoff label, so a "oneoff=False" filter would hide all
+// of its containers.
+func (c *Client) ListContainers(ctx context.Context, opts ListOptions) ([]Container, error) {
+	var labels []string
+	if opts.Project != "" {
+		labels = append(labels, LabelProject+"="+opts.Project)
+	}
+	if opts.Service != "" {
+		labels = append(labels, LabelService+"="+opts.Service)
+	}
+	q := url.Values{}
+	if len(labels) > 0 {
+		q.Set("filters", filterQuery(map[string][]string{"label": labels}))
+	}
+	if opts.All {
+		q.Set("all", "1")
+	}
+	var raw []struct {
+		ID      string            `json:"Id"`
+		Names   []string          `json:"Names"`
+		Image   string            `json:"Image"`
+		ImageID string            `json:"ImageID"`
+		State   string            `json:"State"`
+		Status  string            `json:"Status"`
+		Created int64             `json:"Created"`
+		Labels  map[string]string `json:"Labels"`
+	}
+	if err := c.getJSON(ctx, "/containers/json", q, &raw); err != nil {
+		return nil, err
+	}
+	containers := make([]Container, 0, len(raw))
+	for _, r := range raw {
+		if strings.EqualFold(r.Labels[LabelOneOff], "true") {
+			continue
+		}
+		name := ""
+		if len(r.Names) > 0 {
+			name = strings.TrimPrefix(r.Names[0], "/")
+		}
+		containers = append(containers, Container{
+			ID:      r.ID,
+			Name:    name,
+			Project: r.Labels[LabelProject],
+			Service: r.Labels[LabelService],
+			Image:   r.Image,
+			ImageID: r.ImageID,
+			State:   r.State,
+			Status:  r.Status,
+			Health:  healthFromStatus(r.Status),
+			Created: time.Unix(r.Created, 0),
+			Labels:  r.Labels,
+		})
+	}
+	if c.InspectHealth {
+		for i := range containers {
+			if containers[i].State != "running" || containers[i].Health != "" {
+				continue
+			}
+			if d, err := c.InspectContainer(ctx, containers[i].ID); err == nil {
+				containers[i].Health = d.Health
+			}
+		}
+	}
+	sort.Slice(containers, func(i, j int) bool { return containers[i].Name < containers[j].Name })
+	return containers, nil
+}
+
+func (c *Client) InspectContainer(ctx context.Context, id string) (ContainerDetails, error) {
+	var raw struct {
+		ID      string `json:"Id"`
+		Name    string `json:"Name"`
+		Created string `json:"Created"`
+		Image   string `json:"Image"`
+		Config  struct {
+			Image  string            `json:"Image"`
+			Labels map[string]string `json:"Labels"`
+		} `json:"Config"`
+		State struct {
+			Status     string     `json:"Status"`
+			StartedAt  string     `json:"StartedAt"`
+			FinishedAt string     `json:"FinishedAt"`
+			ExitCode   int        `json:"ExitCode"`
+			OOMKilled  bool       `json:"OOMKilled"`
+			Health     *rawHealth `json:"Health"`
+			// Podman before 4.0 reports health under this name.
+			Healthcheck *rawHealth `json:"Healthcheck"`
+		} `json:"State"`
+		RestartCount int `json:"RestartCount"`
+	}
+	if err := c.getJSON(ctx, "/containers/"+url.PathEscape(id)+"/json", nil, &raw); err != nil {
+		return ContainerDetails{}, err
+	}
+	d := ContainerDetails{
+		Container: Container{
+			ID:      raw.ID,
+			Name:    strings.TrimPrefix(raw.Name, "/"),
+			Project: raw.Config.Labels[LabelProject],
+			Service: raw.Config.Labels[LabelService],
+			Image:   raw.Config.Image,
+			ImageID: raw.Image,
+			State:   raw.State.Status,
+			Created: parseEngineTime(raw.Created),
+			Labels:  raw.Config.Labels,
+		},
+		StartedAt:    parseEngineTime(raw.State.StartedAt),
+		FinishedAt:   parseEngineTime(raw.State.FinishedAt),
+		ExitCode:     raw.State.ExitCode,
+		RestartCount: raw.RestartCount,
+		OOMKilled:    raw.State.OOMKilled,
+	}
+	if raw.State.Health != nil {
+		d.Health = raw.State.Health.Status
+	} else if raw.State.Healthcheck != nil {
+		d.Health = raw.State.Healthcheck.Status
+	}
+	return d, nil
+}
+
+type rawHealth struct {
+	Status string `json:"Status"`
+}
+
+// parseEngineTime parses the engine's RFC 3339 timestamps. It reports
+// "0001-01-01T00:00:00Z" for events that never happened, which parses to
+// the zero time.
+func parseEngineTime(s string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+func (c *Client) ContainerLogs(ctx context.Context, id string, opts LogOptions, w io.Writer) error {
+	q := url.Values{"stdout": {"1"}, "stderr": {"1"}, "tail": {"all"}}
+	if opts.Tail > 0 {
+		q.Set("tail", strconv.Itoa(opts.Tail))
+	}
+	if opts.Follow {
+		q.Set("follow", "1")
+	}
+	if !opts.Since.IsZero() {
+		q.Set("since", strconv.FormatInt(opts.Since.Unix(), 10))
+	}
+	if !opts.Until.IsZero() {
+		q.Set("until", strconv.FormatInt(opts.Until.Unix(), 10))
+	}
+	if opts.Timestamps {
+		q.Set("timestamps", "1")
+	}
+	resp, err := c.do(ctx, http.MethodGet, "/containers/"+url.PathEscape(id)+"/logs", q, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	stderr := opts.Stderr
+	if stderr == nil {
+		stderr = w
+	}
+	err = demuxLogs(resp.Body, w, stderr)
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// demuxLogs copies a log stream to stdout and stderr. Containers without a
+// TTY multiplex the two into frames with an 8-byte header (stream, 0, 0, 0,
+// big-endian length); a TTY stream is raw and copied to stdout as is.
+func demuxLogs(r io.Reader, stdout, stderr io.Writer) error {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(8)
+	if err != nil {
+		// Shorter than a header: either empty or a raw TTY stream.
+		_, err := io.Copy(stdout, br)
+		return err
+	}
+	if header[0] > 2 || header[1] != 0 || header[2] != 0 || header[3] != 0 {
+		_, err := io.Copy(stdout, br)
+		return err
+	}
+	return demux(br, stdout, stderr)
+}
+
+// demux splits a multiplexed stream into stdout and stderr.
+func demux(r io.Reader, stdout, stderr io.Writer) error {
+	var hdr [8]byte
+	for {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		w := stdout
+		if hdr[0] == 2 {
+			w = stderr
+		}
+		size := int64(binary.BigEndian.Uint32(hdr[4:]))
+		if _, err := io.CopyN(w, r, size); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Client) ContainerStats(ctx context.Context, id string) (Stats, error) {
+	type cpuStats struct {
+		CPUUsage struct {
+			TotalUsage  uint64   `json:"total_usage"`
+			PercpuUsage []uint64 `json:"percpu_usage"`
+		} `json:"cpu_usage"`
+		SystemUsage uint64 `json:"system_cpu_usage"`
+		OnlineCPUs  uint64 `json:"online_cpus"`
+	}
+	var raw struct {
+		Read        time.Time `json:"read"`
+		CPUStats    cpuStats  `json:"cpu_stats"`
+		PreCPUStats cpuStats  `json:"precpu_stats"`
+		MemoryStats struct {
+			Usage uint64            `json:"usage"`
+			Limit uint64            `json:"limit"`
+			Stats map[string]uint64 `json:"stats"`
+		} `json:"memory_stats"`
+		Networks map[string]struct {
+			RxBytes uint64 `json:"rx_bytes"`
+			TxBytes uint64 `json:"tx_bytes"`
+		} `json:"networks"`
+		BlkioStats struct {
+			IOServiceBytesRecursive []struct {
+				Op    string `json:"op"`
+				Value uint64 `json:"value"`
+			} `json:"io_service_bytes_recursive"`
+		} `json:"blkio_stats"`
+		PidsStats struct {
+			Current uint64 `json:"current"`
+		} `json:"pids_stats"`
+	}
+	// stream=false waits for a second sample so precpu_stats is filled in.
+	if err := c.getJSON(ctx, "/containers/"+url.PathEscape(id)+"/stats", url.Values{"stream": {"false"}}, &raw); err != nil {
+		return Stats{}, err
+	}
+
+	s := Stats{
+		Read:             raw.Read,
+		MemoryLimitBytes: raw.MemoryStats.Limit,
+		PIDs:             raw.PidsStats.Current,
+	}
+	cpuDelta := float64(raw.CPUStats.CPUUsage.TotalUsage) - float64(raw.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(raw.CPUStats.SystemUsage) - float64(raw.PreCPUStats.SystemUsage)
+	cpus := float64(raw.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(raw.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpuDelta > 0 && systemDelta > 0 {
+		s.CPUPercent = cpuDelta / systemDelta * cpus * 100
+	}
+	// Like docker stats, leave out page cache the kernel can reclaim
+	// (inactive_file on cgroup v2, cache on v1).
+	mem := raw.MemoryStats.Usage
+	if v, ok := raw.MemoryStats.Stats["inactive_file"]; ok && v < mem {
+		mem -= v
+	} else if v, ok := raw.MemoryStats.Stats["cache"]; ok && v < mem {
+		mem -= v
+	}
+	s.MemoryBytes = mem
+	for _, n := range raw.Networks {
+		s.NetworkRxBytes += n.RxBytes
+		s.NetworkTxBytes += n.TxBytes
+	}
+	for _, b := range raw.BlkioStats.IOServiceBytesRecursive {
+		switch strings.ToLower(b.Op) {
+		case "read":
+			s.BlockReadBytes += b.Value
+		case "write":
+			s.BlockWriteBytes += b.Value
+		}
+	}
+	return s, nil
+}
+
+func (c *Client) Events(ctx context.Context, opts EventOptions, fn func(Event)) error {
+	filters := map[string][]string{}
+	if opts.Project != "" {
+		filters["label"] = []string{LabelProject + "=" + opts.Project}
+	}
+	if len(opts.Types) > 0 {
+		filters["type"] = opts.Types
+	}
+	q := url.Values{}
+	if len(filters) > 0 {
+		q.Set("filters", filterQuery(filters))
+	}
+	if !opts.Since.IsZero() {
+		q.Set("since", strconv.FormatInt(opts.Since.Unix(), 10))
+	}
+	resp, err := c.do(ctx, http.MethodGet, "/events", q, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var raw struct {
+			Type   string `json:"Type"`
+			Action string `json:"Action"`
+			Actor  struct {
+				ID         string            `json:"ID"`
+				Attributes map[string]string `json:"Attributes"`
+			} `json:"Actor"`
+			TimeNano int64 `json:"timeNano"`
+		}
+		if err := dec.Decode(&raw); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err == io.EOF {
+				return fmt.Errorf("docker engine closed the event stream")
+			}
+			return fmt.Errorf("decode event: %w", err)
+		}
+		fn(Event{
+			Type:       raw.Type,
+			Action:     raw.Action,
+			ID:         raw.Actor.ID,
+			Name:       raw.Actor.Attributes["name"],
+			Service:    raw.Actor.Attributes[LabelService],
+			Attributes: raw.Actor.Attributes,
+			Time:       time.Unix(0, raw.TimeNano),
+		})
+	}
+}
+
+type rawImageConfig struct {
+	ExposedPorts map[string]struct{} `json:"ExposedPorts"`
+	Volumes      map[string]struct{} `json:"Volumes"`
+	Labels       map[string]string   `json:"Labels"`
+}
+
+func (c *Client) Exec(ctx context.Context, id string, opts ExecOptions) (int, error) {
+	body, _ := json.Marshal(map[string]any{
+		"Cmd":          opts.Cmd,
+		"Tty":          opts.Tty,
+		"AttachStdin":  opts.Stdin != nil,
+		"AttachStdout": true,
+		"AttachStderr": true,
+	})
+	resp, err := c.do(ctx, http.MethodPost, "/containers/"+url.PathEscape(id)+"/exec", nil, bytes.NewReader(body))
+	if err != nil {
+		return -1, err
+	}
+	var created struct {
+		ID string `json:"Id"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	if err != nil || created.ID == "" {
+		return -1, fmt.Errorf("create exec in %s: unexpected response", id)
+	}
+	execPath := "/exec/" + url.PathEscape(created.ID)
+
+	start, _ := json.Marshal(map[string]any{"Detach": false, "Tty": opts.Tty})
+	conn, br, err := c.hijack(ctx, execPath+"/start", start)
+	if err != nil {
+		return -1, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if opts.Resize != nil {
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			for {
+				select {
+				case size, ok := <-opts.Resize:
+					if !ok {
+						return
+					}
+					q := url.Values{"h": {strconv.Itoa(int(size.Rows))}, "w": {strconv.Itoa(int(size.Cols))}}
+					if resp, err := c.do(ctx, http.MethodPost, execPath+"/resize", q, nil); err == nil {
+						resp.Body.Close()
+					}
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+	if opts.Stdin != nil {
+		go func() {
+			io.Copy(conn, opts.Stdin)
+			// Half-close so the command sees EOF on its stdin.
+			if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+				cw.CloseWrite()
+			}
+		}()
+	}
+
+	stdout, stderr := opts.Stdout, opts.Stderr
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = stdout
+	}
+	if opts.Tty {
+		_, err = io.Copy(stdout, br)
+	} else {
+		err = demux(br, stdout, stderr)
+	}
+	if ctx.Err() != nil {
+		return -1, ctx.Err()
+	}
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		return -1, fmt.Errorf("exec in %s: %w", id, err)
+	}
+
+	var inspect struct {
+		Running  bool `json:"Running"`
+		ExitCode int  `json:"ExitCode"`
+	}
+	if err := c.getJSON(ctx, execPath+"/json", nil, &inspect); err != nil {
+		return -1, err
+	}
+	return inspect.ExitCode, nil
+}
+
+// hijack posts body to path and takes over the connection once the engine
+// switches it to a raw stream, as exec start does for attached commands.
+// The returned reader holds what the engine sent after its response.
+func (c *Client) hijack(ctx context.Context, path string, body []byte) (net.Conn, *bufio.Reader, error) {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	conn, err := dialer.DialContext(ctx, "unix", c.Socket)
+	if err != nil {
+		return nil, nil, fmt.Errorf("docker engine at %s: %w", c.Socket, err)
+	}
+	req, err := http.NewRequest(http.MethodPost, "http://docker/"+apiVersion+path, bytes.NewReader(body))
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("docker engine at %s: %w", c.Socket, err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("docker engine at %s: %w", c.Socket, err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusSwitchingProtocols:
+	case resp.StatusCode == http.StatusOK:
+		// Engines that don't upgrade stream the output as the body.
+		return conn, bufio.NewReader(resp.Body), nil
+	default:
+		defer conn.Close()
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		var msg struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &msg) != nil || msg.Message == "" {
+			msg.Message = strings.TrimSpace(string(data))
+		}
+		return nil, nil, &apiError{Status: resp.StatusCode, Message: msg.Message}
+	}
+	return conn, br, nil
+}
+
+func (c *Client) InspectImage(ctx context.Context, ref string) (Image, error) {
+	var raw struct {
+		ID          string         `json:"Id"`
+		RepoTags    []string       `json:"RepoTags"`
+		RepoDigests []string       `json:"RepoDigests"`
+		Created     string         `json:"Created"`
+		Config      rawImageConfig `json:"Config"`
+	}
+	// Image references keep their slashes; the engine routes on the
+	// trailing /json.
+	if err := c.getJSON(ctx, "/images/"+ref+"/json", nil, &raw); err != nil {
+		return Image{}, err
+	}
+	img := Image{
+		ID:          raw.ID,
+		RepoTags:    raw.RepoTags,
+		RepoDigests: raw.RepoDigests,
+		Created:     parseEngineTime(raw.Created),
+		Labels:      raw.Config.Labels,
+	}
+	for spec := range raw.Config.ExposedPorts {
+		port, _, _ := strings.Cut(spec, "/")
+		if n, err := strconv.Atoi(port); err == nil && n > 0 {
+			img.ExposedPorts = append(img.ExposedPorts, n)
+		}
+	}
+	sort.Ints(img.ExposedPorts)
+	for path := range raw.Config.Volumes {
+		img.Volumes = append(img.Volumes, path)
+	}
+	sort.Strings(img.Volumes)
+	return img, nil
+}
+
+func (c *Client) ListImages(ctx context.Context, reference string) ([]Image, error) {
+	q := url.Values{}
+	if reference != "" {
+		q.Set("filters", filterQuery(map[string][]string{"reference": {reference}}))
+	}
+	var raw []struct {
+		ID          string            `json:"Id"`
+		RepoTags    []string          `json:"RepoTags"`
+		RepoDigests []string          `json:"RepoDigests"`
+		Created     int64             `json:"Created"`
+		Labels      map[string]string `json:"Labels"`
+	}
+	if err := c.getJSON(ctx, "/images/json", q, &raw); err != nil {
+		return nil, err
+	}
+	images := make([]Image, 0, len(raw))
+	for _, r := range raw {
+		images = append(images, Image{
+			ID:          r.ID,
+			RepoTags:    r.RepoTags,
+			RepoDigests: r.RepoDigests,
+			Created:     time.Unix(r.Created, 0),
+			Labels:      r.Labels,
+		})
+	}
+	sort.SliceStable(images, func(i, j int) bool { return images[i].Created.After(images[j].Created) })
+	return images, nil
+}
+
+// PullImage pulls through the engine. The engine can't use the CLI's
+// credential helpers (such as the macOS keychain), so when a registry
+// refuses an anonymous pull it falls back to the CLI's pull, which can.
+func (c *Client) PullImage(ctx context.Context, ref string, w io.Writer) error {
+	repo, tag := splitReference(ref)
+	q := url.Values{"fromImage": {repo}, "tag": {tag}}
+	resp, err := c.do(ctx, http.MethodPost, "/images/create", q, nil)
+	if err == nil {
+		defer resp.Body.Close()
+		err = readPullProgress(resp.Body, w)
+	}
+	if err != nil && isAuthError(err) {
+		return pullWithCLI(ctx, c.CLI, ref, w)
+	}
+	if err != nil {
+		return fmt.Errorf("pull image %s: %w", ref, err)
+	}
+	return nil
+}
+
+// readPullProgress drains the JSON progress stream of a pull. Failures after
+// the request was accepted are reported inside the stream.
+func readPullProgress(r io.Reader, w io.Writer) error {
+	dec := json.NewDecoder(r)
+	for {
+		var msg struct {
+			Status      string `json:"status"`
+			ID          string `json:"id"`
+			Error       string `json:"error"`
+			ErrorDetail struct {
+				Message string `json:"message"`
+			} `json:"errorDetail"`
+		}
+		if err := dec.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("read pull progress: %w", err)
+		}
+		if msg.Error != "" {
+			return errors.New(msg.Error)
+		}
+		if msg.ErrorDetail.Message != "" {
+			return errors.New(msg.ErrorDetail.Message)
+		}
+		if w != nil && msg.Status != "" {
+			if msg.ID != "" {
+				fmt.Fprintf(w, "%s: %s\n", msg.ID, msg.Status)
+			} else {
+				fmt.Fprintln(w, msg.Status)
+			}
+		}
+	}
+}
+
+func isAuthError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "unauthorized") || strings.Contains(msg, "denied") ||
+		strings.Contains(msg, "authentication required")
+}
+
+func pullWithCLI(ctx context.Context, cli, ref string, w io.Writer) error {
+	if cli == "" {
+		cli = "docker"
+	}
+	cmd := exec.CommandContext(ctx, cli, "pull", ref)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("pull image %s: %w\n%s", ref, err, out.String())
+	}
+	if w != nil {
+		_, _ = w.Write(out.Bytes())
+	}
+	return nil
+}
+
+// splitReference splits an image reference into the fromImage and tag
+// parameters of a pull. A digest is passed as the tag.
+func splitReference(ref string) (repo, tag string) {
+	if i := strings.Index(ref, "@"); i >= 0 {
+		return ref[:i], ref[i+1:]
+	}
+	slash := strings.LastIndex(ref, "/")
+	if i := strings.LastIndex(ref, ":"); i > slash {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, "latest"
+}
+
+func (c *Client) RemoveImage(ctx context.Context, ref string) error {
+	resp, err := c.do(ctx, http.MethodDelete, "/images/"+ref, nil, nil)
+	if err != nil {
+		return fmt.Errorf("remove image %s: %w", ref, err)
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -0,0 +1,328 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestClient serves mux on a Unix socket and returns a Client for it.
+func newTestClient(t *testing.T, mux *http.ServeMux) *Client {
+	t.Helper()
+	// t.TempDir paths can exceed the 108-byte limit on socket paths.
+	dir, err := os.MkdirTemp("", "tsd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "docker.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: http.StripPrefix("/"+apiVersion, mux)}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return NewClient(socket)
+}
+
+func TestListContainers(t *testing.T) {
+	mux := http.NewServeMux()
+	var filters string
+	mux.HandleFunc("GET /containers/json", func(w http.ResponseWriter, r *http.Request) {
+		filters = r.URL.Query().Get("filters")
+		w.Write([]byte(`[
+			{"Id":"b2","Names":["/app-worker-1"],"Image":"worker:1","State":"exited","Status":"Exited (1) 2 minutes ago",
+			 "Labels":{"com.docker.compose.project":"app","com.docker.compose.service":"worker"}},
+			{"Id":"a1","Names":["/app-web-1"],"Image":"web:1","State":"running","Status":"Up 5 minutes (healthy)","Created":1700000000,
+			 "Labels":{"com.docker.compose.project":"app","com.docker.compose.service":"web"}}
+		]`))
+	})
+	c := newTestClient(t, mux)
+
+	got, err := c.ListContainers(context.Background(), ListOptions{Project: "app", All: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Name != "app-web-1" || got[1].Name != "app-worker-1" {
+		t.Fatalf("containers = %+v, want sorted by name", got)
+	}
+	if got[0].Service != "web" || got[0].Health != "healthy" || got[0].Created.Unix() != 1700000000 {
+		t.Errorf("web = %+v", got[0])
+	}
+	if got[1].Health != "" || got[1].State != "exited" {
+		t.Errorf("worker = %+v", got[1])
+	}
+
+	var f map[string][]string
+	if err := json.Unmarshal([]byte(filters), &f); err != nil {
+		t.Fatalf("filters %q: %v", filters, err)
+	}
+	want := []string{LabelProject + "=app"}
+	if !reflect.DeepEqual(f["label"], want) {
+		t.Errorf("label filters = %v, want %v", f["label"], want)
+	}
+}
+
+func TestInspectContainer(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /containers/{id}/json", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") != "app-web-1" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"No such container: ` + r.PathValue("id") + `"}`))
+			return
+		}
+		w.Write([]byte(`{"Id":"a1","Name":"/app-web-1","Image":"sha256:abc","RestartCount":3,
+			"Config":{"Image":"web:1","Labels":{"com.docker.compose.service":"web"}},
+			"State":{"Status":"running","StartedAt":"2026-01-02T03:04:05.123456789Z","FinishedAt":"0001-01-01T00:00:00Z",
+			         "Health":{"Status":"unhealthy"}}}`))
+	})
+	c := newTestClient(t, mux)
+
+	d, err := c.InspectContainer(context.Background(), "app-web-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Name != "app-web-1" || d.Service != "web" || d.Image != "web:1" || d.ImageID != "sha256:abc" {
+		t.Errorf("details = %+v", d)
+	}
+	if d.Health != "unhealthy" || d.RestartCount != 3 {
+		t.Errorf("health %q restarts %d", d.Health, d.RestartCount)
+	}
+	if d.StartedAt.Year() != 2026 || !d.FinishedAt.IsZero() {
+		t.Errorf("started %v finished %v", d.StartedAt, d.FinishedAt)
+	}
+
+	_, err = c.InspectContainer(context.Background(), "missing")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("err = %v, want ErrNotFound", err)
+	}
+	if !strings.Contains(err.Error(), "No such container: missing") {
+		t.Errorf("err = %v, want engine message", err)
+	}
+}
+
+func TestListContainersPodman(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /containers/json", func(w http.ResponseWriter, r *http.Request) {
+		// podman-compose sets no oneoff label; "compose run" containers of
+		// docker compose carry oneoff=True.
+		w.Write([]byte(`[
+			{"Id":"a1","Names":["/app_web_1"],"State":"running","Status":"Up 5 minutes",
+			 "Labels":{"com.docker.compose.project":"app","com.docker.compose.service":"web"}},
+			{"Id":"c3","Names":["/app-web-run-1"],"State":"running","Status":"Up 1 second",
+			 "Labels":{"com.docker.compose.project":"app","com.docker.compose.service":"web","com.docker.compose.oneoff":"True"}}
+		]`))
+	})
+	mux.HandleFunc("GET /containers/{id}/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Id":"a1","Name":"app_web_1","State":{"Status":"running","Healthcheck":{"Status":"starting"}}}`))
+	})
+	c := newTestClient(t, mux)
+	c.InspectHealth = true
+
+	got, err := c.ListContainers(context.Background(), ListOptions{Project: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Name != "app_web_1" {
+		t.Fatalf("containers = %+v, want only the compose-managed one", got)
+	}
+	if got[0].Health != "starting" {
+		t.Errorf("health = %q, want it read from inspect", got[0].Health)
+	}
+}
+
+func logFrame(stream byte, s string) []byte {
+	hdr := make([]byte, 8, 8+len(s))
+	hdr[0] = stream
+	binary.BigEndian.PutUint32(hdr[4:], uint32(len(s)))
+	return append(hdr, s...)
+}
+
+func TestDemuxLogs(t *testing.T) {
+	var stream []byte
+	stream = append(stream, logFrame(1, "hello\n")...)
+	stream = append(stream, logFrame(2, "oops\n")...)
+	stream = append(stream, logFrame(1, "bye\n")...)
+	var out, errOut bytes.Buffer
+	if err := demuxLogs(bytes.NewReader(stream), &out, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "hello\noops\nbye\n" {
+		t.Errorf("multiplexed = %q", out.String())
+	}
+
+	out.Reset()
+	if err := demuxLogs(bytes.NewReader(stream), &out, &errOut); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "hello\nbye\n" || errOut.String() != "oops\n" {
+		t.Errorf("split = %q and %q", out.String(), errOut.String())
+	}
+
+	out.Reset()
+	if err := demuxLogs(strings.NewReader("tty output without frames\n"), &out, &errOut); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "tty output without frames\n" {
+		t.Errorf("raw = %q", out.String())
+	}
+
+	out.Reset()
+	if err := demuxLogs(strings.NewReader("hi\n"), &out, &errOut); err != nil || out.String() != "hi\n" {
+		t.Errorf("short raw = %q, %v", out.String(), err)
+	}
+}
+
+func TestExec(t *testing.T) {
+	mux := http.NewServeMux()
+	var created map[string]any
+	mux.HandleFunc("POST /containers/c1/exec", func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&created)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"Id":"e1"}`))
+	})
+	resized := make(chan string, 1)
+	mux.HandleFunc("POST /exec/e1/resize", func(w http.ResponseWriter, r *http.Request) {
+		resized <- r.URL.Query().Get("h") + "x" + r.URL.Query().Get("w")
+	})
+	mux.HandleFunc("POST /exec/e1/start", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "tcp" {
+			http.Error(w, "not an upgrade", http.StatusBadRequest)
+			return
+		}
+		io.Copy(io.Discard, r.Body) // the start options, before the raw stream
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		brw.WriteString("HTTP/1.1 101 UPGRADED\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+		brw.Flush()
+		// Echo stdin once the client half-closes it, after the resize.
+		input, _ := io.ReadAll(brw)
+		size := <-resized
+		conn.Write(logFrame(1, "got "+string(input)+" at "+size))
+		conn.Write(logFrame(2, "warning\n"))
+	})
+	mux.HandleFunc("GET /exec/e1/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Running":false,"ExitCode":3}`))
+	})
+	c := newTestClient(t, mux)
+
+	resize := make(chan TermSize, 1)
+	resize <- TermSize{Rows: 24, Cols: 80}
+	var stdout, stderr bytes.Buffer
+	code, err := c.Exec(context.Background(), "c1", ExecOptions{
+		Cmd:    []string{"cat"},
+		Stdin:  strings.NewReader("input"),
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Resize: resize,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != 3 {
+		t.Errorf("exit code = %d, want 3", code)
+	}
+	if stdout.String() != "got input at 24x80" || stderr.String() != "warning\n" {
+		t.Errorf("stdout = %q, stderr = %q", stdout.String(), stderr.String())
+	}
+	if created["AttachStdin"] != true || created["Tty"] != false {
+		t.Errorf("exec create = %v", created)
+	}
+
+	if _, err := c.Exec(context.Background(), "missing", ExecOptions{Cmd: []string{"sh"}}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("exec in missing container = %v, want ErrNotFound", err)
+	}
+}
+
+func TestInspectImage(t *testing.T) {
+	mux := http.NewServeMux()
+	var path string
+	mux.HandleFunc("GET /images/", func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write([]byte(`{"Id":"sha256:def","RepoDigests":["ghcr.io/acme/web@sha256:123"],
+			"Config":{"ExposedPorts":{"8080/tcp":{},"443/tcp":{},"53/udp":{}},"Volumes":{"/data":{},"/cache":{}}}}`))
+	})
+	c := newTestClient(t, mux)
+
+	img, err := c.InspectImage(context.Background(), "ghcr.io/acme/web:1.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/images/ghcr.io/acme/web:1.2/json" {
+		t.Errorf("path = %q", path)
+	}
+	if !reflect.DeepEqual(img.ExposedPorts, []int{53, 443, 8080}) {
+		t.Errorf("ports = %v", img.ExposedPorts)
+	}
+	if !reflect.DeepEqual(img.Volumes, []string{"/cache", "/data"}) {
+		t.Errorf("volumes = %v", img.Volumes)
+	}
+	if len(img.RepoDigests) != 1 {
+		t.Errorf("digests = %v", img.RepoDigests)
+	}
+}
+
+func TestPullImage(t *testing.T) {
+	mux := http.NewServeMux()
+	var query string
+	mux.HandleFunc("POST /images/create", func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		if r.URL.Query().Get("tag") == "broken" {
+			w.Write([]byte(`{"status":"Pulling from acme/web","id":"broken"}
+{"errorDetail":{"message":"manifest unknown"},"error":"manifest unknown"}
+`))
+			return
+		}
+		w.Write([]byte(`{"status":"Pulling from acme/web","id":"1.2"}
+{"status":"Download complete","id":"abc"}
+{"status":"Status: Downloaded newer image for acme/web:1.2"}
+`))
+	})
+	c := newTestClient(t, mux)
+
+	var progress bytes.Buffer
+	if err := c.PullImage(context.Background(), "acme/web:1.2", &progress); err != nil {
+		t.Fatal(err)
+	}
+	if query != "fromImage=acme%2Fweb&tag=1.2" {
+		t.Errorf("query = %q", query)
+	}
+	if !strings.Contains(progress.String(), "abc: Download complete\n") {
+		t.Errorf("progress = %q", progress.String())
+	}
+
+	err := c.PullImage(context.Background(), "acme/web:broken", nil)
+	if err == nil || !strings.Contains(err.Error(), "manifest unknown") {
+		t.Errorf("err = %v, want error from stream", err)
+	}
+}
+
+func TestSplitReference(t *testing.T) {
+	cases := []struct{ ref, repo, tag string }{
+		{"nginx", "nginx", "latest"},
+		{"nginx:1.27", "nginx", "1.27"},
+		{"localhost:5000/app", "localhost:5000/app", "latest"},
+		{"localhost:5000/app:v2", "localhost:5000/app", "v2"},
+		{"ghcr.io/acme/web@sha256:abc", "ghcr.io/acme/web", "sha256:abc"},
+	}
+	for _, tc := range cases {
+		repo, tag := splitReference(tc.ref)
+		if repo != tc.repo || tag != tc.tag {
+			t.Errorf("splitReference(%q) = %q, %q; want %q, %q", tc.ref, repo, tag, tc.repo, tc.tag)
+		}
+	}
+}
@@ -1,67 +1,90 @@
 package docker
 
 import (
-	"bufio"
 	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"sort"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
+// Runner drives docker compose for a generated project directory. Deploy
+// operations (up, pull, rm, stop, run, exec) shell out to compose; status and
+// logs go to Engine, scoped to the project by its compose labels.
 type Runner struct {
-	Workdir          string
-	useLegacyCompose bool
+	Workdir      string
+	Engine       Engine
+	PollInterval time.Duration // how often WaitHealthy checks status; 2s if zero
+	compose      []string
 }
 
-// detectLegacyCompose checks if "docker compose" works, otherwise uses "docker-compose" binary
-func detectLegacyCompose() bool {
-	cmd := exec.Command("docker", "compose", "version")
-	if err := cmd.Run(); err != nil {
-		// docker compose subcommand not available, check for docker-compose binary
-		if _, err := exec.LookPath("docker-compose"); err == nil {
-			log.Printf("docker: using legacy docker-compose binary")
-			return true
-		}
-	}
-	return false
-}
-
-var useLegacyCompose = detectLegacyCompose()
-
 // ComposeCommand returns the compose command being used (for diagnostics)
 func ComposeCommand() string {
-	if useLegacyCompose {
-		return "docker-compose"
-	}
-	return "docker compose"
+	return strings.Join(CurrentPlatform().Compose, " ")
 }
 
 func NewRunner(workdir string) *Runner {
-	return &Runner{Workdir: workdir, useLegacyCompose: useLegacyCompose}
+	return &Runner{Workdir: workdir, Engine: DefaultEngine, compose: CurrentPlatform().Compose}
+}
+
+// Project returns the compose project name of the runner's directory.
+func (r *Runner) Project() string {
+	return ProjectName(r.Workdir)
+}
+
+// ProjectName returns the compose project name: the top-level "name:" of the
+// compose file in dir, or the directory name as compose would default to.
+func ProjectName(dir string) string {
+	if data, err := os.ReadFile(filepath.Join(dir, "docker-compose.yml")); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if name, ok := strings.CutPrefix(line, "name:"); ok {
+				return strings.Trim(strings.TrimSpace(name), `"'`)
+			}
+		}
+	}
+	return strings.ToLower(filepath.Base(dir))
 }
 
 func (r *Runner) Up(ctx context.Context, extraArgs ...string) (string, error) {
-	args := append([]string{"compose", "up", "-d"}, extraArgs...)
+	args := append([]string{"up", "-d"}, extraArgs...)
 	return r.run(ctx, args...)
 }
 
 func (r *Runner) Pull(ctx context.Context, services ...string) (string, error) {
-	args := append([]string{"compose", "pull"}, services...)
+	args := append([]string{"pull"}, services...)
+	return r.run(ctx, args...)
+}
+
+// Remove stops and removes the containers of the given services along with
+// their anonymous volumes.
+func (r *Runner) Remove(ctx context.Context, services ...string) (string, error) {
+	args := append([]string{"rm", "--stop", "--force", "-v"}, services...)
+	return r.run(ctx, args...)
+}
+
+// Stop stops the containers of the given services without removing them, so
+// a later Up starts them again quickly.
+func (r *Runner) Stop(ctx context.Context, services ...string) (string, error) {
+	args := append([]string{"stop"}, services...)
 	return r.run(ctx, args...)
 }
 
-func (r *Runner) PS(ctx context.Context) (string, error) {
-	return r.run(ctx, "compose", "ps")
+// Restart restarts the containers of the given services in place, keeping
+// their configuration.
+func (r *Runner) Restart(ctx context.Context, services ...string) (string, error) {
+	args := append([]string{"restart"}, services...)
+	return r.run(ctx, args...)
 }
 
 type ContainerStatus struct {
+	ID        string     `json:"ID"`
 	Name      string     `json:"Name"`
 	Service   string     `json:"Service"`
 	State     string     `json:"State"`
@@ -69,73 +92,40 @@ type ContainerStatus struct {
 	StartedAt *time.Time `json:"-"`
 }
 
-// PSStatus returns structured container status information if available along with the raw output.
-func (r *Runner) PSStatus(ctx context.Context) ([]ContainerStatus, string, error) {
-	out, err := r.run(ctx, "compose", "ps", "--format", "json")
+// PSStatus lists the project's running containers.
+func (r *Runner) PSStatus(ctx context.Context) ([]ContainerStatus, error) {
+	containers, err := r.Engine.ListContainers(ctx, ListOptions{Project: r.Project()})
 	if err != nil {
-		return nil, out, err
-	}
-	var containers []ContainerStatus
-	if err := json.Unmarshal([]byte(out), &containers); err == nil {
-		return containers, out, nil
-	}
-	// Fallback: docker compose can emit JSON objects per line.
-	scanner := bufio.NewScanner(strings.NewReader(out))
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" {
-			continue
-		}
-		var c ContainerStatus
-		if err := json.Unmarshal([]byte(line), &c); err != nil {
-			return nil, out, fmt.Errorf("parse compose ps json: %w", err)
-		}
-		containers = append(containers, c)
+		return nil, err
 	}
-	if err := scanner.Err(); err != nil {
-		return nil, out, fmt.Errorf("read compose ps json: %w", err)
+	statuses := make([]ContainerStatus, 0, len(containers))
+	for _, c := range containers {
+		statuses = append(statuses, ContainerStatus{
+			ID:      c.ID,
+			Name:    c.Name,
+			Service: c.Service,
+			State:   c.State,
+			Health:  c.Health,
+		})
 	}
-	return containers, out, nil
+	return statuses, nil
 }
 
 // InspectStartedAt returns container start times keyed by container name.
+// Containers that disappeared since they were listed are left out.
 func (r *Runner) InspectStartedAt(ctx context.Context, names []string) (map[string]time.Time, error) {
 	started := make(map[string]time.Time)
-	if len(names) == 0 {
-		return started, nil
-	}
-
-	args := append([]string{"inspect", "--format", "{{.Name}}|{{.State.StartedAt}}"}, names...)
-	out, err := r.run(ctx, args...)
-	if err != nil && strings.TrimSpace(out) == "" {
-		return nil, err
-	}
-
-	scanner := bufio.NewScanner(strings.NewReader(out))
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" {
-			continue
-		}
-		parts := strings.SplitN(line, "|", 2)
-		if len(parts) != 2 {
-			continue
-		}
-		name := strings.TrimPrefix(parts[0], "/")
-		if name == "" {
-			continue
-		}
-		if parts[1] == "" {
+	for _, name := range names {
+		d, err := r.Engine.InspectContainer(ctx, name)
+		if errors.Is(err, ErrNotFound) {
 			continue
 		}
-		when, err := time.Parse(time.RFC3339Nano, parts[1])
 		if err != nil {
-			continue
+			return started, err
+		}
+		if !d.StartedAt.IsZero() {
+			started[d.Name] = d.StartedAt
 		}
-		started[name] = when
-	}
-	if err := scanner.Err(); err != nil {
-		return started, err
 	}
 	return started, nil
 }
@@ -143,8 +133,19 @@ func (r *Runner) InspectStartedAt(ctx context.Context, names []string) (map[stri
 // WaitHealthy polls container status until all target services are running and healthy.
 // If services is empty, it checks all services. Returns error on timeout or context cancellation.
 func (r *Runner) WaitHealthy(ctx context.Context, services []string, timeout time.Duration) error {
+	return r.WaitHealthyReplicas(ctx, services, nil, timeout)
+}
+
+// WaitHealthyReplicas is WaitHealthy with a minimum number of ready containers per service.
+// Every target service needs at least one ready container; replicas raises that floor
+// for scaled services. Services missing from replicas only need their existing containers healthy.
+func (r *Runner) WaitHealthyReplicas(ctx context.Context, services []string, replicas map[string]int, timeout time.Duration) error {
 	deadline := time.Now().Add(timeout)
-	ticker := time.NewTicker(2 * time.Second)
+	interval := r.PollInterval
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	// Build a set of target services for quick lookup
@@ -154,14 +155,29 @@ func (r *Runner) WaitHealthy(ctx context.Context, services []string, timeout tim
 	}
 	checkAll := len(targets) == 0
 
+	want := make(map[string]int)
+	for svc := range targets {
+		want[svc] = 1
+	}
+	for svc, n := range replicas {
+		svc = strings.ToLower(svc)
+		if !checkAll && !targets[svc] {
+			continue
+		}
+		if n > want[svc] {
+			want[svc] = n
+		}
+	}
+
 	for {
 		if time.Now().After(deadline) {
 			return fmt.Errorf("timeout waiting for services to become healthy")
 		}
 
-		containers, _, err := r.PSStatus(ctx)
+		containers, err := r.PSStatus(ctx)
 		if err == nil && len(containers) > 0 {
 			allHealthy := true
+			ready := make(map[string]int)
 			for _, c := range containers {
 				svcName := strings.ToLower(c.Service)
 				if !checkAll && !targets[svcName] {
@@ -182,6 +198,13 @@ func (r *Runner) WaitHealthy(ctx context.Context, services []string, timeout tim
 					allHealthy = false
 					break
 				}
+				ready[svcName]++
+			}
+			for svc, n := range want {
+				if ready[svc] < n {
+					allHealthy = false
+					break
+				}
 			}
 
 			if allHealthy {
@@ -198,54 +221,165 @@ func (r *Runner) WaitHealthy(ctx context.Context, services []string, timeout tim
 	}
 }
 
+// Logs returns the last tail lines (0 for all) of every container of
+// service, each line prefixed with its container name like compose logs.
 func (r *Runner) Logs(ctx context.Context, service string, tail int) (string, error) {
-	args := []string{"compose", "logs"}
-	if tail > 0 {
-		args = append(args, "--tail", fmt.Sprintf("%d", tail))
+	containers, err := r.serviceContainers(ctx, service)
+	if err != nil {
+		return "", err
 	}
-	args = append(args, service)
-	return r.run(ctx, args...)
+	var out strings.Builder
+	for _, c := range containers {
+		var buf bytes.Buffer
+		if err := r.Engine.ContainerLogs(ctx, c.ID, LogOptions{Tail: tail}, &buf); err != nil {
+			return out.String(), fmt.Errorf("logs %s: %w", c.Name, err)
+		}
+		for _, line := range strings.SplitAfter(buf.String(), "\n") {
+			if line != "" {
+				out.WriteString(c.Name + "  | " + line)
+			}
+		}
+		if buf.Len() > 0 && !strings.HasSuffix(buf.String(), "\n") {
+			out.WriteByte('\n')
+		}
+	}
+	return out.String(), nil
 }
 
-// LogsFollow streams logs to the provided writer until context is cancelled.
+// LogsFollow streams the logs of every container of service to w, without
+// prefixes, until ctx is done or the containers stop.
 func (r *Runner) LogsFollow(ctx context.Context, service string, tail int, w io.Writer) error {
-	composeArgs := []string{"logs", "-f", "--no-log-prefix"}
-	if tail > 0 {
-		composeArgs = append(composeArgs, "--tail", fmt.Sprintf("%d", tail))
+	containers, err := r.serviceContainers(ctx, service)
+	if err != nil {
+		return err
+	}
+	lw := &lineWriter{w: w}
+	errs := make(chan error, len(containers))
+	for _, c := range containers {
+		go func() {
+			err := r.Engine.ContainerLogs(ctx, c.ID, LogOptions{Tail: tail, Follow: true}, lw.newStream())
+			errs <- err
+		}()
 	}
-	composeArgs = append(composeArgs, service)
+	var firstErr error
+	for range containers {
+		if err := <-errs; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
 
-	var cmd *exec.Cmd
-	if r.useLegacyCompose {
-		cmd = exec.CommandContext(ctx, "docker-compose", composeArgs...)
-	} else {
-		cmd = exec.CommandContext(ctx, "docker", append([]string{"compose"}, composeArgs...)...)
+func (r *Runner) serviceContainers(ctx context.Context, service string) ([]Container, error) {
+	containers, err := r.Engine.ListContainers(ctx, ListOptions{Project: r.Project(), Service: service, All: true})
+	if err != nil {
+		return nil, err
 	}
-	cmd.Dir = r.Workdir
-	cmd.Stdout = w
-	cmd.Stderr = w
+	if len(containers) == 0 {
+		return nil, fmt.Errorf("no containers for service %s", service)
+	}
+	return containers, nil
+}
+
+// lineWriter interleaves several log streams on one writer a whole line at
+// a time.
+type lineWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
 
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("start logs: %w", err)
+func (lw *lineWriter) newStream() io.Writer {
+	return &streamWriter{lw: lw}
+}
+
+type streamWriter struct {
+	lw      *lineWriter
+	partial []byte
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	s.partial = append(s.partial, p...)
+	i := bytes.LastIndexByte(s.partial, '\n')
+	if i < 0 {
+		return len(p), nil
 	}
+	s.lw.mu.Lock()
+	_, err := s.lw.w.Write(s.partial[:i+1])
+	s.lw.mu.Unlock()
+	s.partial = append(s.partial[:0], s.partial[i+1:]...)
+	return len(p), err
+}
 
-	return cmd.Wait()
+// RunOnce runs a one-off container for service with "compose run --rm" and
+// streams its output to w. A non-zero exit status is returned as the exit
+// code rather than as an error.
+func (r *Runner) RunOnce(ctx context.Context, service string, w io.Writer) (int, error) {
+	return r.stream(ctx, service, w, "run", "--rm", "-T", service)
 }
 
-func (r *Runner) run(ctx context.Context, args ...string) (string, error) {
-	var cmd *exec.Cmd
-	var cmdDesc string
+// RunCommand runs command in a one-off container for service, with the
+// service's image, env, volumes and networks but without starting its
+// dependencies. Exit codes are reported like RunOnce.
+func (r *Runner) RunCommand(ctx context.Context, service string, command []string, w io.Writer) (int, error) {
+	return r.stream(ctx, service, w, append([]string{"run", "--rm", "-T", "--no-deps", service}, command...)...)
+}
 
-	// Use docker-compose binary if docker compose subcommand isn't available
-	if len(args) > 0 && args[0] == "compose" && r.useLegacyCompose {
-		cmd = exec.CommandContext(ctx, "docker-compose", args[1:]...)
-		cmdDesc = "docker-compose " + strings.Join(args[1:], " ")
-	} else {
-		cmd = exec.CommandContext(ctx, "docker", args...)
-		cmdDesc = "docker " + strings.Join(args, " ")
+// Exec runs command inside the service's running container (the first
+// replica). Exit codes are reported like RunOnce.
+func (r *Runner) Exec(ctx context.Context, service string, command []string, w io.Writer) (int, error) {
+	return r.stream(ctx, service, w, append([]string{"exec", "-T", service}, command...)...)
+}
+
+// RunAttached runs command in a one-off container like RunCommand, with
+// stdin attached. There is no TTY: compose only allocates one when its own
+// stdin is a terminal.
+func (r *Runner) RunAttached(ctx context.Context, service string, command []string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	cmd := r.composeCmd(ctx, append([]string{"run", "--rm", "-T", "--no-deps", service}, command...)...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && ctx.Err() == nil {
+			return exitErr.ExitCode(), nil
+		}
+		return -1, fmt.Errorf("compose run %s: %w", service, err)
 	}
+	return 0, nil
+}
 
+// composeCmd builds the platform's compose command for args, run in the
+// project directory.
+func (r *Runner) composeCmd(ctx context.Context, args ...string) *exec.Cmd {
+	compose := r.compose
+	if len(compose) == 0 {
+		compose = []string{"docker", "compose"}
+	}
+	cmd := exec.CommandContext(ctx, compose[0], append(append([]string{}, compose[1:]...), args...)...)
 	cmd.Dir = r.Workdir
+	return cmd
+}
+
+// stream runs a compose subcommand with its combined output going to w.
+func (r *Runner) stream(ctx context.Context, service string, w io.Writer, composeArgs ...string) (int, error) {
+	cmd := r.composeCmd(ctx, composeArgs...)
+	cmd.Stdout = w
+	cmd.Stderr = w
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && ctx.Err() == nil {
+			return exitErr.ExitCode(), nil
+		}
+		return -1, fmt.Errorf("compose %s %s: %w", composeArgs[0], service, err)
+	}
+	return 0, nil
+}
+
+// run runs a compose subcommand and returns its combined output.
+func (r *Runner) run(ctx context.Context, args ...string) (string, error) {
+	cmd := r.composeCmd(ctx, args...)
+	cmdDesc := strings.Join(cmd.Args, " ")
 	var out bytes.Buffer
 	cmd.Stdout = &out
 	cmd.Stderr = &out
@@ -261,80 +395,111 @@ func (r *Runner) run(ctx context.Context, args ...string) (string, error) {
 	return out.String(), nil
 }
 
-// InspectImagePort inspects a Docker image and returns the first exposed port.
+// InspectImagePort inspects a Docker image and returns the lowest exposed port.
 // Returns 0 if no ports are exposed. The image must be available locally.
-func InspectImagePort(ctx context.Context, image string) (int, error) {
-	cmd := exec.CommandContext(ctx, "docker", "image", "inspect", image, "--format", "{{json .Config.ExposedPorts}}")
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &out
-
-	if err := cmd.Run(); err != nil {
+func InspectImagePort(ctx context.Context, e Engine, image string) (int, error) {
+	img, err := e.InspectImage(ctx, image)
+	if err != nil {
 		return 0, fmt.Errorf("inspect image %s: %w", image, err)
 	}
-
-	output := strings.TrimSpace(out.String())
-	if output == "" || output == "null" || output == "{}" {
+	if len(img.ExposedPorts) == 0 {
 		return 0, nil
 	}
-
-	var ports map[string]interface{}
-	if err := json.Unmarshal([]byte(output), &ports); err != nil {
-		return 0, fmt.Errorf("parse exposed ports: %w", err)
-	}
-
-	for portSpec := range ports {
-		parts := strings.Split(portSpec, "/")
-		if len(parts) >= 1 {
-			port, err := strconv.Atoi(parts[0])
-			if err == nil && port > 0 {
-				return port, nil
-			}
-		}
-	}
-
-	return 0, nil
+	return img.ExposedPorts[0], nil
 }
 
 // InspectImageVolumes inspects a Docker image and returns declared volume mountpoints.
 // Returns empty slice if no volumes are declared. The image must be available locally.
-func InspectImageVolumes(ctx context.Context, image string) ([]string, error) {
-	cmd := exec.CommandContext(ctx, "docker", "image", "inspect", image, "--format", "{{json .Config.Volumes}}")
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &out
-
-	if err := cmd.Run(); err != nil {
+func InspectImageVolumes(ctx context.Context, e Engine, image string) ([]string, error) {
+	img, err := e.InspectImage(ctx, image)
+	if err != nil {
 		return nil, fmt.Errorf("inspect image %s: %w", image, err)
 	}
+	return img.Volumes, nil
+}
 
-	output := strings.TrimSpace(out.String())
-	if output == "" || output == "null" || output == "{}" {
-		return nil, nil
+// BuildImage builds contextDir with the platform's CLI and tags the result.
+// Build output is streamed to w as it is produced.
+func BuildImage(ctx context.Context, contextDir, dockerfile, tag string, labels map[string]string, w io.Writer) error {
+	args := []string{"build", "--tag", tag}
+	if dockerfile != "" {
+		args = append(args, "--file", dockerfile)
 	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "--label", k+"="+labels[k])
+	}
+	args = append(args, ".")
 
-	var volumes map[string]any
-	if err := json.Unmarshal([]byte(output), &volumes); err != nil {
-		return nil, fmt.Errorf("parse volumes: %w", err)
+	cmd := exec.CommandContext(ctx, CurrentPlatform().CLI, args...)
+	cmd.Dir = contextDir
+	cmd.Stdout = w
+	cmd.Stderr = w
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("build image %s: %w", tag, err)
 	}
+	return nil
+}
 
-	paths := make([]string, 0, len(volumes))
-	for path := range volumes {
-		paths = append(paths, path)
+// ContainerRepoDigests returns the registry digests ("sha256:...") of the
+// image a container was created from, as recorded when it was pulled.
+func ContainerRepoDigests(ctx context.Context, e Engine, container string) ([]string, error) {
+	d, err := e.InspectContainer(ctx, container)
+	if err != nil {
+		return nil, fmt.Errorf("inspect container %s: %w", container, err)
 	}
-	sort.Strings(paths)
-	return paths, nil
+	return ImageRepoDigests(ctx, e, d.ImageID)
 }
 
-// PullImage pulls a Docker image.
-func PullImage(ctx context.Context, image string) error {
-	cmd := exec.CommandContext(ctx, "docker", "pull", image)
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &out
+// ImageRepoDigests returns the registry digests of a local image. Images that
+// were built locally and never pushed have none.
+func ImageRepoDigests(ctx context.Context, e Engine, image string) ([]string, error) {
+	img, err := e.InspectImage(ctx, image)
+	if err != nil {
+		return nil, fmt.Errorf("inspect image %s: %w", image, err)
+	}
+	digests := make([]string, 0, len(img.RepoDigests))
+	for _, rd := range img.RepoDigests {
+		if i := strings.Index(rd, "@"); i >= 0 {
+			digests = append(digests, rd[i+1:])
+		}
+	}
+	return digests, nil
+}
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("pull image %s: %w\n%s", image, err, out.String())
+// ImageExists reports whether an image reference is available locally.
+func ImageExists(ctx context.Context, image string) bool {
+	_, err := DefaultEngine.InspectImage(ctx, image)
+	return err == nil
+}
+
+// ListImageTags returns the local tags of a repository, newest first.
+func ListImageTags(ctx context.Context, repository string) ([]string, error) {
+	images, err := DefaultEngine.ListImages(ctx, repository)
+	if err != nil {
+		return nil, fmt.Errorf("list images %s: %w", repository, err)
 	}
-	return nil
+	var tags []string
+	for _, img := range images {
+		for _, rt := range img.RepoTags {
+			// The tag follows the last colon after the last slash, since
+			// registry hosts can carry a port.
+			i := strings.LastIndex(rt, ":")
+			if i <= strings.LastIndex(rt, "/") || rt[:i] != repository || rt[i+1:] == "<none>" {
+				continue
+			}
+			tags = append(tags, rt[i+1:])
+		}
+	}
+	return tags, nil
+}
+
+// RemoveImage removes a local image reference. Images still used by a
+// container are left in place and reported as an error.
+func RemoveImage(ctx context.Context, image string) error {
+	return DefaultEngine.RemoveImage(ctx, image)
 }
@@ -0,0 +1,75 @@
+package docker_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tinyserve/internal/docker"
+	"tinyserve/internal/docker/dockertest"
+)
+
+func newRunner(t *testing.T) (*docker.Runner, *dockertest.Engine) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "docker-compose.yml"), []byte("name: apps\nservices: {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	eng := dockertest.New()
+	r := docker.NewRunner(dir)
+	r.Engine = eng
+	r.PollInterval = 10 * time.Millisecond
+	return r, eng
+}
+
+func TestPSStatusOnlyListsProject(t *testing.T) {
+	r, eng := newRunner(t)
+	eng.AddContainer(docker.ContainerDetails{Container: docker.Container{Name: "apps-web-1", Project: "apps", Service: "web", Health: "healthy"}})
+	eng.AddContainer(docker.ContainerDetails{Container: docker.Container{Name: "other-web-1", Project: "other", Service: "web"}})
+	eng.AddContainer(docker.ContainerDetails{Container: docker.Container{Name: "apps-job-1", Project: "apps", Service: "job", State: "exited"}})
+
+	got, err := r.PSStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Name != "apps-web-1" || got[0].Service != "web" || got[0].Health != "healthy" {
+		t.Fatalf("PSStatus = %+v", got)
+	}
+}
+
+func TestWaitHealthyReplicas(t *testing.T) {
+	r, eng := newRunner(t)
+	eng.AddContainer(docker.ContainerDetails{Container: docker.Container{Name: "apps-web-1", Project: "apps", Service: "web", Health: "healthy"}})
+	eng.AddContainer(docker.ContainerDetails{Container: docker.Container{Name: "apps-web-2", Project: "apps", Service: "web", Health: "starting"}})
+
+	ctx := context.Background()
+	if err := r.WaitHealthyReplicas(ctx, []string{"web"}, nil, time.Second); err == nil {
+		t.Fatal("expected timeout while a replica is starting")
+	}
+	eng.SetState("apps-web-2", "running", "healthy")
+	if err := r.WaitHealthyReplicas(ctx, []string{"web"}, map[string]int{"web": 2}, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.WaitHealthyReplicas(ctx, []string{"web"}, map[string]int{"web": 3}, time.Second); err == nil {
+		t.Fatal("expected timeout with too few replicas")
+	}
+}
+
+func TestLogsPrefixesContainers(t *testing.T) {
+	r, eng := newRunner(t)
+	eng.AddContainer(docker.ContainerDetails{Container: docker.Container{Name: "apps-web-1", Project: "apps", Service: "web"}})
+	eng.AddContainer(docker.ContainerDetails{Container: docker.Container{Name: "apps-web-2", Project: "apps", Service: "web", State: "exited"}})
+	eng.SetLogs("apps-web-1", "one\ntwo\nthree\n")
+	eng.SetLogs("apps-web-2", "crashed")
+
+	got, err := r.Logs(context.Background(), "web", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "apps-web-1  | two\napps-web-1  | three\napps-web-2  | crashed\n"
+	if got != want {
+		t.Errorf("Logs = %q, want %q", got, want)
+	}
+}
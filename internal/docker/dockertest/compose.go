@@ -0,0 +1,382 @@
+package dockertest
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tinyserve/internal/docker"
+)
+
+// Behavior is how the containers of an image act once compose starts them.
+type Behavior int
+
+const (
+	// Healthy containers run and pass their healthcheck, if they have one.
+	Healthy Behavior = iota
+	// Unhealthy containers run but report a failing healthcheck.
+	Unhealthy
+	// CrashLoop containers exit with status 1 and keep being restarted.
+	CrashLoop
+	// SlowPull images take Compose.PullDelay to pull and then run healthy.
+	SlowPull
+)
+
+// Compose is an in-memory docker compose. Its runtimes read the compose file
+// of their directory and create, stop and remove containers in Engine the
+// way compose would, so status, logs and health waits work as with Docker.
+type Compose struct {
+	Engine *Engine
+	// PullDelay is how long pulling a SlowPull image takes; a pull whose
+	// context ends first fails.
+	PullDelay time.Duration
+
+	mu        sync.Mutex
+	behaviors map[string]Behavior // by image reference
+	calls     []string
+}
+
+func NewCompose(e *Engine) *Compose {
+	return &Compose{Engine: e, PullDelay: time.Minute}
+}
+
+// SetBehavior sets how containers of image act; images default to Healthy.
+func (c *Compose) SetBehavior(image string, b Behavior) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.behaviors == nil {
+		c.behaviors = make(map[string]Behavior)
+	}
+	c.behaviors[image] = b
+}
+
+func (c *Compose) behavior(image string) Behavior {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.behaviors[image]
+}
+
+// Calls returns the compose commands run so far, e.g. "up web" or "pull",
+// without flags.
+func (c *Compose) Calls() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.calls...)
+}
+
+func (c *Compose) record(cmd string, args []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, strings.TrimSpace(cmd+" "+strings.Join(args, " ")))
+}
+
+// Runtime returns a docker.Runtime for the compose project in dir. It can be
+// assigned to api.Handler.Runtime.
+func (c *Compose) Runtime(dir string) docker.Runtime {
+	r := docker.NewRunner(dir)
+	r.Engine = c.Engine
+	r.PollInterval = 10 * time.Millisecond
+	return &project{Runner: r, compose: c}
+}
+
+// project overrides the compose commands of a Runner; status, health waits
+// and logs are the Runner's own, reading from the fake Engine.
+type project struct {
+	*docker.Runner
+	compose *Compose
+}
+
+type composeService struct {
+	name        string
+	image       string
+	replicas    int
+	healthcheck bool
+	profiles    bool
+}
+
+// services reads the services of the generated compose file. It only
+// understands the layout the generator writes.
+func (p *project) services() ([]composeService, error) {
+	f, err := os.Open(filepath.Join(p.Workdir, "docker-compose.yml"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var out []composeService
+	inServices := false
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		if !strings.HasPrefix(line, " ") {
+			inServices = line == "services:"
+			continue
+		}
+		if !inServices {
+			continue
+		}
+		switch {
+		case !strings.HasPrefix(line, "   ") && strings.HasSuffix(line, ":"):
+			out = append(out, composeService{name: strings.TrimSuffix(strings.TrimSpace(line), ":"), replicas: 1})
+		case len(out) == 0:
+		case strings.HasPrefix(line, "    image: "):
+			out[len(out)-1].image = strings.TrimSpace(strings.TrimPrefix(line, "    image: "))
+		case strings.HasPrefix(line, "    healthcheck:"):
+			out[len(out)-1].healthcheck = true
+		case strings.HasPrefix(line, "    profiles:"):
+			out[len(out)-1].profiles = true
+		case strings.HasPrefix(line, "      replicas: "):
+			if n, err := strconv.Atoi(strings.TrimPrefix(line, "      replicas: ")); err == nil {
+				out[len(out)-1].replicas = n
+			}
+		}
+	}
+	return out, sc.Err()
+}
+
+// selected returns the named services, or every service without a profile
+// when names is empty, like compose.
+func (p *project) selected(names []string) ([]composeService, error) {
+	all, err := p.services()
+	if err != nil {
+		return nil, err
+	}
+	var out []composeService
+	for _, svc := range all {
+		if len(names) == 0 && !svc.profiles {
+			out = append(out, svc)
+		}
+	}
+	for _, name := range names {
+		found := false
+		for _, svc := range all {
+			if svc.name == name {
+				out = append(out, svc)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no such service: %s", name)
+		}
+	}
+	return out, nil
+}
+
+// splitArgs separates compose flags from service names, and collects the
+// replica counts of --scale SERVICE=N.
+func splitArgs(args []string) (flags map[string]bool, scale map[string]int, services []string) {
+	flags = make(map[string]bool)
+	scale = make(map[string]int)
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "--scale" && i+1 < len(args):
+			i++
+			name, n, _ := strings.Cut(args[i], "=")
+			scale[name], _ = strconv.Atoi(n)
+		case strings.HasPrefix(a, "-"):
+			flags[a] = true
+		default:
+			services = append(services, a)
+		}
+	}
+	return flags, scale, services
+}
+
+func (p *project) Pull(ctx context.Context, services ...string) (string, error) {
+	p.compose.record("pull", services)
+	svcs, err := p.selected(services)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	for _, svc := range svcs {
+		if p.compose.behavior(svc.image) == SlowPull {
+			select {
+			case <-time.After(p.compose.PullDelay):
+			case <-ctx.Done():
+				return out.String(), fmt.Errorf("pull %s: %w", svc.image, ctx.Err())
+			}
+		}
+		if err := p.compose.Engine.PullImage(ctx, svc.image, nil); err != nil {
+			return out.String(), err
+		}
+		fmt.Fprintf(&out, " %s Pulled\n", svc.name)
+	}
+	return out.String(), nil
+}
+
+// Up recreates the containers of the selected services from their current
+// image; with --no-recreate, running services are left alone.
+func (p *project) Up(ctx context.Context, extraArgs ...string) (string, error) {
+	flags, scale, services := splitArgs(extraArgs)
+	p.compose.record("up", services)
+	svcs, err := p.selected(services)
+	if err != nil {
+		return "", err
+	}
+	project := p.Project()
+	for _, svc := range svcs {
+		replicas := svc.replicas
+		if n, ok := scale[svc.name]; ok {
+			replicas = n
+		}
+		existing, err := p.compose.Engine.ListContainers(ctx, docker.ListOptions{Project: project, Service: svc.name, All: true})
+		if err != nil {
+			return "", err
+		}
+		if flags["--no-recreate"] && len(existing) >= replicas {
+			continue
+		}
+		for _, c := range existing {
+			p.compose.Engine.RemoveContainer(c.ID)
+			p.emit(c, "destroy", nil)
+		}
+		for i := 1; i <= replicas; i++ {
+			p.start(project, svc, i)
+		}
+	}
+	return "", nil
+}
+
+// start creates replica n of svc in the state its image's behavior calls for.
+func (p *project) start(project string, svc composeService, n int) {
+	name := fmt.Sprintf("%s-%s-%d", project, svc.name, n)
+	now := time.Now()
+	d := docker.ContainerDetails{
+		Container: docker.Container{
+			ID:      name,
+			Name:    name,
+			Project: project,
+			Service: svc.name,
+			Image:   svc.image,
+			ImageID: "sha256:" + svc.image,
+			State:   "running",
+			Created: now,
+			Labels: map[string]string{
+				docker.LabelOneOff: "False",
+				docker.LabelNumber: strconv.Itoa(n),
+			},
+		},
+		StartedAt: now,
+	}
+	if img, err := p.compose.Engine.InspectImage(context.Background(), svc.image); err == nil {
+		d.ImageID = img.ID
+	}
+	switch p.compose.behavior(svc.image) {
+	case Unhealthy:
+		d.Health = "unhealthy"
+	case CrashLoop:
+		d.State = "restarting"
+		d.ExitCode = 1
+		d.RestartCount = 3
+		d.FinishedAt = now
+	default:
+		if svc.healthcheck {
+			d.Health = "healthy"
+		}
+	}
+	p.compose.Engine.AddContainer(d)
+	p.emit(d.Container, "start", nil)
+	if d.State == "restarting" {
+		p.emit(d.Container, "die", map[string]string{"exitCode": "1"})
+	}
+}
+
+func (p *project) Stop(ctx context.Context, services ...string) (string, error) {
+	p.compose.record("stop", services)
+	return "", p.each(ctx, services, func(c docker.Container) {
+		p.compose.Engine.SetState(c.ID, "exited", "")
+		p.emit(c, "die", map[string]string{"exitCode": "0"})
+		p.emit(c, "stop", nil)
+	})
+}
+
+// Restart emits the events Docker sends for a restart: kill, die, stop,
+// start and restart.
+func (p *project) Restart(ctx context.Context, services ...string) (string, error) {
+	p.compose.record("restart", services)
+	return "", p.each(ctx, services, func(c docker.Container) {
+		p.emit(c, "kill", map[string]string{"signal": "SIGTERM"})
+		p.emit(c, "die", map[string]string{"exitCode": "0"})
+		p.emit(c, "stop", nil)
+		p.compose.Engine.SetState(c.ID, "running", c.Health)
+		p.emit(c, "start", nil)
+		p.emit(c, "restart", nil)
+	})
+}
+
+func (p *project) Remove(ctx context.Context, services ...string) (string, error) {
+	p.compose.record("rm", services)
+	return "", p.each(ctx, services, func(c docker.Container) {
+		p.compose.Engine.RemoveContainer(c.ID)
+		p.emit(c, "destroy", nil)
+	})
+}
+
+// emit sends a container event carrying the container's labels and extra
+// attributes, as Docker does.
+func (p *project) emit(c docker.Container, action string, extra map[string]string) {
+	attrs := map[string]string{"name": c.Name}
+	for k, v := range c.Labels {
+		attrs[k] = v
+	}
+	for k, v := range extra {
+		attrs[k] = v
+	}
+	p.compose.Engine.Emit(docker.Event{Type: "container", Action: action, ID: c.ID, Name: c.Name, Service: c.Service, Attributes: attrs})
+}
+
+func (p *project) each(ctx context.Context, services []string, fn func(docker.Container)) error {
+	svcs, err := p.selected(services)
+	if err != nil {
+		return err
+	}
+	for _, svc := range svcs {
+		containers, err := p.compose.Engine.ListContainers(ctx, docker.ListOptions{Project: p.Project(), Service: svc.name, All: true})
+		if err != nil {
+			return err
+		}
+		for _, c := range containers {
+			fn(c)
+		}
+	}
+	return nil
+}
+
+// RunOnce, RunCommand and Exec succeed without output.
+
+func (p *project) RunOnce(_ context.Context, service string, _ io.Writer) (int, error) {
+	p.compose.record("run", []string{service})
+	return 0, nil
+}
+
+func (p *project) RunCommand(_ context.Context, service string, command []string, _ io.Writer) (int, error) {
+	p.compose.record("run", append([]string{service}, command...))
+	return 0, nil
+}
+
+func (p *project) Exec(_ context.Context, service string, command []string, _ io.Writer) (int, error) {
+	p.compose.record("exec", append([]string{service}, command...))
+	return 0, nil
+}
+
+// RunAttached echoes stdin to stdout, so tests can check both directions.
+func (p *project) RunAttached(_ context.Context, service string, command []string, stdin io.Reader, stdout, _ io.Writer) (int, error) {
+	p.compose.record("run", append([]string{service}, command...))
+	if stdin != nil {
+		if _, err := io.Copy(stdout, stdin); err != nil {
+			return -1, err
+		}
+	}
+	return 0, nil
+}
@@ -0,0 +1,375 @@
+// Package dockertest provides an in-memory docker.Engine for tests.
+package dockertest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"tinyserve/internal/docker"
+)
+
+// Engine is a fake docker.Engine. Tests add containers and images directly;
+// the zero value has none. It is safe for concurrent use.
+type Engine struct {
+	mu         sync.Mutex
+	containers map[string]*fakeContainer
+	images     map[string]docker.Image // by reference and by ID
+	events     []docker.Event
+	subs       []chan docker.Event
+
+	// PingErr, when set, is returned by Ping.
+	PingErr error
+	// Pulls records every reference passed to PullImage.
+	Pulls []string
+	// ExecFunc, when set, runs the commands passed to Exec. Without it Exec
+	// echoes stdin to stdout and exits 0.
+	ExecFunc func(container docker.Container, opts docker.ExecOptions) int
+}
+
+type fakeContainer struct {
+	details docker.ContainerDetails
+	logs    string
+	stats   docker.Stats
+}
+
+func New() *Engine {
+	return &Engine{}
+}
+
+// AddContainer adds or replaces a container. Name and ID default to each
+// other, and Project and Service are also stored as compose labels.
+func (e *Engine) AddContainer(c docker.ContainerDetails) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if c.ID == "" {
+		c.ID = c.Name
+	}
+	if c.Name == "" {
+		c.Name = c.ID
+	}
+	if c.Labels == nil {
+		c.Labels = map[string]string{}
+	}
+	if c.Project != "" {
+		c.Labels[docker.LabelProject] = c.Project
+	}
+	if c.Service != "" {
+		c.Labels[docker.LabelService] = c.Service
+	}
+	if c.State == "" {
+		c.State = "running"
+	}
+	if e.containers == nil {
+		e.containers = make(map[string]*fakeContainer)
+	}
+	fc, ok := e.containers[c.ID]
+	if !ok {
+		fc = &fakeContainer{}
+		e.containers[c.ID] = fc
+	}
+	fc.details = c
+}
+
+// SetState changes a container's state and health, e.g. to simulate a crash.
+func (e *Engine) SetState(id, state, health string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if fc := e.find(id); fc != nil {
+		fc.details.State = state
+		fc.details.Health = health
+	}
+}
+
+// RemoveContainer deletes a container.
+func (e *Engine) RemoveContainer(id string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if fc := e.find(id); fc != nil {
+		delete(e.containers, fc.details.ID)
+	}
+}
+
+// SetLogs sets the full log output of a container.
+func (e *Engine) SetLogs(id, logs string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if fc := e.find(id); fc != nil {
+		fc.logs = logs
+	}
+}
+
+// SetStats sets what ContainerStats returns for a container.
+func (e *Engine) SetStats(id string, s docker.Stats) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if fc := e.find(id); fc != nil {
+		fc.stats = s
+	}
+}
+
+// AddImage makes img available under each of its tags, its ID and any
+// extra references.
+func (e *Engine) AddImage(img docker.Image, refs ...string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.images == nil {
+		e.images = make(map[string]docker.Image)
+	}
+	for _, ref := range append(append([]string{img.ID}, img.RepoTags...), refs...) {
+		if ref != "" {
+			e.images[ref] = img
+		}
+	}
+}
+
+// Emit delivers an event to current Events subscribers and to later ones
+// whose Since is before it.
+func (e *Engine) Emit(ev docker.Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	e.events = append(e.events, ev)
+	for _, ch := range e.subs {
+		ch <- ev
+	}
+}
+
+// find looks a container up by ID or name; e.mu must be held.
+func (e *Engine) find(idOrName string) *fakeContainer {
+	if fc, ok := e.containers[idOrName]; ok {
+		return fc
+	}
+	for _, fc := range e.containers {
+		if fc.details.Name == idOrName {
+			return fc
+		}
+	}
+	return nil
+}
+
+func (e *Engine) Ping(context.Context) error {
+	return e.PingErr
+}
+
+func (e *Engine) ListContainers(_ context.Context, opts docker.ListOptions) ([]docker.Container, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var out []docker.Container
+	for _, fc := range e.containers {
+		c := fc.details.Container
+		if opts.Project != "" && c.Project != opts.Project {
+			continue
+		}
+		if opts.Service != "" && c.Service != opts.Service {
+			continue
+		}
+		if !opts.All && c.State != "running" {
+			continue
+		}
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func (e *Engine) InspectContainer(_ context.Context, id string) (docker.ContainerDetails, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	fc := e.find(id)
+	if fc == nil {
+		return docker.ContainerDetails{}, fmt.Errorf("container %s: %w", id, docker.ErrNotFound)
+	}
+	return fc.details, nil
+}
+
+// ContainerLogs writes the stored logs, honoring Tail. Follow does not wait
+// for more output.
+func (e *Engine) ContainerLogs(_ context.Context, id string, opts docker.LogOptions, w io.Writer) error {
+	e.mu.Lock()
+	fc := e.find(id)
+	var logs string
+	if fc != nil {
+		logs = fc.logs
+	}
+	e.mu.Unlock()
+	if fc == nil {
+		return fmt.Errorf("container %s: %w", id, docker.ErrNotFound)
+	}
+	if opts.Tail > 0 {
+		lines := strings.SplitAfter(strings.TrimSuffix(logs, "\n"), "\n")
+		if len(lines) > opts.Tail {
+			lines = lines[len(lines)-opts.Tail:]
+		}
+		logs = strings.Join(lines, "")
+		if logs != "" && !strings.HasSuffix(logs, "\n") {
+			logs += "\n"
+		}
+	}
+	_, err := io.WriteString(w, logs)
+	return err
+}
+
+func (e *Engine) ContainerStats(_ context.Context, id string) (docker.Stats, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	fc := e.find(id)
+	if fc == nil {
+		return docker.Stats{}, fmt.Errorf("container %s: %w", id, docker.ErrNotFound)
+	}
+	return fc.stats, nil
+}
+
+func (e *Engine) Events(ctx context.Context, opts docker.EventOptions, fn func(docker.Event)) error {
+	ch := make(chan docker.Event, 64)
+	e.mu.Lock()
+	var backlog []docker.Event
+	if !opts.Since.IsZero() {
+		for _, ev := range e.events {
+			if !ev.Time.Before(opts.Since) {
+				backlog = append(backlog, ev)
+			}
+		}
+	}
+	e.subs = append(e.subs, ch)
+	e.mu.Unlock()
+	defer func() {
+		e.mu.Lock()
+		for i, sub := range e.subs {
+			if sub == ch {
+				e.subs = append(e.subs[:i], e.subs[i+1:]...)
+				break
+			}
+		}
+		e.mu.Unlock()
+	}()
+
+	match := func(ev docker.Event) bool {
+		if len(opts.Types) > 0 && !contains(opts.Types, ev.Type) {
+			return false
+		}
+		return opts.Project == "" || ev.Attributes[docker.LabelProject] == opts.Project
+	}
+	for _, ev := range backlog {
+		if match(ev) {
+			fn(ev)
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev := <-ch:
+			if match(ev) {
+				fn(ev)
+			}
+		}
+	}
+}
+
+func (e *Engine) Exec(_ context.Context, id string, opts docker.ExecOptions) (int, error) {
+	e.mu.Lock()
+	fc := e.find(id)
+	var c docker.Container
+	if fc != nil {
+		c = fc.details.Container
+	}
+	run := e.ExecFunc
+	e.mu.Unlock()
+	if fc == nil {
+		return -1, fmt.Errorf("container %s: %w", id, docker.ErrNotFound)
+	}
+	if c.State != "running" {
+		return -1, fmt.Errorf("container %s is not running", id)
+	}
+	if run != nil {
+		return run(c, opts), nil
+	}
+	if opts.Stdin != nil && opts.Stdout != nil {
+		if _, err := io.Copy(opts.Stdout, opts.Stdin); err != nil {
+			return -1, err
+		}
+	}
+	return 0, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Engine) InspectImage(_ context.Context, ref string) (docker.Image, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	img, ok := e.images[ref]
+	if !ok {
+		return docker.Image{}, fmt.Errorf("image %s: %w", ref, docker.ErrNotFound)
+	}
+	return img, nil
+}
+
+// ListImages matches reference against the repository part of each tag.
+func (e *Engine) ListImages(_ context.Context, reference string) ([]docker.Image, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	seen := make(map[string]bool)
+	var out []docker.Image
+	for _, img := range e.images {
+		if seen[img.ID] {
+			continue
+		}
+		for _, tag := range img.RepoTags {
+			if i := strings.LastIndex(tag, ":"); reference == "" || (i > 0 && tag[:i] == reference) {
+				out = append(out, img)
+				seen[img.ID] = true
+				break
+			}
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Created.After(out[j].Created) })
+	return out, nil
+}
+
+// PullImage records the pull and makes ref available as an empty image if
+// it isn't already.
+func (e *Engine) PullImage(_ context.Context, ref string, _ io.Writer) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.Pulls = append(e.Pulls, ref)
+	if e.images == nil {
+		e.images = make(map[string]docker.Image)
+	}
+	if _, ok := e.images[ref]; !ok {
+		e.images[ref] = docker.Image{ID: "sha256:" + ref, RepoTags: []string{ref}, Created: time.Now()}
+	}
+	return nil
+}
+
+// RemoveImage removes ref, refusing like the engine when a container uses it.
+func (e *Engine) RemoveImage(_ context.Context, ref string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	img, ok := e.images[ref]
+	if !ok {
+		return fmt.Errorf("image %s: %w", ref, docker.ErrNotFound)
+	}
+	for _, fc := range e.containers {
+		if fc.details.Image == ref || fc.details.ImageID == img.ID {
+			return fmt.Errorf("image %s is used by container %s", ref, fc.details.Name)
+		}
+	}
+	delete(e.images, ref)
+	return nil
+}
+
+var _ docker.Engine = (*Engine)(nil)
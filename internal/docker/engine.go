@@ -0,0 +1,171 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// Compose labels that identify the containers of a project.
+const (
+	LabelProject = "com.docker.compose.project"
+	LabelService = "com.docker.compose.service"
+	LabelOneOff  = "com.docker.compose.oneoff"
+	LabelNumber  = "com.docker.compose.container-number"
+)
+
+// ErrNotFound is returned when a container or image does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Engine is the part of the Docker Engine API tinyserve uses for status,
+// logs, events, stats and images. Client talks to a daemon over its Unix
+// socket; dockertest.Engine is an in-memory stand-in for tests.
+//
+// Deploys still go through docker compose (see Runner), which owns the
+// translation from the generated compose file to containers.
+type Engine interface {
+	Ping(ctx context.Context) error
+
+	ListContainers(ctx context.Context, opts ListOptions) ([]Container, error)
+	InspectContainer(ctx context.Context, id string) (ContainerDetails, error)
+	// ContainerLogs copies stdout and stderr of a container to w. With
+	// opts.Follow it returns when the container stops or ctx is done.
+	ContainerLogs(ctx context.Context, id string, opts LogOptions, w io.Writer) error
+	ContainerStats(ctx context.Context, id string) (Stats, error)
+	// Events calls fn for each event until ctx is done or the stream fails.
+	Events(ctx context.Context, opts EventOptions, fn func(Event)) error
+	// Exec runs a command in a running container and returns its exit code
+	// once its output ends or ctx is done.
+	Exec(ctx context.Context, id string, opts ExecOptions) (int, error)
+
+	InspectImage(ctx context.Context, ref string) (Image, error)
+	// ListImages returns local images matching a reference such as a
+	// repository name, newest first.
+	ListImages(ctx context.Context, reference string) ([]Image, error)
+	// PullImage pulls ref, writing progress lines to w if it is not nil.
+	PullImage(ctx context.Context, ref string, w io.Writer) error
+	RemoveImage(ctx context.Context, ref string) error
+}
+
+// ListOptions selects containers. One-off containers from "compose run" are
+// never included.
+type ListOptions struct {
+	Project string // compose project; empty means any
+	Service string // compose service; empty means any
+	All     bool   // include stopped containers
+}
+
+// Container is a container as listed by the engine.
+type Container struct {
+	ID      string            `json:"id"`
+	Name    string            `json:"name"` // without the leading slash
+	Project string            `json:"project,omitempty"`
+	Service string            `json:"service,omitempty"`
+	Image   string            `json:"image"`
+	ImageID string            `json:"image_id"`
+	State   string            `json:"state"`            // running, exited, restarting, ...
+	Status  string            `json:"status"`           // e.g. "Up 5 minutes (healthy)"
+	Health  string            `json:"health,omitempty"` // healthy, unhealthy, starting; empty without a healthcheck
+	Created time.Time         `json:"created"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+// ContainerDetails adds what only an inspect returns.
+type ContainerDetails struct {
+	Container
+	StartedAt    time.Time `json:"started_at"`
+	FinishedAt   time.Time `json:"finished_at"`
+	ExitCode     int       `json:"exit_code"`
+	RestartCount int       `json:"restart_count"`
+	OOMKilled    bool      `json:"oom_killed,omitempty"`
+}
+
+type LogOptions struct {
+	Tail       int // lines from the end; 0 means all
+	Follow     bool
+	Since      time.Time
+	Until      time.Time
+	Timestamps bool
+	// Stderr receives stderr if set; otherwise it goes to w with stdout.
+	// Containers with a TTY have only one stream.
+	Stderr io.Writer
+}
+
+// ExecOptions describe a command run in a container. Without a TTY stdout
+// and stderr are kept apart; with one, everything goes to Stdout.
+type ExecOptions struct {
+	Cmd    []string
+	Tty    bool
+	Stdin  io.Reader // nil means no stdin; its EOF closes the command's stdin
+	Stdout io.Writer
+	Stderr io.Writer
+	// Resize delivers terminal sizes while a TTY command runs. The first
+	// value should be the initial size.
+	Resize <-chan TermSize
+}
+
+// TermSize is the size of a terminal in characters.
+type TermSize struct {
+	Rows uint16 `json:"rows"`
+	Cols uint16 `json:"cols"`
+}
+
+// Stats is a point-in-time resource sample of a container.
+type Stats struct {
+	Read             time.Time `json:"read"`
+	CPUPercent       float64   `json:"cpu_percent"` // of one core, so 4 busy cores read 400
+	MemoryBytes      uint64    `json:"memory_bytes"`
+	MemoryLimitBytes uint64    `json:"memory_limit_bytes"`
+	NetworkRxBytes   uint64    `json:"network_rx_bytes"`
+	NetworkTxBytes   uint64    `json:"network_tx_bytes"`
+	BlockReadBytes   uint64    `json:"block_read_bytes"`
+	BlockWriteBytes  uint64    `json:"block_write_bytes"`
+	PIDs             uint64    `json:"pids"`
+}
+
+type EventOptions struct {
+	Project string   // limit to containers of a compose project
+	Types   []string // e.g. "container", "image"; empty means all
+	Since   time.Time
+}
+
+// Event is one entry of the engine's event stream.
+type Event struct {
+	Type       string            `json:"type"`
+	Action     string            `json:"action"` // e.g. "start", "die", "health_status: healthy"
+	ID         string            `json:"id"`
+	Name       string            `json:"name,omitempty"`
+	Service    string            `json:"service,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Time       time.Time         `json:"time"`
+}
+
+type Image struct {
+	ID           string            `json:"id"`
+	RepoTags     []string          `json:"repo_tags,omitempty"`
+	RepoDigests  []string          `json:"repo_digests,omitempty"`
+	Created      time.Time         `json:"created"`
+	ExposedPorts []int             `json:"exposed_ports,omitempty"` // ascending
+	Volumes      []string          `json:"volumes,omitempty"`       // sorted
+	Labels       map[string]string `json:"labels,omitempty"`
+}
+
+// DefaultEngine is used by NewRunner and by the image helpers that don't take
+// an Engine.
+var DefaultEngine Engine = NewClient(DefaultSocket())
+
+// healthFromStatus extracts the health state from a listed container's
+// status text, which is the only place the list endpoint reports it.
+func healthFromStatus(status string) string {
+	switch {
+	case strings.Contains(status, "(healthy)"):
+		return "healthy"
+	case strings.Contains(status, "(unhealthy)"):
+		return "unhealthy"
+	case strings.Contains(status, "(health: starting)"):
+		return "starting"
+	}
+	return ""
+}
@@ -0,0 +1,119 @@
+package docker
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Container platforms tinyserve can drive, as named by the
+// container_runtime setting. Podman is used through its Docker-compatible
+// API socket and "podman compose" or podman-compose.
+const (
+	PlatformDocker = "docker"
+	PlatformPodman = "podman"
+)
+
+// Platform is the container platform the daemon talks to.
+type Platform struct {
+	Name    string   `json:"name"`
+	Socket  string   `json:"socket"`  // Engine API socket on the host
+	Compose []string `json:"compose"` // compose command and its leading arguments
+	CLI     string   `json:"cli"`     // "docker" or "podman", for builds and credentialed pulls
+}
+
+var (
+	platformMu sync.Mutex
+	platform   *Platform
+)
+
+// ValidPlatform reports whether name is a supported container_runtime; empty
+// means Docker.
+func ValidPlatform(name string) bool {
+	return name == "" || name == PlatformDocker || name == PlatformPodman
+}
+
+// CurrentPlatform returns the platform in use, detecting Docker's compose
+// command on first use unless UsePlatform was called.
+func CurrentPlatform() Platform {
+	platformMu.Lock()
+	defer platformMu.Unlock()
+	if platform == nil {
+		p := detectPlatform(PlatformDocker)
+		platform = &p
+	}
+	return *platform
+}
+
+// UsePlatform switches to the named platform and points DefaultEngine at
+// its socket. The daemon calls it once at startup, before creating
+// runners or handlers.
+func UsePlatform(name string) (Platform, error) {
+	if !ValidPlatform(name) {
+		return Platform{}, fmt.Errorf("unknown container runtime %q (want %s or %s)", name, PlatformDocker, PlatformPodman)
+	}
+	if name == "" {
+		name = PlatformDocker
+	}
+	p := detectPlatform(name)
+	platformMu.Lock()
+	platform = &p
+	platformMu.Unlock()
+	DefaultEngine = newPlatformClient(p)
+	return p, nil
+}
+
+func newPlatformClient(p Platform) *Client {
+	c := NewClient(p.Socket)
+	c.CLI = p.CLI
+	// Podman's compat API leaves health out of the listed status on
+	// older releases, so it is read from inspect instead.
+	c.InspectHealth = p.Name == PlatformPodman
+	return c
+}
+
+func detectPlatform(name string) Platform {
+	if name == PlatformPodman {
+		return Platform{Name: name, Socket: PodmanSocket(), Compose: detectCompose("podman", "podman-compose"), CLI: "podman"}
+	}
+	return Platform{Name: PlatformDocker, Socket: DefaultSocket(), Compose: detectCompose("docker", "docker-compose"), CLI: "docker"}
+}
+
+// detectCompose prefers the CLI's compose subcommand and falls back to the
+// standalone binary when the subcommand isn't available.
+func detectCompose(cli, standalone string) []string {
+	if err := exec.Command(cli, "compose", "version").Run(); err != nil {
+		if _, err := exec.LookPath(standalone); err == nil {
+			log.Printf("docker: using standalone %s binary", standalone)
+			return []string{standalone}
+		}
+	}
+	return []string{cli, "compose"}
+}
+
+// PodmanSocket returns the socket named by CONTAINER_HOST or DOCKER_HOST,
+// else the rootless socket of the current user if it exists, else the
+// rootful /run/podman/podman.sock.
+func PodmanSocket() string {
+	for _, env := range []string{"CONTAINER_HOST", "DOCKER_HOST"} {
+		if host := os.Getenv(env); strings.HasPrefix(host, "unix://") {
+			return strings.TrimPrefix(host, "unix://")
+		}
+	}
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" && os.Getuid() > 0 {
+		runtimeDir = filepath.Join("/run/user", strconv.Itoa(os.Getuid()))
+	}
+	if runtimeDir != "" {
+		rootless := filepath.Join(runtimeDir, "podman", "podman.sock")
+		if _, err := os.Stat(rootless); err == nil {
+			return rootless
+		}
+	}
+	return "/run/podman/podman.sock"
+}
@@ -0,0 +1,33 @@
+package docker
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Runtime deploys and inspects the compose project in one generated
+// directory. Runner is the real implementation; dockertest.Compose provides
+// an in-memory one so the deploy pipeline can be tested without Docker.
+type Runtime interface {
+	Pull(ctx context.Context, services ...string) (string, error)
+	Up(ctx context.Context, extraArgs ...string) (string, error)
+	Stop(ctx context.Context, services ...string) (string, error)
+	Restart(ctx context.Context, services ...string) (string, error)
+	Remove(ctx context.Context, services ...string) (string, error)
+
+	PSStatus(ctx context.Context) ([]ContainerStatus, error)
+	InspectStartedAt(ctx context.Context, names []string) (map[string]time.Time, error)
+	WaitHealthyReplicas(ctx context.Context, services []string, replicas map[string]int, timeout time.Duration) error
+
+	Logs(ctx context.Context, service string, tail int) (string, error)
+	LogsFollow(ctx context.Context, service string, tail int, w io.Writer) error
+
+	RunOnce(ctx context.Context, service string, w io.Writer) (int, error)
+	RunCommand(ctx context.Context, service string, command []string, w io.Writer) (int, error)
+	Exec(ctx context.Context, service string, command []string, w io.Writer) (int, error)
+	// RunAttached is RunCommand with stdin attached and stderr kept apart.
+	RunAttached(ctx context.Context, service string, command []string, stdin io.Reader, stdout, stderr io.Writer) (int, error)
+}
+
+var _ Runtime = (*Runner)(nil)
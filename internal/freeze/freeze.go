@@ -0,0 +1,185 @@
+// Package freeze evaluates deploy freeze windows.
+//
+// A window either recurs, opening whenever a cron expression fires and
+// staying closed to deploys for a fixed duration (e.g. "0 17 * * fri" for
+// 64 hours covers every weekend), or covers a fixed date range such as a
+// holiday period.
+package freeze
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"tinyserve/internal/jobs"
+	"tinyserve/internal/state"
+)
+
+const (
+	MaxWindows         = 20
+	MaxDurationMinutes = 31 * 24 * 60
+	maxNameLen         = 64
+	maxReasonLen       = 200
+
+	// maxMerges bounds how many back-to-back occurrences of a recurring
+	// window are joined into one period.
+	maxMerges = 1000
+)
+
+// Period is one occurrence of a window.
+type Period struct {
+	Name   string    `json:"name"`
+	Reason string    `json:"reason,omitempty"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+}
+
+// Validate checks a window on its own; ValidateAll also checks that names are
+// unique.
+func Validate(w state.FreezeWindow) error {
+	name := strings.TrimSpace(w.Name)
+	if name == "" {
+		return fmt.Errorf("freeze window name is required")
+	}
+	if len(name) > maxNameLen || strings.ContainsAny(name, "/ \t\n") {
+		return fmt.Errorf("freeze window name %q must be at most %d characters without spaces or slashes", w.Name, maxNameLen)
+	}
+	if len(w.Reason) > maxReasonLen {
+		return fmt.Errorf("freeze window %s: reason must be at most %d characters", name, maxReasonLen)
+	}
+	recurring := w.Cron != ""
+	dated := w.Start != nil || w.End != nil
+	switch {
+	case recurring && dated:
+		return fmt.Errorf("freeze window %s: set either cron and duration or start and end, not both", name)
+	case recurring:
+		if _, err := jobs.ParseSchedule(w.Cron); err != nil {
+			return fmt.Errorf("freeze window %s: %w", name, err)
+		}
+		if w.DurationMinutes < 1 || w.DurationMinutes > MaxDurationMinutes {
+			return fmt.Errorf("freeze window %s: duration must be between 1 and %d minutes", name, MaxDurationMinutes)
+		}
+	case dated:
+		if w.Start == nil || w.End == nil {
+			return fmt.Errorf("freeze window %s: both start and end are required", name)
+		}
+		if !w.End.After(*w.Start) {
+			return fmt.Errorf("freeze window %s: end must be after start", name)
+		}
+		if w.DurationMinutes != 0 {
+			return fmt.Errorf("freeze window %s: duration only applies to cron windows", name)
+		}
+	default:
+		return fmt.Errorf("freeze window %s: set cron and duration, or start and end", name)
+	}
+	return nil
+}
+
+func ValidateAll(windows []state.FreezeWindow) error {
+	if len(windows) > MaxWindows {
+		return fmt.Errorf("at most %d freeze windows are allowed", MaxWindows)
+	}
+	seen := make(map[string]bool, len(windows))
+	for _, w := range windows {
+		if err := Validate(w); err != nil {
+			return err
+		}
+		key := strings.ToLower(strings.TrimSpace(w.Name))
+		if seen[key] {
+			return fmt.Errorf("duplicate freeze window name %q", w.Name)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// Active returns the period in effect at now. When several overlap, the one
+// that ends last wins, since deploys stay frozen until then.
+func Active(windows []state.FreezeWindow, now time.Time) (Period, bool) {
+	var best Period
+	found := false
+	for _, w := range windows {
+		p, ok := activePeriod(w, now)
+		if ok && (!found || p.End.After(best.End)) {
+			best, found = p, true
+		}
+	}
+	return best, found
+}
+
+// Next returns the first period that starts after now.
+func Next(windows []state.FreezeWindow, now time.Time) (Period, bool) {
+	var best Period
+	found := false
+	for _, w := range windows {
+		p, ok := nextPeriod(w, now)
+		if ok && (!found || p.Start.Before(best.Start)) {
+			best, found = p, true
+		}
+	}
+	return best, found
+}
+
+func activePeriod(w state.FreezeWindow, now time.Time) (Period, bool) {
+	if w.Cron == "" {
+		if w.Start == nil || w.End == nil || now.Before(*w.Start) || !now.Before(*w.End) {
+			return Period{}, false
+		}
+		return period(w, *w.Start, *w.End), true
+	}
+	sched, err := jobs.ParseSchedule(w.Cron)
+	if err != nil || w.DurationMinutes <= 0 {
+		return Period{}, false
+	}
+	dur := time.Duration(w.DurationMinutes) * time.Minute
+	// The earliest occurrence still open at now started within the last dur.
+	start := sched.Next(now.Add(-dur))
+	if start.IsZero() || start.After(now) {
+		return Period{}, false
+	}
+	end := start.Add(dur)
+	// Occurrences that begin before the previous one ends extend the freeze.
+	for cur, i := start, 0; i < maxMerges; i++ {
+		next := sched.Next(cur)
+		if next.IsZero() || next.After(end) {
+			break
+		}
+		if e := next.Add(dur); e.After(end) {
+			end = e
+		}
+		cur = next
+	}
+	return period(w, start, end), true
+}
+
+func nextPeriod(w state.FreezeWindow, now time.Time) (Period, bool) {
+	if w.Cron == "" {
+		if w.Start == nil || w.End == nil || !w.Start.After(now) {
+			return Period{}, false
+		}
+		return period(w, *w.Start, *w.End), true
+	}
+	sched, err := jobs.ParseSchedule(w.Cron)
+	if err != nil || w.DurationMinutes <= 0 {
+		return Period{}, false
+	}
+	start := sched.Next(now)
+	if start.IsZero() {
+		return Period{}, false
+	}
+	return period(w, start, start.Add(time.Duration(w.DurationMinutes)*time.Minute)), true
+}
+
+func period(w state.FreezeWindow, start, end time.Time) Period {
+	return Period{Name: w.Name, Reason: w.Reason, Start: start, End: end}
+}
+
+// Describe is a one-line explanation for errors and notifications, e.g.
+// "deploys are frozen until Mon Mar 2 09:00 CET (weekend: no weekend deploys)".
+func (p Period) Describe() string {
+	s := fmt.Sprintf("deploys are frozen until %s (%s", p.End.Local().Format("Mon Jan 2 15:04 MST"), p.Name)
+	if p.Reason != "" {
+		s += ": " + p.Reason
+	}
+	return s + ")"
+}
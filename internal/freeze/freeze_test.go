@@ -0,0 +1,128 @@
+package freeze
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"tinyserve/internal/state"
+)
+
+func at(s string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func ptr(t time.Time) *time.Time { return &t }
+
+func TestActiveRecurring(t *testing.T) {
+	// Friday 17:00 until Monday 09:00. 2026-03-06 is a Friday.
+	windows := []state.FreezeWindow{{Name: "weekend", Cron: "0 17 * * fri", DurationMinutes: 64 * 60, Reason: "no weekend deploys"}}
+
+	tests := []struct {
+		now    string
+		active bool
+	}{
+		{"2026-03-06 16:59", false},
+		{"2026-03-06 17:00", true},
+		{"2026-03-08 12:00", true},
+		{"2026-03-09 08:59", true},
+		{"2026-03-09 09:00", false},
+		{"2026-03-11 12:00", false},
+	}
+	for _, tt := range tests {
+		p, ok := Active(windows, at(tt.now))
+		if ok != tt.active {
+			t.Errorf("Active(%s) = %v, want %v", tt.now, ok, tt.active)
+			continue
+		}
+		if ok && (!p.Start.Equal(at("2026-03-06 17:00")) || !p.End.Equal(at("2026-03-09 09:00"))) {
+			t.Errorf("Active(%s) = %s - %s", tt.now, p.Start, p.End)
+		}
+	}
+}
+
+func TestActiveMergesOverlaps(t *testing.T) {
+	// Starts every day at 22:00 and lasts 30 hours, so it never lifts.
+	windows := []state.FreezeWindow{{Name: "always", Cron: "0 22 * * *", DurationMinutes: 30 * 60}}
+	p, ok := Active(windows, at("2026-03-06 23:00"))
+	if !ok {
+		t.Fatal("expected an active freeze")
+	}
+	if !p.End.After(at("2026-03-10 00:00")) {
+		t.Errorf("End = %s, want overlapping occurrences merged", p.End)
+	}
+}
+
+func TestActiveDateRange(t *testing.T) {
+	windows := []state.FreezeWindow{
+		{Name: "holidays", Start: ptr(at("2026-12-20 00:00")), End: ptr(at("2027-01-03 00:00"))},
+		{Name: "weekend", Cron: "0 17 * * fri", DurationMinutes: 64 * 60},
+	}
+	if _, ok := Active(windows[:1], at("2026-12-19 23:59")); ok {
+		t.Error("freeze active before the range starts")
+	}
+	// 2027-01-01 is a Friday, so both windows are active; the later end wins.
+	p, ok := Active(windows, at("2027-01-01 18:00"))
+	if !ok || p.Name != "weekend" || !p.End.Equal(at("2027-01-04 09:00")) {
+		t.Errorf("Active() = %+v, %v; want weekend ending 2027-01-04 09:00", p, ok)
+	}
+	if _, ok := Active(windows, at("2027-01-03 00:00")); !ok {
+		t.Error("weekend window should still be active")
+	}
+	if _, ok := Active(windows, at("2027-01-05 00:00")); ok {
+		t.Error("freeze active after both windows end")
+	}
+}
+
+func TestNext(t *testing.T) {
+	windows := []state.FreezeWindow{
+		{Name: "holidays", Start: ptr(at("2026-12-20 00:00")), End: ptr(at("2027-01-03 00:00"))},
+		{Name: "weekend", Cron: "0 17 * * fri", DurationMinutes: 64 * 60},
+	}
+	p, ok := Next(windows, at("2026-12-16 12:00"))
+	if !ok || p.Name != "weekend" || !p.Start.Equal(at("2026-12-18 17:00")) {
+		t.Errorf("Next() = %+v, %v; want weekend on 2026-12-18", p, ok)
+	}
+	p, ok = Next(windows, at("2026-12-19 12:00"))
+	if !ok || p.Name != "holidays" {
+		t.Errorf("Next() = %+v, %v; want holidays", p, ok)
+	}
+	if _, ok := Next(nil, at("2026-12-19 12:00")); ok {
+		t.Error("Next() found a period without windows")
+	}
+}
+
+func TestValidateAll(t *testing.T) {
+	valid := []state.FreezeWindow{
+		{Name: "weekend", Cron: "0 17 * * fri", DurationMinutes: 3840},
+		{Name: "holidays", Start: ptr(at("2026-12-20 00:00")), End: ptr(at("2027-01-03 00:00"))},
+	}
+	if err := ValidateAll(valid); err != nil {
+		t.Fatalf("ValidateAll() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		windows []state.FreezeWindow
+		wantErr string
+	}{
+		{"no name", []state.FreezeWindow{{Cron: "@daily", DurationMinutes: 60}}, "name is required"},
+		{"neither", []state.FreezeWindow{{Name: "x"}}, "set cron and duration"},
+		{"both", []state.FreezeWindow{{Name: "x", Cron: "@daily", DurationMinutes: 60, Start: ptr(at("2026-12-20 00:00"))}}, "not both"},
+		{"bad cron", []state.FreezeWindow{{Name: "x", Cron: "0 25 * * *", DurationMinutes: 60}}, "hour"},
+		{"no duration", []state.FreezeWindow{{Name: "x", Cron: "@daily"}}, "duration"},
+		{"missing end", []state.FreezeWindow{{Name: "x", Start: ptr(at("2026-12-20 00:00"))}}, "both start and end"},
+		{"end before start", []state.FreezeWindow{{Name: "x", Start: ptr(at("2026-12-20 00:00")), End: ptr(at("2026-12-19 00:00"))}}, "end must be after start"},
+		{"duplicate", []state.FreezeWindow{valid[0], valid[0]}, "duplicate"},
+	}
+	for _, tt := range tests {
+		err := ValidateAll(tt.windows)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: ValidateAll() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
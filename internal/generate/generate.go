@@ -7,7 +7,9 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -23,9 +25,21 @@ type Output struct {
 	Hostnames    []string
 }
 
+// Runtime is the container engine the files are generated for. It must be
+// the engine the daemon runs on, which differs from the stored
+// container_runtime setting after a change until the daemon restarts.
+type Runtime struct {
+	Name   string // "docker" (also when empty) or "podman"
+	Socket string // engine socket on the host; only used for Podman
+}
+
+func (rt Runtime) podman() bool {
+	return rt.Name == "podman"
+}
+
 // GenerateBaseFiles builds a staging directory with starter docker-compose and config files.
 // It is intentionally minimal so the apply/rollback flow can consume it later.
-func GenerateBaseFiles(ctx context.Context, s state.State, root string) (Output, error) {
+func GenerateBaseFiles(ctx context.Context, s state.State, root string, rt Runtime) (Output, error) {
 	ts := time.Now().UTC().Format("20060102-150405")
 	staging := filepath.Join(root, ".staging-"+ts)
 
@@ -34,6 +48,7 @@ func GenerateBaseFiles(ctx context.Context, s state.State, root string) (Output,
 		filepath.Join(staging, "traefik"),
 		filepath.Join(staging, "cloudflared"),
 		filepath.Join(staging, "services"),
+		filepath.Join(root, "traefik"), // live file-provider config, see writeCompose
 	}
 	for _, p := range paths {
 		if err := os.MkdirAll(p, 0o700); err != nil {
@@ -45,14 +60,14 @@ func GenerateBaseFiles(ctx context.Context, s state.State, root string) (Output,
 	cloudflaredPath := filepath.Join(staging, "cloudflared", "config.yml")
 	traefikPath := filepath.Join(staging, "traefik", "dynamic.yml")
 
-	if err := writeCompose(composePath, s); err != nil {
+	if err := writeCompose(composePath, s, rt); err != nil {
 		return Output{}, err
 	}
 	hostnames := collectHostnames(s)
-	if err := writeCloudflared(cloudflaredPath, s, hostnames); err != nil {
+	if err := writeCloudflared(cloudflaredPath, s, hostnames, rt); err != nil {
 		return Output{}, err
 	}
-	if err := writeTraefikDynamic(traefikPath); err != nil {
+	if err := writeTraefikDynamic(traefikPath, s, rt); err != nil {
 		return Output{}, err
 	}
 
@@ -66,35 +81,52 @@ func GenerateBaseFiles(ctx context.Context, s state.State, root string) (Output,
 	}, nil
 }
 
-func writeCompose(path string, s state.State) error {
+func writeCompose(path string, s state.State, rt Runtime) error {
 	domain := s.Settings.DefaultDomain
 	if domain == "" {
 		domain = "example.com"
 	}
 	whoamiHost := "whoami." + domain
 
+	enabled := enabledServiceNames(s)
+	appNetworks := make([]string, 0, len(enabled))
+	for _, name := range enabled {
+		appNetworks = append(appNetworks, serviceNetworkName(name))
+	}
+
 	var sb strings.Builder
 	sb.WriteString(fmt.Sprintf("name: %s\n", s.Settings.ComposeProjectName))
 	sb.WriteString("services:\n")
-	sb.WriteString(`  traefik:
+	// Traefik is the only container attached to every app network so it can
+	// route to each service without the services being able to see each other.
+	// Its file-provider config is mounted from the stable root/traefik
+	// directory, which the daemon refreshes on promote, so a running Traefik
+	// never watches a release directory that later gets rotated away.
+	sb.WriteString(fmt.Sprintf(`  traefik:
     image: traefik:v3.0
     command:
       - --providers.docker=true
       - --providers.docker.exposedbydefault=false
+      - --providers.file.directory=/etc/traefik/dynamic
+      - --providers.file.watch=true
       - --entrypoints.web.address=:80
       - --accesslog=true
-    networks: [edge]
+    networks: [%s]
     volumes:
-      - /var/run/docker.sock:/var/run/docker.sock:ro
-    labels:
+      - %s:/var/run/docker.sock:ro
+      - ../traefik:/etc/traefik/dynamic:ro
+%s    labels:
       - "traefik.enable=true"
+    # Public traffic arrives via cloudflared; the loopback port is for the
+    # daemon's post-deploy smoke checks.
+    ports:
+      - "%s:80"
     logging:
       driver: json-file
       options:
         max-size: "10m"
         max-file: "3"
-    # No host ports published; access via cloudflared -> traefik
-`)
+`, strings.Join(append([]string{"edge"}, appNetworks...), ", "), engineSocket(rt), hostGateway(rt), TraefikLocalAddr()))
 
 	sb.WriteString(`  cloudflared:
     image: cloudflare/cloudflared:latest
@@ -102,9 +134,7 @@ func writeCompose(path string, s state.State) error {
     volumes:
       - ./cloudflared:/etc/cloudflared
     networks: [edge]
-    extra_hosts:
-      - "host.docker.internal:host-gateway"
-`)
+` + hostGateway(rt))
 
 	sb.WriteString(fmt.Sprintf(`  whoami:
     image: traefik/whoami:v1.10
@@ -123,15 +153,26 @@ func writeCompose(path string, s state.State) error {
 		if !svc.Enabled {
 			continue
 		}
-		appendService(&sb, svc, domain)
+		appendService(&sb, svc, domain, s.Settings.ComposeProjectName, s.Services, enabled)
 	}
 
 	sb.WriteString("networks:\n  edge: {}\n")
+	for _, svc := range s.Services {
+		name := sanitizeName(svc.Name)
+		if !svc.Enabled || name == "" {
+			continue
+		}
+		if svc.NoEgress {
+			sb.WriteString(fmt.Sprintf("  %s:\n    internal: true\n", serviceNetworkName(name)))
+		} else {
+			sb.WriteString(fmt.Sprintf("  %s: {}\n", serviceNetworkName(name)))
+		}
+	}
 
 	return os.WriteFile(path, []byte(strings.TrimSpace(sb.String())+"\n"), 0o600)
 }
 
-func writeCloudflared(path string, s state.State, hostnames []string) error {
+func writeCloudflared(path string, s state.State, hostnames []string, rt Runtime) error {
 	if len(hostnames) == 0 {
 		hostnames = []string{"whoami.example.com"}
 	}
@@ -157,9 +198,9 @@ func writeCloudflared(path string, s state.State, hostnames []string) error {
 	for _, h := range hostnames {
 		service := "http://traefik:80"
 		if uiHost != "" && strings.EqualFold(h, uiHost) {
-			service = fmt.Sprintf("http://host.docker.internal:%s", uiProxyPort())
+			service = fmt.Sprintf("http://%s:%s", containerHost(rt), uiProxyPort())
 		} else if apiHost != "" && strings.EqualFold(h, apiHost) {
-			service = fmt.Sprintf("http://host.docker.internal:%s", webhookProxyPort())
+			service = fmt.Sprintf("http://%s:%s", containerHost(rt), webhookProxyPort())
 		}
 		sb.WriteString(fmt.Sprintf("  - hostname: %s\n    service: %s\n", h, service))
 	}
@@ -167,24 +208,107 @@ func writeCloudflared(path string, s state.State, hostnames []string) error {
 	return os.WriteFile(path, []byte(sb.String()), 0o600)
 }
 
-func writeTraefikDynamic(path string) error {
-	content := strings.TrimSpace(`
-http:
-  middlewares: {}
-  routers: {}
-  services: {}
-`)
-	return os.WriteFile(path, []byte(content+"\n"), 0o600)
+// ErrorPagesPath prefixes the daemon URLs that serve custom error pages; the
+// service name and status code follow, e.g. /_tinyserve/errors/blog/502.
+const ErrorPagesPath = "/_tinyserve/errors/"
+
+// maintenancePriority outranks the rule-length priority Traefik gives the
+// docker routers, so maintenance wins while the app keeps running.
+const maintenancePriority = 1000000
+
+func writeTraefikDynamic(path string, s state.State, rt Runtime) error {
+	return os.WriteFile(path, TraefikDynamic(s, rt), 0o600)
+}
+
+// TraefikDynamic renders the file-provider config. Every route in it points
+// at the daemon ("tinyserve-pages"):
+//   - a highest-priority maintenance router for services in maintenance mode;
+//   - a lowest-priority wake router for services with an idle timeout: while
+//     the container is stopped its docker router disappears and requests fall
+//     through to the daemon's wake endpoint instead of a 404.
+//
+// The service also backs the errors middlewares of services with custom
+// error pages.
+func TraefikDynamic(s state.State, rt Runtime) []byte {
+	domain := s.Settings.DefaultDomain
+	if domain == "" {
+		domain = "example.com"
+	}
+
+	var routers strings.Builder
+	for _, svc := range s.Services {
+		name := sanitizeName(svc.Name)
+		if !svc.Enabled || svc.IsJob() || name == "" {
+			continue
+		}
+		hosts := serviceHostnames(name, svc, domain)
+		if len(hosts) == 0 {
+			continue
+		}
+		rules := make([]string, 0, len(hosts))
+		for _, h := range hosts {
+			rules = append(rules, fmt.Sprintf("Host(`%s`)", h))
+		}
+		rule := strings.Join(rules, " || ")
+		if svc.Maintenance != nil {
+			routers.WriteString(fmt.Sprintf(`    %s-maintenance:
+      rule: "%s"
+      entryPoints: [web]
+      priority: %d
+      service: tinyserve-pages
+`, name, rule, maintenancePriority))
+		}
+		if svc.IdleTimeout > 0 {
+			routers.WriteString(fmt.Sprintf(`    %s-wake:
+      rule: "%s"
+      entryPoints: [web]
+      priority: 1
+      service: tinyserve-pages
+`, name, rule))
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("http:\n  middlewares: {}\n")
+	if routers.Len() == 0 {
+		sb.WriteString("  routers: {}\n")
+	} else {
+		sb.WriteString("  routers:\n")
+		sb.WriteString(routers.String())
+	}
+	sb.WriteString(fmt.Sprintf(`  services:
+    tinyserve-pages:
+      loadBalancer:
+        servers:
+          - url: "http://%s:%s"
+`, containerHost(rt), wakeProxyPort()))
+	return []byte(sb.String())
 }
 
-func appendService(sb *strings.Builder, svc state.Service, defaultDomain string) {
+func appendService(sb *strings.Builder, svc state.Service, defaultDomain, project string, services []state.Service, enabled []string) {
 	name := sanitizeName(svc.Name)
 	if name == "" {
 		return
 	}
 	sb.WriteString(fmt.Sprintf("  %s:\n", name))
 	sb.WriteString(fmt.Sprintf("    image: %s\n", svc.Image))
-	sb.WriteString("    networks: [edge]\n")
+	if svc.Type == state.ServiceTypeGitBuild {
+		// Built locally; there is no registry to pull from.
+		sb.WriteString("    pull_policy: never\n")
+	}
+	if svc.IsJob() {
+		// Jobs only run on demand via "compose run"; the profile keeps
+		// "compose up" from starting them.
+		sb.WriteString("    profiles: [\"jobs\"]\n")
+	}
+	sb.WriteString(fmt.Sprintf("    networks: [%s]\n", strings.Join(serviceNetworks(svc, services, enabled), ", ")))
+
+	if deps := reachableServices(svc.DependsOn, name, enabled); len(deps) > 0 {
+		sb.WriteString("    depends_on:\n")
+		for _, d := range deps {
+			sb.WriteString(fmt.Sprintf("      - %s\n", d))
+		}
+	}
 
 	if len(svc.Env) > 0 {
 		sb.WriteString("    environment:\n")
@@ -239,15 +363,67 @@ func appendService(sb *strings.Builder, svc state.Service, defaultDomain string)
 		}
 	}
 
-	if svc.Resources.MemoryLimitMB > 0 {
-		sb.WriteString("    deploy:\n")
-		sb.WriteString("      resources:\n")
-		sb.WriteString("        limits:\n")
-		sb.WriteString(fmt.Sprintf("          memory: %dm\n", svc.Resources.MemoryLimitMB))
+	restart := svc.RestartPolicy
+	if restart == "" {
+		restart = state.DefaultRestartPolicy
+	}
+	if svc.IsJob() {
+		restart = "no"
+	}
+	// Quoted, since YAML reads a bare no as false.
+	sb.WriteString(fmt.Sprintf("    restart: %q\n", restart))
+
+	sec := svc.Security
+	if sec.User != "" {
+		sb.WriteString(fmt.Sprintf("    user: %q\n", sec.User))
+	}
+	if sec.ReadOnlyRootFS {
+		sb.WriteString("    read_only: true\n")
+	}
+	if len(sec.Tmpfs) > 0 {
+		sb.WriteString("    tmpfs:\n")
+		for _, t := range sec.Tmpfs {
+			sb.WriteString(fmt.Sprintf("      - %q\n", t))
+		}
+	}
+	if len(sec.CapDrop) > 0 {
+		sb.WriteString(fmt.Sprintf("    cap_drop: [%s]\n", quoteList(sec.CapDrop)))
+	}
+	if len(sec.CapAdd) > 0 {
+		sb.WriteString(fmt.Sprintf("    cap_add: [%s]\n", quoteList(sec.CapAdd)))
+	}
+	if sec.NoNewPrivilegesEnabled() {
+		sb.WriteString("    security_opt:\n")
+		sb.WriteString("      - \"no-new-privileges:true\"\n")
+	}
+	if svc.Resources.PidsLimit > 0 {
+		sb.WriteString(fmt.Sprintf("    pids_limit: %d\n", svc.Resources.PidsLimit))
 	}
 
+	logMaxSize := svc.Logging.MaxSizeMB
+	if logMaxSize == 0 {
+		logMaxSize = state.DefaultLogMaxSizeMB
+	}
+	logMaxFiles := svc.Logging.MaxFiles
+	if logMaxFiles == 0 {
+		logMaxFiles = state.DefaultLogMaxFiles
+	}
+	sb.WriteString("    logging:\n")
+	sb.WriteString("      driver: json-file\n")
+	sb.WriteString("      options:\n")
+	sb.WriteString(fmt.Sprintf("        max-size: \"%dm\"\n", logMaxSize))
+	sb.WriteString(fmt.Sprintf("        max-file: \"%d\"\n", logMaxFiles))
+
+	appendDeploy(sb, svc)
+
+	if svc.IsJob() {
+		return
+	}
 	labels := buildTraefikLabels(name, svc, defaultDomain)
 	if len(labels) > 0 {
+		// Pin Traefik to the service's own network; otherwise it may pick a
+		// linked network it is not attached to.
+		labels = append(labels, fmt.Sprintf("traefik.docker.network=%s_%s", project, serviceNetworkName(name)))
 		sb.WriteString("    labels:\n")
 		for _, l := range labels {
 			sb.WriteString(fmt.Sprintf("      - %q\n", l))
@@ -255,6 +431,48 @@ func appendService(sb *strings.Builder, svc state.Service, defaultDomain string)
 	}
 }
 
+// appendDeploy writes the compose deploy block. Replicas of the same service
+// share one set of Traefik labels, so Traefik load-balances across them.
+func appendDeploy(sb *strings.Builder, svc state.Service) {
+	r := svc.Resources
+	hasReplicas := svc.Replicas > 1 && !svc.IsJob()
+	hasLimits := r.MemoryLimitMB > 0 || r.CPULimit > 0
+	hasReservations := r.MemoryReservationMB > 0 || r.CPUReservation > 0
+	if !hasReplicas && !hasLimits && !hasReservations {
+		return
+	}
+	sb.WriteString("    deploy:\n")
+	if hasReplicas {
+		sb.WriteString(fmt.Sprintf("      replicas: %d\n", svc.Replicas))
+	}
+	if !hasLimits && !hasReservations {
+		return
+	}
+	sb.WriteString("      resources:\n")
+	if hasLimits {
+		sb.WriteString("        limits:\n")
+		if r.CPULimit > 0 {
+			sb.WriteString(fmt.Sprintf("          cpus: %q\n", formatCPUs(r.CPULimit)))
+		}
+		if r.MemoryLimitMB > 0 {
+			sb.WriteString(fmt.Sprintf("          memory: %dm\n", r.MemoryLimitMB))
+		}
+	}
+	if hasReservations {
+		sb.WriteString("        reservations:\n")
+		if r.CPUReservation > 0 {
+			sb.WriteString(fmt.Sprintf("          cpus: %q\n", formatCPUs(r.CPUReservation)))
+		}
+		if r.MemoryReservationMB > 0 {
+			sb.WriteString(fmt.Sprintf("          memory: %dm\n", r.MemoryReservationMB))
+		}
+	}
+}
+
+func formatCPUs(cpus float64) string {
+	return strconv.FormatFloat(cpus, 'f', -1, 64)
+}
+
 func buildTraefikLabels(name string, svc state.Service, defaultDomain string) []string {
 	var labels []string
 	enable := "true"
@@ -263,20 +481,25 @@ func buildTraefikLabels(name string, svc state.Service, defaultDomain string) []
 	}
 	labels = append(labels, fmt.Sprintf("traefik.enable=%s", enable))
 
-	hosts := svc.Hostnames
-	if len(hosts) == 0 && defaultDomain != "" {
-		hosts = []string{fmt.Sprintf("%s.%s", name, defaultDomain)}
-	}
+	hosts := serviceHostnames(name, svc, defaultDomain)
 	middleware := fmt.Sprintf("%s-nocache", name)
 	labels = append(labels, fmt.Sprintf("traefik.http.middlewares.%s.headers.customResponseHeaders.Cache-Control=no-store, no-cache, must-revalidate, max-age=0", middleware))
 	labels = append(labels, fmt.Sprintf("traefik.http.middlewares.%s.headers.customResponseHeaders.Pragma=no-cache", middleware))
 	labels = append(labels, fmt.Sprintf("traefik.http.middlewares.%s.headers.customResponseHeaders.Expires=0", middleware))
+	middlewares := middleware
+	if statuses := errorPageStatuses(svc.ErrorPages); statuses != "" {
+		errorPages := fmt.Sprintf("%s-errors", name)
+		labels = append(labels, fmt.Sprintf("traefik.http.middlewares.%s.errors.status=%s", errorPages, statuses))
+		labels = append(labels, fmt.Sprintf("traefik.http.middlewares.%s.errors.service=tinyserve-pages@file", errorPages))
+		labels = append(labels, fmt.Sprintf("traefik.http.middlewares.%s.errors.query=%s%s/{status}", errorPages, ErrorPagesPath, name))
+		middlewares += "," + errorPages
+	}
 	for i, h := range hosts {
 		routerName := fmt.Sprintf("%s-%d", name, i)
 		labels = append(labels, fmt.Sprintf("traefik.http.routers.%s.rule=Host(`%s`)", routerName, h))
 		labels = append(labels, fmt.Sprintf("traefik.http.routers.%s.entrypoints=web", routerName))
 		labels = append(labels, fmt.Sprintf("traefik.http.routers.%s.service=%s", routerName, name))
-		labels = append(labels, fmt.Sprintf("traefik.http.routers.%s.middlewares=%s", routerName, middleware))
+		labels = append(labels, fmt.Sprintf("traefik.http.routers.%s.middlewares=%s", routerName, middlewares))
 	}
 	if svc.InternalPort > 0 {
 		labels = append(labels, fmt.Sprintf("traefik.http.services.%s.loadbalancer.server.port=%d", name, svc.InternalPort))
@@ -284,6 +507,99 @@ func buildTraefikLabels(name string, svc state.Service, defaultDomain string) []
 	return labels
 }
 
+// serviceHostnames returns the hostnames Traefik routes to the service,
+// falling back to name.defaultDomain when none are configured.
+func serviceHostnames(name string, svc state.Service, defaultDomain string) []string {
+	if len(svc.Hostnames) == 0 && defaultDomain != "" {
+		return []string{fmt.Sprintf("%s.%s", name, defaultDomain)}
+	}
+	return svc.Hostnames
+}
+
+// serviceNetworkName returns the private network a service is attached to.
+func serviceNetworkName(name string) string {
+	return name + "-net"
+}
+
+// errorPageStatuses returns the status ranges the errors middleware should
+// intercept for the configured pages, or "" when there are none.
+func errorPageStatuses(pages *state.ServiceErrorPages) string {
+	if pages == nil {
+		return ""
+	}
+	var statuses []string
+	if pages.NotFound != "" {
+		statuses = append(statuses, "404")
+	}
+	if pages.ServerError != "" {
+		statuses = append(statuses, "500-599")
+	}
+	return strings.Join(statuses, ",")
+}
+
+// serviceNetworks lists the networks a service joins: its own private network
+// plus the private networks of every enabled service it links to or depends on.
+// A no-egress service joins only its own internal network, since the network
+// of a peer would give it a way out; the peers join its network instead.
+func serviceNetworks(svc state.Service, services []state.Service, enabled []string) []string {
+	name := sanitizeName(svc.Name)
+	networks := []string{serviceNetworkName(name)}
+	if !svc.NoEgress {
+		for _, peer := range reachableServices(servicePeers(svc), name, enabled) {
+			networks = append(networks, serviceNetworkName(peer))
+		}
+	}
+	var isolated []string
+	for _, other := range services {
+		otherName := sanitizeName(other.Name)
+		if !other.Enabled || !other.NoEgress || otherName == name {
+			continue
+		}
+		if slices.Contains(reachableServices(servicePeers(other), otherName, enabled), name) {
+			isolated = append(isolated, serviceNetworkName(otherName))
+		}
+	}
+	sort.Strings(isolated)
+	return unique(append(networks, isolated...))
+}
+
+func servicePeers(svc state.Service) []string {
+	return append(append([]string{}, svc.Links...), svc.DependsOn...)
+}
+
+// reachableServices normalizes a list of service references, dropping self
+// references, duplicates, and services that are not enabled in this project.
+func reachableServices(refs []string, self string, enabled []string) []string {
+	known := make(map[string]bool, len(enabled))
+	for _, name := range enabled {
+		known[name] = true
+	}
+	var out []string
+	for _, ref := range refs {
+		peer := sanitizeName(ref)
+		if peer == "" || peer == self || !known[peer] {
+			continue
+		}
+		out = append(out, peer)
+	}
+	out = unique(out)
+	sort.Strings(out)
+	return out
+}
+
+func enabledServiceNames(s state.State) []string {
+	var names []string
+	for _, svc := range s.Services {
+		if !svc.Enabled {
+			continue
+		}
+		if name := sanitizeName(svc.Name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
 func quoteList(items []string) string {
 	var quoted []string
 	for _, i := range items {
@@ -301,6 +617,35 @@ func sanitizeName(name string) string {
 	return name
 }
 
+// containerHost is the name containers reach the daemon on the host by.
+// Docker needs the host-gateway mapping from hostGateway; Podman resolves
+// host.containers.internal by itself.
+func containerHost(rt Runtime) string {
+	if rt.podman() {
+		return "host.containers.internal"
+	}
+	return "host.docker.internal"
+}
+
+// hostGateway is the extra_hosts block that maps host.docker.internal to
+// the host on Docker. Podman gets none.
+func hostGateway(rt Runtime) string {
+	if rt.podman() {
+		return ""
+	}
+	return "    extra_hosts:\n      - \"host.docker.internal:host-gateway\"\n"
+}
+
+// engineSocket is the host socket Traefik's docker provider reads. Docker
+// Desktop and Colima serve /var/run/docker.sock inside their VM whatever the
+// host path; Podman's rootless socket lives under the user's runtime dir.
+func engineSocket(rt Runtime) string {
+	if rt.podman() {
+		return rt.Socket
+	}
+	return "/var/run/docker.sock"
+}
+
 func uiProxyPort() string {
 	addr := os.Getenv("TINYSERVE_UI_ADDR")
 	if addr == "" {
@@ -325,6 +670,28 @@ func webhookProxyPort() string {
 	return port
 }
 
+// TraefikLocalAddr is the host address Traefik's web entrypoint is published
+// on, from TINYSERVE_TRAEFIK_ADDR. It should stay on loopback: everything
+// behind it is otherwise only reachable through the tunnel.
+func TraefikLocalAddr() string {
+	if addr := os.Getenv("TINYSERVE_TRAEFIK_ADDR"); addr != "" {
+		return addr
+	}
+	return "127.0.0.1:7080"
+}
+
+func wakeProxyPort() string {
+	addr := os.Getenv("TINYSERVE_WAKE_ADDR")
+	if addr == "" {
+		return "7073"
+	}
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil || port == "" {
+		return "7073"
+	}
+	return port
+}
+
 func remoteUIHostname(s state.State) string {
 	if s.Settings.Remote.UIHostname != "" {
 		return s.Settings.Remote.UIHostname
@@ -344,7 +711,7 @@ func collectHostnames(s state.State) []string {
 	var hosts []string
 	hosts = append(hosts, "whoami."+domain)
 	for _, svc := range s.Services {
-		if !svc.Enabled {
+		if !svc.Enabled || svc.IsJob() {
 			continue
 		}
 		if len(svc.Hostnames) > 0 {
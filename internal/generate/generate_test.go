@@ -272,7 +272,7 @@ func TestGenerateBaseFiles(t *testing.T) {
 		},
 	}
 
-	out, err := GenerateBaseFiles(context.Background(), s, tmpDir)
+	out, err := GenerateBaseFiles(context.Background(), s, tmpDir, Runtime{})
 	if err != nil {
 		t.Fatalf("GenerateBaseFiles() error = %v", err)
 	}
@@ -340,7 +340,7 @@ func TestGenerateComposeWithHealthcheck(t *testing.T) {
 		},
 	}
 
-	out, err := GenerateBaseFiles(context.Background(), s, tmpDir)
+	out, err := GenerateBaseFiles(context.Background(), s, tmpDir, Runtime{})
 	if err != nil {
 		t.Fatalf("GenerateBaseFiles() error = %v", err)
 	}
@@ -380,7 +380,7 @@ func TestGenerateComposeWithVolumes(t *testing.T) {
 		},
 	}
 
-	out, err := GenerateBaseFiles(context.Background(), s, tmpDir)
+	out, err := GenerateBaseFiles(context.Background(), s, tmpDir, Runtime{})
 	if err != nil {
 		t.Fatalf("GenerateBaseFiles() error = %v", err)
 	}
@@ -420,7 +420,7 @@ func TestGenerateComposeWithCommandAndEntrypoint(t *testing.T) {
 		},
 	}
 
-	out, err := GenerateBaseFiles(context.Background(), s, tmpDir)
+	out, err := GenerateBaseFiles(context.Background(), s, tmpDir, Runtime{})
 	if err != nil {
 		t.Fatalf("GenerateBaseFiles() error = %v", err)
 	}
@@ -465,7 +465,7 @@ func TestGenerateComposeWithMemoryLimit(t *testing.T) {
 		},
 	}
 
-	out, err := GenerateBaseFiles(context.Background(), s, tmpDir)
+	out, err := GenerateBaseFiles(context.Background(), s, tmpDir, Runtime{})
 	if err != nil {
 		t.Fatalf("GenerateBaseFiles() error = %v", err)
 	}
@@ -501,7 +501,7 @@ func TestGenerateComposeWithEnv(t *testing.T) {
 		},
 	}
 
-	out, err := GenerateBaseFiles(context.Background(), s, tmpDir)
+	out, err := GenerateBaseFiles(context.Background(), s, tmpDir, Runtime{})
 	if err != nil {
 		t.Fatalf("GenerateBaseFiles() error = %v", err)
 	}
@@ -532,7 +532,7 @@ func TestStagingDirUniqueness(t *testing.T) {
 	s := state.NewState()
 
 	// Generate first
-	out1, err := GenerateBaseFiles(context.Background(), s, tmpDir)
+	out1, err := GenerateBaseFiles(context.Background(), s, tmpDir, Runtime{})
 	if err != nil {
 		t.Fatalf("first GenerateBaseFiles() error = %v", err)
 	}
@@ -553,3 +553,468 @@ func TestStagingDirUniqueness(t *testing.T) {
 		t.Error("traefik config should exist")
 	}
 }
+
+func TestGenerateComposeNetworkIsolation(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "tinyserve-generate-test-*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	s := state.NewState()
+	s.Services = []state.Service{
+		{Name: "web", Image: "web:latest", InternalPort: 8080, Enabled: true, Links: []string{"api"}},
+		{Name: "api", Image: "api:latest", InternalPort: 9000, Enabled: true, DependsOn: []string{"db"}},
+		{Name: "db", Image: "postgres:16", InternalPort: 5432, Enabled: true, NoEgress: true},
+		{Name: "old", Image: "old:latest", InternalPort: 80, Enabled: false},
+	}
+
+	out, err := GenerateBaseFiles(context.Background(), s, tmpDir, Runtime{})
+	if err != nil {
+		t.Fatalf("GenerateBaseFiles() error = %v", err)
+	}
+
+	content, err := os.ReadFile(out.ComposePath)
+	if err != nil {
+		t.Fatalf("failed to read compose: %v", err)
+	}
+	compose := string(content)
+
+	expected := []string{
+		"networks: [edge, web-net, api-net, db-net]",
+		"networks: [web-net, api-net]",
+		"networks: [api-net, db-net]",
+		"networks: [db-net]",
+		"depends_on:\n      - db\n",
+		"db-net:\n    internal: true",
+		"web-net: {}",
+		`"traefik.docker.network=tinyserve_web-net"`,
+	}
+	for _, exp := range expected {
+		if !strings.Contains(compose, exp) {
+			t.Errorf("compose missing %q\n%s", exp, compose)
+		}
+	}
+	if strings.Contains(compose, "old-net") {
+		t.Error("compose should not create networks for disabled services")
+	}
+	if strings.Count(compose, "networks: [edge]") != 2 {
+		t.Error("only cloudflared and whoami should share the edge network")
+	}
+}
+
+func TestGenerateComposeNoEgressLinks(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "tinyserve-generate-test-*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	s := state.NewState()
+	s.Services = []state.Service{
+		{Name: "worker", Image: "worker:latest", InternalPort: 8080, Enabled: true, NoEgress: true, Links: []string{"api", "cache"}},
+		{Name: "api", Image: "api:latest", InternalPort: 9000, Enabled: true},
+		{Name: "cache", Image: "redis:7", InternalPort: 6379, Enabled: true, NoEgress: true},
+	}
+
+	out, err := GenerateBaseFiles(context.Background(), s, tmpDir, Runtime{})
+	if err != nil {
+		t.Fatalf("GenerateBaseFiles() error = %v", err)
+	}
+	content, err := os.ReadFile(out.ComposePath)
+	if err != nil {
+		t.Fatalf("failed to read compose: %v", err)
+	}
+	compose := string(content)
+
+	// The worker stays on its internal network; the services it links to
+	// join that network rather than the worker joining theirs.
+	expected := []string{
+		"  worker:\n    image: worker:latest\n    networks: [worker-net]\n",
+		"  api:\n    image: api:latest\n    networks: [api-net, worker-net]\n",
+		"  cache:\n    image: redis:7\n    networks: [cache-net, worker-net]\n",
+		"worker-net:\n    internal: true",
+		"api-net: {}",
+	}
+	for _, exp := range expected {
+		if !strings.Contains(compose, exp) {
+			t.Errorf("compose missing %q\n%s", exp, compose)
+		}
+	}
+}
+
+func TestReachableServices(t *testing.T) {
+	enabled := []string{"web", "api", "db"}
+	got := reachableServices([]string{"DB", "api", "web", "missing", "api", ""}, "web", enabled)
+	want := []string{"api", "db"}
+	if len(got) != len(want) {
+		t.Fatalf("reachableServices() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("reachableServices() = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestGenerateComposeWithHardening(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "tinyserve-generate-test-*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	allowPrivs := false
+	s := state.NewState()
+	s.Services = []state.Service{
+		{
+			Name:         "hardened",
+			Image:        "myapp:latest",
+			InternalPort: 8080,
+			Enabled:      true,
+			Resources: state.ServiceResources{
+				MemoryLimitMB:       512,
+				MemoryReservationMB: 128,
+				CPULimit:            1.5,
+				CPUReservation:      0.25,
+				PidsLimit:           200,
+			},
+			RestartPolicy: "on-failure:5",
+			Security: state.ServiceSecurity{
+				User:           "1000:1000",
+				ReadOnlyRootFS: true,
+				Tmpfs:          []string{"/tmp:size=64m"},
+				CapDrop:        []string{"ALL"},
+				CapAdd:         []string{"NET_BIND_SERVICE"},
+			},
+			Logging: state.ServiceLogging{MaxSizeMB: 50, MaxFiles: 5},
+		},
+		{
+			Name:         "defaults",
+			Image:        "other:latest",
+			InternalPort: 80,
+			Enabled:      true,
+			Security:     state.ServiceSecurity{NoNewPrivileges: &allowPrivs},
+		},
+	}
+
+	out, err := GenerateBaseFiles(context.Background(), s, tmpDir, Runtime{})
+	if err != nil {
+		t.Fatalf("GenerateBaseFiles() error = %v", err)
+	}
+
+	content, err := os.ReadFile(out.ComposePath)
+	if err != nil {
+		t.Fatalf("failed to read compose: %v", err)
+	}
+	compose := string(content)
+
+	expected := []string{
+		`restart: "on-failure:5"`,
+		`user: "1000:1000"`,
+		"read_only: true",
+		`- "/tmp:size=64m"`,
+		`cap_drop: ["ALL"]`,
+		`cap_add: ["NET_BIND_SERVICE"]`,
+		`- "no-new-privileges:true"`,
+		"pids_limit: 200",
+		`max-size: "50m"`,
+		`max-file: "5"`,
+		`cpus: "1.5"`,
+		"memory: 512m",
+		"reservations:",
+		`cpus: "0.25"`,
+		"memory: 128m",
+		`restart: "unless-stopped"`,
+		`max-size: "10m"`,
+	}
+	for _, exp := range expected {
+		if !strings.Contains(compose, exp) {
+			t.Errorf("compose missing %q", exp)
+		}
+	}
+	if strings.Count(compose, "no-new-privileges:true") != 1 {
+		t.Error("no-new-privileges should only be emitted for the service that did not opt out")
+	}
+}
+
+func TestGenerateComposeRestartPolicyNo(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "tinyserve-generate-test-*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	s := state.NewState()
+	s.Services = []state.Service{
+		{Name: "oneshot", Image: "myapp:latest", InternalPort: 8080, Enabled: true, RestartPolicy: "no"},
+	}
+
+	out, err := GenerateBaseFiles(context.Background(), s, tmpDir, Runtime{})
+	if err != nil {
+		t.Fatalf("GenerateBaseFiles() error = %v", err)
+	}
+	content, err := os.ReadFile(out.ComposePath)
+	if err != nil {
+		t.Fatalf("failed to read compose: %v", err)
+	}
+	// A bare no would be read as the boolean false, which compose rejects.
+	if compose := string(content); !strings.Contains(compose, "    restart: \"no\"\n") {
+		t.Errorf("compose should quote the restart policy:\n%s", compose)
+	}
+}
+
+func TestGenerateComposeWithReplicas(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "tinyserve-generate-test-*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	s := state.NewState()
+	s.Services = []state.Service{
+		{Name: "scaled", Image: "myapp:latest", InternalPort: 8080, Enabled: true, Replicas: 3},
+		{Name: "single", Image: "other:latest", InternalPort: 80, Enabled: true, Replicas: 1},
+	}
+
+	out, err := GenerateBaseFiles(context.Background(), s, tmpDir, Runtime{})
+	if err != nil {
+		t.Fatalf("GenerateBaseFiles() error = %v", err)
+	}
+
+	content, err := os.ReadFile(out.ComposePath)
+	if err != nil {
+		t.Fatalf("failed to read compose: %v", err)
+	}
+	compose := string(content)
+
+	if !strings.Contains(compose, "    deploy:\n      replicas: 3\n") {
+		t.Errorf("compose missing replicas for scaled service\n%s", compose)
+	}
+	if strings.Count(compose, "replicas:") != 1 {
+		t.Error("single-replica services should not emit deploy.replicas")
+	}
+	if strings.Contains(compose, "container_name") {
+		t.Error("replicated services must not pin container_name")
+	}
+}
+
+func TestGenerateComposeGitBuildNeverPulls(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "tinyserve-generate-test-*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	s := state.NewState()
+	s.Services = []state.Service{
+		{Name: "tool", Type: state.ServiceTypeGitBuild, Image: "tinyserve-build/tool:0123456789ab", InternalPort: 8080, Enabled: true},
+		{Name: "web", Type: state.ServiceTypeRegistryImage, Image: "nginx:latest", InternalPort: 80, Enabled: true},
+	}
+
+	out, err := GenerateBaseFiles(context.Background(), s, tmpDir, Runtime{})
+	if err != nil {
+		t.Fatalf("GenerateBaseFiles() error = %v", err)
+	}
+
+	content, err := os.ReadFile(out.ComposePath)
+	if err != nil {
+		t.Fatalf("failed to read compose: %v", err)
+	}
+	compose := string(content)
+
+	if !strings.Contains(compose, "    image: tinyserve-build/tool:0123456789ab\n    pull_policy: never\n") {
+		t.Errorf("git-build service should set pull_policy: never\n%s", compose)
+	}
+	if strings.Count(compose, "pull_policy") != 1 {
+		t.Error("registry services should keep the default pull policy")
+	}
+}
+
+func TestGeneratePodman(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "tinyserve-generate-test-*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	s := state.NewState()
+	s.Settings.DefaultDomain = "example.com"
+	s.Settings.Remote = state.RemoteSettings{Enabled: true, UIHostname: "admin.example.com"}
+	s.Services = []state.Service{
+		{Name: "web", Image: "nginx:latest", InternalPort: 80, Enabled: true, Hostnames: []string{"web.example.com"}},
+	}
+
+	// The stored setting only takes effect when the daemon restarts; until
+	// then files are generated for the engine it runs on.
+	s.Settings.ContainerRuntime = "podman"
+	out, err := GenerateBaseFiles(context.Background(), s, tmpDir, Runtime{Name: "docker"})
+	if err != nil {
+		t.Fatalf("GenerateBaseFiles() error = %v", err)
+	}
+	compose, _ := os.ReadFile(out.ComposePath)
+	if !strings.Contains(string(compose), "- /var/run/docker.sock:/var/run/docker.sock:ro\n") || !strings.Contains(string(compose), "host-gateway") {
+		t.Errorf("a stored podman setting should not change files generated for docker\n%s", compose)
+	}
+
+	s.Settings.ContainerRuntime = ""
+	out, err = GenerateBaseFiles(context.Background(), s, tmpDir, Runtime{Name: "podman", Socket: "/run/user/1000/podman/podman.sock"})
+	if err != nil {
+		t.Fatalf("GenerateBaseFiles() error = %v", err)
+	}
+	compose, _ = os.ReadFile(out.ComposePath)
+	if !strings.Contains(string(compose), "- /run/user/1000/podman/podman.sock:/var/run/docker.sock:ro\n") {
+		t.Errorf("traefik should mount the podman socket\n%s", compose)
+	}
+	if strings.Contains(string(compose), "host-gateway") {
+		t.Errorf("podman provides host.containers.internal; no host-gateway mapping expected\n%s", compose)
+	}
+	cloudflared, _ := os.ReadFile(out.Cloudflared)
+	if !strings.Contains(string(cloudflared), "service: http://host.containers.internal:7071") {
+		t.Errorf("ui ingress should use host.containers.internal\n%s", cloudflared)
+	}
+	dynamic, _ := os.ReadFile(out.Traefik)
+	if !strings.Contains(string(dynamic), `url: "http://host.containers.internal:7073"`) {
+		t.Errorf("daemon pages should use host.containers.internal\n%s", dynamic)
+	}
+}
+
+func TestGenerateComposeJobService(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "tinyserve-generate-test-*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	s := state.NewState()
+	s.Settings.DefaultDomain = "example.com"
+	s.Services = []state.Service{
+		{
+			Name:    "backup",
+			Type:    state.ServiceTypeJob,
+			Image:   "alpine:3.20",
+			Command: []string{"sh", "-c", "echo done"},
+			Job:     &state.ServiceJob{Schedule: "@daily"},
+			Enabled: true,
+		},
+	}
+
+	out, err := GenerateBaseFiles(context.Background(), s, tmpDir, Runtime{})
+	if err != nil {
+		t.Fatalf("GenerateBaseFiles() error = %v", err)
+	}
+
+	content, err := os.ReadFile(out.ComposePath)
+	if err != nil {
+		t.Fatalf("failed to read compose: %v", err)
+	}
+	compose := string(content)
+
+	if !strings.Contains(compose, "    profiles: [\"jobs\"]\n") {
+		t.Errorf("job service should be behind the jobs profile\n%s", compose)
+	}
+	if !strings.Contains(compose, "    restart: \"no\"\n") {
+		t.Errorf("job service should not restart\n%s", compose)
+	}
+	if strings.Contains(compose, "traefik.http.routers.backup") {
+		t.Error("job service should not be routed through traefik")
+	}
+
+	cf, err := os.ReadFile(out.Cloudflared)
+	if err != nil {
+		t.Fatalf("failed to read cloudflared config: %v", err)
+	}
+	if strings.Contains(string(cf), "backup.example.com") {
+		t.Error("job service should not get a hostname")
+	}
+}
+
+func TestGenerateTraefikWakeRouters(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	s := state.NewState()
+	s.Settings.DefaultDomain = "example.com"
+	s.Services = []state.Service{
+		{Name: "blog", Image: "ghost:5", InternalPort: 2368, IdleTimeout: 30, Enabled: true},
+		{Name: "shop", Image: "shop:1", InternalPort: 80, Hostnames: []string{"shop.example.org", "www.shop.example.org"}, IdleTimeout: 10, Enabled: true},
+		{Name: "api", Image: "api:1", InternalPort: 8080, Enabled: true},
+	}
+
+	out, err := GenerateBaseFiles(context.Background(), s, tmpDir, Runtime{})
+	if err != nil {
+		t.Fatalf("GenerateBaseFiles() error = %v", err)
+	}
+	content, err := os.ReadFile(out.Traefik)
+	if err != nil {
+		t.Fatalf("failed to read traefik config: %v", err)
+	}
+	dynamic := string(content)
+
+	if !strings.Contains(dynamic, "    blog-wake:\n      rule: \"Host(`blog.example.com`)\"\n") {
+		t.Errorf("missing wake router for blog\n%s", dynamic)
+	}
+	if !strings.Contains(dynamic, "rule: \"Host(`shop.example.org`) || Host(`www.shop.example.org`)\"") {
+		t.Errorf("wake router should cover every shop hostname\n%s", dynamic)
+	}
+	if strings.Contains(dynamic, "api-wake") {
+		t.Errorf("service without idle timeout should not get a wake router\n%s", dynamic)
+	}
+	if !strings.Contains(dynamic, "priority: 1\n") || !strings.Contains(dynamic, "url: \"http://host.docker.internal:7073\"") {
+		t.Errorf("wake routers should be lowest priority and point at the daemon\n%s", dynamic)
+	}
+
+	compose, err := os.ReadFile(out.ComposePath)
+	if err != nil {
+		t.Fatalf("failed to read compose: %v", err)
+	}
+	if !strings.Contains(string(compose), "      - ../traefik:/etc/traefik/dynamic:ro\n") {
+		t.Errorf("traefik should mount the live file-provider directory\n%s", compose)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "traefik")); err != nil {
+		t.Errorf("live traefik directory not created: %v", err)
+	}
+}
+
+func TestGenerateMaintenanceAndErrorPages(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	s := state.NewState()
+	s.Settings.DefaultDomain = "example.com"
+	s.Services = []state.Service{
+		{
+			Name: "shop", Image: "shop:1", InternalPort: 80, Enabled: true,
+			Maintenance: &state.ServiceMaintenance{Message: "Back soon"},
+			ErrorPages:  &state.ServiceErrorPages{NotFound: "<h1>404</h1>", ServerError: "<h1>oops</h1>"},
+		},
+		{
+			Name: "blog", Image: "ghost:5", InternalPort: 2368, Enabled: true,
+			ErrorPages: &state.ServiceErrorPages{ServerError: "<h1>oops</h1>"},
+		},
+	}
+
+	out, err := GenerateBaseFiles(context.Background(), s, tmpDir, Runtime{})
+	if err != nil {
+		t.Fatalf("GenerateBaseFiles() error = %v", err)
+	}
+	dynamic, _ := os.ReadFile(out.Traefik)
+	if !strings.Contains(string(dynamic), "    shop-maintenance:\n      rule: \"Host(`shop.example.com`)\"\n      entryPoints: [web]\n      priority: 1000000\n") {
+		t.Errorf("missing maintenance router for shop\n%s", dynamic)
+	}
+	if strings.Contains(string(dynamic), "blog-maintenance") {
+		t.Errorf("blog is not in maintenance\n%s", dynamic)
+	}
+
+	content, _ := os.ReadFile(out.ComposePath)
+	compose := string(content)
+	for _, want := range []string{
+		"traefik.http.middlewares.shop-errors.errors.status=404,500-599",
+		"traefik.http.middlewares.shop-errors.errors.service=tinyserve-pages@file",
+		"traefik.http.middlewares.shop-errors.errors.query=/_tinyserve/errors/shop/{status}",
+		"traefik.http.routers.shop-0.middlewares=shop-nocache,shop-errors",
+		"traefik.http.middlewares.blog-errors.errors.status=500-599",
+	} {
+		if !strings.Contains(compose, want) {
+			t.Errorf("compose missing %q", want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+// Package idle tracks per-service request activity for scale-to-zero.
+//
+// Activity comes from Traefik's access log: every request routed by a
+// service's docker router is recorded as a hit for that service. Services
+// that see no hits for their idle timeout are stopped by the daemon and woken
+// again by the first request that reaches the wake endpoint.
+package idle
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// accessLogRegex matches Traefik's common log format line and captures the
+// request time and the docker router that served it. Routers generated for
+// services are named "<service>-<index>".
+var accessLogRegex = regexp.MustCompile(`\[(\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4})\] ".*" \d+ "([a-z0-9][a-z0-9_.-]*)-\d+@docker"`)
+
+const accessLogTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// ParseAccessLog extracts the service and request time from a Traefik access
+// log line. ok is false for lines that were not routed to a service.
+func ParseAccessLog(line string) (service string, at time.Time, ok bool) {
+	m := accessLogRegex.FindStringSubmatch(line)
+	if m == nil {
+		return "", time.Time{}, false
+	}
+	at, err := time.Parse(accessLogTimeLayout, m[1])
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return m[2], at, true
+}
+
+// Tracker records the last request time per service.
+type Tracker struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{seen: make(map[string]time.Time)}
+}
+
+// Touch records activity for service at the given time. Older timestamps,
+// e.g. from replayed log lines, never move the last-seen time backwards.
+func (t *Tracker) Touch(service string, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if last, ok := t.seen[service]; !ok || at.After(last) {
+		t.seen[service] = at
+	}
+}
+
+// Forget drops what is known about service, so the next IdleFor starts a
+// fresh grace period.
+func (t *Tracker) Forget(service string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.seen, service)
+}
+
+// IdleFor returns how long service has gone without requests. A service the
+// tracker has not seen yet starts counting from now.
+func (t *Tracker) IdleFor(service string, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	last, ok := t.seen[service]
+	if !ok {
+		t.seen[service] = now
+		return 0
+	}
+	if now.Before(last) {
+		return 0
+	}
+	return now.Sub(last)
+}
+
+// FollowFunc streams log output to w until ctx is done or the source exits.
+type FollowFunc func(ctx context.Context, w io.Writer) error
+
+// Watch feeds access log lines from follow into t until ctx is done. follow
+// is restarted after it exits, e.g. when the Traefik container is recreated.
+func Watch(ctx context.Context, t *Tracker, follow FollowFunc) {
+	for {
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(follow(ctx, pw))
+		}()
+		scanner := bufio.NewScanner(pr)
+		for scanner.Scan() {
+			if service, at, ok := ParseAccessLog(scanner.Text()); ok {
+				t.Touch(service, at)
+			}
+		}
+		_ = pr.Close()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// Waker runs at most one wake-up per service at a time.
+type Waker struct {
+	mu    sync.Mutex
+	wakes map[string]*wake
+}
+
+type wake struct {
+	done bool
+	err  error
+}
+
+func NewWaker() *Waker {
+	return &Waker{wakes: make(map[string]*wake)}
+}
+
+// Wake starts fn in the background for service unless a wake-up is already in
+// progress. Once that wake-up has finished, the next call reports its outcome:
+// ready is true when fn succeeded, otherwise err holds its error. Reporting
+// the outcome clears it, so a later call starts a new wake-up.
+func (w *Waker) Wake(ctx context.Context, service string, fn func(context.Context) error) (ready bool, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if wk, ok := w.wakes[service]; ok {
+		if !wk.done {
+			return false, nil
+		}
+		delete(w.wakes, service)
+		return wk.err == nil, wk.err
+	}
+
+	wk := &wake{}
+	w.wakes[service] = wk
+	go func() {
+		err := fn(ctx)
+		w.mu.Lock()
+		wk.done = true
+		wk.err = err
+		w.mu.Unlock()
+	}()
+	return false, nil
+}
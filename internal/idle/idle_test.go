@@ -0,0 +1,128 @@
+package idle
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAccessLog(t *testing.T) {
+	line := `172.18.0.4 - - [18/Oct/2026:10:15:30 +0000] "GET /api/items?page=2 HTTP/1.1" 200 512 "-" "curl/8.4.0" 12 "blog-0@docker" "http://172.19.0.3:8080" 3ms`
+	service, at, ok := ParseAccessLog(line)
+	if !ok {
+		t.Fatalf("ParseAccessLog() did not match %q", line)
+	}
+	if service != "blog" {
+		t.Errorf("service = %q, want blog", service)
+	}
+	if want := time.Date(2026, 10, 18, 10, 15, 30, 0, time.UTC); !at.Equal(want) {
+		t.Errorf("at = %s, want %s", at, want)
+	}
+
+	ignored := []string{
+		`172.18.0.4 - - [18/Oct/2026:10:15:30 +0000] "GET / HTTP/1.1" 200 5 "-" "curl" 1 "blog-wake@file" "http://host.docker.internal:7073" 1ms`,
+		`172.18.0.4 - - [18/Oct/2026:10:15:30 +0000] "GET / HTTP/1.1" 200 5 "-" "curl" 1 "whoami@docker" "http://172.18.0.2:80" 1ms`,
+		`time="2026-10-18T10:15:30Z" level=info msg="Configuration loaded from file"`,
+		``,
+	}
+	for _, l := range ignored {
+		if service, _, ok := ParseAccessLog(l); ok {
+			t.Errorf("ParseAccessLog(%q) = %q, want no match", l, service)
+		}
+	}
+}
+
+func TestTrackerIdleFor(t *testing.T) {
+	tr := NewTracker()
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	if got := tr.IdleFor("blog", now); got != 0 {
+		t.Errorf("IdleFor() for unseen service = %s, want 0", got)
+	}
+	if got := tr.IdleFor("blog", now.Add(20*time.Minute)); got != 20*time.Minute {
+		t.Errorf("IdleFor() = %s, want 20m", got)
+	}
+
+	tr.Touch("blog", now.Add(15*time.Minute))
+	tr.Touch("blog", now.Add(5*time.Minute)) // replayed older line
+	if got := tr.IdleFor("blog", now.Add(20*time.Minute)); got != 5*time.Minute {
+		t.Errorf("IdleFor() after Touch() = %s, want 5m", got)
+	}
+
+	tr.Forget("blog")
+	if got := tr.IdleFor("blog", now.Add(time.Hour)); got != 0 {
+		t.Errorf("IdleFor() after Forget() = %s, want 0", got)
+	}
+}
+
+func TestWatchFeedsTracker(t *testing.T) {
+	tr := NewTracker()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		Watch(ctx, tr, func(ctx context.Context, w io.Writer) error {
+			_, _ = io.Copy(w, strings.NewReader(
+				`10.0.0.1 - - [18/Oct/2026:10:00:00 +0000] "GET / HTTP/1.1" 200 5 "-" "curl" 1 "blog-1@docker" "http://10.0.0.2:80" 1ms`+"\n"))
+			cancel()
+			return nil
+		})
+		close(done)
+	}()
+	<-done
+
+	now := time.Date(2026, 10, 18, 10, 30, 0, 0, time.UTC)
+	if got := tr.IdleFor("blog", now); got != 30*time.Minute {
+		t.Errorf("IdleFor() = %s, want 30m", got)
+	}
+}
+
+func TestWakerSingleFlight(t *testing.T) {
+	w := NewWaker()
+	release := make(chan struct{})
+	calls := 0
+	fn := func(ctx context.Context) error {
+		calls++
+		<-release
+		return nil
+	}
+
+	if ready, err := w.Wake(context.Background(), "blog", fn); ready || err != nil {
+		t.Fatalf("first Wake() = %v, %v", ready, err)
+	}
+	if ready, err := w.Wake(context.Background(), "blog", fn); ready || err != nil {
+		t.Fatalf("Wake() while in progress = %v, %v", ready, err)
+	}
+	close(release)
+	waitFor(t, func() bool {
+		ready, _ := w.Wake(context.Background(), "blog", fn)
+		return ready
+	})
+	if calls != 1 {
+		t.Errorf("fn called %d times, want 1", calls)
+	}
+
+	failed := errors.New("unhealthy")
+	_, _ = w.Wake(context.Background(), "api", func(ctx context.Context) error { return failed })
+	var err error
+	waitFor(t, func() bool {
+		_, err = w.Wake(context.Background(), "api", nil)
+		return err != nil
+	})
+	if !errors.Is(err, failed) {
+		t.Errorf("Wake() error = %v, want %v", err, failed)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,193 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxOutputBytes caps the captured output stored per run.
+const MaxOutputBytes = 1 << 20
+
+const (
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusSkipped   = "skipped"
+)
+
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+// ErrRunNotFound is returned when a run does not exist.
+var ErrRunNotFound = errors.New("run not found")
+
+// Run records one execution of a job.
+type Run struct {
+	ID              string     `json:"id"`
+	Service         string     `json:"service"`
+	Trigger         string     `json:"trigger"`
+	Status          string     `json:"status"`
+	ExitCode        int        `json:"exit_code"`
+	StartedAt       time.Time  `json:"started_at"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+	DurationMs      int64      `json:"duration_ms,omitempty"`
+	Error           string     `json:"error,omitempty"`
+	OutputTruncated bool       `json:"output_truncated,omitempty"`
+}
+
+// History stores runs as <root>/<service>/<id>.json with output in <id>.log.
+type History struct {
+	Root string
+}
+
+func NewHistory(root string) *History {
+	return &History{Root: root}
+}
+
+func (h *History) dir(service string) string {
+	return filepath.Join(h.Root, strings.ToLower(service))
+}
+
+// Save writes the run record, replacing any earlier version of it.
+func (h *History) Save(run Run) error {
+	dir := h.dir(run.Service)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("create job history dir: %w", err)
+	}
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, run.ID+".json.tmp")
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, run.ID+".json"))
+}
+
+// OutputWriter opens the output file for a run.
+func (h *History) OutputWriter(service, id string) (io.WriteCloser, error) {
+	dir := h.dir(service)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create job history dir: %w", err)
+	}
+	return os.OpenFile(filepath.Join(dir, id+".log"), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+}
+
+// List returns runs for a service, newest first.
+func (h *History) List(service string) ([]Run, error) {
+	entries, err := os.ReadDir(h.dir(service))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var runs []Run
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(h.dir(service), e.Name()))
+		if err != nil {
+			continue
+		}
+		var run Run
+		if err := json.Unmarshal(data, &run); err != nil {
+			continue
+		}
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].ID > runs[j].ID })
+	return runs, nil
+}
+
+// Get returns a single run.
+func (h *History) Get(service, id string) (Run, error) {
+	if !validRunID(id) {
+		return Run{}, ErrRunNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(h.dir(service), id+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Run{}, ErrRunNotFound
+		}
+		return Run{}, err
+	}
+	var run Run
+	if err := json.Unmarshal(data, &run); err != nil {
+		return Run{}, err
+	}
+	return run, nil
+}
+
+// Output returns the captured output of a run.
+func (h *History) Output(service, id string) ([]byte, error) {
+	if !validRunID(id) {
+		return nil, ErrRunNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(h.dir(service), id+".log"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrRunNotFound
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// Prune removes finished runs beyond the newest keep.
+func (h *History) Prune(service string, keep int) error {
+	runs, err := h.List(service)
+	if err != nil {
+		return err
+	}
+	kept := 0
+	for _, run := range runs {
+		if run.Status == StatusRunning || kept < keep {
+			kept++
+			continue
+		}
+		_ = os.Remove(filepath.Join(h.dir(service), run.ID+".json"))
+		_ = os.Remove(filepath.Join(h.dir(service), run.ID+".log"))
+	}
+	return nil
+}
+
+func validRunID(id string) bool {
+	return id != "" && !strings.ContainsAny(id, `/\.`)
+}
+
+// cappedWriter stops writing after limit bytes and remembers that it did.
+type cappedWriter struct {
+	w         io.Writer
+	remaining int
+	truncated bool
+}
+
+func (c *cappedWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if c.remaining <= 0 {
+		c.truncated = c.truncated || n > 0
+		return n, nil
+	}
+	if len(p) > c.remaining {
+		p = p[:c.remaining]
+		c.truncated = true
+	}
+	written, err := c.w.Write(p)
+	c.remaining -= written
+	if err != nil {
+		return written, err
+	}
+	return n, nil
+}
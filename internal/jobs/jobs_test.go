@@ -0,0 +1,159 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"tinyserve/internal/state"
+)
+
+func TestParseSchedule(t *testing.T) {
+	valid := []string{"* * * * *", "*/15 2-4 * * mon-fri", "0 3 1,15 * *", "@daily", "@hourly", "30 4 * jan,jul 7", "5/10 * * * *"}
+	for _, spec := range valid {
+		if _, err := ParseSchedule(spec); err != nil {
+			t.Errorf("ParseSchedule(%q) error = %v", spec, err)
+		}
+	}
+	invalid := []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *", "@often"}
+	for _, spec := range invalid {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("ParseSchedule(%q) should fail", spec)
+		}
+	}
+}
+
+func TestScheduleMatches(t *testing.T) {
+	// 2026-03-02 is a Monday.
+	mon := time.Date(2026, 3, 2, 3, 0, 0, 0, time.UTC)
+	tests := []struct {
+		spec string
+		t    time.Time
+		want bool
+	}{
+		{"0 3 * * *", mon, true},
+		{"0 3 * * *", mon.Add(time.Minute), false},
+		{"*/15 * * * *", mon.Add(45 * time.Minute), true},
+		{"0 3 * * mon-fri", mon, true},
+		{"0 3 * * sat,sun", mon, false},
+		{"0 3 * * 7", mon.AddDate(0, 0, 6), true}, // Sunday
+		{"0 3 15 * mon", mon, true},               // either day field may match
+		{"0 3 15 * *", mon, false},
+		{"@monthly", time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC), true},
+	}
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.spec)
+		if err != nil {
+			t.Fatalf("ParseSchedule(%q) error = %v", tt.spec, err)
+		}
+		if got := s.Matches(tt.t); got != tt.want {
+			t.Errorf("%q.Matches(%s) = %v, want %v", tt.spec, tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	s, _ := ParseSchedule("30 2 * * *")
+	from := time.Date(2026, 3, 2, 3, 0, 0, 0, time.UTC)
+	want := time.Date(2026, 3, 3, 2, 30, 0, 0, time.UTC)
+	if got := s.Next(from); !got.Equal(want) {
+		t.Errorf("Next() = %s, want %s", got, want)
+	}
+
+	never, _ := ParseSchedule("0 0 30 2 *")
+	if got := never.Next(from); !got.IsZero() {
+		t.Errorf("Next() for 30 February = %s, want zero", got)
+	}
+}
+
+func TestManagerRecordsRuns(t *testing.T) {
+	history := NewHistory(t.TempDir())
+	m := NewManager(history, func(ctx context.Context, service string, w io.Writer) (int, error) {
+		fmt.Fprintf(w, "cleaning up %s\n", service)
+		if service == "broken" {
+			return 3, nil
+		}
+		return 0, nil
+	})
+
+	ok, err := m.Trigger(Job{Name: "cleanup", Spec: state.ServiceJob{Schedule: "@daily"}}, TriggerManual)
+	if err != nil {
+		t.Fatalf("Trigger() error = %v", err)
+	}
+	if _, err := m.Trigger(Job{Name: "broken", Spec: state.ServiceJob{Schedule: "@daily"}}, TriggerSchedule); err != nil {
+		t.Fatalf("Trigger() error = %v", err)
+	}
+	m.Wait()
+
+	run, err := history.Get("cleanup", ok.ID)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if run.Status != StatusSucceeded || run.ExitCode != 0 || run.FinishedAt == nil {
+		t.Errorf("cleanup run = %+v", run)
+	}
+	out, err := history.Output("cleanup", ok.ID)
+	if err != nil || string(out) != "cleaning up cleanup\n" {
+		t.Errorf("Output() = %q, %v", out, err)
+	}
+
+	runs, _ := history.List("broken")
+	if len(runs) != 1 || runs[0].Status != StatusFailed || runs[0].ExitCode != 3 || runs[0].Trigger != TriggerSchedule {
+		t.Errorf("broken runs = %+v", runs)
+	}
+}
+
+func TestManagerConcurrencyLimit(t *testing.T) {
+	history := NewHistory(t.TempDir())
+	release := make(chan struct{})
+	m := NewManager(history, func(ctx context.Context, service string, w io.Writer) (int, error) {
+		<-release
+		return 0, nil
+	})
+	job := Job{Name: "report", Spec: state.ServiceJob{Schedule: "@hourly", MaxConcurrency: 1}}
+
+	if _, err := m.Trigger(job, TriggerSchedule); err != nil {
+		t.Fatalf("first Trigger() error = %v", err)
+	}
+	skipped, err := m.Trigger(job, TriggerManual)
+	if err != ErrConcurrencyLimit {
+		t.Fatalf("second Trigger() error = %v, want ErrConcurrencyLimit", err)
+	}
+	if skipped.Status != StatusSkipped {
+		t.Errorf("second run status = %q, want skipped", skipped.Status)
+	}
+	close(release)
+	m.Wait()
+
+	if _, err := m.Trigger(job, TriggerManual); err != nil {
+		t.Errorf("Trigger() after completion error = %v", err)
+	}
+	m.Wait()
+}
+
+func TestHistoryPrune(t *testing.T) {
+	history := NewHistory(t.TempDir())
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		finished := base.Add(time.Duration(i) * time.Hour)
+		run := Run{ID: newRunID(finished), Service: "job", Status: StatusSucceeded, StartedAt: finished, FinishedAt: &finished}
+		if err := history.Save(run); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := history.Prune("job", 2); err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	runs, _ := history.List("job")
+	if len(runs) != 2 {
+		t.Fatalf("List() after Prune() = %d runs, want 2", len(runs))
+	}
+	if !runs[0].StartedAt.Equal(base.Add(4 * time.Hour)) {
+		t.Errorf("Prune() kept the wrong runs: newest = %s", runs[0].StartedAt)
+	}
+	if _, err := history.Get("job", "../state"); err != ErrRunNotFound {
+		t.Errorf("Get() with traversal id error = %v, want ErrRunNotFound", err)
+	}
+}
@@ -0,0 +1,206 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"tinyserve/internal/state"
+)
+
+// ErrConcurrencyLimit is returned when a job already has MaxConcurrency runs in flight.
+var ErrConcurrencyLimit = errors.New("job is already running at its concurrency limit")
+
+// RunFunc runs one job container to completion, writing its output to w.
+// A non-zero exit code is not an error; err is reserved for failing to run.
+type RunFunc func(ctx context.Context, service string, w io.Writer) (exitCode int, err error)
+
+// Job is a schedulable job service. Name is the compose service name.
+type Job struct {
+	Name string
+	Spec state.ServiceJob
+}
+
+// Manager runs jobs on schedule or on demand and records their history.
+type Manager struct {
+	History *History
+
+	run    RunFunc
+	mu     sync.Mutex
+	ctx    context.Context
+	active map[string]int
+	wg     sync.WaitGroup
+}
+
+func NewManager(history *History, run RunFunc) *Manager {
+	return &Manager{
+		History: history,
+		run:     run,
+		ctx:     context.Background(),
+		active:  make(map[string]int),
+	}
+}
+
+// Start runs the scheduler until ctx is cancelled. list is called at the top
+// of every minute so schedule changes apply without a restart.
+func (m *Manager) Start(ctx context.Context, list func(context.Context) ([]Job, error)) {
+	m.mu.Lock()
+	m.ctx = ctx
+	m.mu.Unlock()
+
+	go func() {
+		for {
+			next := time.Now().Truncate(time.Minute).Add(time.Minute)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Until(next)):
+			}
+			m.tick(ctx, next, list)
+		}
+	}()
+}
+
+func (m *Manager) tick(ctx context.Context, t time.Time, list func(context.Context) ([]Job, error)) {
+	jobs, err := list(ctx)
+	if err != nil {
+		log.Printf("jobs: list jobs: %v", err)
+		return
+	}
+	for _, job := range jobs {
+		sched, err := ParseSchedule(job.Spec.Schedule)
+		if err != nil {
+			log.Printf("jobs: %s: invalid schedule %q: %v", job.Name, job.Spec.Schedule, err)
+			continue
+		}
+		if !sched.Matches(t) {
+			continue
+		}
+		if _, err := m.Trigger(job, TriggerSchedule); err != nil {
+			log.Printf("jobs: %s: %v", job.Name, err)
+		}
+	}
+}
+
+// Trigger starts a run in the background and returns its initial record. If
+// the job is at its concurrency limit a skipped run is recorded instead.
+func (m *Manager) Trigger(job Job, trigger string) (Run, error) {
+	limit := job.Spec.MaxConcurrency
+	if limit < 1 {
+		limit = state.DefaultJobMaxConcurrency
+	}
+
+	run := Run{
+		ID:        newRunID(time.Now()),
+		Service:   job.Name,
+		Trigger:   trigger,
+		Status:    StatusRunning,
+		StartedAt: time.Now().UTC(),
+	}
+
+	m.mu.Lock()
+	if m.active[job.Name] >= limit {
+		m.mu.Unlock()
+		finished := run.StartedAt
+		run.Status = StatusSkipped
+		run.FinishedAt = &finished
+		run.Error = ErrConcurrencyLimit.Error()
+		if err := m.History.Save(run); err != nil {
+			log.Printf("jobs: %s: save run: %v", job.Name, err)
+		}
+		return run, ErrConcurrencyLimit
+	}
+	m.active[job.Name]++
+	ctx := m.ctx
+	m.mu.Unlock()
+
+	if err := m.History.Save(run); err != nil {
+		m.release(job.Name)
+		return Run{}, fmt.Errorf("save run: %w", err)
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer m.release(job.Name)
+		m.execute(ctx, job, run)
+	}()
+	return run, nil
+}
+
+// Wait blocks until all in-flight runs have finished.
+func (m *Manager) Wait() {
+	m.wg.Wait()
+}
+
+func (m *Manager) release(name string) {
+	m.mu.Lock()
+	m.active[name]--
+	if m.active[name] <= 0 {
+		delete(m.active, name)
+	}
+	m.mu.Unlock()
+}
+
+func (m *Manager) execute(ctx context.Context, job Job, run Run) {
+	if job.Spec.TimeoutSeconds > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(job.Spec.TimeoutSeconds)*time.Second)
+		defer cancel()
+	}
+
+	log.Printf("jobs: %s: run %s started (%s)", job.Name, run.ID, run.Trigger)
+	var code int
+	var runErr error
+	out, err := m.History.OutputWriter(job.Name, run.ID)
+	if err != nil {
+		runErr = err
+	} else {
+		cw := &cappedWriter{w: out, remaining: MaxOutputBytes}
+		code, runErr = m.run(ctx, job.Name, cw)
+		out.Close()
+		run.OutputTruncated = cw.truncated
+	}
+
+	finished := time.Now().UTC()
+	run.FinishedAt = &finished
+	run.DurationMs = finished.Sub(run.StartedAt).Milliseconds()
+	run.ExitCode = code
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		run.Status = StatusFailed
+		run.Error = fmt.Sprintf("timed out after %ds", job.Spec.TimeoutSeconds)
+	case runErr != nil:
+		run.Status = StatusFailed
+		run.Error = runErr.Error()
+	case code != 0:
+		run.Status = StatusFailed
+	default:
+		run.Status = StatusSucceeded
+	}
+	log.Printf("jobs: %s: run %s %s (exit=%d duration=%s)", job.Name, run.ID, run.Status, code, time.Duration(run.DurationMs)*time.Millisecond)
+
+	if err := m.History.Save(run); err != nil {
+		log.Printf("jobs: %s: save run: %v", job.Name, err)
+	}
+	keep := job.Spec.HistoryLimit
+	if keep < 1 {
+		keep = state.DefaultJobHistoryLimit
+	}
+	if err := m.History.Prune(job.Name, keep); err != nil {
+		log.Printf("jobs: %s: prune history: %v", job.Name, err)
+	}
+}
+
+// newRunID returns a sortable, unique run identifier.
+func newRunID(t time.Time) string {
+	var b [3]byte
+	_, _ = rand.Read(b[:])
+	return t.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(b[:])
+}
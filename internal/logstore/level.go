@@ -0,0 +1,99 @@
+package logstore
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Levels, from least to most severe.
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+var levelRank = map[string]int{LevelDebug: 0, LevelInfo: 1, LevelWarn: 2, LevelError: 3}
+
+// levelWords maps the spellings apps use to a level.
+var levelWords = map[string]string{
+	"trace": LevelDebug, "debug": LevelDebug, "dbg": LevelDebug,
+	"info": LevelInfo, "inf": LevelInfo, "notice": LevelInfo,
+	"warn": LevelWarn, "warning": LevelWarn, "wrn": LevelWarn,
+	"error": LevelError, "err": LevelError, "eror": LevelError, "fatal": LevelError, "panic": LevelError,
+	"crit": LevelError, "critical": LevelError, "alert": LevelError, "emerg": LevelError, "severe": LevelError,
+}
+
+// ParseLevel returns the level a name such as "warning" or "ERROR" stands
+// for.
+func ParseLevel(name string) (string, error) {
+	if level, ok := levelWords[strings.ToLower(name)]; ok {
+		return level, nil
+	}
+	return "", fmt.Errorf("unknown log level %q; use debug, info, warn or error", name)
+}
+
+// levelScanTokens is how many leading words of a line DetectLevel looks at,
+// so an "error" deep in a message does not count.
+const levelScanTokens = 6
+
+// DetectLevel guesses the level of a log line from a JSON level or
+// severity field, a logfmt level=, or a level word such as [WARN] or
+// ERROR: near its start. It returns "" if there is none.
+func DetectLevel(line string) string {
+	head := line
+	if len(head) > 512 {
+		head = head[:512]
+	}
+	lower := strings.ToLower(head)
+	for _, key := range []string{`"level":`, `"lvl":`, `"severity":`, "level=", "lvl=", "severity="} {
+		if i := strings.Index(lower, key); i >= 0 {
+			value := strings.TrimLeft(lower[i+len(key):], ` "`)
+			end := strings.IndexAny(value, "\", }")
+			if end >= 0 {
+				value = value[:end]
+			}
+			if level, ok := levelWords[value]; ok {
+				return level
+			}
+		}
+	}
+	for i, word := range strings.Fields(lower) {
+		if i == levelScanTokens {
+			break
+		}
+		word = strings.Trim(word, "[]()<>:|-")
+		if level, ok := levelWords[word]; ok {
+			return level
+		}
+		// Single-letter glog and klog prefixes such as E0102 or W0102.
+		if len(word) == 5 && i == 0 && isDigits(word[1:]) {
+			switch word[0] {
+			case 'e', 'f':
+				return LevelError
+			case 'w':
+				return LevelWarn
+			case 'i':
+				return LevelInfo
+			}
+		}
+	}
+	return ""
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// levelOrInfo treats lines without a level as info.
+func levelOrInfo(level string) string {
+	if level == "" {
+		return LevelInfo
+	}
+	return level
+}
@@ -0,0 +1,505 @@
+// Package logstore keeps log lines on disk so they outlive containers and
+// daemon restarts. Each source (a compose service, or one of the daemon's
+// access logs) gets a directory under the root with a current file and
+// older ones rotated by size, compressed with gzip and pruned by age and
+// total size.
+//
+// Files hold one entry per line: an RFC 3339 timestamp, the stream and the
+// text, separated by single spaces, so zgrep works on them as well.
+package logstore
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for the limits of a Store.
+const (
+	DefaultMaxFileBytes = 10 << 20            // rotate the current file at this size
+	DefaultMaxBytes     = 200 << 20           // per source, compressed files included
+	DefaultMaxAge       = 14 * 24 * time.Hour // drop rotated files older than this
+)
+
+// MaxLineBytes caps a stored line; longer ones are cut.
+const MaxLineBytes = 64 << 10
+
+const (
+	currentFile   = "current.log"
+	rotatedSuffix = ".log.gz"
+	// rotatedLayout names rotated files after their newest entry, so their
+	// names sort in time order.
+	rotatedLayout = "20060102T150405.000000000Z"
+)
+
+// Streams of an entry.
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+	StreamAccess = "access"
+)
+
+// Entry is one log line of a source.
+type Entry struct {
+	Time    time.Time `json:"time"`
+	Service string    `json:"service"`
+	Stream  string    `json:"stream"`
+	Level   string    `json:"level,omitempty"` // set by Query
+	Line    string    `json:"line"`
+}
+
+// Query selects entries. Zero fields match everything.
+type Query struct {
+	Services []string
+	Since    time.Time // inclusive
+	Until    time.Time // exclusive
+	Grep     *regexp.Regexp
+	Level    string // minimum level, see ParseLevel
+	Limit    int    // newest Limit entries
+}
+
+// Store writes and queries the logs under Root. The limits may be changed
+// before the first Append.
+type Store struct {
+	Root         string
+	MaxFileBytes int64
+	MaxBytes     int64
+	MaxAge       time.Duration
+
+	mu    sync.Mutex
+	files map[string]*currentLog
+}
+
+type currentLog struct {
+	f    *os.File
+	size int64
+	last time.Time
+}
+
+func New(root string) *Store {
+	return &Store{
+		Root:         root,
+		MaxFileBytes: DefaultMaxFileBytes,
+		MaxBytes:     DefaultMaxBytes,
+		MaxAge:       DefaultMaxAge,
+		files:        make(map[string]*currentLog),
+	}
+}
+
+// validSource rejects names that would leave the root.
+func validSource(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid log source %q", name)
+	}
+	return nil
+}
+
+// Append stores entries, rotating the current file of a source once it
+// reaches MaxFileBytes.
+func (s *Store) Append(entries ...Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range entries {
+		if err := s.append(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) append(e Entry) error {
+	if err := validSource(e.Service); err != nil {
+		return err
+	}
+	cur, err := s.open(e.Service)
+	if err != nil {
+		return err
+	}
+	line := strings.TrimRight(e.Line, "\r\n")
+	line = strings.NewReplacer("\r\n", " ", "\n", " ").Replace(line)
+	if len(line) > MaxLineBytes {
+		line = line[:MaxLineBytes]
+	}
+	stream := e.Stream
+	if stream == "" {
+		stream = StreamStdout
+	}
+	record := e.Time.UTC().Format(time.RFC3339Nano) + " " + stream + " " + line + "\n"
+	n, err := cur.f.WriteString(record)
+	cur.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("write %s log: %w", e.Service, err)
+	}
+	if e.Time.After(cur.last) {
+		cur.last = e.Time
+	}
+	if s.MaxFileBytes > 0 && cur.size >= s.MaxFileBytes {
+		return s.rotate(e.Service, cur)
+	}
+	return nil
+}
+
+// open returns the current file of source, opening it if needed; s.mu must
+// be held.
+func (s *Store) open(source string) (*currentLog, error) {
+	if cur := s.files[source]; cur != nil {
+		return cur, nil
+	}
+	dir := filepath.Join(s.Root, source)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create log dir: %w", err)
+	}
+	path := filepath.Join(dir, currentFile)
+	last, _ := lastEntryTime(path)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open %s log: %w", source, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	cur := &currentLog{f: f, size: info.Size(), last: last}
+	s.files[source] = cur
+	return cur, nil
+}
+
+// rotate compresses the current file of source into a rotated one and
+// prunes the source; s.mu must be held.
+func (s *Store) rotate(source string, cur *currentLog) error {
+	delete(s.files, source)
+	if err := cur.f.Close(); err != nil {
+		return err
+	}
+	dir := filepath.Join(s.Root, source)
+	path := filepath.Join(dir, currentFile)
+	last := cur.last
+	if last.IsZero() {
+		last = time.Now()
+	}
+	name := last.UTC().Format(rotatedLayout) + rotatedSuffix
+	if err := compressFile(path, filepath.Join(dir, name)); err != nil {
+		return fmt.Errorf("rotate %s log: %w", source, err)
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	return s.pruneSource(source, time.Now())
+}
+
+func compressFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := dst + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// Last returns the time of the newest stored entry of source, or the zero
+// time if there is none.
+func (s *Store) Last(source string) time.Time {
+	if validSource(source) != nil {
+		return time.Time{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cur := s.files[source]; cur != nil && !cur.last.IsZero() {
+		return cur.last
+	}
+	dir := filepath.Join(s.Root, source)
+	if t, err := lastEntryTime(filepath.Join(dir, currentFile)); err == nil && !t.IsZero() {
+		return t
+	}
+	rotated, _ := rotatedFiles(dir)
+	if len(rotated) > 0 {
+		return rotated[len(rotated)-1].end
+	}
+	return time.Time{}
+}
+
+// lastEntryTime reads the time of the last entry of a current file.
+func lastEntryTime(path string) (time.Time, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return time.Time{}, err
+	}
+	const window = MaxLineBytes + 256
+	offset := max(info.Size()-window, 0)
+	buf := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(buf, offset); err != nil && err != io.EOF {
+		return time.Time{}, err
+	}
+	lines := strings.Split(strings.TrimRight(string(buf), "\n"), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if e, ok := parseRecord(lines[i]); ok {
+			return e.Time, nil
+		}
+	}
+	return time.Time{}, nil
+}
+
+type rotatedFile struct {
+	path string
+	end  time.Time // time of its newest entry
+	size int64
+}
+
+// rotatedFiles lists the rotated files in dir, oldest first.
+func rotatedFiles(dir string) ([]rotatedFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var files []rotatedFile
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, rotatedSuffix) {
+			continue
+		}
+		end, err := time.Parse(rotatedLayout, strings.TrimSuffix(name, rotatedSuffix))
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, rotatedFile{path: filepath.Join(dir, name), end: end, size: info.Size()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].end.Before(files[j].end) })
+	return files, nil
+}
+
+// Prune drops rotated files older than MaxAge, then the oldest ones while
+// a source holds more than MaxBytes.
+func (s *Store) Prune(now time.Time) error {
+	sources, err := s.Sources()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, source := range sources {
+		if err := s.pruneSource(source, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneSource prunes one source; s.mu must be held.
+func (s *Store) pruneSource(source string, now time.Time) error {
+	dir := filepath.Join(s.Root, source)
+	files, err := rotatedFiles(dir)
+	if err != nil {
+		return err
+	}
+	var total int64
+	if info, err := os.Stat(filepath.Join(dir, currentFile)); err == nil {
+		total = info.Size()
+	}
+	for _, f := range files {
+		total += f.size
+	}
+	for _, f := range files {
+		tooOld := s.MaxAge > 0 && now.Sub(f.end) > s.MaxAge
+		tooBig := s.MaxBytes > 0 && total > s.MaxBytes
+		if !tooOld && !tooBig {
+			break
+		}
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		total -= f.size
+	}
+	return nil
+}
+
+// Sources lists the sources with stored logs.
+func (s *Store) Sources() ([]string, error) {
+	entries, err := os.ReadDir(s.Root)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var sources []string
+	for _, e := range entries {
+		if e.IsDir() {
+			sources = append(sources, e.Name())
+		}
+	}
+	return sources, nil
+}
+
+// Close closes the open current files.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	for source, cur := range s.files {
+		if cerr := cur.f.Close(); err == nil {
+			err = cerr
+		}
+		delete(s.files, source)
+	}
+	return err
+}
+
+// Query returns the matching entries of the requested sources, oldest
+// first, with the entries of several sources interleaved by time.
+func (s *Store) Query(q Query) ([]Entry, error) {
+	minLevel := -1
+	if q.Level != "" {
+		level, err := ParseLevel(q.Level)
+		if err != nil {
+			return nil, err
+		}
+		minLevel = levelRank[level]
+	}
+	var out []Entry
+	for _, source := range q.Services {
+		if err := validSource(source); err != nil {
+			return nil, err
+		}
+		entries, err := s.querySource(source, q, minLevel)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, entries...)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Time.Before(out[j].Time) })
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[len(out)-q.Limit:]
+	}
+	return out, nil
+}
+
+func (s *Store) querySource(source string, q Query, minLevel int) ([]Entry, error) {
+	dir := filepath.Join(s.Root, source)
+	s.mu.Lock()
+	files, err := rotatedFiles(dir)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var out []Entry
+	keep := func(e Entry) {
+		if !q.Since.IsZero() && e.Time.Before(q.Since) {
+			return
+		}
+		if !q.Until.IsZero() && !e.Time.Before(q.Until) {
+			return
+		}
+		if q.Grep != nil && !q.Grep.MatchString(e.Line) {
+			return
+		}
+		e.Service = source
+		e.Level = DetectLevel(e.Line)
+		if minLevel >= 0 && levelRank[levelOrInfo(e.Level)] < minLevel {
+			return
+		}
+		out = append(out, e)
+		// Only the newest Limit entries can make it into the result.
+		if q.Limit > 0 && len(out) >= 2*q.Limit {
+			out = append(out[:0], out[len(out)-q.Limit:]...)
+		}
+	}
+
+	for _, f := range files {
+		if !q.Since.IsZero() && f.end.Before(q.Since) {
+			continue
+		}
+		if err := readEntries(f.path, true, keep); err != nil {
+			return nil, err
+		}
+		if !q.Until.IsZero() && !f.end.Before(q.Until) {
+			// Later files only hold later entries.
+			return out, nil
+		}
+	}
+	if err := readEntries(filepath.Join(dir, currentFile), false, keep); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return out, nil
+}
+
+func readEntries(path string, compressed bool, fn func(Entry)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if compressed && errors.Is(err, os.ErrNotExist) {
+			// Pruned since it was listed.
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if compressed {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", filepath.Base(path), err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64<<10), MaxLineBytes+256)
+	for sc.Scan() {
+		if e, ok := parseRecord(sc.Text()); ok {
+			fn(e)
+		}
+	}
+	return sc.Err()
+}
+
+func parseRecord(line string) (Entry, bool) {
+	ts, rest, ok := strings.Cut(line, " ")
+	if !ok {
+		return Entry{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return Entry{}, false
+	}
+	stream, text, _ := strings.Cut(rest, " ")
+	return Entry{Time: t, Stream: stream, Line: text}, true
+}
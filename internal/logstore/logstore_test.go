@@ -0,0 +1,155 @@
+package logstore
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func lines(entries []Entry) []string {
+	var out []string
+	for _, e := range entries {
+		out = append(out, e.Service+": "+e.Line)
+	}
+	return out
+}
+
+func TestAppendAndQuery(t *testing.T) {
+	s := New(t.TempDir())
+	defer s.Close()
+	base := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	err := s.Append(
+		Entry{Time: base, Service: "web", Stream: StreamStdout, Line: "GET / 200"},
+		Entry{Time: base.Add(2 * time.Second), Service: "web", Stream: StreamStderr, Line: "ERROR: upstream timed out"},
+		Entry{Time: base.Add(time.Second), Service: "api", Line: `{"level":"warn","msg":"slow query"}`},
+		Entry{Time: base.Add(3 * time.Second), Service: "api", Line: "level=debug msg=tick\n"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		q    Query
+		want []string
+	}{
+		{"one service", Query{Services: []string{"web"}}, []string{"web: GET / 200", "web: ERROR: upstream timed out"}},
+		{"interleaved", Query{Services: []string{"web", "api"}}, []string{
+			"web: GET / 200", `api: {"level":"warn","msg":"slow query"}`, "web: ERROR: upstream timed out", "api: level=debug msg=tick"}},
+		{"since and until", Query{Services: []string{"web", "api"}, Since: base.Add(time.Second), Until: base.Add(3 * time.Second)}, []string{
+			`api: {"level":"warn","msg":"slow query"}`, "web: ERROR: upstream timed out"}},
+		{"grep", Query{Services: []string{"web", "api"}, Grep: regexp.MustCompile(`(?i)slow|timed`)}, []string{
+			`api: {"level":"warn","msg":"slow query"}`, "web: ERROR: upstream timed out"}},
+		{"level", Query{Services: []string{"web", "api"}, Level: "warning"}, []string{
+			`api: {"level":"warn","msg":"slow query"}`, "web: ERROR: upstream timed out"}},
+		{"limit keeps the newest", Query{Services: []string{"web", "api"}, Limit: 1}, []string{"api: level=debug msg=tick"}},
+		{"unknown service", Query{Services: []string{"db"}}, nil},
+	}
+	for _, tc := range tests {
+		got, err := s.Query(tc.q)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if strings.Join(lines(got), "\n") != strings.Join(tc.want, "\n") {
+			t.Errorf("%s = %q, want %q", tc.name, lines(got), tc.want)
+		}
+	}
+
+	got, _ := s.Query(Query{Services: []string{"web"}})
+	if got[1].Stream != StreamStderr || got[1].Level != LevelError || !got[1].Time.Equal(base.Add(2*time.Second)) {
+		t.Errorf("entry = %+v", got[1])
+	}
+	if _, err := s.Query(Query{Services: []string{"web"}, Level: "loud"}); err == nil {
+		t.Error("unknown level accepted")
+	}
+	if err := s.Append(Entry{Time: base, Service: "../etc", Line: "x"}); err == nil {
+		t.Error("source outside the root accepted")
+	}
+	if last := s.Last("web"); !last.Equal(base.Add(2 * time.Second)) {
+		t.Errorf("Last = %v", last)
+	}
+}
+
+func TestRotateAndPrune(t *testing.T) {
+	root := t.TempDir()
+	s := New(root)
+	s.MaxFileBytes = 1 << 10
+	s.MaxAge = 0
+	base := time.Now().Add(-10 * 24 * time.Hour)
+	for i := range 100 {
+		line := fmt.Sprintf("line %03d %s", i, strings.Repeat("x", 64))
+		if err := s.Append(Entry{Time: base.Add(time.Duration(i) * time.Hour), Service: "web", Line: line}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rotated, _ := rotatedFiles(filepath.Join(root, "web"))
+	if len(rotated) < 5 {
+		t.Fatalf("%d rotated files, want several", len(rotated))
+	}
+	got, err := s.Query(Query{Services: []string{"web"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 100 || !strings.HasPrefix(got[0].Line, "line 000") || !strings.HasPrefix(got[99].Line, "line 099") {
+		t.Fatalf("query across rotated files returned %d entries", len(got))
+	}
+	got, _ = s.Query(Query{Services: []string{"web"}, Since: base.Add(50 * time.Hour), Until: base.Add(52 * time.Hour)})
+	if len(got) != 2 || !strings.HasPrefix(got[0].Line, "line 050") {
+		t.Errorf("time range = %q", lines(got))
+	}
+	s.Close()
+
+	// A new store picks up where the old one stopped.
+	s = New(root)
+	defer s.Close()
+	if last := s.Last("web"); !last.Equal(base.Add(99 * time.Hour)) {
+		t.Errorf("Last after reopen = %v", last)
+	}
+
+	s.MaxAge = 7 * 24 * time.Hour
+	if err := s.Prune(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = s.Query(Query{Services: []string{"web"}})
+	if len(got) == 100 || len(got) == 0 {
+		t.Errorf("%d entries after age pruning", len(got))
+	}
+	if time.Since(got[0].Time) > 8*24*time.Hour {
+		t.Errorf("entry from %v survived pruning", got[0].Time)
+	}
+
+	s.MaxBytes = 1
+	if err := s.Prune(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if rotated, _ := rotatedFiles(filepath.Join(root, "web")); len(rotated) != 0 {
+		t.Errorf("%d rotated files left over the size limit", len(rotated))
+	}
+	s.Append(Entry{Time: time.Now(), Service: "web", Line: "after pruning"})
+	if got, _ := s.Query(Query{Services: []string{"web"}}); len(got) == 0 || got[len(got)-1].Line != "after pruning" {
+		t.Errorf("entries after pruning = %q", lines(got))
+	}
+}
+
+func TestDetectLevel(t *testing.T) {
+	tests := map[string]string{
+		`{"time":"x","level":"ERROR","msg":"boom"}`:   LevelError,
+		`{"severity": "warning"}`:                     LevelWarn,
+		`time=x level=info msg="listening"`:           LevelInfo,
+		`2026/10/18 12:00:00 [warn] disk almost full`: LevelWarn,
+		`ERROR: relation "users" does not exist`:      LevelError,
+		`E1018 12:00:00.000 1 main.go:10] failed`:     LevelError,
+		`DEBUG starting worker`:                       LevelDebug,
+		`GET /error 200 12ms`:                         "",
+		`listening on :8080`:                          "",
+		`a b c d e f g error`:                         "",
+	}
+	for line, want := range tests {
+		if got := DetectLevel(line); got != want {
+			t.Errorf("DetectLevel(%q) = %q, want %q", line, got, want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Package notify delivers daemon events to a user-configured webhook.
+//
+// Each event is POSTed as JSON. The human-readable summary is in "text", so
+// Slack and Mattermost incoming webhooks display it as-is; other receivers can
+// use the structured fields.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Event kinds.
+const (
+	KindUpdateAvailable = "update.available"
+	KindUpdateSucceeded = "update.succeeded"
+	KindUpdateFailed    = "update.failed"
+	KindDeploySucceeded = "deploy.succeeded"
+	KindDeployFailed    = "deploy.failed"
+	KindDeployPending   = "deploy.pending"
+	KindDeployApproved  = "deploy.approved"
+	KindDeployRejected  = "deploy.rejected"
+	KindDeployExpired   = "deploy.expired"
+	KindDeployBlocked   = "deploy.blocked"
+	KindFreezeOverride  = "deploy.freeze_override"
+	KindCrashLoop       = "service.crash_loop"
+	KindTest            = "test"
+)
+
+// Event is one notification.
+type Event struct {
+	Kind    string            `json:"event"`
+	Service string            `json:"service,omitempty"`
+	Text    string            `json:"text"`
+	Details map[string]string `json:"details,omitempty"`
+	Time    time.Time         `json:"time"`
+}
+
+// Sender posts events to a webhook URL.
+type Sender struct {
+	HTTP *http.Client
+}
+
+func NewSender() *Sender {
+	return &Sender{HTTP: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Send posts ev to url. A zero Time is set to now.
+func (s *Sender) Send(ctx context.Context, url string, ev Event) error {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("notification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "tinyserve")
+	resp, err := s.HTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("send notification: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("notification webhook returned %s", resp.Status)
+	}
+	return nil
+}
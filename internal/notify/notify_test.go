@@ -0,0 +1,45 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSend(t *testing.T) {
+	var got map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Content-Type = %q", r.Header.Get("Content-Type"))
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	ev := Event{Kind: KindUpdateSucceeded, Service: "web", Text: "web updated", Details: map[string]string{"to": "nginx:1.26"}}
+	if err := NewSender().Send(context.Background(), srv.URL, ev); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if got["event"] != KindUpdateSucceeded || got["service"] != "web" || got["text"] != "web updated" {
+		t.Errorf("payload = %v", got)
+	}
+	if details, _ := got["details"].(map[string]any); details["to"] != "nginx:1.26" {
+		t.Errorf("details = %v", got["details"])
+	}
+	if got["time"] == "" || got["time"] == nil {
+		t.Error("time should be set")
+	}
+}
+
+func TestSendRejectsErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	if err := NewSender().Send(context.Background(), srv.URL, Event{Kind: KindTest}); err == nil {
+		t.Error("Send() should fail on a 403")
+	}
+}
@@ -0,0 +1,276 @@
+// Package registry talks to container registries over the Docker Registry
+// HTTP API v2: resolving a tag to its manifest digest and listing tags. Only
+// anonymous (public) pulls are supported; registries that require a bearer
+// token get one from the realm named in their WWW-Authenticate challenge.
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	dockerHubRegistry = "registry-1.docker.io"
+	maxTagPages       = 50
+)
+
+// manifestAccept lists the manifest types we accept, multi-platform indexes
+// first, so the digest matches what "docker pull" records for the tag.
+var manifestAccept = strings.Join([]string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+}, ", ")
+
+// Reference is a parsed image reference.
+type Reference struct {
+	Registry   string // host[:port] serving the v2 API
+	Repository string // e.g. library/nginx
+	Tag        string
+}
+
+func (r Reference) String() string {
+	return r.Registry + "/" + r.Repository + ":" + r.Tag
+}
+
+// ParseReference splits image into registry, repository and tag using the
+// same defaults as docker: Docker Hub, the library/ namespace and "latest".
+// Images pinned by digest cannot be followed and are rejected.
+func ParseReference(image string) (Reference, error) {
+	image = strings.TrimSpace(image)
+	if image == "" {
+		return Reference{}, fmt.Errorf("empty image reference")
+	}
+	if strings.Contains(image, "@") {
+		return Reference{}, fmt.Errorf("image %q is pinned by digest", image)
+	}
+
+	ref := Reference{Registry: dockerHubRegistry, Tag: "latest"}
+	rest := image
+	if i := strings.Index(rest, "/"); i >= 0 {
+		first := rest[:i]
+		if strings.ContainsAny(first, ".:") || first == "localhost" {
+			ref.Registry = first
+			rest = rest[i+1:]
+		}
+	}
+	if i := strings.LastIndex(rest, ":"); i >= 0 {
+		ref.Tag = rest[i+1:]
+		rest = rest[:i]
+	}
+	if rest == "" || ref.Tag == "" {
+		return Reference{}, fmt.Errorf("invalid image reference %q", image)
+	}
+	if ref.Registry == "docker.io" || ref.Registry == "index.docker.io" {
+		ref.Registry = dockerHubRegistry
+	}
+	if ref.Registry == dockerHubRegistry && !strings.Contains(rest, "/") {
+		rest = "library/" + rest
+	}
+	ref.Repository = rest
+	return ref, nil
+}
+
+// Client queries registries. The zero value is not usable; call NewClient.
+type Client struct {
+	HTTP *http.Client
+}
+
+func NewClient() *Client {
+	return &Client{HTTP: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Digest returns the manifest digest the registry currently serves for ref's tag.
+func (c *Client) Digest(ctx context.Context, ref Reference) (string, error) {
+	endpoint := c.baseURL(ref) + "/manifests/" + url.PathEscape(ref.Tag)
+	resp, err := c.do(ctx, http.MethodHead, endpoint, manifestAccept)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("manifest %s: %s", ref, resp.Status)
+	}
+	if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+
+	// Some registries only send the digest header on GET; fall back to
+	// hashing the manifest body, which is how the digest is defined.
+	resp, err = c.do(ctx, http.MethodGet, endpoint, manifestAccept)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("manifest %s: %s", ref, resp.Status)
+	}
+	if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, io.LimitReader(resp.Body, 4<<20)); err != nil {
+		return "", fmt.Errorf("read manifest %s: %w", ref, err)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Tags lists every tag of ref's repository, following pagination.
+func (c *Client) Tags(ctx context.Context, ref Reference) ([]string, error) {
+	endpoint := c.baseURL(ref) + "/tags/list?n=1000"
+	var tags []string
+	for page := 0; endpoint != "" && page < maxTagPages; page++ {
+		resp, err := c.do(ctx, http.MethodGet, endpoint, "application/json")
+		if err != nil {
+			return nil, err
+		}
+		var body struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(io.LimitReader(resp.Body, 8<<20)).Decode(&body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("list tags of %s: %s", ref.Repository, resp.Status)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decode tags of %s: %w", ref.Repository, err)
+		}
+		tags = append(tags, body.Tags...)
+		endpoint = nextPage(resp.Header.Get("Link"), endpoint)
+	}
+	return tags, nil
+}
+
+func (c *Client) baseURL(ref Reference) string {
+	return schemeFor(ref.Registry) + "://" + ref.Registry + "/v2/" + ref.Repository
+}
+
+// schemeFor uses plain HTTP only for registries on the loopback interface,
+// such as a local registry:2 container or a test server.
+func schemeFor(host string) string {
+	hostname := host
+	if i := strings.LastIndex(host, ":"); i >= 0 && !strings.HasSuffix(host, "]") {
+		hostname = host[:i]
+	}
+	switch strings.Trim(hostname, "[]") {
+	case "localhost", "127.0.0.1", "::1":
+		return "http"
+	}
+	return "https"
+}
+
+// do sends the request, answering a bearer challenge with an anonymous token.
+func (c *Client) do(ctx context.Context, method, endpoint, accept string) (*http.Response, error) {
+	resp, err := c.send(ctx, method, endpoint, accept, "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+
+	token, err := c.token(ctx, challenge)
+	if err != nil {
+		return nil, err
+	}
+	return c.send(ctx, method, endpoint, accept, token)
+}
+
+func (c *Client) send(ctx context.Context, method, endpoint, accept, token string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("registry request: %w", err)
+	}
+	return resp, nil
+}
+
+var challengeParamRegex = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// token fetches an anonymous bearer token for a WWW-Authenticate challenge.
+func (c *Client) token(ctx context.Context, challenge string) (string, error) {
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return "", fmt.Errorf("registry requires credentials")
+	}
+	params := make(map[string]string)
+	for _, m := range challengeParamRegex.FindAllStringSubmatch(challenge, -1) {
+		params[strings.ToLower(m[1])] = m[2]
+	}
+	realm := params["realm"]
+	if realm == "" {
+		return "", fmt.Errorf("registry auth challenge has no realm")
+	}
+	u, err := url.Parse(realm)
+	if err != nil {
+		return "", fmt.Errorf("invalid auth realm: %w", err)
+	}
+	q := u.Query()
+	if params["service"] != "" {
+		q.Set("service", params["service"])
+	}
+	if params["scope"] != "" {
+		q.Set("scope", params["scope"])
+	}
+	u.RawQuery = q.Encode()
+
+	resp, err := c.send(ctx, http.MethodGet, u.String(), "application/json", "")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry token: %s", resp.Status)
+	}
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return "", fmt.Errorf("decode registry token: %w", err)
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	if body.AccessToken != "" {
+		return body.AccessToken, nil
+	}
+	return "", fmt.Errorf("registry returned an empty token")
+}
+
+var linkNextRegex = regexp.MustCompile(`<([^>]+)>\s*;\s*rel="?next"?`)
+
+// nextPage resolves the rel="next" target of a Link header against current.
+func nextPage(link, current string) string {
+	m := linkNextRegex.FindStringSubmatch(link)
+	if m == nil {
+		return ""
+	}
+	base, err := url.Parse(current)
+	if err != nil {
+		return ""
+	}
+	next, err := base.Parse(m[1])
+	if err != nil {
+		return ""
+	}
+	return next.String()
+}
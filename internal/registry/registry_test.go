@@ -0,0 +1,166 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		image string
+		want  Reference
+	}{
+		{"nginx", Reference{"registry-1.docker.io", "library/nginx", "latest"}},
+		{"nginx:1.25", Reference{"registry-1.docker.io", "library/nginx", "1.25"}},
+		{"docker.io/grafana/grafana:10.2.0", Reference{"registry-1.docker.io", "grafana/grafana", "10.2.0"}},
+		{"ghcr.io/owner/app:latest", Reference{"ghcr.io", "owner/app", "latest"}},
+		{"localhost:5000/team/app", Reference{"localhost:5000", "team/app", "latest"}},
+	}
+	for _, tt := range tests {
+		got, err := ParseReference(tt.image)
+		if err != nil {
+			t.Errorf("ParseReference(%q) error = %v", tt.image, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseReference(%q) = %+v, want %+v", tt.image, got, tt.want)
+		}
+	}
+	for _, image := range []string{"", "nginx@sha256:abc", "app:"} {
+		if _, err := ParseReference(image); err == nil {
+			t.Errorf("ParseReference(%q) should fail", image)
+		}
+	}
+}
+
+func TestRangeContains(t *testing.T) {
+	tests := []struct {
+		rng string
+		in  []string
+		out []string
+	}{
+		{"^1.4", []string{"1.4.0", "1.9.3", "v1.4.1"}, []string{"1.3.9", "2.0.0", "1.5.0-rc.1"}},
+		{"^0.2.3", []string{"0.2.3", "0.2.9"}, []string{"0.3.0", "0.2.2"}},
+		{"~1.4.2", []string{"1.4.2", "1.4.10"}, []string{"1.5.0", "1.4.1"}},
+		{"~1", []string{"1.0.0", "1.9.0"}, []string{"2.0.0"}},
+		{"1.4.x", []string{"1.4.0", "1.4.7"}, []string{"1.5.0"}},
+		{">=1.2 <2", []string{"1.2.0", "1.99.0"}, []string{"1.1.9", "2.0.0"}},
+		{">1.2, <=1.4", []string{"1.3.0", "1.4.5"}, []string{"1.2.9", "1.5.0"}},
+		{"^1 || ^3", []string{"1.2.0", "3.0.1"}, []string{"2.0.0"}},
+		{"*", []string{"0.0.1", "12.0.0"}, []string{"1.0.0-beta"}},
+	}
+	for _, tt := range tests {
+		r, err := ParseRange(tt.rng)
+		if err != nil {
+			t.Fatalf("ParseRange(%q) error = %v", tt.rng, err)
+		}
+		for _, tag := range tt.in {
+			v, _ := ParseVersion(tag)
+			if !r.Contains(v) {
+				t.Errorf("%q should contain %s", tt.rng, tag)
+			}
+		}
+		for _, tag := range tt.out {
+			v, _ := ParseVersion(tag)
+			if r.Contains(v) {
+				t.Errorf("%q should not contain %s", tt.rng, tag)
+			}
+		}
+	}
+	for _, rng := range []string{"", "^", "latest", ">=1.2.3.4", "^1 ||"} {
+		if _, err := ParseRange(rng); err == nil {
+			t.Errorf("ParseRange(%q) should fail", rng)
+		}
+	}
+}
+
+func TestLatest(t *testing.T) {
+	r, _ := ParseRange("^1.4")
+	tags := []string{"latest", "1.3.9", "1.4", "1.4.2", "v1.6.0", "1.7.0-rc.1", "2.0.0", "alpine"}
+	got, ok := Latest(tags, r)
+	if !ok || got.Tag != "v1.6.0" {
+		t.Errorf("Latest() = %q, %v; want v1.6.0", got.Tag, ok)
+	}
+	if _, ok := Latest([]string{"latest", "2.0.0"}, r); ok {
+		t.Error("Latest() should find nothing outside the range")
+	}
+}
+
+// fakeRegistry is a minimal v2 registry stand-in that requires an anonymous
+// bearer token, like Docker Hub and GHCR.
+func fakeRegistry(t *testing.T, digests map[string]string, tagPages [][]string) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if r.URL.Query().Get("scope") != "repository:team/app:pull" {
+				http.Error(w, "bad scope", http.StatusForbidden)
+				return
+			}
+			w.Write([]byte(`{"token":"anon"}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer anon" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+srv.URL+`/token",service="test",scope="repository:team/app:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v2/team/app/manifests/"):
+			digest, ok := digests[strings.TrimPrefix(r.URL.Path, "/v2/team/app/manifests/")]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			if !strings.Contains(r.Header.Get("Accept"), "manifest.list.v2+json") {
+				http.Error(w, "missing accept", http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Docker-Content-Digest", digest)
+		case r.URL.Path == "/v2/team/app/tags/list":
+			page := 0
+			if r.URL.Query().Get("last") != "" {
+				page = 1
+			}
+			if page+1 < len(tagPages) {
+				w.Header().Set("Link", `</v2/team/app/tags/list?n=1000&last=x>; rel="next"`)
+			}
+			quoted := make([]string, len(tagPages[page]))
+			for i, tag := range tagPages[page] {
+				quoted[i] = `"` + tag + `"`
+			}
+			w.Write([]byte(`{"name":"team/app","tags":[` + strings.Join(quoted, ",") + `]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestClientAgainstLocalRegistry(t *testing.T) {
+	srv := fakeRegistry(t, map[string]string{"latest": "sha256:aaa"}, [][]string{{"1.0.0", "1.1.0"}, {"1.2.0", "latest"}})
+	ref, err := ParseReference(strings.TrimPrefix(srv.URL, "http://") + "/team/app:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClient()
+	ctx := context.Background()
+
+	digest, err := client.Digest(ctx, ref)
+	if err != nil || digest != "sha256:aaa" {
+		t.Errorf("Digest() = %q, %v", digest, err)
+	}
+	tags, err := client.Tags(ctx, ref)
+	if err != nil || strings.Join(tags, ",") != "1.0.0,1.1.0,1.2.0,latest" {
+		t.Errorf("Tags() = %v, %v", tags, err)
+	}
+
+	ref.Tag = "missing"
+	if _, err := client.Digest(ctx, ref); err == nil {
+		t.Error("Digest() for an unknown tag should fail")
+	}
+}
@@ -0,0 +1,216 @@
+package registry
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version parsed from an image tag. Tags may carry a
+// leading "v" and omit the minor or patch number ("1", "v1.4").
+type Version struct {
+	Major, Minor, Patch int
+	Prerelease          string
+	Tag                 string // the tag it was parsed from
+}
+
+var versionRegex = regexp.MustCompile(`^v?(\d+)(?:\.(\d+))?(?:\.(\d+))?(?:-([0-9A-Za-z.-]+))?$`)
+
+// ParseVersion parses tag as a semantic version.
+func ParseVersion(tag string) (Version, bool) {
+	m := versionRegex.FindStringSubmatch(tag)
+	if m == nil {
+		return Version{}, false
+	}
+	v := Version{Prerelease: m[4], Tag: tag}
+	v.Major, _ = strconv.Atoi(m[1])
+	if m[2] != "" {
+		v.Minor, _ = strconv.Atoi(m[2])
+	}
+	if m[3] != "" {
+		v.Patch, _ = strconv.Atoi(m[3])
+	}
+	return v, true
+}
+
+// Compare returns -1, 0 or 1. A prerelease sorts before its release; two
+// prereleases of the same version compare lexically.
+func (v Version) Compare(o Version) int {
+	for _, d := range [3]int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if d < 0 {
+			return -1
+		}
+		if d > 0 {
+			return 1
+		}
+	}
+	switch {
+	case v.Prerelease == o.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case o.Prerelease == "":
+		return -1
+	case v.Prerelease < o.Prerelease:
+		return -1
+	default:
+		return 1
+	}
+}
+
+// Range is a version constraint in the npm/Cargo style:
+//
+//	^1.4      >=1.4.0 <2.0.0      ~1.4.2   >=1.4.2 <1.5.0
+//	1.4, 1.4.x  >=1.4.0 <1.5.0    >=1.2 <2, >=1.2, <2   every clause must hold
+//	^1 || ^2  either side may match
+//
+// Prerelease tags never match a range.
+type Range struct {
+	alternatives [][]bound
+}
+
+// bound is a half-open interval [lo, hi); nil ends are unbounded.
+type bound struct {
+	lo, hi *Version
+}
+
+// ParseRange parses a version range.
+func ParseRange(s string) (Range, error) {
+	var r Range
+	for _, alt := range strings.Split(s, "||") {
+		fields := strings.FieldsFunc(alt, func(c rune) bool { return c == ' ' || c == ',' })
+		if len(fields) == 0 {
+			return Range{}, fmt.Errorf("empty version range %q", s)
+		}
+		var clauses []bound
+		for _, f := range fields {
+			b, err := parseClause(f)
+			if err != nil {
+				return Range{}, err
+			}
+			clauses = append(clauses, b)
+		}
+		r.alternatives = append(r.alternatives, clauses)
+	}
+	return r, nil
+}
+
+var clauseRegex = regexp.MustCompile(`^(\^|~|>=|<=|>|<|=)?v?(\d+|[xX*])(?:\.(\d+|[xX*]))?(?:\.(\d+|[xX*]))?$`)
+
+func parseClause(clause string) (bound, error) {
+	if clause == "*" || clause == "x" || clause == "X" {
+		return bound{}, nil
+	}
+	m := clauseRegex.FindStringSubmatch(clause)
+	if m == nil {
+		return bound{}, fmt.Errorf("invalid version constraint %q", clause)
+	}
+	op := m[1]
+	// parts holds the numbers given before the first wildcard or omission.
+	var parts []int
+	for _, p := range m[2:5] {
+		if p == "" || p == "x" || p == "X" || p == "*" {
+			break
+		}
+		n, _ := strconv.Atoi(p)
+		parts = append(parts, n)
+	}
+	if len(parts) == 0 {
+		if op == "" || op == "=" || op == ">=" || op == "<=" {
+			return bound{}, nil
+		}
+		return bound{}, fmt.Errorf("invalid version constraint %q", clause)
+	}
+
+	lo := versionFromParts(parts)
+	// next is the first version after everything the partial version covers:
+	// 1.4 covers 1.4.x, so next is 1.5.0.
+	next := bumpParts(parts, len(parts)-1)
+
+	switch op {
+	case "", "=":
+		return bound{lo: &lo, hi: &next}, nil
+	case ">=":
+		return bound{lo: &lo}, nil
+	case ">":
+		return bound{lo: &next}, nil
+	case "<":
+		return bound{hi: &lo}, nil
+	case "<=":
+		return bound{hi: &next}, nil
+	case "~":
+		// ~1.4.2 and ~1.4 allow patch updates, ~1 allows minor updates.
+		hi := bumpParts(parts, min(len(parts)-1, 1))
+		return bound{lo: &lo, hi: &hi}, nil
+	case "^":
+		// Allow changes that do not modify the left-most non-zero number.
+		i := 0
+		for i < len(parts)-1 && parts[i] == 0 {
+			i++
+		}
+		hi := bumpParts(parts, i)
+		return bound{lo: &lo, hi: &hi}, nil
+	}
+	return bound{}, fmt.Errorf("invalid version constraint %q", clause)
+}
+
+func versionFromParts(parts []int) Version {
+	var v Version
+	for i, n := range parts {
+		switch i {
+		case 0:
+			v.Major = n
+		case 1:
+			v.Minor = n
+		case 2:
+			v.Patch = n
+		}
+	}
+	return v
+}
+
+// bumpParts increments parts[i] and drops everything after it.
+func bumpParts(parts []int, i int) Version {
+	bumped := append([]int{}, parts[:i+1]...)
+	bumped[i]++
+	return versionFromParts(bumped)
+}
+
+// Contains reports whether v satisfies the range.
+func (r Range) Contains(v Version) bool {
+	if v.Prerelease != "" {
+		return false
+	}
+	for _, clauses := range r.alternatives {
+		ok := true
+		for _, b := range clauses {
+			if (b.lo != nil && v.Compare(*b.lo) < 0) || (b.hi != nil && v.Compare(*b.hi) >= 0) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Latest returns the highest tag in tags that satisfies r.
+func Latest(tags []string, r Range) (Version, bool) {
+	var best Version
+	found := false
+	for _, tag := range tags {
+		v, ok := ParseVersion(tag)
+		if !ok || !r.Contains(v) {
+			continue
+		}
+		// Prefer the more specific tag on ties, e.g. 1.4.2 over 1.4.
+		if !found || v.Compare(best) > 0 || (v.Compare(best) == 0 && len(v.Tag) > len(best.Tag)) {
+			best = v
+			found = true
+		}
+	}
+	return best, found
+}
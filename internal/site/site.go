@@ -0,0 +1,395 @@
+package site
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ServerImage is the container that serves static services.
+const ServerImage = "nginx:1.27-alpine"
+
+// MountPath is where a site root is mounted in the server container. nginx
+// serves MountPath/html, which is why the live pointer is named html.
+const MountPath = "/usr/share/nginx"
+
+// DefaultKeep is how many previous releases are retained for rollback.
+const DefaultKeep = 5
+
+// MaxUploadBytes bounds the unpacked size of a single upload.
+const MaxUploadBytes = 512 << 20
+
+const (
+	releasesDir = "releases"
+	livePointer = "html"
+	maxFiles    = 100000
+)
+
+// ErrNotFound is returned when a release does not exist.
+var ErrNotFound = errors.New("release not found")
+
+// Store manages the releases of one static site. Layout under Root:
+//
+//	releases/<version>/...   unpacked uploads
+//	html -> releases/<version>
+//
+// Switching versions replaces the html symlink with a rename, so nginx never
+// sees a half-written tree.
+type Store struct {
+	Root string
+}
+
+type Release struct {
+	Version   string    `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Current   bool      `json:"current"`
+}
+
+func NewStore(root string) *Store {
+	return &Store{Root: root}
+}
+
+// Init creates the site layout with a placeholder page if nothing is published yet.
+func (s *Store) Init(name string, now time.Time) error {
+	if s.Current() != "" {
+		return nil
+	}
+	version, dir, err := s.newReleaseDir(now)
+	if err != nil {
+		return err
+	}
+	page := fmt.Sprintf("<!doctype html>\n<title>%s</title>\n<p>Nothing has been published to %s yet.</p>\n", name, name)
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte(page), 0o644); err != nil {
+		return fmt.Errorf("write placeholder: %w", err)
+	}
+	return s.link(version)
+}
+
+// Publish unpacks a tar (optionally gzipped) archive into a new release, makes
+// it live and returns it with the slash-separated paths that differ from the
+// previous release.
+func (s *Store) Publish(r io.Reader, now time.Time) (Release, []string, error) {
+	version, dir, err := s.newReleaseDir(now)
+	if err != nil {
+		return Release{}, nil, err
+	}
+	if err := extract(r, dir); err != nil {
+		_ = os.RemoveAll(dir)
+		return Release{}, nil, err
+	}
+	changed, err := s.Activate(version)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return Release{}, nil, err
+	}
+	return Release{Version: version, CreatedAt: now.UTC(), Current: true}, changed, nil
+}
+
+// Activate makes an existing release live and returns the paths that changed.
+func (s *Store) Activate(version string) ([]string, error) {
+	if !validVersion(version) {
+		return nil, ErrNotFound
+	}
+	dir := filepath.Join(s.Root, releasesDir, version)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, ErrNotFound
+	}
+
+	var changed []string
+	if current := s.Current(); current != "" && current != version {
+		var err error
+		changed, err = diffTrees(filepath.Join(s.Root, releasesDir, current), dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := s.link(version); err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
+
+// Current returns the live release version, or "" if none.
+func (s *Store) Current() string {
+	target, err := os.Readlink(filepath.Join(s.Root, livePointer))
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(target)
+}
+
+// Releases lists releases newest first.
+func (s *Store) Releases() ([]Release, error) {
+	entries, err := os.ReadDir(filepath.Join(s.Root, releasesDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	current := s.Current()
+	var releases []Release
+	for _, e := range entries {
+		if !e.IsDir() || !validVersion(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		releases = append(releases, Release{
+			Version:   e.Name(),
+			CreatedAt: info.ModTime().UTC(),
+			Current:   e.Name() == current,
+		})
+	}
+	sort.Slice(releases, func(i, j int) bool { return releases[i].Version > releases[j].Version })
+	return releases, nil
+}
+
+// Previous returns the newest release older than the live one.
+func (s *Store) Previous() (string, error) {
+	releases, err := s.Releases()
+	if err != nil {
+		return "", err
+	}
+	current := s.Current()
+	for _, r := range releases {
+		if r.Version < current {
+			return r.Version, nil
+		}
+	}
+	return "", ErrNotFound
+}
+
+// Prune removes all but the live release and the keep newest others.
+func (s *Store) Prune(keep int) ([]string, error) {
+	releases, err := s.Releases()
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	kept := 0
+	for _, r := range releases {
+		if r.Current {
+			continue
+		}
+		if kept < keep {
+			kept++
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(s.Root, releasesDir, r.Version)); err != nil {
+			return removed, err
+		}
+		removed = append(removed, r.Version)
+	}
+	return removed, nil
+}
+
+// URLPaths maps changed files to the URL paths a CDN may have cached them
+// under, including directory URLs for index.html files.
+func URLPaths(changed []string) []string {
+	seen := make(map[string]struct{}, len(changed))
+	var out []string
+	add := func(p string) {
+		if _, ok := seen[p]; ok {
+			return
+		}
+		seen[p] = struct{}{}
+		out = append(out, p)
+	}
+	for _, c := range changed {
+		add("/" + c)
+		if path.Base(c) == "index.html" {
+			dir := path.Dir(c)
+			if dir == "." {
+				add("/")
+			} else {
+				add("/" + dir + "/")
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (s *Store) newReleaseDir(now time.Time) (string, string, error) {
+	base := now.UTC().Format("20060102-150405")
+	root := filepath.Join(s.Root, releasesDir)
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return "", "", fmt.Errorf("create releases dir: %w", err)
+	}
+	version := base
+	for i := 1; ; i++ {
+		dir := filepath.Join(root, version)
+		err := os.Mkdir(dir, 0o755)
+		if err == nil {
+			return version, dir, nil
+		}
+		if !os.IsExist(err) {
+			return "", "", fmt.Errorf("create release dir: %w", err)
+		}
+		version = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+func (s *Store) link(version string) error {
+	tmp := filepath.Join(s.Root, "."+livePointer+"-"+version)
+	_ = os.Remove(tmp)
+	// Relative target so the link also resolves inside the container mount.
+	if err := os.Symlink(filepath.Join(releasesDir, version), tmp); err != nil {
+		return fmt.Errorf("link release: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(s.Root, livePointer)); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("switch release: %w", err)
+	}
+	return nil
+}
+
+func validVersion(v string) bool {
+	return v != "" && !strings.ContainsAny(v, `/\`) && v != "." && v != ".."
+}
+
+// extract unpacks regular files and directories; links and devices are rejected.
+func extract(r io.Reader, dst string) error {
+	br := bufio.NewReader(r)
+	var src io.Reader = br
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("open gzip: %w", err)
+		}
+		defer gz.Close()
+		src = gz
+	}
+
+	tr := tar.NewReader(src)
+	var total int64
+	files := 0
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read archive: %w", err)
+		}
+
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		if name == "." {
+			continue
+		}
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("archive entry %q escapes the site root", hdr.Name)
+		}
+		target := filepath.Join(dst, filepath.FromSlash(name))
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			files++
+			if files > maxFiles {
+				return fmt.Errorf("archive has more than %d files", maxFiles)
+			}
+			total += hdr.Size
+			if total > MaxUploadBytes {
+				return fmt.Errorf("archive exceeds %d MB", MaxUploadBytes>>20)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			if err := writeFile(target, tr); err != nil {
+				return err
+			}
+		case tar.TypeXGlobalHeader:
+			continue
+		default:
+			return fmt.Errorf("archive entry %q: only regular files and directories are allowed", hdr.Name)
+		}
+	}
+	if files == 0 {
+		return fmt.Errorf("archive contains no files")
+	}
+	return nil
+}
+
+func writeFile(target string, r io.Reader) error {
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// diffTrees returns slash-separated paths added, removed or modified between two trees.
+func diffTrees(oldDir, newDir string) ([]string, error) {
+	oldSums, err := hashTree(oldDir)
+	if err != nil {
+		return nil, err
+	}
+	newSums, err := hashTree(newDir)
+	if err != nil {
+		return nil, err
+	}
+	var changed []string
+	for p, sum := range newSums {
+		if oldSums[p] != sum {
+			changed = append(changed, p)
+		}
+	}
+	for p := range oldSums {
+		if _, ok := newSums[p]; !ok {
+			changed = append(changed, p)
+		}
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+func hashTree(root string) (map[string]string, error) {
+	sums := make(map[string]string)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return err
+		}
+		sums[filepath.ToSlash(rel)] = hex.EncodeToString(h.Sum(nil))
+		return nil
+	})
+	return sums, err
+}
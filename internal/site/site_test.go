@@ -0,0 +1,152 @@
+package site
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func tarball(t *testing.T, gz bool, files map[string]string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	var tw *tar.Writer
+	var zw *gzip.Writer
+	if gz {
+		zw = gzip.NewWriter(&buf)
+		tw = tar.NewWriter(zw)
+	} else {
+		tw = tar.NewWriter(&buf)
+	}
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &buf
+}
+
+func TestPublishAndRollback(t *testing.T) {
+	s := NewStore(t.TempDir())
+	t0 := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	if err := s.Init("docs", t0); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	placeholder := s.Current()
+	if placeholder == "" {
+		t.Fatal("Init() should create a live release")
+	}
+
+	first, _, err := s.Publish(tarball(t, true, map[string]string{
+		"./index.html":    "v1",
+		"css/site.css":    "body{}",
+		"blog/index.html": "posts",
+	}), t0.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(s.Root, "html", "index.html")); err != nil || string(got) != "v1" {
+		t.Fatalf("live index.html = %q, %v", got, err)
+	}
+
+	second, changed, err := s.Publish(tarball(t, false, map[string]string{
+		"index.html":      "v2",
+		"css/site.css":    "body{}",
+		"blog/index.html": "posts",
+		"new.txt":         "hi",
+	}), t0.Add(2*time.Minute))
+	if err != nil {
+		t.Fatalf("second Publish() error = %v", err)
+	}
+	if want := []string{"index.html", "new.txt"}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("changed = %v, want %v", changed, want)
+	}
+	if s.Current() != second.Version {
+		t.Errorf("Current() = %q, want %q", s.Current(), second.Version)
+	}
+
+	prev, err := s.Previous()
+	if err != nil || prev != first.Version {
+		t.Fatalf("Previous() = %q, %v; want %q", prev, err, first.Version)
+	}
+	changed, err = s.Activate(prev)
+	if err != nil {
+		t.Fatalf("Activate() error = %v", err)
+	}
+	if want := []string{"index.html", "new.txt"}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("rollback changed = %v, want %v", changed, want)
+	}
+	if got, _ := os.ReadFile(filepath.Join(s.Root, "html", "index.html")); string(got) != "v1" {
+		t.Errorf("after rollback index.html = %q", got)
+	}
+
+	// Keep one previous release besides the live one.
+	removed, err := s.Prune(1)
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if !reflect.DeepEqual(removed, []string{placeholder}) {
+		t.Errorf("Prune() removed %v, want [%s]", removed, placeholder)
+	}
+
+	if _, err := s.Activate("../etc"); err != ErrNotFound {
+		t.Errorf("Activate(../etc) error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestPublishRejectsUnsafeArchives(t *testing.T) {
+	tests := []struct {
+		name string
+		hdr  tar.Header
+	}{
+		{"parent path", tar.Header{Name: "../evil.html", Typeflag: tar.TypeReg}},
+		{"absolute path", tar.Header{Name: "/etc/passwd", Typeflag: tar.TypeReg}},
+		{"symlink", tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewStore(t.TempDir())
+			var buf bytes.Buffer
+			tw := tar.NewWriter(&buf)
+			if err := tw.WriteHeader(&tt.hdr); err != nil {
+				t.Fatal(err)
+			}
+			tw.Close()
+
+			if _, _, err := s.Publish(&buf, time.Now()); err == nil {
+				t.Error("Publish() should reject the archive")
+			}
+			if s.Current() != "" {
+				t.Error("failed publish must not switch the live release")
+			}
+			releases, _ := s.Releases()
+			if len(releases) != 0 {
+				t.Errorf("failed publish left releases behind: %v", releases)
+			}
+		})
+	}
+}
+
+func TestURLPaths(t *testing.T) {
+	got := URLPaths([]string{"index.html", "blog/index.html", "css/site.css"})
+	want := []string{"/", "/blog/", "/blog/index.html", "/css/site.css", "/index.html"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("URLPaths() = %v, want %v", got, want)
+	}
+}
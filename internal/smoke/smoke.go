@@ -0,0 +1,116 @@
+// Package smoke runs post-deploy HTTP checks against services.
+//
+// Checks go through Traefik rather than to containers directly, with the
+// service's public hostname as the Host header, so they exercise the same
+// routing, middlewares and load balancing that real traffic gets.
+package smoke
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultStatus  = http.StatusOK
+	DefaultTimeout = 30 * time.Second
+
+	// retryInterval spaces attempts while Traefik picks up new containers and
+	// the app finishes starting.
+	retryInterval = time.Second
+	// maxBodyBytes bounds how much of a response is searched for BodyContains.
+	maxBodyBytes = 1 << 20
+)
+
+// Check is one request and what its response must look like.
+type Check struct {
+	Host         string
+	Path         string
+	ExpectStatus int    // 0 means DefaultStatus
+	BodyContains string // empty skips the body check
+	Timeout      time.Duration
+}
+
+func (c Check) String() string {
+	return c.Host + c.Path
+}
+
+// Runner sends checks to a Traefik entrypoint.
+type Runner struct {
+	BaseURL string // e.g. http://127.0.0.1:7080
+	HTTP    *http.Client
+}
+
+func NewRunner(baseURL string) *Runner {
+	return &Runner{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		HTTP: &http.Client{
+			Timeout: 10 * time.Second,
+			// A redirect is a response worth asserting on, not something to follow.
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}
+}
+
+// Run retries c until it passes or its timeout expires, and returns the last
+// failure.
+func (r *Runner) Run(ctx context.Context, c Check) error {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var lastErr error
+	for {
+		err := r.once(ctx, c)
+		if err == nil {
+			return nil
+		}
+		// An attempt cut short by the deadline says less than the one before it.
+		if lastErr == nil || ctx.Err() == nil {
+			lastErr = err
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s: %w (gave up after %s)", c, lastErr, timeout)
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+func (r *Runner) once(ctx context.Context, c Check) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.BaseURL+c.Path, nil)
+	if err != nil {
+		return err
+	}
+	req.Host = c.Host
+	req.Header.Set("User-Agent", "tinyserve-smoke")
+	resp, err := r.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	want := c.ExpectStatus
+	if want == 0 {
+		want = DefaultStatus
+	}
+	if resp.StatusCode != want {
+		return fmt.Errorf("got status %d, want %d", resp.StatusCode, want)
+	}
+	if c.BodyContains != "" {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodyBytes))
+		if err != nil {
+			return fmt.Errorf("read body: %w", err)
+		}
+		if !strings.Contains(string(body), c.BodyContains) {
+			return fmt.Errorf("body does not contain %q", c.BodyContains)
+		}
+	}
+	return nil
+}
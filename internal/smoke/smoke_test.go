@@ -0,0 +1,67 @@
+package smoke
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "shop.example.com" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.URL.Path {
+		case "/warming":
+			// Fails once, like a container that is still starting.
+			if calls.Add(1) == 1 {
+				http.Error(w, "starting", http.StatusBadGateway)
+				return
+			}
+			w.Write([]byte("ready"))
+		case "/old":
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+		case "/broken":
+			http.Error(w, "boom", http.StatusInternalServerError)
+		default:
+			w.Write([]byte(`{"status":"ok"}`))
+		}
+	}))
+	defer srv.Close()
+
+	r := NewRunner(srv.URL + "/")
+	ctx := context.Background()
+	host := "shop.example.com"
+
+	passing := []Check{
+		{Host: host, Path: "/healthz", BodyContains: `"ok"`},
+		{Host: host, Path: "/warming", BodyContains: "ready", Timeout: 5 * time.Second},
+		{Host: host, Path: "/old", ExpectStatus: http.StatusMovedPermanently},
+	}
+	for _, c := range passing {
+		if err := r.Run(ctx, c); err != nil {
+			t.Errorf("Run(%s) error = %v", c, err)
+		}
+	}
+
+	failing := []struct {
+		check Check
+		want  string
+	}{
+		{Check{Host: host, Path: "/broken", Timeout: 100 * time.Millisecond}, "got status 500"},
+		{Check{Host: host, Path: "/healthz", BodyContains: "healthy", Timeout: 100 * time.Millisecond}, "does not contain"},
+		{Check{Host: "other.example.com", Path: "/healthz", Timeout: 100 * time.Millisecond}, "got status 404"},
+	}
+	for _, tt := range failing {
+		err := r.Run(ctx, tt.check)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Run(%s) error = %v, want %q", tt.check, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Audited actions.
+const (
+	AuditExec = "exec"
+	AuditRun  = "run"
+)
+
+// AuditEntry records a privileged action such as a command run in a
+// service container. Entries are added when the action starts and
+// finished when it ends, so a crash leaves one without an exit code.
+type AuditEntry struct {
+	ID         int64     `json:"id"`
+	Time       time.Time `json:"time"`
+	Actor      string    `json:"actor"` // token name
+	Action     string    `json:"action"`
+	Service    string    `json:"service"`
+	Command    []string  `json:"command,omitempty"`
+	TTY        bool      `json:"tty,omitempty"`
+	RemoteAddr string    `json:"remote_addr,omitempty"`
+	ExitCode   *int      `json:"exit_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms,omitempty"`
+}
+
+// AuditFilter selects audit entries. Zero fields match everything.
+type AuditFilter struct {
+	Service string
+	Since   time.Time
+	Limit   int // newest Limit entries
+}
+
+// AuditLog stores audit entries apart from State.
+type AuditLog interface {
+	// AppendAudit stores e and returns it with its ID set.
+	AppendAudit(ctx context.Context, e AuditEntry) (AuditEntry, error)
+	// FinishAudit records the outcome of the entry with e.ID.
+	FinishAudit(ctx context.Context, e AuditEntry) error
+	// ListAudit returns matching entries, oldest first.
+	ListAudit(ctx context.Context, f AuditFilter) ([]AuditEntry, error)
+}
+
+func (f AuditFilter) match(e AuditEntry) bool {
+	if f.Service != "" && e.Service != f.Service {
+		return false
+	}
+	return f.Since.IsZero() || !e.Time.Before(f.Since)
+}
+
+type memoryAudit struct {
+	mu      sync.Mutex
+	entries []AuditEntry
+}
+
+func (m *memoryAudit) AppendAudit(ctx context.Context, e AuditEntry) (AuditEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e.ID = int64(len(m.entries)) + 1
+	m.entries = append(m.entries, e)
+	return e, nil
+}
+
+func (m *memoryAudit) FinishAudit(ctx context.Context, e AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e.ID < 1 || e.ID > int64(len(m.entries)) {
+		return fmt.Errorf("audit entry %d not found", e.ID)
+	}
+	stored := &m.entries[e.ID-1]
+	stored.ExitCode = e.ExitCode
+	stored.Error = e.Error
+	stored.DurationMs = e.DurationMs
+	return nil
+}
+
+func (m *memoryAudit) ListAudit(ctx context.Context, f AuditFilter) ([]AuditEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []AuditEntry
+	for _, e := range m.entries {
+		if f.match(e) {
+			out = append(out, e)
+		}
+	}
+	if f.Limit > 0 && len(out) > f.Limit {
+		out = out[len(out)-f.Limit:]
+	}
+	return out, nil
+}
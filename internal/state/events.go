@@ -0,0 +1,99 @@
+package state
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Container event actions recorded per service.
+const (
+	EventDie          = "die"
+	EventOOM          = "oom"
+	EventRestart      = "restart"
+	EventHealthStatus = "health_status"
+)
+
+// ServiceEvent is a container event of a service, such as a crash or a
+// failing healthcheck.
+type ServiceEvent struct {
+	ID        int64     `json:"id"`
+	Service   string    `json:"service"`
+	Container string    `json:"container"`
+	Action    string    `json:"action"`
+	ExitCode  *int      `json:"exit_code,omitempty"` // for die
+	Health    string    `json:"health,omitempty"`    // for health_status
+	Time      time.Time `json:"time"`
+}
+
+// EventFilter selects recorded events. Zero fields match everything.
+type EventFilter struct {
+	Service string
+	Since   time.Time
+	AfterID int64
+	Limit   int // newest Limit events
+}
+
+// EventLog stores service events apart from State, since they grow much
+// faster than the configuration.
+type EventLog interface {
+	// AppendEvent stores ev and returns it with its ID set.
+	AppendEvent(ctx context.Context, ev ServiceEvent) (ServiceEvent, error)
+	// ListEvents returns matching events, oldest first.
+	ListEvents(ctx context.Context, f EventFilter) ([]ServiceEvent, error)
+	// PruneEvents removes events older than before.
+	PruneEvents(ctx context.Context, before time.Time) error
+}
+
+func (f EventFilter) match(ev ServiceEvent) bool {
+	if f.Service != "" && ev.Service != f.Service {
+		return false
+	}
+	if !f.Since.IsZero() && ev.Time.Before(f.Since) {
+		return false
+	}
+	return ev.ID > f.AfterID
+}
+
+type memoryEvents struct {
+	mu     sync.Mutex
+	events []ServiceEvent
+	lastID int64
+}
+
+func (m *memoryEvents) AppendEvent(ctx context.Context, ev ServiceEvent) (ServiceEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastID++
+	ev.ID = m.lastID
+	m.events = append(m.events, ev)
+	return ev, nil
+}
+
+func (m *memoryEvents) ListEvents(ctx context.Context, f EventFilter) ([]ServiceEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []ServiceEvent
+	for _, ev := range m.events {
+		if f.match(ev) {
+			out = append(out, ev)
+		}
+	}
+	if f.Limit > 0 && len(out) > f.Limit {
+		out = out[len(out)-f.Limit:]
+	}
+	return out, nil
+}
+
+func (m *memoryEvents) PruneEvents(ctx context.Context, before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := m.events[:0]
+	for _, ev := range m.events {
+		if !ev.Time.Before(before) {
+			kept = append(kept, ev)
+		}
+	}
+	m.events = kept
+	return nil
+}
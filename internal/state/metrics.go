@@ -0,0 +1,180 @@
+package state
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MetricTier is one resolution of the metrics time series.
+type MetricTier struct {
+	Step      time.Duration
+	Retention time.Duration
+}
+
+// MetricTiers are the stored resolutions, finest first. The first holds the
+// samples as taken; each later one averages the one before it.
+var MetricTiers = []MetricTier{
+	{Step: 15 * time.Second, Retention: 6 * time.Hour},
+	{Step: 5 * time.Minute, Retention: 7 * 24 * time.Hour},
+	{Step: time.Hour, Retention: 90 * 24 * time.Hour},
+}
+
+// MetricSample is the resource use of all containers of a service at a
+// point in time, or averaged over a step. Network and block IO are rates.
+type MetricSample struct {
+	Service          string    `json:"-"`
+	Time             time.Time `json:"time"`
+	CPUPercent       float64   `json:"cpu_percent"` // of one core, summed over replicas
+	MemoryBytes      uint64    `json:"memory_bytes"`
+	MemoryLimitBytes uint64    `json:"memory_limit_bytes,omitempty"` // of one container
+	NetworkRxRate    float64   `json:"network_rx_bytes_per_sec"`
+	NetworkTxRate    float64   `json:"network_tx_bytes_per_sec"`
+	BlockReadRate    float64   `json:"block_read_bytes_per_sec"`
+	BlockWriteRate   float64   `json:"block_write_bytes_per_sec"`
+	Containers       int       `json:"containers"`
+}
+
+// MetricsStore keeps the per-service metrics time series.
+type MetricsStore interface {
+	// AppendMetrics stores samples at the finest resolution.
+	AppendMetrics(ctx context.Context, samples []MetricSample) error
+	// QueryMetrics returns the samples of service at step since a time,
+	// oldest first.
+	QueryMetrics(ctx context.Context, service string, step time.Duration, since time.Time) ([]MetricSample, error)
+	// CompactMetrics averages recent samples into the coarser tiers and
+	// drops samples past their tier's retention.
+	CompactMetrics(ctx context.Context, now time.Time) error
+}
+
+// TierFor returns the finest tier that still covers span.
+func TierFor(span time.Duration) MetricTier {
+	for _, tier := range MetricTiers {
+		if span <= tier.Retention {
+			return tier
+		}
+	}
+	return MetricTiers[len(MetricTiers)-1]
+}
+
+// compactWindow is where CompactMetrics reads tier i-1 from: the bucket of
+// tier i in progress and the one before it, which may have been written
+// before its last samples came in.
+func compactWindow(i int, now time.Time) time.Time {
+	step := MetricTiers[i].Step
+	return now.Truncate(step).Add(-step)
+}
+
+// downsample averages samples into buckets of step per service. Memory
+// limit and container count take the largest value in the bucket.
+func downsample(samples []MetricSample, step time.Duration) []MetricSample {
+	type key struct {
+		service string
+		time    time.Time
+	}
+	type bucket struct {
+		sum MetricSample
+		n   int
+	}
+	buckets := make(map[key]*bucket)
+	for _, s := range samples {
+		k := key{s.Service, s.Time.Truncate(step)}
+		b := buckets[k]
+		if b == nil {
+			b = &bucket{sum: MetricSample{Service: k.service, Time: k.time}}
+			buckets[k] = b
+		}
+		b.n++
+		b.sum.CPUPercent += s.CPUPercent
+		b.sum.MemoryBytes += s.MemoryBytes
+		b.sum.NetworkRxRate += s.NetworkRxRate
+		b.sum.NetworkTxRate += s.NetworkTxRate
+		b.sum.BlockReadRate += s.BlockReadRate
+		b.sum.BlockWriteRate += s.BlockWriteRate
+		b.sum.MemoryLimitBytes = max(b.sum.MemoryLimitBytes, s.MemoryLimitBytes)
+		b.sum.Containers = max(b.sum.Containers, s.Containers)
+	}
+	out := make([]MetricSample, 0, len(buckets))
+	for _, b := range buckets {
+		n := float64(b.n)
+		avg := b.sum
+		avg.CPUPercent /= n
+		avg.MemoryBytes /= uint64(b.n)
+		avg.NetworkRxRate /= n
+		avg.NetworkTxRate /= n
+		avg.BlockReadRate /= n
+		avg.BlockWriteRate /= n
+		out = append(out, avg)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].Time.Equal(out[j].Time) {
+			return out[i].Time.Before(out[j].Time)
+		}
+		return out[i].Service < out[j].Service
+	})
+	return out
+}
+
+type memoryMetrics struct {
+	mu    sync.Mutex
+	tiers map[time.Duration][]MetricSample // by step, oldest first
+}
+
+func (m *memoryMetrics) AppendMetrics(ctx context.Context, samples []MetricSample) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.put(MetricTiers[0].Step, samples)
+	return nil
+}
+
+// put replaces samples of the same service and time; m.mu must be held.
+func (m *memoryMetrics) put(step time.Duration, samples []MetricSample) {
+	if m.tiers == nil {
+		m.tiers = make(map[time.Duration][]MetricSample)
+	}
+	tier := m.tiers[step]
+	for _, s := range samples {
+		tier = slices.DeleteFunc(tier, func(old MetricSample) bool {
+			return old.Service == s.Service && old.Time.Equal(s.Time)
+		})
+		tier = append(tier, s)
+	}
+	sort.SliceStable(tier, func(i, j int) bool { return tier[i].Time.Before(tier[j].Time) })
+	m.tiers[step] = tier
+}
+
+func (m *memoryMetrics) QueryMetrics(ctx context.Context, service string, step time.Duration, since time.Time) ([]MetricSample, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []MetricSample
+	for _, s := range m.tiers[step] {
+		if s.Service == service && !s.Time.Before(since) {
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
+
+func (m *memoryMetrics) CompactMetrics(ctx context.Context, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := 1; i < len(MetricTiers); i++ {
+		from := compactWindow(i, now)
+		var recent []MetricSample
+		for _, s := range m.tiers[MetricTiers[i-1].Step] {
+			if !s.Time.Before(from) {
+				recent = append(recent, s)
+			}
+		}
+		m.put(MetricTiers[i].Step, downsample(recent, MetricTiers[i].Step))
+	}
+	for _, tier := range MetricTiers {
+		cutoff := now.Add(-tier.Retention)
+		m.tiers[tier.Step] = slices.DeleteFunc(m.tiers[tier.Step], func(s MetricSample) bool {
+			return s.Time.Before(cutoff)
+		})
+	}
+	return nil
+}
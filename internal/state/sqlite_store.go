@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -15,7 +16,7 @@ import (
 	_ "modernc.org/sqlite"
 )
 
-const schemaVersion = 5
+const schemaVersion = 27
 
 const schema = `
 CREATE TABLE IF NOT EXISTS schema_version (
@@ -34,7 +35,11 @@ CREATE TABLE IF NOT EXISTS settings (
 	tunnel_account_id TEXT,
 	ui_local_port INTEGER NOT NULL DEFAULT 7070,
 	max_backups INTEGER DEFAULT 10,
+	max_site_versions INTEGER DEFAULT 0,
 	cloudflare_api_token TEXT,
+	notifications TEXT,
+	freeze_windows TEXT,
+	container_runtime TEXT,
 	remote_enabled INTEGER NOT NULL DEFAULT 0,
 	remote_hostname TEXT,
 	remote_ui_hostname TEXT,
@@ -56,9 +61,36 @@ CREATE TABLE IF NOT EXISTS services (
 	command TEXT,
 	entrypoint TEXT,
 	healthcheck TEXT,
+	smoke_checks TEXT,
+	hooks TEXT,
+	build TEXT,
+	job TEXT,
+	preview TEXT,
+	maintenance TEXT,
+	error_pages TEXT,
+	update_policy TEXT,
+	webhook TEXT,
+	crash_policy TEXT,
 	memory_limit_mb INTEGER DEFAULT 0,
+	memory_reservation_mb INTEGER DEFAULT 0,
+	cpu_limit REAL DEFAULT 0,
+	cpu_reservation REAL DEFAULT 0,
+	pids_limit INTEGER DEFAULT 0,
+	replicas INTEGER DEFAULT 0,
+	idle_timeout_minutes INTEGER DEFAULT 0,
+	restart_policy TEXT,
+	security TEXT,
+	logging TEXT,
+	links TEXT,
+	depends_on TEXT,
+	no_egress INTEGER NOT NULL DEFAULT 0,
+	require_approval INTEGER NOT NULL DEFAULT 0,
+	approval_ttl_minutes INTEGER DEFAULT 0,
 	enabled INTEGER NOT NULL DEFAULT 0,
+	stopped INTEGER NOT NULL DEFAULT 0,
 	last_deploy TEXT,
+	deployed_image TEXT,
+	previous_image TEXT,
 	status TEXT
 );
 
@@ -68,9 +100,54 @@ CREATE TABLE IF NOT EXISTS tokens (
 	id TEXT PRIMARY KEY,
 	name TEXT NOT NULL,
 	hash TEXT NOT NULL,
+	admin INTEGER NOT NULL DEFAULT 0,
 	created_at TEXT NOT NULL,
 	last_used TEXT
 );
+
+CREATE TABLE IF NOT EXISTS events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	service TEXT NOT NULL,
+	container TEXT NOT NULL,
+	action TEXT NOT NULL,
+	exit_code INTEGER,
+	health TEXT,
+	time TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_events_service ON events(service, id);
+CREATE INDEX IF NOT EXISTS idx_events_time ON events(time);
+
+CREATE TABLE IF NOT EXISTS audit (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	time TEXT NOT NULL,
+	actor TEXT NOT NULL,
+	action TEXT NOT NULL,
+	service TEXT NOT NULL,
+	command TEXT,
+	tty INTEGER NOT NULL DEFAULT 0,
+	remote_addr TEXT,
+	exit_code INTEGER,
+	error TEXT,
+	duration_ms INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_service ON audit(service, id);
+
+CREATE TABLE IF NOT EXISTS metrics (
+	service TEXT NOT NULL,
+	step INTEGER NOT NULL,
+	time INTEGER NOT NULL,
+	cpu_percent REAL NOT NULL,
+	memory_bytes INTEGER NOT NULL,
+	memory_limit_bytes INTEGER NOT NULL,
+	network_rx_rate REAL NOT NULL,
+	network_tx_rate REAL NOT NULL,
+	block_read_rate REAL NOT NULL,
+	block_write_rate REAL NOT NULL,
+	containers INTEGER NOT NULL,
+	PRIMARY KEY (step, service, time)
+);
 `
 
 type SQLiteStore struct {
@@ -155,6 +232,165 @@ func (s *SQLiteStore) migrate() error {
 		_, _ = s.db.Exec(`ALTER TABLE services ADD COLUMN entrypoint TEXT`)
 	}
 
+	if version < 6 {
+		// v6: add per-service network isolation fields
+		_, _ = s.db.Exec(`ALTER TABLE services ADD COLUMN links TEXT`)
+		_, _ = s.db.Exec(`ALTER TABLE services ADD COLUMN depends_on TEXT`)
+		_, _ = s.db.Exec(`ALTER TABLE services ADD COLUMN no_egress INTEGER NOT NULL DEFAULT 0`)
+	}
+
+	if version < 7 {
+		// v7: add resource reservations, restart policy, hardening and log rotation
+		_, _ = s.db.Exec(`ALTER TABLE services ADD COLUMN memory_reservation_mb INTEGER DEFAULT 0`)
+		_, _ = s.db.Exec(`ALTER TABLE services ADD COLUMN cpu_limit REAL DEFAULT 0`)
+		_, _ = s.db.Exec(`ALTER TABLE services ADD COLUMN cpu_reservation REAL DEFAULT 0`)
+		_, _ = s.db.Exec(`ALTER TABLE services ADD COLUMN pids_limit INTEGER DEFAULT 0`)
+		_, _ = s.db.Exec(`ALTER TABLE services ADD COLUMN restart_policy TEXT`)
+		_, _ = s.db.Exec(`ALTER TABLE services ADD COLUMN security TEXT`)
+		_, _ = s.db.Exec(`ALTER TABLE services ADD COLUMN logging TEXT`)
+	}
+
+	if version < 8 {
+		// v8: add replica count
+		_, _ = s.db.Exec(`ALTER TABLE services ADD COLUMN replicas INTEGER DEFAULT 0`)
+	}
+
+	if version < 9 {
+		// v9: add build spec for git-build services
+		_, _ = s.db.Exec(`ALTER TABLE services ADD COLUMN build TEXT`)
+	}
+
+	if version < 10 {
+		// v10: add static site release retention
+		_, _ = s.db.Exec(`ALTER TABLE settings ADD COLUMN max_site_versions INTEGER DEFAULT 0`)
+	}
+
+	if version < 11 {
+		// v11: add job schedule for job services
+		_, _ = s.db.Exec(`ALTER TABLE services ADD COLUMN job TEXT`)
+	}
+
+	if version < 12 {
+		// v12: add preview metadata for pull request previews
+		_, _ = s.db.Exec(`ALTER TABLE services ADD COLUMN preview TEXT`)
+	}
+
+	if version < 13 {
+		// v13: add idle timeout for scale-to-zero
+		_, _ = s.db.Exec(`ALTER TABLE services ADD COLUMN idle_timeout_minutes INTEGER DEFAULT 0`)
+	}
+
+	if version < 14 {
+		// v14: add maintenance mode and custom error pages
+		_, _ = s.db.Exec(`ALTER TABLE services ADD COLUMN maintenance TEXT`)
+		_, _ = s.db.Exec(`ALTER TABLE services ADD COLUMN error_pages TEXT`)
+	}
+
+	if version < 15 {
+		// v15: add automatic image update policies and notification settings
+		_, _ = s.db.Exec(`ALTER TABLE services ADD COLUMN update_policy TEXT`)
+		_, _ = s.db.Exec(`ALTER TABLE settings ADD COLUMN notifications TEXT`)
+	}
+
+	if version < 16 {
+		// v16: add provider webhook triggers
+		_, _ = s.db.Exec(`ALTER TABLE services ADD COLUMN webhook TEXT`)
+	}
+
+	if version < 17 {
+		// v17: record the image of the last successful deploy
+		_, _ = s.db.Exec(`ALTER TABLE services ADD COLUMN deployed_image TEXT`)
+	}
+
+	if version < 18 {
+		// v18: add post-deploy smoke checks
+		_, _ = s.db.Exec(`ALTER TABLE services ADD COLUMN smoke_checks TEXT`)
+	}
+
+	if version < 19 {
+		// v19: add pre- and post-deploy hooks
+		_, _ = s.db.Exec(`ALTER TABLE services ADD COLUMN hooks TEXT`)
+	}
+
+	if version < 20 {
+		// v20: add deploy approvals for webhook deploys
+		_, _ = s.db.Exec(`ALTER TABLE services ADD COLUMN require_approval INTEGER NOT NULL DEFAULT 0`)
+		_, _ = s.db.Exec(`ALTER TABLE services ADD COLUMN approval_ttl_minutes INTEGER DEFAULT 0`)
+	}
+
+	if version < 21 {
+		// v21: add deploy freeze windows
+		_, _ = s.db.Exec(`ALTER TABLE settings ADD COLUMN freeze_windows TEXT`)
+	}
+
+	if version < 22 {
+		// v22: add container runtime selection
+		_, _ = s.db.Exec(`ALTER TABLE settings ADD COLUMN container_runtime TEXT`)
+	}
+
+	if version < 23 {
+		// v23: add container event log
+		_, _ = s.db.Exec(`CREATE TABLE IF NOT EXISTS events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			service TEXT NOT NULL,
+			container TEXT NOT NULL,
+			action TEXT NOT NULL,
+			exit_code INTEGER,
+			health TEXT,
+			time TEXT NOT NULL
+		)`)
+		_, _ = s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_events_service ON events(service, id)`)
+		_, _ = s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_events_time ON events(time)`)
+	}
+
+	if version < 24 {
+		// v24: add per-service metrics time series
+		_, _ = s.db.Exec(`CREATE TABLE IF NOT EXISTS metrics (
+			service TEXT NOT NULL,
+			step INTEGER NOT NULL,
+			time INTEGER NOT NULL,
+			cpu_percent REAL NOT NULL,
+			memory_bytes INTEGER NOT NULL,
+			memory_limit_bytes INTEGER NOT NULL,
+			network_rx_rate REAL NOT NULL,
+			network_tx_rate REAL NOT NULL,
+			block_read_rate REAL NOT NULL,
+			block_write_rate REAL NOT NULL,
+			containers INTEGER NOT NULL,
+			PRIMARY KEY (step, service, time)
+		)`)
+	}
+
+	if version < 25 {
+		// v25: add crash-loop policies and the rollback image
+		_, _ = s.db.Exec(`ALTER TABLE services ADD COLUMN crash_policy TEXT`)
+		_, _ = s.db.Exec(`ALTER TABLE services ADD COLUMN previous_image TEXT`)
+	}
+
+	if version < 26 {
+		// v26: add admin tokens and the audit log
+		_, _ = s.db.Exec(`ALTER TABLE tokens ADD COLUMN admin INTEGER NOT NULL DEFAULT 0`)
+		_, _ = s.db.Exec(`CREATE TABLE IF NOT EXISTS audit (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			time TEXT NOT NULL,
+			actor TEXT NOT NULL,
+			action TEXT NOT NULL,
+			service TEXT NOT NULL,
+			command TEXT,
+			tty INTEGER NOT NULL DEFAULT 0,
+			remote_addr TEXT,
+			exit_code INTEGER,
+			error TEXT,
+			duration_ms INTEGER
+		)`)
+		_, _ = s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_audit_service ON audit(service, id)`)
+	}
+
+	if version < 27 {
+		// v27: remember services stopped by hand
+		_, _ = s.db.Exec(`ALTER TABLE services ADD COLUMN stopped INTEGER NOT NULL DEFAULT 0`)
+	}
+
 	if _, err := s.db.Exec(`INSERT OR REPLACE INTO schema_version (version) VALUES (?)`, schemaVersion); err != nil {
 		return fmt.Errorf("set schema version: %w", err)
 	}
@@ -178,15 +414,15 @@ func (s *SQLiteStore) Load(ctx context.Context) (State, error) {
 
 	var createdAt, updatedAt string
 	var tunnelToken, tunnelCredFile, tunnelID, tunnelName, tunnelAccountID, defaultDomain sql.NullString
-	var cloudflareAPIToken, remoteHostname, remoteUIHostname, remoteAPIHostname, remoteBrowserAuth sql.NullString
-	var maxBackups sql.NullInt64
+	var cloudflareAPIToken, notifications, freezeWindows, containerRuntime, remoteHostname, remoteUIHostname, remoteAPIHostname, remoteBrowserAuth sql.NullString
+	var maxBackups, maxSiteVersions sql.NullInt64
 	var remoteEnabled int
 
 	err := s.db.QueryRowContext(ctx, `
 		SELECT compose_project_name, default_domain, tunnel_mode, tunnel_token, 
 		       tunnel_credentials_file, tunnel_id, tunnel_name, tunnel_account_id,
-		       ui_local_port, max_backups, cloudflare_api_token,
-		       remote_enabled, remote_hostname, remote_ui_hostname, remote_api_hostname, remote_browser_auth,
+		       ui_local_port, max_backups, max_site_versions, cloudflare_api_token, notifications, freeze_windows,
+		       container_runtime, remote_enabled, remote_hostname, remote_ui_hostname, remote_api_hostname, remote_browser_auth,
 		       created_at, updated_at
 		FROM settings WHERE id = 1
 	`).Scan(
@@ -200,7 +436,11 @@ func (s *SQLiteStore) Load(ctx context.Context) (State, error) {
 		&tunnelAccountID,
 		&st.Settings.UILocalPort,
 		&maxBackups,
+		&maxSiteVersions,
 		&cloudflareAPIToken,
+		&notifications,
+		&freezeWindows,
+		&containerRuntime,
 		&remoteEnabled,
 		&remoteHostname,
 		&remoteUIHostname,
@@ -223,6 +463,7 @@ func (s *SQLiteStore) Load(ctx context.Context) (State, error) {
 	st.Settings.Tunnel.TunnelName = tunnelName.String
 	st.Settings.Tunnel.AccountID = tunnelAccountID.String
 	st.Settings.CloudflareAPIToken = cloudflareAPIToken.String
+	st.Settings.ContainerRuntime = containerRuntime.String
 	st.Settings.Remote.Enabled = remoteEnabled == 1
 	st.Settings.Remote.Hostname = remoteHostname.String
 	st.Settings.Remote.UIHostname = remoteUIHostname.String
@@ -233,6 +474,13 @@ func (s *SQLiteStore) Load(ctx context.Context) (State, error) {
 	if maxBackups.Valid {
 		st.Settings.MaxBackups = int(maxBackups.Int64)
 	}
+	st.Settings.MaxSiteVersions = int(maxSiteVersions.Int64)
+	if notifications.Valid && notifications.String != "" {
+		_ = json.Unmarshal([]byte(notifications.String), &st.Settings.Notifications)
+	}
+	if freezeWindows.Valid && freezeWindows.String != "" {
+		_ = json.Unmarshal([]byte(freezeWindows.String), &st.Settings.FreezeWindows)
+	}
 
 	if t, err := time.Parse(time.RFC3339Nano, createdAt); err == nil {
 		st.CreatedAt = t
@@ -243,7 +491,9 @@ func (s *SQLiteStore) Load(ctx context.Context) (State, error) {
 
 	rows, err := s.db.QueryContext(ctx, `
 		SELECT id, name, type, image, internal_port, hostnames, env, volumes,
-		       command, entrypoint, healthcheck, memory_limit_mb, enabled, last_deploy, status
+		       command, entrypoint, healthcheck, smoke_checks, hooks, build, job, preview, maintenance, error_pages, update_policy, webhook, crash_policy, memory_limit_mb, memory_reservation_mb,
+		       cpu_limit, cpu_reservation, pids_limit, replicas, idle_timeout_minutes, restart_policy, security, logging,
+		       links, depends_on, no_egress, require_approval, approval_ttl_minutes, enabled, stopped, last_deploy, deployed_image, previous_image, status
 		FROM services
 	`)
 	if err != nil {
@@ -253,19 +503,43 @@ func (s *SQLiteStore) Load(ctx context.Context) (State, error) {
 
 	for rows.Next() {
 		var svc Service
-		var hostnames, env, volumes, command, entrypoint, healthcheck, lastDeploy, status sql.NullString
-		var enabled int
+		var hostnames, env, volumes, command, entrypoint, healthcheck, smokeChecks, links, dependsOn, lastDeploy, deployedImage, previousImage, status sql.NullString
+		var hooks, build, job, preview, maintenance, errorPages, updatePolicy, webhook, crashPolicy, restartPolicy, security, logging sql.NullString
+		var memoryReservation, pidsLimit, replicas, idleTimeout, approvalTTL sql.NullInt64
+		var cpuLimit, cpuReservation sql.NullFloat64
+		var enabled, stopped, noEgress, requireApproval int
 
 		if err := rows.Scan(
 			&svc.ID, &svc.Name, &svc.Type, &svc.Image, &svc.InternalPort,
-			&hostnames, &env, &volumes, &command, &entrypoint, &healthcheck,
-			&svc.Resources.MemoryLimitMB, &enabled, &lastDeploy, &status,
+			&hostnames, &env, &volumes, &command, &entrypoint, &healthcheck, &smokeChecks, &hooks, &build, &job, &preview, &maintenance, &errorPages, &updatePolicy, &webhook, &crashPolicy,
+			&svc.Resources.MemoryLimitMB, &memoryReservation,
+			&cpuLimit, &cpuReservation, &pidsLimit, &replicas, &idleTimeout, &restartPolicy, &security, &logging,
+			&links, &dependsOn, &noEgress, &requireApproval, &approvalTTL, &enabled, &stopped, &lastDeploy, &deployedImage, &previousImage, &status,
 		); err != nil {
 			return State{}, fmt.Errorf("scan service: %w", err)
 		}
 
 		svc.Enabled = enabled == 1
+		svc.Stopped = stopped == 1
+		svc.NoEgress = noEgress == 1
+		svc.RequireApproval = requireApproval == 1
+		svc.ApprovalTTL = int(approvalTTL.Int64)
 		svc.Status = status.String
+		svc.DeployedImage = deployedImage.String
+		svc.PreviousImage = previousImage.String
+		svc.RestartPolicy = restartPolicy.String
+		svc.Replicas = int(replicas.Int64)
+		svc.IdleTimeout = int(idleTimeout.Int64)
+		svc.Resources.MemoryReservationMB = int(memoryReservation.Int64)
+		svc.Resources.CPULimit = cpuLimit.Float64
+		svc.Resources.CPUReservation = cpuReservation.Float64
+		svc.Resources.PidsLimit = int(pidsLimit.Int64)
+		if security.Valid && security.String != "" {
+			_ = json.Unmarshal([]byte(security.String), &svc.Security)
+		}
+		if logging.Valid && logging.String != "" {
+			_ = json.Unmarshal([]byte(logging.String), &svc.Logging)
+		}
 
 		if hostnames.Valid && hostnames.String != "" {
 			_ = json.Unmarshal([]byte(hostnames.String), &svc.Hostnames)
@@ -282,12 +556,75 @@ func (s *SQLiteStore) Load(ctx context.Context) (State, error) {
 		if entrypoint.Valid && entrypoint.String != "" {
 			_ = json.Unmarshal([]byte(entrypoint.String), &svc.Entrypoint)
 		}
+		if links.Valid && links.String != "" {
+			_ = json.Unmarshal([]byte(links.String), &svc.Links)
+		}
+		if dependsOn.Valid && dependsOn.String != "" {
+			_ = json.Unmarshal([]byte(dependsOn.String), &svc.DependsOn)
+		}
 		if healthcheck.Valid && healthcheck.String != "" {
 			var hc ServiceHealthcheck
 			if err := json.Unmarshal([]byte(healthcheck.String), &hc); err == nil {
 				svc.Healthcheck = &hc
 			}
 		}
+		if smokeChecks.Valid && smokeChecks.String != "" {
+			_ = json.Unmarshal([]byte(smokeChecks.String), &svc.SmokeChecks)
+		}
+		if hooks.Valid && hooks.String != "" {
+			var hk ServiceHooks
+			if err := json.Unmarshal([]byte(hooks.String), &hk); err == nil {
+				svc.Hooks = &hk
+			}
+		}
+		if build.Valid && build.String != "" {
+			var b ServiceBuild
+			if err := json.Unmarshal([]byte(build.String), &b); err == nil {
+				svc.Build = &b
+			}
+		}
+		if job.Valid && job.String != "" {
+			var j ServiceJob
+			if err := json.Unmarshal([]byte(job.String), &j); err == nil {
+				svc.Job = &j
+			}
+		}
+		if preview.Valid && preview.String != "" {
+			var p ServicePreview
+			if err := json.Unmarshal([]byte(preview.String), &p); err == nil {
+				svc.Preview = &p
+			}
+		}
+		if maintenance.Valid && maintenance.String != "" {
+			var m ServiceMaintenance
+			if err := json.Unmarshal([]byte(maintenance.String), &m); err == nil {
+				svc.Maintenance = &m
+			}
+		}
+		if errorPages.Valid && errorPages.String != "" {
+			var p ServiceErrorPages
+			if err := json.Unmarshal([]byte(errorPages.String), &p); err == nil {
+				svc.ErrorPages = &p
+			}
+		}
+		if updatePolicy.Valid && updatePolicy.String != "" {
+			var u ServiceUpdatePolicy
+			if err := json.Unmarshal([]byte(updatePolicy.String), &u); err == nil {
+				svc.UpdatePolicy = &u
+			}
+		}
+		if webhook.Valid && webhook.String != "" {
+			var wh ServiceWebhook
+			if err := json.Unmarshal([]byte(webhook.String), &wh); err == nil {
+				svc.Webhook = &wh
+			}
+		}
+		if crashPolicy.Valid && crashPolicy.String != "" {
+			var cp ServiceCrashPolicy
+			if err := json.Unmarshal([]byte(crashPolicy.String), &cp); err == nil {
+				svc.CrashPolicy = &cp
+			}
+		}
 		if lastDeploy.Valid && lastDeploy.String != "" {
 			if t, err := time.Parse(time.RFC3339Nano, lastDeploy.String); err == nil {
 				svc.LastDeploy = &t
@@ -303,7 +640,7 @@ func (s *SQLiteStore) Load(ctx context.Context) (State, error) {
 
 	// Load tokens
 	tokenRows, err := s.db.QueryContext(ctx, `
-		SELECT id, name, hash, created_at, last_used FROM tokens
+		SELECT id, name, hash, admin, created_at, last_used FROM tokens
 	`)
 	if err != nil {
 		return State{}, fmt.Errorf("load tokens: %w", err)
@@ -315,7 +652,7 @@ func (s *SQLiteStore) Load(ctx context.Context) (State, error) {
 		var createdAtStr string
 		var lastUsed sql.NullString
 
-		if err := tokenRows.Scan(&tok.ID, &tok.Name, &tok.Hash, &createdAtStr, &lastUsed); err != nil {
+		if err := tokenRows.Scan(&tok.ID, &tok.Name, &tok.Hash, &tok.Admin, &createdAtStr, &lastUsed); err != nil {
 			return State{}, fmt.Errorf("scan token: %w", err)
 		}
 
@@ -362,14 +699,22 @@ func (s *SQLiteStore) Save(ctx context.Context, st State) error {
 	if st.Settings.Remote.BrowserAuth.Type != "" {
 		remoteBrowserAuth, _ = json.Marshal(st.Settings.Remote.BrowserAuth)
 	}
+	var notifications []byte
+	if st.Settings.Notifications != (NotificationSettings{}) {
+		notifications, _ = json.Marshal(st.Settings.Notifications)
+	}
+	var freezeWindows []byte
+	if len(st.Settings.FreezeWindows) > 0 {
+		freezeWindows, _ = json.Marshal(st.Settings.FreezeWindows)
+	}
 
 	_, err = tx.ExecContext(ctx, `
 		INSERT INTO settings (id, compose_project_name, default_domain, tunnel_mode, 
 		                      tunnel_token, tunnel_credentials_file, tunnel_id, tunnel_name,
-		                      tunnel_account_id, ui_local_port, max_backups, cloudflare_api_token,
-		                      remote_enabled, remote_hostname, remote_ui_hostname, remote_api_hostname, remote_browser_auth,
+		                      tunnel_account_id, ui_local_port, max_backups, max_site_versions, cloudflare_api_token, notifications, freeze_windows,
+		                      container_runtime, remote_enabled, remote_hostname, remote_ui_hostname, remote_api_hostname, remote_browser_auth,
 		                      created_at, updated_at)
-		VALUES (1, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		VALUES (1, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(id) DO UPDATE SET
 			compose_project_name = excluded.compose_project_name,
 			default_domain = excluded.default_domain,
@@ -381,7 +726,11 @@ func (s *SQLiteStore) Save(ctx context.Context, st State) error {
 			tunnel_account_id = excluded.tunnel_account_id,
 			ui_local_port = excluded.ui_local_port,
 			max_backups = excluded.max_backups,
+			max_site_versions = excluded.max_site_versions,
 			cloudflare_api_token = excluded.cloudflare_api_token,
+			notifications = excluded.notifications,
+			freeze_windows = excluded.freeze_windows,
+			container_runtime = excluded.container_runtime,
 			remote_enabled = excluded.remote_enabled,
 			remote_hostname = excluded.remote_hostname,
 			remote_ui_hostname = excluded.remote_ui_hostname,
@@ -399,7 +748,11 @@ func (s *SQLiteStore) Save(ctx context.Context, st State) error {
 		nullString(st.Settings.Tunnel.AccountID),
 		st.Settings.UILocalPort,
 		st.Settings.MaxBackups,
+		st.Settings.MaxSiteVersions,
 		nullString(st.Settings.CloudflareAPIToken),
+		nullString(string(notifications)),
+		nullString(string(freezeWindows)),
+		nullString(st.Settings.ContainerRuntime),
 		remoteEnabled,
 		nullString(st.Settings.Remote.Hostname),
 		nullString(st.Settings.Remote.UIHostname),
@@ -442,10 +795,54 @@ func (s *SQLiteStore) Save(ctx context.Context, st State) error {
 		volumes, _ := json.Marshal(svc.Volumes)
 		command, _ := json.Marshal(svc.Command)
 		entrypoint, _ := json.Marshal(svc.Entrypoint)
+		links, _ := json.Marshal(svc.Links)
+		dependsOn, _ := json.Marshal(svc.DependsOn)
+		security, _ := json.Marshal(svc.Security)
+		logging, _ := json.Marshal(svc.Logging)
 		var healthcheck []byte
 		if svc.Healthcheck != nil {
 			healthcheck, _ = json.Marshal(svc.Healthcheck)
 		}
+		var smokeChecks []byte
+		if len(svc.SmokeChecks) > 0 {
+			smokeChecks, _ = json.Marshal(svc.SmokeChecks)
+		}
+		var hooks []byte
+		if svc.Hooks != nil {
+			hooks, _ = json.Marshal(svc.Hooks)
+		}
+		var build []byte
+		if svc.Build != nil {
+			build, _ = json.Marshal(svc.Build)
+		}
+		var job []byte
+		if svc.Job != nil {
+			job, _ = json.Marshal(svc.Job)
+		}
+		var preview []byte
+		if svc.Preview != nil {
+			preview, _ = json.Marshal(svc.Preview)
+		}
+		var maintenance []byte
+		if svc.Maintenance != nil {
+			maintenance, _ = json.Marshal(svc.Maintenance)
+		}
+		var errorPages []byte
+		if svc.ErrorPages != nil {
+			errorPages, _ = json.Marshal(svc.ErrorPages)
+		}
+		var updatePolicy []byte
+		if svc.UpdatePolicy != nil {
+			updatePolicy, _ = json.Marshal(svc.UpdatePolicy)
+		}
+		var webhook []byte
+		if svc.Webhook != nil {
+			webhook, _ = json.Marshal(svc.Webhook)
+		}
+		var crashPolicy []byte
+		if svc.CrashPolicy != nil {
+			crashPolicy, _ = json.Marshal(svc.CrashPolicy)
+		}
 		var lastDeploy sql.NullString
 		if svc.LastDeploy != nil {
 			lastDeploy = sql.NullString{String: svc.LastDeploy.Format(time.RFC3339Nano), Valid: true}
@@ -454,11 +851,25 @@ func (s *SQLiteStore) Save(ctx context.Context, st State) error {
 		if svc.Enabled {
 			enabled = 1
 		}
+		noEgress := 0
+		if svc.NoEgress {
+			noEgress = 1
+		}
+		requireApproval := 0
+		if svc.RequireApproval {
+			requireApproval = 1
+		}
+		stopped := 0
+		if svc.Stopped {
+			stopped = 1
+		}
 
 		_, err = tx.ExecContext(ctx, `
 			INSERT INTO services (id, name, type, image, internal_port, hostnames, env, volumes,
-			                      command, entrypoint, healthcheck, memory_limit_mb, enabled, last_deploy, status)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			                      command, entrypoint, healthcheck, smoke_checks, hooks, build, job, preview, maintenance, error_pages, update_policy, webhook, crash_policy, memory_limit_mb, memory_reservation_mb,
+			                      cpu_limit, cpu_reservation, pids_limit, replicas, idle_timeout_minutes, restart_policy, security, logging,
+			                      links, depends_on, no_egress, require_approval, approval_ttl_minutes, enabled, stopped, last_deploy, deployed_image, previous_image, status)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 			ON CONFLICT(id) DO UPDATE SET
 				name = excluded.name,
 				type = excluded.type,
@@ -470,14 +881,44 @@ func (s *SQLiteStore) Save(ctx context.Context, st State) error {
 				command = excluded.command,
 				entrypoint = excluded.entrypoint,
 				healthcheck = excluded.healthcheck,
+				smoke_checks = excluded.smoke_checks,
+				hooks = excluded.hooks,
+				build = excluded.build,
+				job = excluded.job,
+				preview = excluded.preview,
+				maintenance = excluded.maintenance,
+				error_pages = excluded.error_pages,
+				update_policy = excluded.update_policy,
+				webhook = excluded.webhook,
+				crash_policy = excluded.crash_policy,
 				memory_limit_mb = excluded.memory_limit_mb,
+				memory_reservation_mb = excluded.memory_reservation_mb,
+				cpu_limit = excluded.cpu_limit,
+				cpu_reservation = excluded.cpu_reservation,
+				pids_limit = excluded.pids_limit,
+				replicas = excluded.replicas,
+				idle_timeout_minutes = excluded.idle_timeout_minutes,
+				restart_policy = excluded.restart_policy,
+				security = excluded.security,
+				logging = excluded.logging,
+				links = excluded.links,
+				depends_on = excluded.depends_on,
+				no_egress = excluded.no_egress,
+				require_approval = excluded.require_approval,
+				approval_ttl_minutes = excluded.approval_ttl_minutes,
 				enabled = excluded.enabled,
+				stopped = excluded.stopped,
 				last_deploy = excluded.last_deploy,
+				deployed_image = excluded.deployed_image,
+				previous_image = excluded.previous_image,
 				status = excluded.status
 		`,
 			svc.ID, svc.Name, svc.Type, svc.Image, svc.InternalPort,
-			string(hostnames), string(env), string(volumes), string(command), string(entrypoint), string(healthcheck),
-			svc.Resources.MemoryLimitMB, enabled, lastDeploy, nullString(svc.Status),
+			string(hostnames), string(env), string(volumes), string(command), string(entrypoint), string(healthcheck), string(smokeChecks), string(hooks), string(build), string(job), string(preview), string(maintenance), string(errorPages), string(updatePolicy), string(webhook), string(crashPolicy),
+			svc.Resources.MemoryLimitMB, svc.Resources.MemoryReservationMB,
+			svc.Resources.CPULimit, svc.Resources.CPUReservation, svc.Resources.PidsLimit,
+			svc.Replicas, svc.IdleTimeout, nullString(svc.RestartPolicy), string(security), string(logging),
+			string(links), string(dependsOn), noEgress, requireApproval, svc.ApprovalTTL, enabled, stopped, lastDeploy, nullString(svc.DeployedImage), nullString(svc.PreviousImage), nullString(svc.Status),
 		)
 		if err != nil {
 			return fmt.Errorf("upsert service %s: %w", svc.Name, err)
@@ -516,14 +957,15 @@ func (s *SQLiteStore) Save(ctx context.Context, st State) error {
 		}
 
 		_, err = tx.ExecContext(ctx, `
-			INSERT INTO tokens (id, name, hash, created_at, last_used)
-			VALUES (?, ?, ?, ?, ?)
+			INSERT INTO tokens (id, name, hash, admin, created_at, last_used)
+			VALUES (?, ?, ?, ?, ?, ?)
 			ON CONFLICT(id) DO UPDATE SET
 				name = excluded.name,
 				hash = excluded.hash,
+				admin = excluded.admin,
 				last_used = excluded.last_used
 		`,
-			tok.ID, tok.Name, tok.Hash, tok.CreatedAt.Format(time.RFC3339Nano), lastUsed,
+			tok.ID, tok.Name, tok.Hash, tok.Admin, tok.CreatedAt.Format(time.RFC3339Nano), lastUsed,
 		)
 		if err != nil {
 			return fmt.Errorf("upsert token %s: %w", tok.ID, err)
@@ -537,6 +979,259 @@ func (s *SQLiteStore) Save(ctx context.Context, st State) error {
 	return nil
 }
 
+// eventTimeFormat has a fixed width, so event times compare as strings.
+const eventTimeFormat = "2006-01-02T15:04:05.000000000Z"
+
+func (s *SQLiteStore) AppendEvent(ctx context.Context, ev ServiceEvent) (ServiceEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var exitCode sql.NullInt64
+	if ev.ExitCode != nil {
+		exitCode = sql.NullInt64{Int64: int64(*ev.ExitCode), Valid: true}
+	}
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO events (service, container, action, exit_code, health, time)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, ev.Service, ev.Container, ev.Action, exitCode, nullString(ev.Health), ev.Time.UTC().Format(eventTimeFormat))
+	if err != nil {
+		return ServiceEvent{}, fmt.Errorf("insert event: %w", err)
+	}
+	ev.ID, err = res.LastInsertId()
+	return ev, err
+}
+
+func (s *SQLiteStore) ListEvents(ctx context.Context, f EventFilter) ([]ServiceEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query := `SELECT id, service, container, action, exit_code, health, time FROM events WHERE id > ?`
+	args := []any{f.AfterID}
+	if f.Service != "" {
+		query += ` AND service = ?`
+		args = append(args, f.Service)
+	}
+	if !f.Since.IsZero() {
+		query += ` AND time >= ?`
+		args = append(args, f.Since.UTC().Format(eventTimeFormat))
+	}
+	// The newest Limit events are selected and then put back in order.
+	query += ` ORDER BY id DESC`
+	if f.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, f.Limit)
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []ServiceEvent
+	for rows.Next() {
+		var ev ServiceEvent
+		var exitCode sql.NullInt64
+		var health sql.NullString
+		var t string
+		if err := rows.Scan(&ev.ID, &ev.Service, &ev.Container, &ev.Action, &exitCode, &health, &t); err != nil {
+			return nil, fmt.Errorf("scan event: %w", err)
+		}
+		if exitCode.Valid {
+			code := int(exitCode.Int64)
+			ev.ExitCode = &code
+		}
+		ev.Health = health.String
+		ev.Time, _ = time.Parse(time.RFC3339Nano, t)
+		events = append(events, ev)
+	}
+	slices.Reverse(events)
+	return events, rows.Err()
+}
+
+func (s *SQLiteStore) PruneEvents(ctx context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM events WHERE time < ?`, before.UTC().Format(eventTimeFormat)); err != nil {
+		return fmt.Errorf("prune events: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) AppendAudit(ctx context.Context, e AuditEntry) (AuditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	command, _ := json.Marshal(e.Command)
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO audit (time, actor, action, service, command, tty, remote_addr)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, e.Time.UTC().Format(eventTimeFormat), e.Actor, e.Action, e.Service, string(command), e.TTY, nullString(e.RemoteAddr))
+	if err != nil {
+		return AuditEntry{}, fmt.Errorf("insert audit entry: %w", err)
+	}
+	e.ID, err = res.LastInsertId()
+	return e, err
+}
+
+func (s *SQLiteStore) FinishAudit(ctx context.Context, e AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var exitCode sql.NullInt64
+	if e.ExitCode != nil {
+		exitCode = sql.NullInt64{Int64: int64(*e.ExitCode), Valid: true}
+	}
+	res, err := s.db.ExecContext(ctx, `UPDATE audit SET exit_code = ?, error = ?, duration_ms = ? WHERE id = ?`,
+		exitCode, nullString(e.Error), e.DurationMs, e.ID)
+	if err != nil {
+		return fmt.Errorf("update audit entry %d: %w", e.ID, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("audit entry %d not found", e.ID)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) ListAudit(ctx context.Context, f AuditFilter) ([]AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query := `SELECT id, time, actor, action, service, command, tty, remote_addr, exit_code, error, duration_ms FROM audit WHERE 1 = 1`
+	var args []any
+	if f.Service != "" {
+		query += ` AND service = ?`
+		args = append(args, f.Service)
+	}
+	if !f.Since.IsZero() {
+		query += ` AND time >= ?`
+		args = append(args, f.Since.UTC().Format(eventTimeFormat))
+	}
+	// The newest Limit entries are selected and then put back in order.
+	query += ` ORDER BY id DESC`
+	if f.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, f.Limit)
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query audit log: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		var t string
+		var command, remoteAddr, errMsg sql.NullString
+		var exitCode, duration sql.NullInt64
+		if err := rows.Scan(&e.ID, &t, &e.Actor, &e.Action, &e.Service, &command, &e.TTY, &remoteAddr, &exitCode, &errMsg, &duration); err != nil {
+			return nil, fmt.Errorf("scan audit entry: %w", err)
+		}
+		e.Time, _ = time.Parse(time.RFC3339Nano, t)
+		if command.Valid {
+			_ = json.Unmarshal([]byte(command.String), &e.Command)
+		}
+		e.RemoteAddr = remoteAddr.String
+		if exitCode.Valid {
+			code := int(exitCode.Int64)
+			e.ExitCode = &code
+		}
+		e.Error = errMsg.String
+		e.DurationMs = duration.Int64
+		entries = append(entries, e)
+	}
+	slices.Reverse(entries)
+	return entries, rows.Err()
+}
+
+func (s *SQLiteStore) AppendMetrics(ctx context.Context, samples []MetricSample) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.putMetrics(ctx, MetricTiers[0].Step, samples)
+}
+
+// putMetrics replaces samples of the same service and time; s.mu must be
+// held. Times are stored as Unix seconds, and steps in seconds.
+func (s *SQLiteStore) putMetrics(ctx context.Context, step time.Duration, samples []MetricSample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	for _, m := range samples {
+		_, err := tx.ExecContext(ctx, `
+			INSERT OR REPLACE INTO metrics (service, step, time, cpu_percent, memory_bytes, memory_limit_bytes,
+				network_rx_rate, network_tx_rate, block_read_rate, block_write_rate, containers)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, m.Service, int64(step.Seconds()), m.Time.Unix(), m.CPUPercent, int64(m.MemoryBytes), int64(m.MemoryLimitBytes),
+			m.NetworkRxRate, m.NetworkTxRate, m.BlockReadRate, m.BlockWriteRate, m.Containers)
+		if err != nil {
+			return fmt.Errorf("insert metrics of %s: %w", m.Service, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) QueryMetrics(ctx context.Context, service string, step time.Duration, since time.Time) ([]MetricSample, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.queryMetrics(ctx, `service = ? AND step = ? AND time >= ?`, service, int64(step.Seconds()), since.Unix())
+}
+
+// queryMetrics returns the samples matching where, oldest first; s.mu must
+// be held.
+func (s *SQLiteStore) queryMetrics(ctx context.Context, where string, args ...any) ([]MetricSample, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT service, time, cpu_percent, memory_bytes, memory_limit_bytes,
+		       network_rx_rate, network_tx_rate, block_read_rate, block_write_rate, containers
+		FROM metrics WHERE `+where+` ORDER BY time, service`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query metrics: %w", err)
+	}
+	defer rows.Close()
+
+	var samples []MetricSample
+	for rows.Next() {
+		var m MetricSample
+		var t, mem, limit int64
+		if err := rows.Scan(&m.Service, &t, &m.CPUPercent, &mem, &limit,
+			&m.NetworkRxRate, &m.NetworkTxRate, &m.BlockReadRate, &m.BlockWriteRate, &m.Containers); err != nil {
+			return nil, fmt.Errorf("scan metrics: %w", err)
+		}
+		m.Time = time.Unix(t, 0).UTC()
+		m.MemoryBytes = uint64(mem)
+		m.MemoryLimitBytes = uint64(limit)
+		samples = append(samples, m)
+	}
+	return samples, rows.Err()
+}
+
+func (s *SQLiteStore) CompactMetrics(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := 1; i < len(MetricTiers); i++ {
+		recent, err := s.queryMetrics(ctx, `step = ? AND time >= ?`, int64(MetricTiers[i-1].Step.Seconds()), compactWindow(i, now).Unix())
+		if err != nil {
+			return err
+		}
+		if err := s.putMetrics(ctx, MetricTiers[i].Step, downsample(recent, MetricTiers[i].Step)); err != nil {
+			return err
+		}
+	}
+	for _, tier := range MetricTiers {
+		if _, err := s.db.ExecContext(ctx, `DELETE FROM metrics WHERE step = ? AND time < ?`,
+			int64(tier.Step.Seconds()), now.Add(-tier.Retention).Unix()); err != nil {
+			return fmt.Errorf("prune metrics: %w", err)
+		}
+	}
+	return nil
+}
+
 func nullString(s string) sql.NullString {
 	if s == "" {
 		return sql.NullString{}
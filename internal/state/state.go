@@ -3,6 +3,7 @@ package state
 import (
 	"context"
 	"errors"
+	"slices"
 	"sync"
 	"time"
 )
@@ -37,20 +38,72 @@ type RemoteSettings struct {
 	BrowserAuth BrowserAuthSettings `json:"browser_auth,omitempty"`
 }
 
+// NotificationSettings configures where the daemon reports automated events
+// such as image updates.
+type NotificationSettings struct {
+	WebhookURL string `json:"webhook_url,omitempty"` // receives a JSON POST per event
+}
+
+// FreezeWindow is a period during which webhook and automatic deploys are
+// refused. It either recurs, starting whenever Cron fires and lasting
+// DurationMinutes, or covers the fixed range from Start to End.
+type FreezeWindow struct {
+	Name            string     `json:"name"`
+	Cron            string     `json:"cron,omitempty"` // five-field cron in the daemon's local time
+	DurationMinutes int        `json:"duration_minutes,omitempty"`
+	Start           *time.Time `json:"start,omitempty"`
+	End             *time.Time `json:"end,omitempty"`
+	Reason          string     `json:"reason,omitempty"`
+}
+
 type GlobalSettings struct {
-	ComposeProjectName string         `json:"compose_project_name"`
-	DefaultDomain      string         `json:"default_domain,omitempty"`
-	Tunnel             TunnelSettings `json:"tunnel"`
-	UILocalPort        int            `json:"ui_local_port"`
-	MaxBackups         int            `json:"max_backups,omitempty"` // default 10
-	Remote             RemoteSettings `json:"remote,omitempty"`
-	CloudflareAPIToken string         `json:"cloudflare_api_token,omitempty"`
+	ComposeProjectName string               `json:"compose_project_name"`
+	DefaultDomain      string               `json:"default_domain,omitempty"`
+	Tunnel             TunnelSettings       `json:"tunnel"`
+	UILocalPort        int                  `json:"ui_local_port"`
+	MaxBackups         int                  `json:"max_backups,omitempty"`       // default 10
+	MaxSiteVersions    int                  `json:"max_site_versions,omitempty"` // previous static site releases kept, default 5
+	Remote             RemoteSettings       `json:"remote,omitempty"`
+	CloudflareAPIToken string               `json:"cloudflare_api_token,omitempty"`
+	Notifications      NotificationSettings `json:"notifications,omitempty"`
+	FreezeWindows      []FreezeWindow       `json:"freeze_windows,omitempty"`
+	ContainerRuntime   string               `json:"container_runtime,omitempty"` // "docker" (default) or "podman"; read at daemon start
 }
 
 type ServiceResources struct {
-	MemoryLimitMB int `json:"memory_limit_mb"`
+	MemoryLimitMB       int     `json:"memory_limit_mb"`
+	MemoryReservationMB int     `json:"memory_reservation_mb,omitempty"`
+	CPULimit            float64 `json:"cpu_limit,omitempty"`       // in cores, e.g. 0.5
+	CPUReservation      float64 `json:"cpu_reservation,omitempty"` // in cores
+	PidsLimit           int     `json:"pids_limit,omitempty"`
+}
+
+type ServiceSecurity struct {
+	User            string   `json:"user,omitempty"` // uid[:gid] or name[:group]
+	ReadOnlyRootFS  bool     `json:"read_only_root_fs,omitempty"`
+	Tmpfs           []string `json:"tmpfs,omitempty"` // writable mounts when the root filesystem is read-only
+	CapDrop         []string `json:"cap_drop,omitempty"`
+	CapAdd          []string `json:"cap_add,omitempty"`
+	NoNewPrivileges *bool    `json:"no_new_privileges,omitempty"` // nil means enabled
+}
+
+// NoNewPrivilegesEnabled reports whether no-new-privileges applies; it is on unless explicitly disabled.
+func (s ServiceSecurity) NoNewPrivilegesEnabled() bool {
+	return s.NoNewPrivileges == nil || *s.NoNewPrivileges
+}
+
+type ServiceLogging struct {
+	MaxSizeMB int `json:"max_size_mb,omitempty"`
+	MaxFiles  int `json:"max_files,omitempty"`
 }
 
+const (
+	DefaultRestartPolicy = "unless-stopped"
+	DefaultLogMaxSizeMB  = 10
+	DefaultLogMaxFiles   = 3
+	DefaultMemoryLimitMB = 256
+)
+
 type ServiceHealthcheck struct {
 	Command            []string `json:"command,omitempty"`
 	IntervalSeconds    int      `json:"interval_seconds,omitempty"`
@@ -59,32 +112,177 @@ type ServiceHealthcheck struct {
 	StartPeriodSeconds int      `json:"start_period_seconds,omitempty"`
 }
 
+// ServiceSmokeCheck is an HTTP request the daemon sends through Traefik to each
+// of the service's hostnames after a deploy; a failure rolls the deploy back.
+type ServiceSmokeCheck struct {
+	Path           string `json:"path"`                      // request path, e.g. "/healthz"
+	ExpectStatus   int    `json:"expect_status,omitempty"`   // default 200
+	BodyContains   string `json:"body_contains,omitempty"`   // optional substring of the response body
+	TimeoutSeconds int    `json:"timeout_seconds,omitempty"` // how long to keep retrying, default 30
+}
+
+// ServiceHook is a command run as part of a deploy, e.g. a database migration.
+type ServiceHook struct {
+	Command        []string `json:"command"`
+	TimeoutSeconds int      `json:"timeout_seconds,omitempty"` // default 300
+}
+
+// ServiceHooks are the commands run around a deploy. PreDeploy runs in a
+// one-off container from the new image before it is started and aborts the
+// deploy on failure; PostDeploy runs inside the new container once it is
+// healthy, and a failure rolls the deploy back.
+type ServiceHooks struct {
+	PreDeploy  *ServiceHook `json:"pre_deploy,omitempty"`
+	PostDeploy *ServiceHook `json:"post_deploy,omitempty"`
+}
+
+// ServiceBuild describes how a git-build service image is produced.
+type ServiceBuild struct {
+	Source     string `json:"source"`               // local repository path or Git URL
+	Ref        string `json:"ref,omitempty"`        // branch, tag or commit; defaults to HEAD
+	Dockerfile string `json:"dockerfile,omitempty"` // relative to the repository root; defaults to Dockerfile
+	Commit     string `json:"commit,omitempty"`     // commit SHA of the last successful build
+}
+
+// ServiceJob describes when and how a job service runs.
+type ServiceJob struct {
+	Schedule       string `json:"schedule"`                  // cron expression or @hourly, @daily, ...
+	MaxConcurrency int    `json:"max_concurrency,omitempty"` // runs allowed at once, default 1
+	TimeoutSeconds int    `json:"timeout_seconds,omitempty"` // 0 means no limit
+	HistoryLimit   int    `json:"history_limit,omitempty"`   // runs kept, default 50
+}
+
+// ServicePreview marks a service as an ephemeral pull request preview of Parent.
+type ServicePreview struct {
+	Parent    string    `json:"parent"`
+	PR        int       `json:"pr"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ServiceUpdatePolicy opts a registry image into automatic updates.
+type ServiceUpdatePolicy struct {
+	Semver          string `json:"semver,omitempty"`           // version range such as "^1.4"; empty follows the current tag's digest
+	IntervalMinutes int    `json:"interval_minutes,omitempty"` // registry poll interval, default 60
+}
+
+// Crash-loop actions.
+const (
+	CrashActionAlert    = "alert"    // notify only
+	CrashActionStop     = "stop"     // stop the service's containers
+	CrashActionRollback = "rollback" // redeploy the previous image
+)
+
+const (
+	DefaultCrashMaxRestarts   = 5
+	DefaultCrashWindowMinutes = 10
+)
+
+// ServiceCrashPolicy says when a service counts as crash-looping and what
+// the daemon does about it. Services without one alert after the default
+// number of restarts.
+type ServiceCrashPolicy struct {
+	Action        string `json:"action,omitempty"`         // alert, stop or rollback; default alert
+	MaxRestarts   int    `json:"max_restarts,omitempty"`   // restarts within the window that make a loop, default 5
+	WindowMinutes int    `json:"window_minutes,omitempty"` // default 10
+}
+
+// ServiceWebhook lets GitHub, GitLab and Docker Hub webhooks deploy a
+// service. Each filter is a list of glob patterns; an empty list ignores that
+// kind of event.
+type ServiceWebhook struct {
+	Secret    string   `json:"secret"`               // HMAC key for GitHub, token for GitLab and Docker Hub
+	Branches  []string `json:"branches,omitempty"`   // git branches whose pushes redeploy
+	Tags      []string `json:"tags,omitempty"`       // git tags and releases, deployed as the image tag
+	ImageTags []string `json:"image_tags,omitempty"` // tags pushed to GHCR or Docker Hub
+}
+
+// ServiceMaintenance is set while a service's hostnames are rerouted to the
+// maintenance page.
+type ServiceMaintenance struct {
+	Message string    `json:"message,omitempty"`
+	Since   time.Time `json:"since"`
+}
+
+// ServiceErrorPages holds custom HTML shown instead of the app's own error
+// responses. An empty page keeps the app's response for that class.
+type ServiceErrorPages struct {
+	NotFound    string `json:"not_found,omitempty"`    // 404
+	ServerError string `json:"server_error,omitempty"` // 500-599
+}
+
+const (
+	DefaultJobMaxConcurrency = 1
+	DefaultJobHistoryLimit   = 50
+)
+
 type Service struct {
-	ID            string              `json:"id"`
-	Name          string              `json:"name"`
-	Type          string              `json:"type"`
-	Image         string              `json:"image"`
-	InternalPort  int                 `json:"internal_port"`
-	Hostnames     []string            `json:"hostnames,omitempty"`
-	Env           map[string]string   `json:"env,omitempty"`
-	Volumes       []string            `json:"volumes,omitempty"`
-	Command       []string            `json:"command,omitempty"`
-	Entrypoint    []string            `json:"entrypoint,omitempty"`
-	Healthcheck   *ServiceHealthcheck `json:"healthcheck,omitempty"`
-	Resources     ServiceResources    `json:"resources"`
-	Enabled       bool                `json:"enabled"`
-	LastDeploy    *time.Time          `json:"last_deploy,omitempty"`
-	Status        string              `json:"status,omitempty"`
-	UptimeSeconds int                 `json:"uptime_seconds,omitempty"`
-}
-
-const ServiceTypeRegistryImage = "registry-image"
+	ID              string               `json:"id"`
+	Name            string               `json:"name"`
+	Type            string               `json:"type"`
+	Image           string               `json:"image"`
+	InternalPort    int                  `json:"internal_port"`
+	Hostnames       []string             `json:"hostnames,omitempty"`
+	Env             map[string]string    `json:"env,omitempty"`
+	Volumes         []string             `json:"volumes,omitempty"`
+	Command         []string             `json:"command,omitempty"`
+	Entrypoint      []string             `json:"entrypoint,omitempty"`
+	Healthcheck     *ServiceHealthcheck  `json:"healthcheck,omitempty"`
+	SmokeChecks     []ServiceSmokeCheck  `json:"smoke_checks,omitempty"` // run after each deploy, before promote
+	Hooks           *ServiceHooks        `json:"hooks,omitempty"`        // pre- and post-deploy commands
+	Build           *ServiceBuild        `json:"build,omitempty"`        // only for git-build services
+	Job             *ServiceJob          `json:"job,omitempty"`          // only for job services
+	Preview         *ServicePreview      `json:"preview,omitempty"`      // set on pull request previews
+	Maintenance     *ServiceMaintenance  `json:"maintenance,omitempty"`  // set while in maintenance mode
+	ErrorPages      *ServiceErrorPages   `json:"error_pages,omitempty"`
+	UpdatePolicy    *ServiceUpdatePolicy `json:"update_policy,omitempty"` // automatic image updates
+	Webhook         *ServiceWebhook      `json:"webhook,omitempty"`       // provider webhook triggers
+	CrashPolicy     *ServiceCrashPolicy  `json:"crash_policy,omitempty"`  // what to do when it keeps restarting
+	Resources       ServiceResources     `json:"resources"`
+	Replicas        int                  `json:"replicas,omitempty"`             // 0 or 1 runs a single container
+	IdleTimeout     int                  `json:"idle_timeout_minutes,omitempty"` // stop after this many idle minutes; 0 keeps it running
+	RestartPolicy   string               `json:"restart_policy,omitempty"`
+	Security        ServiceSecurity      `json:"security"`
+	Logging         ServiceLogging       `json:"logging"`
+	Links           []string             `json:"links,omitempty"`                // services this one may reach over their private network
+	DependsOn       []string             `json:"depends_on,omitempty"`           // start order; also grants reachability
+	NoEgress        bool                 `json:"no_egress,omitempty"`            // private network is internal-only (no outbound traffic)
+	RequireApproval bool                 `json:"require_approval,omitempty"`     // webhook deploys wait for a human to approve them
+	ApprovalTTL     int                  `json:"approval_ttl_minutes,omitempty"` // pending deploys expire after this, default 1440
+	Enabled         bool                 `json:"enabled"`
+	Stopped         bool                 `json:"stopped,omitempty"` // stopped by hand; deploys and restarts of the daemon leave it down
+	LastDeploy      *time.Time           `json:"last_deploy,omitempty"`
+	DeployedImage   string               `json:"deployed_image,omitempty"` // image running since the last successful deploy, pinned to its digest when known
+	PreviousImage   string               `json:"previous_image,omitempty"` // deployed image before that, the crash-loop rollback target
+	Status          string               `json:"status,omitempty"`
+	UptimeSeconds   int                  `json:"uptime_seconds,omitempty"`
+}
+
+const (
+	ServiceTypeRegistryImage = "registry-image"
+	ServiceTypeGitBuild      = "git-build"
+	ServiceTypeStatic        = "static"
+	ServiceTypeJob           = "job"
+)
+
+// IsJob reports whether the service runs on a schedule instead of continuously.
+func (s Service) IsJob() bool {
+	return s.Type == ServiceTypeJob
+}
+
+// ReplicaCount returns the number of containers the service should run.
+func (s Service) ReplicaCount() int {
+	if s.Replicas < 1 {
+		return 1
+	}
+	return s.Replicas
+}
 
 type APIToken struct {
 	ID        string     `json:"id"`
 	Name      string     `json:"name"`
 	Hash      string     `json:"hash"`
 	Services  []string   `json:"services,omitempty"` // If empty, token can deploy any service
+	Admin     bool       `json:"admin,omitempty"`    // may exec and run commands in service containers
 	CreatedAt time.Time  `json:"created_at"`
 	LastUsed  *time.Time `json:"last_used,omitempty"`
 }
@@ -132,16 +330,24 @@ type Store interface {
 type InMemoryStore struct {
 	mu    sync.RWMutex
 	state State
+	memoryEvents
+	memoryMetrics
+	memoryAudit
 }
 
 func NewInMemoryStore(s State) *InMemoryStore {
 	return &InMemoryStore{state: s}
 }
 
+// Load returns a copy whose service and token lists can be edited without
+// touching the stored state until Save, as with the SQLite store.
 func (m *InMemoryStore) Load(ctx context.Context) (State, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	return m.state, nil
+	st := m.state
+	st.Services = slices.Clone(m.state.Services)
+	st.Tokens = slices.Clone(m.state.Tokens)
+	return st, nil
 }
 
 func (m *InMemoryStore) Save(ctx context.Context, s State) error {
@@ -263,6 +263,7 @@ func TestSQLiteStore(t *testing.T) {
 	s.Settings.DefaultDomain = "test.example.com"
 	s.Settings.Tunnel.Mode = TunnelModeCredentialsFile
 	s.Settings.Tunnel.TunnelID = "abc123"
+	s.Settings.MaxSiteVersions = 7
 	s.Services = append(s.Services, Service{
 		ID:           "test-123",
 		Name:         "test",
@@ -280,7 +281,34 @@ func TestSQLiteStore(t *testing.T) {
 			IntervalSeconds: 30,
 			Retries:         3,
 		},
-		Resources: ServiceResources{MemoryLimitMB: 512},
+		Resources:       ServiceResources{MemoryLimitMB: 512, CPULimit: 1.5, PidsLimit: 100},
+		Replicas:        3,
+		IdleTimeout:     15,
+		Maintenance:     &ServiceMaintenance{Message: "Upgrading the database", Since: time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)},
+		ErrorPages:      &ServiceErrorPages{NotFound: "<h1>Not here</h1>"},
+		UpdatePolicy:    &ServiceUpdatePolicy{Semver: "^1.4", IntervalMinutes: 30},
+		Webhook:         &ServiceWebhook{Secret: "s3cret", Branches: []string{"main"}, ImageTags: []string{"v*"}},
+		CrashPolicy:     &ServiceCrashPolicy{Action: CrashActionRollback, MaxRestarts: 3, WindowMinutes: 5},
+		DeployedImage:   "nginx:1.25@sha256:abc",
+		PreviousImage:   "nginx:1.24@sha256:def",
+		SmokeChecks:     []ServiceSmokeCheck{{Path: "/healthz", ExpectStatus: 204, BodyContains: "ok"}},
+		RequireApproval: true,
+		ApprovalTTL:     90,
+		Stopped:         true,
+		Hooks:           &ServiceHooks{PreDeploy: &ServiceHook{Command: []string{"./manage.py", "migrate"}, TimeoutSeconds: 600}},
+		Job:             &ServiceJob{Schedule: "0 3 * * *", MaxConcurrency: 2},
+		Preview:         &ServicePreview{Parent: "api", PR: 42, ExpiresAt: time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)},
+		Build:           &ServiceBuild{Source: "https://github.com/example/app.git", Ref: "main", Commit: "abc123"},
+		RestartPolicy:   "always",
+		Security: ServiceSecurity{
+			User:           "1000:1000",
+			ReadOnlyRootFS: true,
+			CapDrop:        []string{"ALL"},
+		},
+		Logging:   ServiceLogging{MaxSizeMB: 20, MaxFiles: 2},
+		Links:     []string{"api"},
+		DependsOn: []string{"db"},
+		NoEgress:  true,
 	})
 
 	if err := store.Save(ctx, s); err != nil {
@@ -301,6 +329,9 @@ func TestSQLiteStore(t *testing.T) {
 	if reloaded.Settings.Tunnel.TunnelID != "abc123" {
 		t.Error("Load() did not restore Tunnel.TunnelID")
 	}
+	if reloaded.Settings.MaxSiteVersions != 7 {
+		t.Error("Load() did not restore MaxSiteVersions")
+	}
 	if len(reloaded.Services) != 1 {
 		t.Fatalf("Load() restored %d services, want 1", len(reloaded.Services))
 	}
@@ -330,6 +361,75 @@ func TestSQLiteStore(t *testing.T) {
 	if svc.Resources.MemoryLimitMB != 512 {
 		t.Error("Load() did not restore resources")
 	}
+	if svc.Resources.CPULimit != 1.5 || svc.Resources.PidsLimit != 100 {
+		t.Errorf("Load() did not restore cpu/pids limits: %+v", svc.Resources)
+	}
+	if svc.Job == nil || svc.Job.Schedule != "0 3 * * *" || svc.Job.MaxConcurrency != 2 {
+		t.Errorf("Load() did not restore job spec: %+v", svc.Job)
+	}
+	if svc.Preview == nil || svc.Preview.Parent != "api" || svc.Preview.PR != 42 || !svc.Preview.ExpiresAt.Equal(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("Load() did not restore preview: %+v", svc.Preview)
+	}
+	if svc.Build == nil || svc.Build.Ref != "main" || svc.Build.Commit != "abc123" {
+		t.Errorf("Load() did not restore build spec: %+v", svc.Build)
+	}
+	if svc.Replicas != 3 {
+		t.Errorf("Load() did not restore replicas: %d", svc.Replicas)
+	}
+	if svc.IdleTimeout != 15 {
+		t.Errorf("Load() did not restore idle timeout: %d", svc.IdleTimeout)
+	}
+	if svc.Maintenance == nil || svc.Maintenance.Message != "Upgrading the database" || svc.Maintenance.Since.IsZero() {
+		t.Errorf("Load() did not restore maintenance: %+v", svc.Maintenance)
+	}
+	if svc.ErrorPages == nil || svc.ErrorPages.NotFound != "<h1>Not here</h1>" || svc.ErrorPages.ServerError != "" {
+		t.Errorf("Load() did not restore error pages: %+v", svc.ErrorPages)
+	}
+	if svc.UpdatePolicy == nil || svc.UpdatePolicy.Semver != "^1.4" || svc.UpdatePolicy.IntervalMinutes != 30 {
+		t.Errorf("Load() did not restore update policy: %+v", svc.UpdatePolicy)
+	}
+	if svc.Webhook == nil || svc.Webhook.Secret != "s3cret" || len(svc.Webhook.Branches) != 1 || svc.Webhook.ImageTags[0] != "v*" {
+		t.Errorf("Load() did not restore webhook: %+v", svc.Webhook)
+	}
+	if len(svc.SmokeChecks) != 1 || svc.SmokeChecks[0].Path != "/healthz" || svc.SmokeChecks[0].ExpectStatus != 204 {
+		t.Errorf("Load() did not restore smoke checks: %+v", svc.SmokeChecks)
+	}
+	if svc.Hooks == nil || svc.Hooks.PreDeploy == nil || len(svc.Hooks.PreDeploy.Command) != 2 || svc.Hooks.PreDeploy.TimeoutSeconds != 600 || svc.Hooks.PostDeploy != nil {
+		t.Errorf("Load() did not restore hooks: %+v", svc.Hooks)
+	}
+	if !svc.RequireApproval || svc.ApprovalTTL != 90 {
+		t.Errorf("Load() RequireApproval = %v, ApprovalTTL = %d", svc.RequireApproval, svc.ApprovalTTL)
+	}
+	if !svc.Stopped {
+		t.Error("Load() lost Stopped")
+	}
+	if svc.DeployedImage != "nginx:1.25@sha256:abc" {
+		t.Errorf("Load() DeployedImage = %q", svc.DeployedImage)
+	}
+	if svc.PreviousImage != "nginx:1.24@sha256:def" {
+		t.Errorf("Load() PreviousImage = %q", svc.PreviousImage)
+	}
+	if svc.CrashPolicy == nil || *svc.CrashPolicy != (ServiceCrashPolicy{Action: CrashActionRollback, MaxRestarts: 3, WindowMinutes: 5}) {
+		t.Errorf("Load() did not restore crash policy: %+v", svc.CrashPolicy)
+	}
+	if svc.RestartPolicy != "always" {
+		t.Errorf("Load() did not restore restart policy: %q", svc.RestartPolicy)
+	}
+	if svc.Security.User != "1000:1000" || !svc.Security.ReadOnlyRootFS || len(svc.Security.CapDrop) != 1 {
+		t.Errorf("Load() did not restore security: %+v", svc.Security)
+	}
+	if svc.Logging.MaxSizeMB != 20 || svc.Logging.MaxFiles != 2 {
+		t.Errorf("Load() did not restore logging: %+v", svc.Logging)
+	}
+	if len(svc.Links) != 1 || svc.Links[0] != "api" {
+		t.Errorf("Load() did not restore links: %v", svc.Links)
+	}
+	if len(svc.DependsOn) != 1 || svc.DependsOn[0] != "db" {
+		t.Errorf("Load() did not restore depends_on: %v", svc.DependsOn)
+	}
+	if !svc.NoEgress {
+		t.Error("Load() did not restore no_egress")
+	}
 }
 
 func TestSQLiteStoreServiceDeletion(t *testing.T) {
@@ -468,6 +568,14 @@ func TestSQLiteStoreCloudflareAndRemote(t *testing.T) {
 
 	// Set Cloudflare API token and remote settings
 	s.Settings.CloudflareAPIToken = "test-cf-token-123"
+	s.Settings.Notifications.WebhookURL = "https://hooks.example.com/tinyserve"
+	holidayStart := time.Date(2026, 12, 20, 0, 0, 0, 0, time.UTC)
+	holidayEnd := time.Date(2027, 1, 3, 0, 0, 0, 0, time.UTC)
+	s.Settings.FreezeWindows = []FreezeWindow{
+		{Name: "weekend", Cron: "0 17 * * fri", DurationMinutes: 3840},
+		{Name: "holidays", Start: &holidayStart, End: &holidayEnd, Reason: "skeleton crew"},
+	}
+	s.Settings.ContainerRuntime = "podman"
 	s.Settings.Remote.Enabled = true
 	s.Settings.Remote.Hostname = "admin.example.com"
 	s.Settings.Remote.BrowserAuth = BrowserAuthSettings{
@@ -489,6 +597,21 @@ func TestSQLiteStoreCloudflareAndRemote(t *testing.T) {
 	if reloaded.Settings.CloudflareAPIToken != "test-cf-token-123" {
 		t.Errorf("CloudflareAPIToken = %q, want %q", reloaded.Settings.CloudflareAPIToken, "test-cf-token-123")
 	}
+	if reloaded.Settings.Notifications.WebhookURL != "https://hooks.example.com/tinyserve" {
+		t.Errorf("Notifications.WebhookURL = %q", reloaded.Settings.Notifications.WebhookURL)
+	}
+	if len(reloaded.Settings.FreezeWindows) != 2 {
+		t.Fatalf("FreezeWindows = %+v, want 2 windows", reloaded.Settings.FreezeWindows)
+	}
+	if w := reloaded.Settings.FreezeWindows[0]; w.Cron != "0 17 * * fri" || w.DurationMinutes != 3840 {
+		t.Errorf("FreezeWindows[0] = %+v", w)
+	}
+	if w := reloaded.Settings.FreezeWindows[1]; w.Start == nil || !w.Start.Equal(holidayStart) || w.End == nil || !w.End.Equal(holidayEnd) || w.Reason != "skeleton crew" {
+		t.Errorf("FreezeWindows[1] = %+v", w)
+	}
+	if reloaded.Settings.ContainerRuntime != "podman" {
+		t.Errorf("ContainerRuntime = %q, want podman", reloaded.Settings.ContainerRuntime)
+	}
 	if !reloaded.Settings.Remote.Enabled {
 		t.Error("Remote.Enabled = false, want true")
 	}
@@ -568,6 +691,7 @@ func TestSQLiteStoreTokens(t *testing.T) {
 		ID:        "tok-456",
 		Name:      "second-token",
 		Hash:      "hash456",
+		Admin:     true,
 		CreatedAt: now,
 	})
 
@@ -592,6 +716,12 @@ func TestSQLiteStoreTokens(t *testing.T) {
 			if tok.LastUsed == nil {
 				t.Error("expected LastUsed to be set")
 			}
+			if tok.Admin {
+				t.Error("first token should not be an admin token")
+			}
+		}
+		if tok.ID == "tok-456" && !tok.Admin {
+			t.Error("expected the second token to stay an admin token")
 		}
 	}
 	if !found {
@@ -616,3 +746,208 @@ func TestSQLiteStoreTokens(t *testing.T) {
 		t.Errorf("wrong token remaining: %s", reloaded3.Tokens[0].ID)
 	}
 }
+
+func TestEventLog(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "tinyserve-sqlite-test-*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	sqlite, err := NewSQLiteStore(filepath.Join(tmpDir, "state.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() error = %v", err)
+	}
+	defer sqlite.Close()
+
+	for name, log := range map[string]EventLog{"sqlite": sqlite, "memory": NewInMemoryStore(NewState())} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			base := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+			exit := 137
+			for i, ev := range []ServiceEvent{
+				{Service: "web", Container: "apps-web-1", Action: EventDie, ExitCode: &exit},
+				{Service: "api", Container: "apps-api-1", Action: EventHealthStatus, Health: "unhealthy"},
+				{Service: "web", Container: "apps-web-1", Action: EventOOM},
+				{Service: "web", Container: "apps-web-1", Action: EventRestart},
+			} {
+				ev.Time = base.Add(time.Duration(i) * time.Hour)
+				got, err := log.AppendEvent(ctx, ev)
+				if err != nil {
+					t.Fatalf("AppendEvent: %v", err)
+				}
+				if got.ID != int64(i+1) {
+					t.Fatalf("event %d got ID %d", i, got.ID)
+				}
+			}
+
+			web, err := log.ListEvents(ctx, EventFilter{Service: "web"})
+			if err != nil || len(web) != 3 || web[0].Action != EventDie || web[2].Action != EventRestart {
+				t.Fatalf("ListEvents(web) = %+v, %v; want 3 events oldest first", web, err)
+			}
+			if web[0].ExitCode == nil || *web[0].ExitCode != 137 || !web[0].Time.Equal(base) {
+				t.Errorf("die event = %+v", web[0])
+			}
+			last, _ := log.ListEvents(ctx, EventFilter{Limit: 2})
+			if len(last) != 2 || last[0].ID != 3 || last[1].ID != 4 {
+				t.Errorf("ListEvents(limit 2) = %+v, want the newest two in order", last)
+			}
+			after, _ := log.ListEvents(ctx, EventFilter{AfterID: 2, Since: base.Add(3 * time.Hour)})
+			if len(after) != 1 || after[0].ID != 4 {
+				t.Errorf("ListEvents(after 2, since +3h) = %+v", after)
+			}
+
+			if err := log.PruneEvents(ctx, base.Add(2*time.Hour)); err != nil {
+				t.Fatalf("PruneEvents: %v", err)
+			}
+			all, _ := log.ListEvents(ctx, EventFilter{})
+			if len(all) != 2 || all[0].ID != 3 {
+				t.Errorf("after prune = %+v", all)
+			}
+			next, _ := log.AppendEvent(ctx, ServiceEvent{Service: "web", Action: EventDie, Time: base})
+			if next.ID != 5 {
+				t.Errorf("ID after prune = %d, want IDs never reused", next.ID)
+			}
+		})
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "tinyserve-sqlite-test-*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	sqlite, err := NewSQLiteStore(filepath.Join(tmpDir, "state.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() error = %v", err)
+	}
+	defer sqlite.Close()
+
+	for name, log := range map[string]AuditLog{"sqlite": sqlite, "memory": NewInMemoryStore(NewState())} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			base := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+			exec, err := log.AppendAudit(ctx, AuditEntry{
+				Time: base, Actor: "ops", Action: AuditExec, Service: "web",
+				Command: []string{"sh", "-c", "ls /data"}, TTY: true, RemoteAddr: "10.0.0.1:5000",
+			})
+			if err != nil || exec.ID != 1 {
+				t.Fatalf("AppendAudit = %+v, %v", exec, err)
+			}
+			run, _ := log.AppendAudit(ctx, AuditEntry{Time: base.Add(time.Hour), Actor: "ops", Action: AuditRun, Service: "api", Command: []string{"migrate"}})
+
+			code := 2
+			exec.ExitCode = &code
+			exec.DurationMs = 1500
+			if err := log.FinishAudit(ctx, exec); err != nil {
+				t.Fatalf("FinishAudit: %v", err)
+			}
+			if err := log.FinishAudit(ctx, AuditEntry{ID: 99}); err == nil {
+				t.Error("FinishAudit of a missing entry should fail")
+			}
+
+			all, err := log.ListAudit(ctx, AuditFilter{})
+			if err != nil || len(all) != 2 || all[0].ID != exec.ID || all[1].ID != run.ID {
+				t.Fatalf("ListAudit = %+v, %v; want both entries oldest first", all, err)
+			}
+			got := all[0]
+			if got.ExitCode == nil || *got.ExitCode != 2 || got.DurationMs != 1500 || !got.TTY ||
+				len(got.Command) != 3 || got.Command[2] != "ls /data" || got.RemoteAddr != "10.0.0.1:5000" || !got.Time.Equal(base) {
+				t.Errorf("exec entry = %+v", got)
+			}
+			if all[1].ExitCode != nil {
+				t.Errorf("unfinished entry has exit code %d", *all[1].ExitCode)
+			}
+			if api, _ := log.ListAudit(ctx, AuditFilter{Service: "api"}); len(api) != 1 || api[0].Action != AuditRun {
+				t.Errorf("ListAudit(api) = %+v", api)
+			}
+			if last, _ := log.ListAudit(ctx, AuditFilter{Limit: 1}); len(last) != 1 || last[0].ID != run.ID {
+				t.Errorf("ListAudit(limit 1) = %+v", last)
+			}
+		})
+	}
+}
+
+func TestMetricsStore(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "tinyserve-sqlite-test-*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	sqlite, err := NewSQLiteStore(filepath.Join(tmpDir, "state.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() error = %v", err)
+	}
+	defer sqlite.Close()
+
+	raw, fine, coarse := MetricTiers[0].Step, MetricTiers[1].Step, MetricTiers[2].Step
+	for name, store := range map[string]MetricsStore{"sqlite": sqlite, "memory": NewInMemoryStore(NewState())} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			base := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+			// One api sample, and ten minutes of web at 10% CPU then 30%.
+			samples := []MetricSample{{Service: "api", Time: base, CPUPercent: 5, MemoryLimitBytes: 1 << 30, Containers: 1}}
+			for i := 0; i < 40; i++ {
+				cpu := 10.0
+				if i >= 20 {
+					cpu = 30
+				}
+				samples = append(samples, MetricSample{Service: "web", Time: base.Add(time.Duration(i) * raw), CPUPercent: cpu, MemoryBytes: 100 << 20, Containers: 2})
+			}
+			// Compaction only revisits recent buckets, so it runs after each
+			// batch as the sampler does.
+			for _, batch := range [][]MetricSample{samples[:21], samples[21:]} {
+				if err := store.AppendMetrics(ctx, batch); err != nil {
+					t.Fatalf("AppendMetrics: %v", err)
+				}
+				if err := store.CompactMetrics(ctx, batch[len(batch)-1].Time.Add(raw)); err != nil {
+					t.Fatalf("CompactMetrics: %v", err)
+				}
+			}
+
+			got, err := store.QueryMetrics(ctx, "web", raw, base.Add(9*time.Minute))
+			if err != nil || len(got) != 4 || !got[0].Time.Equal(base.Add(9*time.Minute)) {
+				t.Fatalf("raw web since +9m = %+v, %v", got, err)
+			}
+			got, _ = store.QueryMetrics(ctx, "web", fine, base)
+			if len(got) != 2 || got[0].CPUPercent != 10 || got[1].CPUPercent != 30 || got[0].MemoryBytes != 100<<20 || got[0].Containers != 2 {
+				t.Fatalf("5m web = %+v", got)
+			}
+			got, _ = store.QueryMetrics(ctx, "web", coarse, base)
+			if len(got) != 1 || got[0].CPUPercent != 20 || !got[0].Time.Equal(base) {
+				t.Errorf("1h web = %+v", got)
+			}
+			api, _ := store.QueryMetrics(ctx, "api", fine, base)
+			if len(api) != 1 || api[0].MemoryLimitBytes != 1<<30 || api[0].Service != "api" {
+				t.Errorf("5m api = %+v", api)
+			}
+
+			// Compacting again later prunes raw samples past their retention
+			// but keeps the coarser tiers.
+			if err := store.CompactMetrics(ctx, base.Add(MetricTiers[0].Retention+time.Hour)); err != nil {
+				t.Fatalf("CompactMetrics: %v", err)
+			}
+			if got, _ := store.QueryMetrics(ctx, "web", raw, base); len(got) != 0 {
+				t.Errorf("raw samples past retention = %d", len(got))
+			}
+			if got, _ := store.QueryMetrics(ctx, "web", fine, base); len(got) != 2 {
+				t.Errorf("5m samples after pruning raw = %+v", got)
+			}
+		})
+	}
+}
+
+func TestTierFor(t *testing.T) {
+	if got := TierFor(time.Hour); got.Step != MetricTiers[0].Step {
+		t.Errorf("TierFor(1h) = %v", got.Step)
+	}
+	if got := TierFor(24 * time.Hour); got.Step != 5*time.Minute {
+		t.Errorf("TierFor(24h) = %v", got.Step)
+	}
+	if got := TierFor(365 * 24 * time.Hour); got.Step != time.Hour {
+		t.Errorf("TierFor(1y) = %v", got.Step)
+	}
+}
@@ -11,6 +11,9 @@ import (
 // Examples: nginx, nginx:latest, ghcr.io/user/repo:v1.0
 var imageNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._/-]*(?::[a-zA-Z0-9._-]+)?(?:@sha256:[a-fA-F0-9]{64})?$`)
 
+// Docker image tag: up to 128 word characters, dots and dashes, not starting with . or -
+var imageTagRegex = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.-]{0,127}$`)
+
 // Environment variable key validation
 // Must start with letter or underscore, contain only alphanumeric and underscore
 var envKeyRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
@@ -24,6 +27,24 @@ var serviceNameRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]*$`)
 // Volume path validation - basic format check
 var volumePathRegex = regexp.MustCompile(`^[^:]+:[^:]+(?::(ro|rw))?$`)
 
+// Container user: uid[:gid] or name[:group]
+var containerUserRegex = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.-]*(?::[a-zA-Z0-9_][a-zA-Z0-9_.-]*)?$`)
+
+// Linux capability name, with or without the CAP_ prefix
+var capabilityRegex = regexp.MustCompile(`^(?:CAP_)?[A-Z][A-Z_]*$`)
+
+// tmpfs mount: absolute container path with optional comma-separated options
+var tmpfsRegex = regexp.MustCompile(`^/[a-zA-Z0-9._/-]*(?::[a-zA-Z0-9=,]+)?$`)
+
+// Restart policy: no, always, unless-stopped, on-failure[:max-retries]
+var restartPolicyRegex = regexp.MustCompile(`^(?:no|always|unless-stopped|on-failure(?::[1-9][0-9]{0,3})?)$`)
+
+// Git remote: URL with a known scheme or scp-style user@host:path
+var gitURLRegex = regexp.MustCompile(`^(?:(?:https?|ssh|git|file)://[^\s]+|[a-zA-Z0-9._-]+@[a-zA-Z0-9.-]+:[^\s]+)$`)
+
+// Git ref: branch, tag, or commit SHA (no whitespace or revision syntax)
+var gitRefRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._/-]*$`)
+
 // Dangerous host paths that should not be mounted
 var dangerousHostPaths = []string{
 	"/etc/passwd",
@@ -51,6 +72,17 @@ func ImageName(image string) error {
 	return nil
 }
 
+// ImageTag validates a Docker image tag (the part after the colon)
+func ImageTag(tag string) error {
+	if tag == "" {
+		return fmt.Errorf("image tag is required")
+	}
+	if !imageTagRegex.MatchString(tag) {
+		return fmt.Errorf("invalid image tag: %q", tag)
+	}
+	return nil
+}
+
 // EnvKey validates an environment variable key
 func EnvKey(key string) error {
 	if key == "" {
@@ -178,6 +210,116 @@ func Port(port int) error {
 	return nil
 }
 
+// RestartPolicy validates a compose restart policy. Empty means the default.
+func RestartPolicy(policy string) error {
+	if policy == "" {
+		return nil
+	}
+	if !restartPolicyRegex.MatchString(policy) {
+		return fmt.Errorf("invalid restart policy: %q (expected no, always, unless-stopped, or on-failure[:N])", policy)
+	}
+	return nil
+}
+
+// ContainerUser validates the user a container runs as
+func ContainerUser(user string) error {
+	if user == "" {
+		return nil
+	}
+	if len(user) > 128 {
+		return fmt.Errorf("user too long (max 128 characters)")
+	}
+	if !containerUserRegex.MatchString(user) {
+		return fmt.Errorf("invalid user: %q (expected uid[:gid] or name[:group])", user)
+	}
+	return nil
+}
+
+// Capability validates a Linux capability name for cap_add/cap_drop
+func Capability(capability string) error {
+	if capability == "ALL" {
+		return nil
+	}
+	if len(capability) > 64 || !capabilityRegex.MatchString(capability) {
+		return fmt.Errorf("invalid capability: %q (expected e.g. NET_BIND_SERVICE or ALL)", capability)
+	}
+	return nil
+}
+
+// TmpfsMount validates a tmpfs mount like /tmp or /run:size=64m,mode=1777
+func TmpfsMount(mount string) error {
+	if mount == "" {
+		return fmt.Errorf("tmpfs mount is required")
+	}
+	if len(mount) > 4096 {
+		return fmt.Errorf("tmpfs mount too long (max 4096 characters)")
+	}
+	if !tmpfsRegex.MatchString(mount) {
+		return fmt.Errorf("invalid tmpfs mount: %q (expected /path or /path:options)", mount)
+	}
+	return nil
+}
+
+// CPUs validates a CPU limit or reservation in cores. Zero means unset.
+func CPUs(field string, cpus float64) error {
+	if cpus < 0 || cpus > 256 {
+		return fmt.Errorf("%s must be between 0 and 256 cores, got %g", field, cpus)
+	}
+	return nil
+}
+
+// MemoryMB validates a memory limit or reservation in megabytes. Zero means unset.
+func MemoryMB(field string, mb int) error {
+	if mb < 0 || mb > 1<<20 {
+		return fmt.Errorf("%s must be between 0 and %d MB, got %d", field, 1<<20, mb)
+	}
+	if mb > 0 && mb < 6 {
+		return fmt.Errorf("%s must be at least 6 MB", field)
+	}
+	return nil
+}
+
+// PidsLimit validates a container process limit. Zero means unset.
+func PidsLimit(limit int) error {
+	if limit < 0 || limit > 1<<22 {
+		return fmt.Errorf("pids limit must be between 0 and %d, got %d", 1<<22, limit)
+	}
+	return nil
+}
+
+// MaxReplicas caps how many containers a single service may run.
+const MaxReplicas = 32
+
+// Replicas validates a service replica count. Zero means a single container.
+func Replicas(n int) error {
+	if n < 0 || n > MaxReplicas {
+		return fmt.Errorf("replicas must be between 1 and %d, got %d", MaxReplicas, n)
+	}
+	return nil
+}
+
+// MaxIdleTimeoutMinutes caps a scale-to-zero idle timeout at one week.
+const MaxIdleTimeoutMinutes = 7 * 24 * 60
+
+// IdleTimeout validates a scale-to-zero idle timeout in minutes. Zero disables it.
+func IdleTimeout(minutes int) error {
+	if minutes < 0 || minutes > MaxIdleTimeoutMinutes {
+		return fmt.Errorf("idle timeout must be between 0 and %d minutes, got %d", MaxIdleTimeoutMinutes, minutes)
+	}
+	return nil
+}
+
+// LogRotation validates json-file log rotation settings. Zero means the default.
+func LogRotation(maxSizeMB, maxFiles int) error {
+	if maxSizeMB < 0 || maxSizeMB > 1024 {
+		return fmt.Errorf("log max size must be between 0 and 1024 MB, got %d", maxSizeMB)
+	}
+	if maxFiles < 0 || maxFiles > 100 {
+		return fmt.Errorf("log max files must be between 0 and 100, got %d", maxFiles)
+	}
+	return nil
+}
+
 // containsYAMLInjection checks for characters that could be used for YAML injection
 func containsYAMLInjection(s string) bool {
 	// Check for newlines (could inject new YAML keys)
@@ -195,3 +337,50 @@ func containsYAMLInjection(s string) bool {
 	}
 	return false
 }
+
+// BuildSource validates a git-build source: an absolute local path or a Git URL.
+func BuildSource(source string) error {
+	if source == "" {
+		return fmt.Errorf("build source is required")
+	}
+	if len(source) > 1024 {
+		return fmt.Errorf("build source too long (max 1024 characters)")
+	}
+	if strings.HasPrefix(source, "/") {
+		if strings.ContainsAny(source, "\n\r") {
+			return fmt.Errorf("build source contains invalid characters")
+		}
+		return nil
+	}
+	if !gitURLRegex.MatchString(source) {
+		return fmt.Errorf("build source must be an absolute path or a Git URL: %q", source)
+	}
+	return nil
+}
+
+// GitRef validates a branch, tag or commit to build. Empty means HEAD.
+func GitRef(ref string) error {
+	if ref == "" {
+		return nil
+	}
+	if len(ref) > 256 || !gitRefRegex.MatchString(ref) || strings.Contains(ref, "..") {
+		return fmt.Errorf("invalid git ref: %q", ref)
+	}
+	return nil
+}
+
+// DockerfilePath validates a Dockerfile location relative to the repository root.
+func DockerfilePath(path string) error {
+	if path == "" {
+		return nil
+	}
+	if strings.HasPrefix(path, "/") || strings.ContainsAny(path, "\n\r\\") {
+		return fmt.Errorf("dockerfile must be a relative path: %q", path)
+	}
+	for _, part := range strings.Split(path, "/") {
+		if part == ".." {
+			return fmt.Errorf("dockerfile must stay inside the repository: %q", path)
+		}
+	}
+	return nil
+}
@@ -33,6 +33,30 @@ func TestImageName(t *testing.T) {
 	}
 }
 
+func TestImageTag(t *testing.T) {
+	tests := []struct {
+		tag     string
+		wantErr bool
+	}{
+		{"latest", false},
+		{"pr-42", false},
+		{"sha-0123abc", false},
+		{"v1.2.3_rc1", false},
+		{"", true},
+		{"-leading-dash", true},
+		{".hidden", true},
+		{"has/slash", true},
+		{"a:b", true},
+		{strings.Repeat("a", 129), true},
+	}
+
+	for _, tt := range tests {
+		if err := ImageTag(tt.tag); (err != nil) != tt.wantErr {
+			t.Errorf("ImageTag(%q) error = %v, wantErr %v", tt.tag, err, tt.wantErr)
+		}
+	}
+}
+
 func TestEnvKey(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -242,6 +266,185 @@ func TestCommandArgs(t *testing.T) {
 	}
 }
 
+func TestRestartPolicy(t *testing.T) {
+	tests := []struct {
+		policy  string
+		wantErr bool
+	}{
+		{"", false},
+		{"no", false},
+		{"always", false},
+		{"unless-stopped", false},
+		{"on-failure", false},
+		{"on-failure:5", false},
+		{"on-failure:0", true},
+		{"sometimes", true},
+		{"always\nprivileged: true", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			err := RestartPolicy(tt.policy)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RestartPolicy(%q) error = %v, wantErr %v", tt.policy, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestContainerUser(t *testing.T) {
+	tests := []struct {
+		user    string
+		wantErr bool
+	}{
+		{"", false},
+		{"1000", false},
+		{"1000:1000", false},
+		{"node", false},
+		{"www-data:www-data", false},
+		{"root:", true},
+		{"a b", true},
+		{"1000\nprivileged: true", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.user, func(t *testing.T) {
+			err := ContainerUser(tt.user)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ContainerUser(%q) error = %v, wantErr %v", tt.user, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCapability(t *testing.T) {
+	tests := []struct {
+		capability string
+		wantErr    bool
+	}{
+		{"ALL", false},
+		{"NET_BIND_SERVICE", false},
+		{"CAP_CHOWN", false},
+		{"net_admin", true},
+		{"", true},
+		{"SYS_ADMIN; rm", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.capability, func(t *testing.T) {
+			err := Capability(tt.capability)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Capability(%q) error = %v, wantErr %v", tt.capability, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTmpfsMount(t *testing.T) {
+	tests := []struct {
+		mount   string
+		wantErr bool
+	}{
+		{"/tmp", false},
+		{"/run:size=64m,mode=1777", false},
+		{"", true},
+		{"tmp", true},
+		{"/tmp:size=64m\nprivileged: true", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mount, func(t *testing.T) {
+			err := TmpfsMount(tt.mount)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("TmpfsMount(%q) error = %v, wantErr %v", tt.mount, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResourceLimits(t *testing.T) {
+	if err := CPUs("cpu limit", 0.5); err != nil {
+		t.Errorf("CPUs(0.5) error = %v", err)
+	}
+	if err := CPUs("cpu limit", -1); err == nil {
+		t.Error("CPUs(-1) should fail")
+	}
+	if err := MemoryMB("memory limit", 512); err != nil {
+		t.Errorf("MemoryMB(512) error = %v", err)
+	}
+	if err := MemoryMB("memory limit", 2); err == nil {
+		t.Error("MemoryMB(2) should fail")
+	}
+	if err := PidsLimit(256); err != nil {
+		t.Errorf("PidsLimit(256) error = %v", err)
+	}
+	if err := PidsLimit(-1); err == nil {
+		t.Error("PidsLimit(-1) should fail")
+	}
+	if err := Replicas(4); err != nil {
+		t.Errorf("Replicas(4) error = %v", err)
+	}
+	if err := Replicas(MaxReplicas + 1); err == nil {
+		t.Error("Replicas(MaxReplicas+1) should fail")
+	}
+	if err := IdleTimeout(30); err != nil {
+		t.Errorf("IdleTimeout(30) error = %v", err)
+	}
+	if err := IdleTimeout(-5); err == nil {
+		t.Error("IdleTimeout(-5) should fail")
+	}
+	if err := LogRotation(10, 3); err != nil {
+		t.Errorf("LogRotation(10, 3) error = %v", err)
+	}
+	if err := LogRotation(10, 1000); err == nil {
+		t.Error("LogRotation(10, 1000) should fail")
+	}
+}
+
+func TestBuildSource(t *testing.T) {
+	tests := []struct {
+		source  string
+		wantErr bool
+	}{
+		{"https://github.com/example/tool.git", false},
+		{"git@github.com:example/tool.git", false},
+		{"ssh://git@git.example.com/tool.git", false},
+		{"/srv/src/tool", false},
+		{"", true},
+		{"relative/path", true},
+		{"ftp://example.com/repo", true},
+		{"https://example.com/repo with space", true},
+	}
+	for _, tt := range tests {
+		if err := BuildSource(tt.source); (err != nil) != tt.wantErr {
+			t.Errorf("BuildSource(%q) error = %v, wantErr %v", tt.source, err, tt.wantErr)
+		}
+	}
+}
+
+func TestGitRefAndDockerfile(t *testing.T) {
+	for _, ref := range []string{"", "main", "v1.2.0", "feature/login", "0123abcd"} {
+		if err := GitRef(ref); err != nil {
+			t.Errorf("GitRef(%q) error = %v", ref, err)
+		}
+	}
+	for _, ref := range []string{"-bad", "main..dev", "a b", "HEAD~1"} {
+		if err := GitRef(ref); err == nil {
+			t.Errorf("GitRef(%q) should fail", ref)
+		}
+	}
+	for _, path := range []string{"", "Dockerfile", "docker/Dockerfile.prod"} {
+		if err := DockerfilePath(path); err != nil {
+			t.Errorf("DockerfilePath(%q) error = %v", path, err)
+		}
+	}
+	for _, path := range []string{"/etc/Dockerfile", "../Dockerfile", "a/../../Dockerfile"} {
+		if err := DockerfilePath(path); err == nil {
+			t.Errorf("DockerfilePath(%q) should fail", path)
+		}
+	}
+}
+
 func TestContainsYAMLInjection(t *testing.T) {
 	tests := []struct {
 		name string
@@ -0,0 +1,100 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEcho(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t" {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		conn, err := Accept(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			typ, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(typ, data); err != nil {
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	_, err := Dial(ctx, srv.URL, nil)
+	var hs *HandshakeError
+	if !errors.As(err, &hs) || hs.Status != http.StatusUnauthorized || hs.Message != "invalid token" {
+		t.Fatalf("dial without token = %v", err)
+	}
+
+	conn, err := Dial(ctx, "ws"+srv.URL[len("http"):], http.Header{"Authorization": {"Bearer t"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// Payload lengths that use each of the three length encodings.
+	for _, size := range []int{0, 5, 125, 126, 70000} {
+		msg := bytes.Repeat([]byte{'x'}, size)
+		if err := conn.WriteMessage(BinaryMessage, msg); err != nil {
+			t.Fatal(err)
+		}
+		typ, got, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ != BinaryMessage || !bytes.Equal(got, msg) {
+			t.Errorf("echo of %d bytes = type %d, %d bytes", size, typ, len(got))
+		}
+	}
+
+	// Pings are answered by the reader; the next message still arrives.
+	if err := conn.writeFrame(opPing, []byte("p")); err != nil {
+		t.Fatal(err)
+	}
+	conn.WriteMessage(TextMessage, []byte("after ping"))
+	if _, got, err := conn.ReadMessage(); err != nil || string(got) != "after ping" {
+		t.Errorf("after ping = %q, %v", got, err)
+	}
+
+	if err := conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteMessage(TextMessage, nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("write after close = %v", err)
+	}
+}
+
+func TestAcceptRejectsPlainRequests(t *testing.T) {
+	w := httptest.NewRecorder()
+	if _, err := Accept(w, httptest.NewRequest(http.MethodGet, "/", nil)); err == nil || w.Code != http.StatusBadRequest {
+		t.Errorf("plain GET = %d, %v", w.Code, err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Connection", "keep-alive, Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	r.Header.Set("Sec-WebSocket-Version", "8")
+	w = httptest.NewRecorder()
+	if _, err := Accept(w, r); err == nil || w.Code != http.StatusUpgradeRequired {
+		t.Errorf("old version = %d, %v", w.Code, err)
+	}
+}
+
+func TestAcceptKey(t *testing.T) {
+	// The example from RFC 6455, section 1.3.
+	if got := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("acceptKey = %q", got)
+	}
+}